@@ -0,0 +1,307 @@
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+func parseString(t *testing.T, s string) *parse.Tree {
+	tree, err := parse.Reader(strings.NewReader(s), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestTests(t *testing.T) {
+	tree := parseString(t, `(ns foo.bar-test
+  (:require [clojure.test :as t :refer [deftest testing is]]))
+
+(deftest simple
+  (is (= 1 1)))
+
+(t/deftest ^:integration nested
+  (let [x 1]
+    (testing "outer"
+      (testing "inner \"quoted\""
+        (is x))))
+  (testing (str "not" "literal")))
+
+(defn not-a-test [])
+`)
+	var got []string
+	var visit func(prefix string, blocks []*Testing)
+	visit = func(prefix string, blocks []*Testing) {
+		for _, b := range blocks {
+			got = append(got, prefix+b.Desc+"@"+b.Pos.String())
+			visit(prefix+"  ", b.Testing)
+		}
+	}
+	for _, test := range Tests(tree) {
+		got = append(got, test.Namespace+"/"+test.Name+"@"+test.Pos.String())
+		visit("  ", test.Testing)
+	}
+	want := []string{
+		"foo.bar-test/simple@temp:4:1",
+		"foo.bar-test/nested@temp:7:1",
+		"  outer@temp:9:5",
+		`    inner "quoted"@temp:10:7`,
+		"  @temp:12:3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTodos(t *testing.T) {
+	tree := parseString(t, `(ns foo) ; TODO: rename
+
+(defn f [x]
+  ;; FIXME(bob): off by one
+  (inc x)) ; TODOS are not todos
+
+(defmethod g :a [x]
+  #_foo ; HACK
+  x)
+`)
+	var got []string
+	for _, todo := range Todos(tree) {
+		got = append(got, todo.Pos.String()+" "+todo.Tag+" ["+todo.Context+"] "+todo.Text)
+	}
+	want := []string{
+		"temp:1:10 TODO [] rename",
+		"temp:4:3 FIXME [f] off by one",
+		"temp:8:9 HACK [g] ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFoldingRanges(t *testing.T) {
+	src := `(ns foo
+  (:require [clojure.string :as str]))
+
+;; Two lines
+;; of comments.
+(defn f [x]
+  (let [y (inc x)
+        z (dec x)]
+    #?(:clj
+       (+ y z)
+       :cljs (- y
+                z))))
+
+(def x 1) ; one
+; line
+`
+	tree := parseString(t, src)
+	var got []string
+	for _, r := range FoldingRanges(tree, []byte(src)) {
+		got = append(got, fmt.Sprintf("%d-%d %d", r.StartLine, r.EndLine, r.Kind))
+	}
+	want := []string{"1-2 2", "4-5 1", "6-12 0", "7-12 0", "9-10 0", "11-12 0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	trees := []*parse.Tree{
+		parseString(t, `(ns app.user (:require [app.schema :as s]))
+{:status 1 ::id 2 ::s/name 3 :user/email 4}
+(:status m)
+(get m :staus)
+(get m :statuses)
+[#:user{:email 5 :_/plain 6 :app.x/y {:z 7}} #::s{:name 8} #::{:id 9 #_#_:a 1}]
+`),
+		parseString(t, `(ns app.other)
+[:status ::id :x :y ::nope/z]
+`),
+	}
+	keywords := Keywords(trees)
+	var got []string
+	for _, k := range keywords {
+		got = append(got, fmt.Sprintf("%s %d", k, len(k.Uses)))
+	}
+	want := []string{
+		":a 1",
+		":plain 1",
+		":status 3",
+		":statuses 1",
+		":staus 1",
+		":x 1",
+		":y 1",
+		":z 1",
+		":app.other/id 1",
+		":app.schema/name 2",
+		":app.user/id 2",
+		":app.x/y 1",
+		":nope/z 1",
+		":user/email 2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if k := keywords[2]; k.Uses[0].String() != "temp:2:2" || k.Uses[2].String() != "temp:2:2" {
+		t.Errorf("wrong positions for :status: %v", k.Uses)
+	}
+
+	got = nil
+	for _, cluster := range KeywordTypos(keywords, 1) {
+		var names []string
+		for _, k := range cluster {
+			names = append(names, k.String())
+		}
+		got = append(got, strings.Join(names, " "))
+	}
+	want = []string{":status :staus"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got typos %q; want %q", got, want)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tree := parseString(t, `(ns app.ui (:require [app.i18n :as i]))
+
+(def title "Title")
+
+(defn ^:private greet
+  "Greets the user."
+  [name]
+  (str (i/tr "Hello, %s\n" name) "!" (tr "Bye" #"re")))
+
+(println (i/tr ["nested"]))
+`)
+	for _, tt := range []struct {
+		wrappers []string
+		want     []string
+	}{
+		{nil, []string{
+			`temp:3:12 "Title" [def] title`,
+			`temp:8:14 "Hello, %s\n" [i/tr] greet`,
+			`temp:8:34 "!" [str] greet`,
+			`temp:8:42 "Bye" [tr] greet`,
+			`temp:10:17 "nested" [i/tr] `,
+		}},
+		{[]string{"app.i18n/tr"}, []string{
+			`temp:8:14 "Hello, %s\n" [i/tr] greet`,
+		}},
+	} {
+		var got []string
+		for _, s := range Strings(tree, tt.wrappers...) {
+			got = append(got, fmt.Sprintf("%s %q [%s] %s", &s.Pos, s.Text, s.Function, s.Context))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("with wrappers %q: got\n%s\nwant\n%s", tt.wrappers, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestDestructure(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"x", []string{"x@temp:1:1"}},
+		{"[a ^String b & rest :as all]", []string{
+			"a@temp:1:2",
+			"b@temp:1:12 hinted",
+			"rest@temp:1:16",
+			"all@temp:1:25",
+		}},
+		{"{:keys [a ns/b :c] :strs [d] :syms [e] :or {a 1 d 2} :as m}", []string{
+			"m@temp:1:58 map",
+			"a@temp:1:9 map :a or=num(1)",
+			"b@temp:1:11 map :ns/b",
+			"c@temp:1:16 map :c",
+			"d@temp:1:27 map \"d\" or=num(2)",
+			"e@temp:1:37 map 'e",
+		}},
+		{"{:ns/keys [a] ::syms [b]}", []string{
+			"a@temp:1:12 map :ns/a",
+			"b@temp:1:23 map ':b",
+		}},
+		{"{[x y] :pt z :z :or {x 0 z 1}}", []string{
+			"x@temp:1:3",
+			"y@temp:1:5",
+			"z@temp:1:12 map or=num(1)",
+		}},
+	} {
+		tree := parseString(t, tt.pattern)
+		var got []string
+		for _, b := range Destructure(tree.Roots[0]) {
+			pos := b.Pos()
+			s := fmt.Sprintf("%s@%s", b.Name, &pos)
+			if b.Hinted {
+				s += " hinted"
+			}
+			if b.Map != nil {
+				s += " map"
+			}
+			if key := b.LookupKey(); key != "" {
+				s += " " + key
+			}
+			if b.Default != nil {
+				s += " or=" + b.Default.String()
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Destructure(%s): got\n%s\nwant\n%s", tt.pattern, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestWalkScopes(t *testing.T) {
+	tree := parseString(t, `(defn f [^String s {:keys [a] :or {a s}}]
+  (let [sb (StringBuilder.)
+        [x & xs] (g s)]
+    (for [y xs :let [z y]]
+      (try (h a sb x z) (catch Exception e e)))))`)
+	var got []string
+	for _, root := range tree.Roots {
+		WalkScopes(root, nil, func(n parse.Node, s *Scope) bool {
+			sym, ok := n.(*parse.SymbolNode)
+			if !ok {
+				return true
+			}
+			l := s.Lookup(sym.Val)
+			switch {
+			case s.Binds(sym):
+				got = append(got, fmt.Sprintf("%s@%d:%d binds (typed %t)", sym.Val, sym.Line, sym.Col, l.Typed))
+			case l != nil:
+				pos := l.Node.Position()
+				got = append(got, fmt.Sprintf("%s@%d:%d refers to %d:%d", sym.Val, sym.Line, sym.Col, pos.Line, pos.Col))
+			}
+			return true
+		})
+	}
+	want := []string{
+		"s@1:18 binds (typed true)",
+		"a@1:28 binds (typed false)",
+		"a@1:36 refers to 1:28",
+		"s@1:38 refers to 1:18",
+		"sb@2:9 binds (typed true)",
+		"s@3:21 refers to 1:18",
+		"x@3:10 binds (typed false)",
+		"xs@3:14 binds (typed false)",
+		"xs@4:13 refers to 3:14",
+		"y@4:11 binds (typed false)",
+		"y@4:24 refers to 4:11",
+		"z@4:22 binds (typed false)",
+		"a@5:15 refers to 1:28",
+		"sb@5:17 refers to 2:9",
+		"x@5:20 refers to 3:10",
+		"z@5:22 refers to 4:22",
+		"e@5:42 binds (typed true)",
+		"e@5:44 refers to 5:42",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
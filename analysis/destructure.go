@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Binding is a local bound by a binding pattern.
+type Binding struct {
+	// Name is the name of the local, without any namespace: a for both
+	// a and ns/a in {:keys [ns/a]}.
+	Name string
+	// Node names the local in the pattern. It is a symbol or, for a
+	// keyword in a :keys vector (as in {:keys [:a]}), a keyword.
+	Node parse.Node
+	// Hinted reports whether the local has a type hint in the pattern,
+	// as in [^String s].
+	Hinted bool
+	// Map is the map pattern which binds the local itself (by a key, by
+	// :as, or in a :keys, :strs, or :syms vector), if any.
+	Map *parse.MapNode
+	// Keys is the keyword (such as :keys or :ns/strs) before the vector
+	// of Map which binds the local, if any.
+	Keys *parse.KeywordNode
+	// Default is the expression given for the local by the :or map of
+	// Map, if any, and OrName is the symbol naming the local there.
+	Default parse.Node
+	OrName  *parse.SymbolNode
+}
+
+// Pos returns the position of the name of the local in the pattern.
+func (b *Binding) Pos() parse.Pos { return *b.Node.Position() }
+
+// LookupKey returns the key which the local is looked up by, as it would be
+// written in a map pattern, if it is bound by a :keys, :strs, or :syms
+// vector: :a for a in :keys, :ns/a for a in :ns/keys or ns/a in :keys, "a"
+// for a in :strs, and 'a for a in :syms. Otherwise, it returns "".
+func (b *Binding) LookupKey() string {
+	if b.Keys == nil {
+		return ""
+	}
+	if k, ok := b.Node.(*parse.KeywordNode); ok {
+		return k.Val
+	}
+	name := b.Node.(*parse.SymbolNode).Val
+	kw := b.Keys.Val
+	i := strings.LastIndexAny(kw, ":/")
+	prefix, kind := kw[:i+1], kw[i+1:]
+	switch kind {
+	case "strs":
+		return strconv.Quote(name)
+	case "syms":
+		if strings.Contains(name, "/") {
+			return "'" + name
+		}
+		return "'" + strings.TrimPrefix(prefix, ":") + name
+	}
+	if strings.Contains(name, "/") {
+		return ":" + name
+	}
+	return prefix + name
+}
+
+// Destructure returns the locals bound by a binding pattern, such as the
+// left-hand side of a let binding or a parameter of a fn: a symbol, or a
+// vector or map destructuring pattern, nested to any depth. For example,
+// [a & rest :as all] binds a, rest, and all, and {:keys [x] {y :y} :z}
+// binds x and y. The locals are returned in order of position, apart from
+// those of the :keys, :strs, and :syms vectors of a map pattern, which
+// follow the others of the map.
+func Destructure(pattern parse.Node) []*Binding {
+	var bindings []*Binding
+	destructure(pattern, false, &bindings)
+	return bindings
+}
+
+func destructure(pat parse.Node, hinted bool, bindings *[]*Binding) {
+	switch pat := pat.(type) {
+	case *parse.SymbolNode:
+		if pat.Val != "&" {
+			*bindings = append(*bindings, &Binding{Name: goclj.SymbolName(pat.Val), Node: pat, Hinted: hinted})
+		}
+	case *parse.VectorNode:
+		for _, it := range Items(pat.Nodes) {
+			destructure(it.Node, it.Hinted, bindings)
+		}
+	case *parse.MapNode:
+		start := len(*bindings)
+		var keys []*Binding
+		var defaults parse.Node
+		it := Items(pat.Nodes)
+		for i := 0; i+1 < len(it); i += 2 {
+			k, v := it[i], it[i+1]
+			kw, ok := k.Node.(*parse.KeywordNode)
+			if !ok {
+				destructure(k.Node, k.Hinted, bindings)
+				continue
+			}
+			switch {
+			case kw.Val == ":as":
+				destructure(v.Node, v.Hinted, bindings)
+			case kw.Val == ":or":
+				defaults = v.Node
+			case keysKeyword(kw.Val):
+				for _, name := range Items(v.Node.Children()) {
+					b := &Binding{Node: name.Node, Hinted: name.Hinted, Keys: kw}
+					switch n := name.Node.(type) {
+					case *parse.SymbolNode:
+						b.Name = goclj.SymbolName(n.Val)
+					case *parse.KeywordNode:
+						b.Name = goclj.SymbolName(strings.TrimLeft(n.Val, ":"))
+					default:
+						continue
+					}
+					keys = append(keys, b)
+				}
+			}
+		}
+		*bindings = append(*bindings, keys...)
+		// Only the locals bound by this map (rather than by the
+		// patterns nested in it) take its defaults.
+		own := make(map[string]*Binding)
+		for _, b := range (*bindings)[start:] {
+			if b.Map == nil && (b.Keys != nil || isDirectChild(pat, b.Node)) {
+				b.Map = pat
+				own[b.Name] = b
+			}
+		}
+		if defaults != nil {
+			d := Items(defaults.Children())
+			for i := 0; i+1 < len(d); i += 2 {
+				sym, ok := d[i].Node.(*parse.SymbolNode)
+				if !ok {
+					continue
+				}
+				if b, ok := own[sym.Val]; ok {
+					b.Default = d[i+1].Node
+					b.OrName = sym
+				}
+			}
+		}
+	}
+}
+
+// keysKeyword reports whether kw introduces a vector of locals to look up in
+// a map pattern: :keys, :strs, or :syms, possibly qualified, as in :ns/keys
+// or ::keys.
+func keysKeyword(kw string) bool {
+	i := strings.LastIndexAny(kw, ":/")
+	switch kw[i+1:] {
+	case "keys", "strs", "syms":
+		return true
+	}
+	return false
+}
+
+func isDirectChild(parent, n parse.Node) bool {
+	for _, child := range parent.Children() {
+		if child == n {
+			return true
+		}
+	}
+	return false
+}
+
+// An Item is a form among the children of a node, such as a binding
+// pattern or a parameter, along with whether it has a type hint.
+type Item struct {
+	Node   parse.Node
+	Hinted bool
+}
+
+// Items returns the forms among nodes (rather than comments, metadata,
+// discarded forms, and the like), noting which are preceded by a type hint.
+func Items(nodes []parse.Node) []Item {
+	var (
+		result []Item
+		hinted bool
+	)
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *parse.MetadataNode:
+			if TypeHint(n) {
+				hinted = true
+			}
+			continue
+		case *parse.NewlineNode, *parse.CommentNode, *parse.ReaderDiscardNode, *parse.TagNode:
+			continue
+		}
+		result = append(result, Item{Node: n, Hinted: hinted})
+		hinted = false
+	}
+	return result
+}
+
+// TypeHint reports whether the metadata m is a type hint, such as ^String,
+// ^"[B", or ^{:tag String}.
+func TypeHint(m *parse.MetadataNode) bool {
+	switch n := m.Node.(type) {
+	case *parse.SymbolNode, *parse.StringNode:
+		return true
+	case *parse.MapNode:
+		for _, it := range Items(n.Nodes) {
+			if kw, ok := it.Node.(*parse.KeywordNode); ok && kw.Val == ":tag" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package analysis
+
+import (
+	"sort"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A FoldKind is the kind of code covered by a FoldingRange.
+type FoldKind int
+
+const (
+	FoldForm    FoldKind = iota // a top-level form, let body, or reader conditional branch
+	FoldComment                 // a block of line comments
+	FoldImports                 // the ns form
+)
+
+// A FoldingRange is a range of lines which an editor may fold, leaving only
+// the first line visible. Lines are 1-based, like those of parse.Pos.
+type FoldingRange struct {
+	StartLine int
+	EndLine   int
+	Kind      FoldKind
+}
+
+// letForms are the forms whose bodies are folded as well as the top-level
+// forms: those which bind locals.
+var letForms = []string{
+	"let", "let*", "loop", "loop*", "letfn", "binding", "with-redefs",
+	"when-let", "if-let", "when-some", "if-some", "when-first", "with-open",
+	"dotimes", "doseq", "for",
+}
+
+// FoldingRanges finds the ranges of lines of t which may be folded: the
+// top-level forms, the forms which bind locals (such as let), the blocks of
+// two or more consecutive line comments, and the branches of reader
+// conditionals. Only ranges which span more than one line are included, in
+// order of their starting lines. The tree must have been parsed from src
+// with parse.IncludeNonSemantic.
+func FoldingRanges(t *parse.Tree, src []byte) []*FoldingRange {
+	var ranges []*FoldingRange
+	seen := make(map[[2]int]bool)
+	add := func(start, end int, kind FoldKind) {
+		if end <= start || seen[[2]int{start, end}] {
+			return
+		}
+		seen[[2]int{start, end}] = true
+		ranges = append(ranges, &FoldingRange{start, end, kind})
+	}
+	// endLine returns the line of the last character of n.
+	endLine := func(n parse.Node) int {
+		end := parse.End(n, src)
+		line := n.Position().Line
+		for i := n.Position().Offset; i < end-1; i++ {
+			if src[i] == '\n' {
+				line++
+			}
+		}
+		return line
+	}
+	var fold func(nodes []parse.Node, top bool)
+	fold = func(nodes []parse.Node, top bool) {
+		var comments []*parse.CommentNode // the current block of comments
+		endComments := func() {
+			if len(comments) > 1 {
+				add(comments[0].Line, comments[len(comments)-1].Line, FoldComment)
+			}
+			comments = nil
+		}
+		for i, n := range nodes {
+			switch n := n.(type) {
+			case *parse.NewlineNode:
+				continue
+			case *parse.CommentNode:
+				if !ownLine(n, src) {
+					break
+				}
+				if len(comments) > 0 && comments[len(comments)-1].Line+1 != n.Line {
+					endComments()
+				}
+				comments = append(comments, n)
+				continue
+			}
+			endComments()
+			switch {
+			case top && goclj.FnFormSymbol(n, "ns"):
+				add(n.Position().Line, endLine(n), FoldImports)
+			case top, goclj.FnFormSymbol(n, letForms...):
+				add(n.Position().Line, endLine(n), FoldForm)
+			}
+			if tag, ok := n.(*parse.TagNode); ok && (tag.Val == "?" || tag.Val == "?@") {
+				// The branches of #?(:clj ... :cljs ...) are the pairs
+				// of the list which follows the tag.
+				for _, next := range nodes[i+1:] {
+					if goclj.Newline(next) || goclj.Comment(next) {
+						continue
+					}
+					branches, _ := parse.SemanticChildren(next)
+					for j := 0; j+1 < len(branches); j += 2 {
+						add(branches[j].Position().Line, endLine(branches[j+1]), FoldForm)
+					}
+					break
+				}
+			}
+			fold(n.Children(), false)
+		}
+		endComments()
+	}
+	fold(t.Roots, true)
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].StartLine < ranges[j].StartLine })
+	return ranges
+}
+
+// ownLine reports whether c is the first thing on its line (rather than
+// following some code).
+func ownLine(c *parse.CommentNode, src []byte) bool {
+	for i := c.Offset - 1; i >= 0 && src[i] != '\n'; i-- {
+		if src[i] != ' ' && src[i] != '\t' && src[i] != ',' {
+			return false
+		}
+	}
+	return true
+}
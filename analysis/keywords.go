@@ -0,0 +1,234 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Keyword is a keyword used in a set of files, along with the places it
+// is used.
+type Keyword struct {
+	// Namespace is the namespace qualifying the keyword, if any. For an
+	// auto-resolved keyword such as ::id or ::s/id, it is the namespace of
+	// the file or the aliased namespace.
+	Namespace string
+	Name      string
+	Uses      []parse.Pos // in order of the files, then position
+}
+
+// String returns the keyword in its fully-qualified form, such as :user/id.
+func (k *Keyword) String() string {
+	if k.Namespace == "" {
+		return ":" + k.Name
+	}
+	return ":" + k.Namespace + "/" + k.Name
+}
+
+// Keywords finds the keywords used in trees, which are typically the files
+// of a project, sorted by namespace and then by name. Auto-resolved keywords
+// are resolved through the ns form of their file; those which can't be
+// resolved (because an alias is unknown) keep the alias as their namespace.
+// The keys of a namespaced map, such as #:user{:id 1} or #::s{:id 1}, are
+// qualified by its namespace (resolved in the same way). The keywords of ns
+// forms (such as :require) are left out.
+func Keywords(trees []*parse.Tree) []*Keyword {
+	byName := make(map[string]*Keyword)
+	for _, t := range trees {
+		r := goclj.NewResolver(t)
+		var ns string
+		record := func(k *Keyword, pos parse.Pos) {
+			if prev, ok := byName[k.String()]; ok {
+				k = prev
+			} else {
+				byName[k.String()] = k
+			}
+			k.Uses = append(k.Uses, pos)
+		}
+		var find func(n parse.Node)
+		find = func(n parse.Node) {
+			switch n := n.(type) {
+			case *parse.KeywordNode:
+				record(resolveKeyword(n.Val, ns, r), n.Pos)
+				return
+			case *parse.NamespacedMapNode:
+				// The keys without a namespace take the map's, and
+				// those in the namespace _ have none.
+				mapNS := resolveKeyword(n.Namespace+"/_", ns, r).Namespace
+				i := 0
+				for _, child := range n.Nodes {
+					if !goclj.Semantic(child) {
+						find(child) // metadata may have keywords
+						continue
+					}
+					if _, ok := child.(*parse.ReaderDiscardNode); ok {
+						find(child)
+						continue
+					}
+					if kw, ok := child.(*parse.KeywordNode); ok && i%2 == 0 {
+						k := resolveKeyword(kw.Val, ns, r)
+						switch {
+						case strings.HasPrefix(kw.Val, "::"):
+						case k.Namespace == "":
+							k.Namespace = mapNS
+						case k.Namespace == "_":
+							k.Namespace = ""
+						}
+						record(k, kw.Pos)
+					} else {
+						find(child)
+					}
+					i++
+				}
+				return
+			}
+			for _, child := range n.Children() {
+				find(child)
+			}
+		}
+		for _, root := range t.Roots {
+			if goclj.FnFormSymbol(root, "ns") {
+				if ns == "" {
+					ns = formName(root)
+				}
+				continue
+			}
+			find(root)
+		}
+	}
+	keywords := make([]*Keyword, 0, len(byName))
+	for _, k := range byName {
+		keywords = append(keywords, k)
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		ki, kj := keywords[i], keywords[j]
+		if ki.Namespace != kj.Namespace {
+			return ki.Namespace < kj.Namespace
+		}
+		return ki.Name < kj.Name
+	})
+	return keywords
+}
+
+// resolveKeyword returns the Keyword (without uses) written as text in the
+// namespace ns, resolving aliases with r.
+func resolveKeyword(text, ns string, r *goclj.Resolver) *Keyword {
+	k := &Keyword{}
+	name := strings.TrimPrefix(text, ":")
+	if strings.HasPrefix(name, ":") {
+		// Auto-resolved.
+		name = name[1:]
+		if i := strings.IndexByte(name, '/'); i > 0 && i < len(name)-1 {
+			qualified := r.Resolve(name)
+			i = strings.IndexByte(qualified, '/')
+			k.Namespace, k.Name = qualified[:i], qualified[i+1:]
+			return k
+		}
+		k.Namespace, k.Name = ns, name
+		return k
+	}
+	if i := strings.IndexByte(name, '/'); i > 0 && i < len(name)-1 {
+		k.Namespace, k.Name = name[:i], name[i+1:]
+		return k
+	}
+	k.Name = name
+	return k
+}
+
+// KeywordTypos finds the keywords among keywords which are likely typos of
+// one another: those with the same namespace whose names are within maxDist
+// edits (insertions, deletions, substitutions, or transpositions of
+// adjacent characters) of each other, such as :staus and :status. Names
+// shorter than four characters, which are often legitimately similar (:x
+// and :y), are ignored. Each cluster of similar keywords is sorted by
+// descending number of uses, so the likely intended spelling comes first;
+// the clusters are sorted by their first keyword.
+func KeywordTypos(keywords []*Keyword, maxDist int) [][]*Keyword {
+	// Union-find over the indexes of keywords.
+	parent := make([]int, len(keywords))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	for i, ki := range keywords {
+		if len(ki.Name) < 4 {
+			continue
+		}
+		for j := i + 1; j < len(keywords); j++ {
+			kj := keywords[j]
+			if len(kj.Name) < 4 || ki.Namespace != kj.Namespace {
+				continue
+			}
+			if editDistance(ki.Name, kj.Name) <= maxDist {
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+	groups := make(map[int][]*Keyword)
+	for i, k := range keywords {
+		groups[root(i)] = append(groups[root(i)], k)
+	}
+	var clusters [][]*Keyword
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			if len(group[i].Uses) != len(group[j].Uses) {
+				return len(group[i].Uses) > len(group[j].Uses)
+			}
+			return group[i].String() < group[j].String()
+		})
+		clusters = append(clusters, group)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i][0].String() < clusters[j][0].String()
+	})
+	return clusters
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b: the Levenshtein distance, also counting the transposition of two
+// adjacent characters as a single edit.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] is the distance between s[:i] and t[:j].
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(x int, ys ...int) int {
+	for _, y := range ys {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
@@ -0,0 +1,368 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Local is a name bound by a let, fn, or other binding form.
+type Local struct {
+	// Node binds the local. It is a symbol or, for a keyword in a :keys
+	// vector (as in {:keys [:a]}), a keyword.
+	Node parse.Node
+	// Typed is whether the compiler knows the local's type, because it
+	// is hinted (as in [^String s]) or is inferred from its init
+	// expression (as in [sb (StringBuilder.)]), the interface method it
+	// is a parameter of, or the exception class of a catch.
+	Typed bool
+}
+
+// A Scope holds the locals visible at some point in the code, by name. The
+// nil *Scope is the top-level scope, which has no locals.
+type Scope struct {
+	Parent *Scope
+	Locals map[string]*Local
+}
+
+// Lookup returns the local of the given name visible in s, or nil if there
+// is none.
+func (s *Scope) Lookup(name string) *Local {
+	for ; s != nil; s = s.Parent {
+		if l, ok := s.Locals[name]; ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// Binds reports whether n binds a local in s itself (not its parents).
+func (s *Scope) Binds(n parse.Node) bool {
+	if s == nil {
+		return false
+	}
+	for _, l := range s.Locals {
+		if l.Node == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) child() *Scope {
+	return &Scope{Parent: s, Locals: make(map[string]*Local)}
+}
+
+// WalkScopes calls visit for n and each of its descendants (each after its
+// parent) with the scope of the locals bound around it. If visit returns
+// false, the descendants of that node are skipped.
+//
+// The binding forms of clojure.core (let, loop, fn, defn, doseq, letfn,
+// and the like) are understood; the forms of other macros are treated as
+// function calls. The nodes of a binding pattern are visited in the scope of
+// the locals which it binds, so that s.Binds(n) reports whether a symbol n
+// binds a local, and the other symbols of the pattern (such as the names in
+// an :or map) refer to them.
+func WalkScopes(n parse.Node, s *Scope, visit func(n parse.Node, s *Scope) bool) {
+	w := &scopeWalker{visit: visit}
+	w.walk(n, s)
+}
+
+type scopeWalker struct {
+	visit func(n parse.Node, s *Scope) bool
+}
+
+func (w *scopeWalker) walk(n parse.Node, s *Scope) {
+	if !w.visit(n, s) {
+		return
+	}
+	nodes := n.Children()
+	if !goclj.FnFormSymbol(n) {
+		w.walkAll(nodes, s)
+		return
+	}
+	w.walk(nodes[0], s)
+	args := nodes[1:]
+	switch goclj.SymbolName(nodes[0].(*parse.SymbolNode).Val) {
+	case "let", "let*", "loop", "loop*", "when-let", "if-let", "when-some",
+		"if-some", "when-first", "with-open", "dotimes":
+		w.walkLet(args, s, false)
+	case "doseq", "for":
+		w.walkLet(args, s, true)
+	case "fn", "fn*":
+		if it := Items(args); len(it) > 0 && goclj.Symbol(it[0].Node) {
+			sym := it[0].Node.(*parse.SymbolNode)
+			i := indexOf(args, sym)
+			w.walkAll(args[:i], s)
+			s = s.child()
+			s.Locals[sym.Val] = &Local{Node: sym}
+			w.walk(sym, s)
+			args = args[i+1:]
+		}
+		w.walkFnTail(args, s, false)
+	case "defn", "defn-", "defmacro":
+		d, ok := goclj.ParseDefn(n)
+		if !ok {
+			w.walkAll(args, s)
+			return
+		}
+		start := d.Params
+		if start < 0 {
+			start = d.Arities[0]
+		}
+		w.walkAll(nodes[1:start], s)
+		w.walkFnTail(nodes[start:], s, false)
+	case "defmethod":
+		it := Items(args)
+		if len(it) < 3 {
+			w.walkAll(args, s)
+			return
+		}
+		i := indexOf(args, it[1].Node)
+		w.walkAll(args[:i+1], s)
+		w.walkFnTail(args[i+1:], s, false)
+	case "letfn":
+		it := Items(args)
+		if len(it) == 0 || !goclj.Vector(it[0].Node) {
+			w.walkAll(args, s)
+			return
+		}
+		inner := s.child()
+		specs := it[0].Node.Children()
+		for _, spec := range Items(specs) {
+			if goclj.FnFormSymbol(spec.Node) {
+				sym := spec.Node.Children()[0].(*parse.SymbolNode)
+				inner.Locals[sym.Val] = &Local{Node: sym}
+			}
+		}
+		i := indexOf(args, it[0].Node)
+		w.walkAll(args[:i], s)
+		if w.visit(it[0].Node, s) {
+			for _, spec := range specs {
+				if !goclj.FnFormSymbol(spec) {
+					w.walk(spec, s)
+					continue
+				}
+				if !w.visit(spec, inner) {
+					continue
+				}
+				fn := spec.Children()
+				w.walk(fn[0], inner)
+				w.walkFnTail(fn[1:], inner, false)
+			}
+		}
+		w.walkAll(args[i+1:], inner)
+	case "catch":
+		// (catch Exception e body...)
+		it := Items(args)
+		if len(it) < 2 || !goclj.Symbol(it[1].Node) {
+			w.walkAll(args, s)
+			return
+		}
+		inner := s.child()
+		sym := it[1].Node.(*parse.SymbolNode)
+		inner.Locals[sym.Val] = &Local{Node: sym, Typed: true}
+		i := indexOf(args, sym)
+		w.walkAll(args[:i], s)
+		w.walkAll(args[i:], inner)
+	case "deftype", "defrecord":
+		// (deftype Name [fields*] specs*)
+		it := Items(args)
+		if len(it) < 2 || !goclj.Vector(it[1].Node) {
+			w.walkAll(args, s)
+			return
+		}
+		inner := s.child()
+		bindParams(inner, it[1].Node, false)
+		i := indexOf(args, it[1].Node)
+		w.walkAll(args[:i], s)
+		w.walk(args[i], inner)
+		w.walkMethods(args[i+1:], inner)
+	case "reify", "proxy", "extend-type", "extend-protocol", "extend",
+		"definterface", "defprotocol":
+		w.walkMethods(args, s)
+	default:
+		w.walkAll(args, s)
+	}
+}
+
+func (w *scopeWalker) walkAll(nodes []parse.Node, s *Scope) {
+	for _, n := range nodes {
+		w.walk(n, s)
+	}
+}
+
+// walkLet walks the arguments of a let-like form: a binding vector followed
+// by a body. In a comprehension (doseq or for), the bindings may also include
+// :let, :when, and :while modifiers.
+func (w *scopeWalker) walkLet(args []parse.Node, s *Scope, comprehension bool) {
+	it := Items(args)
+	if len(it) == 0 || !goclj.Vector(it[0].Node) {
+		w.walkAll(args, s)
+		return
+	}
+	vec := it[0].Node
+	i := indexOf(args, vec)
+	w.walkAll(args[:i], s)
+	inner := w.walkBindings(vec, s, comprehension)
+	w.walkAll(args[i+1:], inner)
+}
+
+// walkBindings walks a binding vector, returning the scope of the locals it
+// binds.
+func (w *scopeWalker) walkBindings(vec parse.Node, s *Scope, comprehension bool) *Scope {
+	if !w.visit(vec, s) {
+		// Skip the nodes, but still find the locals.
+		w = &scopeWalker{visit: func(parse.Node, *Scope) bool { return false }}
+	}
+	nodes := vec.Children()
+	it := Items(nodes)
+	paired := make(map[parse.Node]bool)
+	for j := 0; j+1 < len(it); j += 2 {
+		paired[it[j].Node] = true
+		paired[it[j+1].Node] = true
+	}
+	// Comments, type hints, and the like are visited in the outer scope,
+	// each init in the scope of the bindings before it, and each pattern
+	// in the scope of the locals it binds.
+	for _, n := range nodes {
+		if !paired[n] {
+			w.walk(n, s)
+		}
+	}
+	cur := s
+	for j := 0; j+1 < len(it); j += 2 {
+		pat, init := it[j], it[j+1]
+		if kw, ok := pat.Node.(*parse.KeywordNode); ok && comprehension {
+			w.walk(kw, cur)
+			if kw.Val == ":let" && goclj.Vector(init.Node) {
+				cur = w.walkBindings(init.Node, cur, false)
+			} else {
+				w.walk(init.Node, cur)
+			}
+			continue
+		}
+		w.walk(init.Node, cur)
+		next := cur.child()
+		// In a comprehension, the local is bound to the elements of
+		// init, so its type can't be inferred.
+		typed := !comprehension && inferredType(init, cur)
+		bindPattern(next, pat.Node, pat.Hinted || typed)
+		w.walk(pat.Node, next)
+		cur = next
+	}
+	return cur
+}
+
+// walkFnTail walks the parameters and body of a function: either a
+// parameter vector followed by a body or a list of such for each arity.
+// If typed is true, the parameters are known to be typed (as those of
+// interface methods are).
+func (w *scopeWalker) walkFnTail(nodes []parse.Node, s *Scope, typed bool) {
+	if it := Items(nodes); len(it) > 0 && goclj.Vector(it[0].Node) {
+		w.walkArity(nodes, s, typed)
+		return
+	}
+	for _, n := range nodes {
+		if _, ok := n.(*parse.ListNode); !ok {
+			w.walk(n, s)
+			continue
+		}
+		if w.visit(n, s) {
+			w.walkArity(n.Children(), s, typed)
+		}
+	}
+}
+
+// walkArity walks a parameter vector and body.
+func (w *scopeWalker) walkArity(nodes []parse.Node, s *Scope, typed bool) {
+	it := Items(nodes)
+	if len(it) == 0 || !goclj.Vector(it[0].Node) {
+		w.walkAll(nodes, s)
+		return
+	}
+	inner := s.child()
+	bindParams(inner, it[0].Node, typed)
+	i := indexOf(nodes, it[0].Node)
+	w.walkAll(nodes[:i], s)
+	w.walkAll(nodes[i:], inner)
+}
+
+// walkMethods walks the method implementations among the arguments of a
+// form such as reify or deftype, as in (method [params*] body) or
+// (method ([params*] body)+). Their parameters are typed by the interfaces
+// they implement.
+func (w *scopeWalker) walkMethods(args []parse.Node, s *Scope) {
+	for _, n := range args {
+		it := Items(n.Children())
+		if _, ok := n.(*parse.ListNode); !ok || len(it) < 2 || !goclj.Symbol(it[0].Node) {
+			w.walk(n, s)
+			continue
+		}
+		switch it[1].Node.(type) {
+		case *parse.VectorNode, *parse.ListNode:
+		default:
+			w.walk(n, s)
+			continue
+		}
+		if !w.visit(n, s) {
+			continue
+		}
+		nodes := n.Children()
+		i := indexOf(nodes, it[0].Node)
+		w.walkAll(nodes[:i+1], s)
+		w.walkFnTail(nodes[i+1:], s, true)
+	}
+}
+
+// bindParams adds the locals bound by a parameter vector to s.
+func bindParams(s *Scope, params parse.Node, typed bool) {
+	for _, it := range Items(params.Children()) {
+		bindPattern(s, it.Node, it.Hinted || typed)
+	}
+}
+
+// bindPattern adds the locals bound by a binding pattern (a symbol or a
+// destructuring vector or map) to s. If typed is true, a pattern which is a
+// symbol is known to be typed.
+func bindPattern(s *Scope, pat parse.Node, typed bool) {
+	for _, b := range Destructure(pat) {
+		s.Locals[b.Name] = &Local{Node: b.Node, Typed: b.Hinted || (b.Node == pat && typed)}
+	}
+}
+
+// inferredType reports whether the compiler can infer the type of a local
+// bound to init.
+func inferredType(init Item, s *Scope) bool {
+	if init.Hinted {
+		return true
+	}
+	switch n := init.Node.(type) {
+	case *parse.StringNode:
+		return true
+	case *parse.SymbolNode:
+		l := s.Lookup(n.Val)
+		return l != nil && l.Typed
+	case *parse.ListNode:
+		if !goclj.FnFormSymbol(n) {
+			return false
+		}
+		head := n.Nodes[0].(*parse.SymbolNode).Val
+		if head == "new" || head == "str" || head == "clojure.core/str" {
+			return true
+		}
+		// A constructor call, such as (StringBuilder.).
+		return len(head) > 1 && strings.HasSuffix(head, ".") && !strings.HasPrefix(head, ".")
+	}
+	return false
+}
+
+func indexOf(nodes []parse.Node, n parse.Node) int {
+	for i, node := range nodes {
+		if node == n {
+			return i
+		}
+	}
+	return -1
+}
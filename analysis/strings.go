@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A String is a string literal in the code, as found by Strings.
+type String struct {
+	Text string // the value of the string, with escapes interpreted
+	Pos  parse.Pos
+	// Function is the head symbol of the innermost form containing the
+	// string, such as "tr" for (tr "Hello"). It is empty for strings
+	// outside of any form.
+	Function string
+	// Context is the name of the enclosing top-level definition, as for
+	// Todo.
+	Context string
+}
+
+// Strings finds the string literals of t in source order, for extracting
+// the text of a program for translation. Docstrings, the strings of ns forms,
+// and regular expressions are left out. If wrappers are given, only the
+// strings which are direct arguments of calls to one of the named functions
+// (such as "tr", in (tr "Hello, %s" name)) are included; the names may be
+// qualified, and are resolved through the ns form of t (see
+// goclj.Resolver.FnFormSymbol).
+func Strings(t *parse.Tree, wrappers ...string) []*String {
+	r := goclj.NewResolver(t)
+	var strs []*String
+	var find func(n parse.Node, function, context string, wrapped bool)
+	find = func(n parse.Node, function, context string, wrapped bool) {
+		if s, ok := n.(*parse.StringNode); ok {
+			if len(wrappers) == 0 || wrapped {
+				strs = append(strs, &String{
+					Text:     unquote(s.Val),
+					Pos:      s.Pos,
+					Function: function,
+					Context:  context,
+				})
+			}
+			return
+		}
+		var doc parse.Node
+		if isDefForm(n) {
+			doc = docstring(n)
+		}
+		isCall := goclj.FnFormSymbol(n)
+		if isCall {
+			function = n.Children()[0].(*parse.SymbolNode).Val
+		}
+		wrapped = isCall && len(wrappers) > 0 && r.FnFormSymbol(n, wrappers...)
+		for _, child := range n.Children() {
+			if child != doc {
+				find(child, function, context, wrapped)
+			}
+		}
+	}
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") {
+			continue
+		}
+		find(root, "", defName(root), false)
+	}
+	return strs
+}
+
+// docstring returns the docstring of the def-like form n, or nil if it
+// doesn't have one: a string following the name which isn't the last
+// element of the form (as the value of (def x "text") is).
+func docstring(n parse.Node) parse.Node {
+	var nodes []parse.Node
+	args, _ := parse.SemanticChildren(n)
+	for _, n := range args[1:] {
+		if _, ok := n.(*parse.MetadataNode); !ok {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) < 3 {
+		return nil
+	}
+	if s, ok := nodes[1].(*parse.StringNode); ok {
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"strconv"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Test is a test var defined with deftest.
+type Test struct {
+	Namespace string
+	Name      string
+	Pos       parse.Pos
+	Testing   []*Testing
+}
+
+// A Testing is a (testing "description" ...) block inside a test.
+type Testing struct {
+	Desc    string
+	Pos     parse.Pos
+	Testing []*Testing // nested testing blocks
+}
+
+// Tests finds the deftest forms at the top level of t (including those
+// wrapped in metadata or qualified as clojure.test/deftest). The tests are
+// returned in source order.
+func Tests(t *parse.Tree) []*Test {
+	var (
+		ns    string
+		tests []*Test
+	)
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") {
+			ns = formName(root)
+			continue
+		}
+		if !isForm(root, "deftest") {
+			continue
+		}
+		name := formName(root)
+		if name == "" {
+			continue
+		}
+		tests = append(tests, &Test{
+			Namespace: ns,
+			Name:      name,
+			Pos:       *root.Position(),
+			Testing:   findTesting(root.Children()[1:]),
+		})
+	}
+	return tests
+}
+
+func findTesting(nodes []parse.Node) []*Testing {
+	var blocks []*Testing
+	for _, n := range nodes {
+		if !isForm(n, "testing") {
+			blocks = append(blocks, findTesting(n.Children())...)
+			continue
+		}
+		args, _ := parse.SemanticChildren(n)
+		args = args[1:]
+		if len(args) == 0 {
+			continue
+		}
+		b := &Testing{
+			Pos:     *n.Position(),
+			Testing: findTesting(args[1:]),
+		}
+		if s, ok := args[0].(*parse.StringNode); ok {
+			b.Desc = unquote(s.Val)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// isForm reports whether n is a list whose first element is the symbol name,
+// possibly namespace-qualified.
+func isForm(n parse.Node, name string) bool {
+	if !goclj.FnFormSymbol(n) {
+		return false
+	}
+	return goclj.SymbolName(n.Children()[0].(*parse.SymbolNode).Val) == name
+}
+
+// formName returns the name symbol of a def-like form such as
+// (deftest ^:slow foo ...), or the empty string if there isn't one.
+func formName(form parse.Node) string {
+	nodes, _ := parse.SemanticChildren(form)
+	for _, n := range nodes[1:] {
+		switch n := n.(type) {
+		case *parse.MetadataNode:
+			continue
+		case *parse.SymbolNode:
+			return n.Val
+		}
+		break
+	}
+	return ""
+}
+
+func unquote(raw string) string {
+	s, err := strconv.Unquote(`"` + raw + `"`)
+	if err != nil {
+		return raw
+	}
+	return s
+}
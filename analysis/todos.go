@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// TodoTags are the comment markers recognized by Todos.
+var TodoTags = []string{"TODO", "FIXME", "HACK"}
+
+// A Todo is a comment beginning with one of TodoTags.
+type Todo struct {
+	Tag  string
+	Text string // the remainder of the comment after the tag
+	Pos  parse.Pos
+	// Context is the name of the enclosing top-level definition (for
+	// instance, the function name for a comment inside a defn). It is
+	// empty for comments outside of any definition.
+	Context string
+}
+
+// Todos finds the TODO, FIXME, and HACK comments in t in source order.
+// The tree must have been parsed with parse.IncludeNonSemantic.
+func Todos(t *parse.Tree) []*Todo {
+	var todos []*Todo
+	var find func(n parse.Node, context string)
+	find = func(n parse.Node, context string) {
+		if c, ok := n.(*parse.CommentNode); ok {
+			if todo := parseTodo(c.Text); todo != nil {
+				todo.Pos = *c.Position()
+				todo.Context = context
+				todos = append(todos, todo)
+			}
+			return
+		}
+		for _, child := range n.Children() {
+			find(child, context)
+		}
+	}
+	for _, root := range t.Roots {
+		find(root, defName(root))
+	}
+	return todos
+}
+
+// defName returns the name defined by n if it is a def-like form such as
+// (defn foo ...) or (defmethod foo ...).
+func defName(n parse.Node) string {
+	if !isDefForm(n) {
+		return ""
+	}
+	return formName(n)
+}
+
+func isDefForm(n parse.Node) bool {
+	if !goclj.FnFormSymbol(n) {
+		return false
+	}
+	return strings.HasPrefix(goclj.SymbolName(n.Children()[0].(*parse.SymbolNode).Val), "def")
+}
+
+func parseTodo(comment string) *Todo {
+	text := strings.TrimLeft(comment, ";#! \t")
+	for _, tag := range TodoTags {
+		if !strings.HasPrefix(text, tag) {
+			continue
+		}
+		rest := text[len(tag):]
+		if rest != "" {
+			if r := []rune(rest)[0]; unicode.IsLetter(r) || unicode.IsDigit(r) {
+				continue // e.g., TODOS
+			}
+		}
+		// Allow for TODO(name): ...
+		if strings.HasPrefix(rest, "(") {
+			if i := strings.IndexByte(rest, ')'); i >= 0 {
+				rest = rest[i+1:]
+			}
+		}
+		rest = strings.TrimLeft(rest, ": \t")
+		return &Todo{Tag: tag, Text: strings.TrimSpace(rest)}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// An Input is a Clojure source file used by the benchmarks.
+type Input struct {
+	Name string
+	Src  []byte
+}
+
+// Inputs are the standard benchmark inputs. They are generated
+// deterministically, so results are comparable from release to release.
+var Inputs = []Input{
+	{"small", Generate(5)},
+	{"medium", Generate(100)},
+	{"huge", Generate(5000)},
+	{"nested", Nested(500)},
+	{"comments", Comments(1000)},
+}
+
+const nsForm = `(ns bench.core
+  "A generated namespace for benchmarking."
+  (:require [clojure.string :as str]
+            [clojure.set :as set])
+  (:import (java.util UUID Date)
+           java.io.File))
+`
+
+const defnForm = `
+(defn f%d
+  "Docstring for f%d.
+  It has two lines."
+  [{:keys [a b] :as m} & args]
+  (let [x (str/join "," args)
+        y #{:a :b 'c}]
+    (cond
+      (nil? a) {:x x, :y [1 2.5 \c]}
+      :else (-> m
+                (assoc :a @(atom %d))
+                (update :b #(+ %% 1))))))
+`
+
+// Generate returns a namespace with n typical function definitions.
+func Generate(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(nsForm)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, defnForm, i, i, i)
+	}
+	return buf.Bytes()
+}
+
+// Nested returns a single form which is nested depth levels deep, alternating
+// between lists, vectors, and maps.
+func Nested(depth int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(nsForm)
+	buf.WriteString("\n(def nested\n")
+	closing := make([]string, 0, depth)
+	for i := 0; i < depth; i++ {
+		switch i % 3 {
+		case 0:
+			buf.WriteString("(f :a\n")
+			closing = append(closing, ")")
+		case 1:
+			buf.WriteString("[1\n")
+			closing = append(closing, "]")
+		case 2:
+			buf.WriteString("{:k\n")
+			closing = append(closing, "}")
+		}
+	}
+	buf.WriteString("x")
+	for i := len(closing) - 1; i >= 0; i-- {
+		buf.WriteString(closing[i])
+	}
+	buf.WriteString(")\n")
+	return buf.Bytes()
+}
+
+// Comments returns a namespace with n short definitions, each surrounded by
+// line comments and commented-out forms.
+func Comments(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(nsForm)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "\n;; Section %d\n;; %s\n", i, strings.Repeat("lorem ipsum ", 6))
+		fmt.Fprintf(&buf, "(def x%d ; trailing comment\n  #_(old value)\n  %d)\n", i, i)
+	}
+	return buf.Bytes()
+}
+
+// Parse benchmarks parsing in, including non-semantic nodes.
+func Parse(b *testing.B, in Input) {
+	b.SetBytes(int64(len(in.Src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse.Reader(bytes.NewReader(in.Src), in.Name, parse.IncludeNonSemantic); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Print benchmarks printing the parsed input with every transform disabled.
+func Print(b *testing.B, in Input) {
+	printTree(b, in, map[format.Transform]bool{})
+}
+
+// Transform benchmarks printing the parsed input with every transform
+// enabled. The cost of the transforms themselves is the difference between
+// this and Print.
+func Transform(b *testing.B, in Input) {
+	printTree(b, in, allTransforms)
+}
+
+var allTransforms = map[format.Transform]bool{
+	format.TransformSortImportRequire:              true,
+	format.TransformRemoveTrailingNewlines:         true,
+	format.TransformFixDefnArglistNewline:          true,
+	format.TransformFixDefmethodDispatchValNewline: true,
+	format.TransformRemoveExtraBlankLines:          true,
+	format.TransformUseToRequire:                   true,
+	format.TransformRemoveUnusedRequires:           true,
+	format.TransformFormatSchemas:                  true,
+}
+
+func printTree(b *testing.B, in Input, transforms map[format.Transform]bool) {
+	b.SetBytes(int64(len(in.Src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// Transforms modify the tree, so each iteration needs its own.
+		b.StopTimer()
+		t, err := parse.Reader(bytes.NewReader(in.Src), in.Name, parse.IncludeNonSemantic)
+		if err != nil {
+			b.Fatal(err)
+		}
+		p := format.NewPrinter(ioutil.Discard)
+		p.Transforms = make(map[format.Transform]bool)
+		for k, v := range allTransforms {
+			p.Transforms[k] = v && transforms[k]
+		}
+		b.StartTimer()
+		if err := p.PrintTree(t); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Format benchmarks the whole of what cljfmt does to a file: parsing it and
+// printing it with the default transforms.
+func Format(b *testing.B, in Input) {
+	b.SetBytes(int64(len(in.Src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t, err := parse.Reader(bytes.NewReader(in.Src), in.Name, parse.IncludeNonSemantic)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := format.NewPrinter(ioutil.Discard).PrintTree(t); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
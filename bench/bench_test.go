@@ -0,0 +1,27 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/cespare/goclj/corpus"
+)
+
+func TestInputs(t *testing.T) {
+	for _, in := range Inputs {
+		if err := corpus.Check(in.Name+".clj", in.Src, nil); err != nil {
+			t.Errorf("%s: %s", in.Name, err)
+		}
+	}
+}
+
+func run(b *testing.B, fn func(*testing.B, Input)) {
+	for _, in := range Inputs {
+		in := in
+		b.Run(in.Name, func(b *testing.B) { fn(b, in) })
+	}
+}
+
+func BenchmarkParse(b *testing.B)     { run(b, Parse) }
+func BenchmarkPrint(b *testing.B)     { run(b, Print) }
+func BenchmarkTransform(b *testing.B) { run(b, Transform) }
+func BenchmarkFormat(b *testing.B)    { run(b, Format) }
@@ -0,0 +1,108 @@
+// Command capi is a C interface to the formatter. Build it as a shared
+// library with
+//
+//	go build -buildmode=c-shared -o libgoclj.so ./capi
+//
+// which also writes libgoclj.h, declaring:
+//
+//	char* goclj_format(char* src, char* conf, char** errp);
+//	char* goclj_capabilities(void);
+//	void goclj_free(char* p);
+//
+// goclj_format formats the Clojure source src. If conf is not NULL, it is
+// a JSON object with the optional fields
+//
+//	{"filename": "src/foo/core.clj", "transforms": {"use-to-require": true}}
+//
+// where filename is used in error messages and to detect the dialect, and
+// transforms turns transforms (named as for cljfmt's -enable-transform) on
+// or off. It returns the formatted source; on failure, it returns NULL and
+// sets *errp (if errp is not NULL) to an error message.
+//
+// goclj_capabilities returns a JSON object {"parse": ..., "format": ...}
+// holding the parse and format packages' Features, so that callers can
+// check whether a transform is supported before asking for it.
+//
+// The caller must free the returned strings with goclj_free.
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unsafe"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+type config struct {
+	Filename   string          `json:"filename"`
+	Transforms map[string]bool `json:"transforms"`
+}
+
+//export goclj_format
+func goclj_format(src, conf *C.char, errp **C.char) *C.char {
+	out, err := formatSource(C.GoString(src), conf)
+	if err != nil {
+		if errp != nil {
+			*errp = C.CString(err.Error())
+		}
+		return nil
+	}
+	return C.CString(out)
+}
+
+//export goclj_capabilities
+func goclj_capabilities() *C.char {
+	b, err := json.Marshal(map[string]interface{}{
+		"parse":  parse.Capabilities(),
+		"format": format.Capabilities(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return C.CString(string(b))
+}
+
+//export goclj_free
+func goclj_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+func formatSource(src string, conf *C.char) (string, error) {
+	c := config{Filename: "input.clj"}
+	if conf != nil {
+		if err := json.Unmarshal([]byte(C.GoString(conf)), &c); err != nil {
+			return "", err
+		}
+	}
+	transforms := make(map[format.Transform]bool)
+	for name, on := range c.Transforms {
+		t, err := format.ParseTransform(name)
+		if err != nil {
+			return "", err
+		}
+		transforms[t] = on
+	}
+	tree, err := parse.Reader(strings.NewReader(src), c.Filename, parse.IncludeNonSemantic)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	p := format.NewPrinter(&buf)
+	p.Transforms = transforms
+	p.Dialect = goclj.DetectDialect(c.Filename, tree)
+	if err := p.PrintTree(tree); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func main() {}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"flag"
 	"fmt"
@@ -9,47 +10,106 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"regexp"
+	"runtime"
+	"sync"
 
+	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/internal/diff"
 	"github.com/cespare/goclj/parse"
 )
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `usage: %s [flags] [paths...]
-Any directories given will be recursively walked. If no paths are provided,
+       %[1]s <subcommand> [flags] [paths...]
+Any directories given will be recursively walked (dir/... means the same as
+dir), and their files formatted concurrently. If no paths are provided,
 cljfmt reads from standard input.
 
+Subcommands:
+%s
+
 Flags:
-`, os.Args[0])
+`, os.Args[0], subcommandUsage())
 	flag.PrintDefaults()
 	fmt.Fprintln(os.Stderr, `
 See the goclj README for more documentation of the available transforms.`)
 }
 
 type config struct {
-	indentOverrides      map[string]format.IndentStyle
 	threadFirstOverrides map[string]format.ThreadFirstStyle
-	transforms           map[format.Transform]bool
+	formAliases          map[string]string
+	dataProfiles         map[string]format.DataProfile
+	fileDataProfiles     map[string]format.DataProfile // keyed by glob pattern
+	transforms           map[format.Transform]bool     // from flags
+	sortCollation        format.Collation
+	preserveAlignment    bool
+	whitespaceOnly       bool
+	expandQuotes         bool
+	verbatim             bool
+	blankLinesAfterNS    *int
+	maxBlankLines        map[format.BlankLineContext]int
+	requireAliases       map[string]string // scanned from :require-classpath
+	generated            bool              // format generated files too
+	lint                 lintConfig
 	list                 bool
+	diff                 bool
+	changed              bool // some file's formatting differs (for -l and -d)
 	write                bool
+	stream               bool
+	fixDelims            bool
+	workers              int
+
+	// dotConfig holds the settings of the config file which the format
+	// package understands (transforms, indent overrides, line width, and
+	// generated-file marker). If findProjectConfig is set, they are
+	// overridden by those of the format.ConfigFile of each file's project.
+	dotConfig         *format.Config
+	findProjectConfig bool
+	projectMu         sync.Mutex
+	projectConfigs    map[string]*format.Config // by directory
 }
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("clfmt: ")
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd.run(os.Args[2:])
+			return
+		}
+	}
 	var configFile pathFlag
 	if home, ok := os.LookupEnv("HOME"); ok {
 		configFile.p = filepath.Join(home, ".cljfmt")
 	}
 	conf := config{
-		transforms: make(map[format.Transform]bool),
+		transforms:        make(map[format.Transform]bool),
+		findProjectConfig: true,
 	}
 	flag.Var(&configFile, "c", "path to config file")
 	flag.BoolVar(&conf.list, "l", false,
-		"print files whose formatting differs from cljfmt's")
+		"print files whose formatting differs from cljfmt's "+
+			"(exiting with status 1 if there are any)")
+	flag.BoolVar(&conf.diff, "d", false,
+		"print diffs of the changes instead of the formatted code "+
+			"(exiting with status 1 if there are any)")
 	flag.BoolVar(&conf.write, "w", false,
 		"write result to (source) file instead of stdout")
+	flag.BoolVar(&conf.stream, "stream", false,
+		"format one top-level form at a time, using little memory "+
+			"(cannot be used with -l, -d, or -w)")
+	flag.BoolVar(&conf.whitespaceOnly, "whitespace-only", false,
+		"only fix indentation and whitespace, applying no transforms")
+	flag.BoolVar(&conf.verbatim, "verbatim", false,
+		"leave the forms which no transform changes exactly as they are")
+	flag.IntVar(&conf.workers, "j", runtime.NumCPU(),
+		"number of files to format at once")
+	flag.BoolVar(&conf.generated, "generated", false,
+		"format generated files (see :generated-marker) rather than leaving them as they are")
+	flag.BoolVar(&conf.fixDelims, "fix-delims", false,
+		"repair unbalanced delimiters (judging by indentation) before formatting")
 	flag.Var(transformFlag{conf.transforms, true}, "enable-transform",
 		"turn on the named transform")
 	flag.Var(transformFlag{conf.transforms, false}, "disable-transform",
@@ -58,31 +118,43 @@ func main() {
 	flag.Parse()
 
 	conf.parseDotConfigFile(configFile)
+	if conf.stream && (conf.list || conf.diff || conf.write) {
+		log.Fatal("cannot use -stream with -l, -d, or -w")
+	}
 
 	if flag.NArg() == 0 {
 		if conf.write {
 			log.Fatal("cannot use -w with standard input")
 		}
 		conf.list = false
-		if err := conf.processFile("<stdin>", os.Stdin); err != nil {
+		out, changed, err := conf.formatFile("<stdin>", os.Stdin)
+		if err != nil {
 			log.Fatal(err)
 		}
-		return
+		os.Stdout.Write(out)
+		conf.changed = changed
+		conf.exit()
 	}
 
-	for _, path := range flag.Args() {
-		stat, err := os.Stat(path)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if stat.IsDir() {
-			conf.walkDir(path)
-			continue
-		}
-		if err := conf.processFile(path, nil); err != nil {
-			log.Fatal(err)
-		}
+	var filenames []string
+	err := walkClojureFiles(flag.Args(), func(path string) error {
+		filenames = append(filenames, path)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.processFiles(filenames)
+	conf.exit()
+}
+
+// exit exits, with status 1 if -l or -d found files to change (so that
+// they can be used to check formatting in CI).
+func (c *config) exit() {
+	if c.changed && (c.list || c.diff) {
+		os.Exit(1)
 	}
+	os.Exit(0)
 }
 
 type transformFlag struct {
@@ -91,24 +163,9 @@ type transformFlag struct {
 }
 
 func (tf transformFlag) Set(v string) error {
-	var t format.Transform
-	switch v {
-	case "sort-import-require":
-		t = format.TransformSortImportRequire
-	case "remove-trailing-newlines":
-		t = format.TransformRemoveTrailingNewlines
-	case "fix-defn-arglist-newline":
-		t = format.TransformFixDefnArglistNewline
-	case "fix-defmethod-dispatch-val-newline":
-		t = format.TransformFixDefmethodDispatchValNewline
-	case "remove-extra-blank-lines":
-		t = format.TransformRemoveExtraBlankLines
-	case "use-to-require":
-		t = format.TransformUseToRequire
-	case "remove-unused-requires":
-		t = format.TransformRemoveUnusedRequires
-	default:
-		return fmt.Errorf("unrecognized transform %q", v)
+	t, err := format.ParseTransform(v)
+	if err != nil {
+		return err
 	}
 	tf.m[t] = tf.b
 	return nil
@@ -137,97 +194,270 @@ func (c *config) parseDotConfigFile(pf pathFlag) {
 	if pf.p == "" {
 		return
 	}
-	f, err := os.Open(pf.p)
+	b, err := ioutil.ReadFile(pf.p)
 	if err != nil {
 		if !os.IsNotExist(err) || pf.set {
 			log.Println("warning: could not open config", err)
 		}
 		return
 	}
-	defer f.Close()
-	if err := c.parseDotConfig(f, pf.p); err != nil {
+	if err := c.parseDotConfig(bytes.NewReader(b), pf.p); err != nil {
+		log.Fatalf("error parsing config %s: %s", pf.p, err)
+	}
+	dc, err := format.ParseConfig(bytes.NewReader(b), pf.p)
+	if err != nil {
 		log.Fatalf("error parsing config %s: %s", pf.p, err)
 	}
+	c.dotConfig = dc
 }
 
-var (
-	buf1 bytes.Buffer
-	buf2 bytes.Buffer
-)
+// projectConfig returns the project configuration for the named file (or,
+// for standard input, the current directory), if c.findProjectConfig is set
+// and there is one.
+func (c *config) projectConfig(filename string) *format.Config {
+	if !c.findProjectConfig {
+		return nil
+	}
+	dir := "."
+	if filename != "<stdin>" {
+		dir = filepath.Dir(filename)
+	}
+	c.projectMu.Lock()
+	defer c.projectMu.Unlock()
+	if pc, ok := c.projectConfigs[dir]; ok {
+		return pc
+	}
+	pc, err := format.FindConfig(dir)
+	if err != nil {
+		log.Fatalf("error reading project config: %s", err)
+	}
+	if c.projectConfigs == nil {
+		c.projectConfigs = make(map[string]*format.Config)
+	}
+	c.projectConfigs[dir] = pc
+	return pc
+}
 
-// processFile formats the given file.
-// If in == nil, the input is the file of the given name.
-func (c *config) processFile(filename string, in io.Reader) error {
+// transformsFor returns the transforms configured for the named file: those
+// of the config file, then of the project config, then of the flags.
+func (c *config) transformsFor(filename string) map[format.Transform]bool {
+	transforms := make(map[format.Transform]bool)
+	for _, conf := range []*format.Config{c.dotConfig, c.projectConfig(filename)} {
+		if conf != nil {
+			for t, on := range conf.Transforms {
+				transforms[t] = on
+			}
+		}
+	}
+	for t, on := range c.transforms {
+		transforms[t] = on
+	}
+	return transforms
+}
+
+// formatFile formats the given file and returns what to print to standard
+// output and whether the formatting differs from the input. If in == nil,
+// the input is the file of the given name.
+func (c *config) formatFile(filename string, in io.Reader) (out []byte, changed bool, err error) {
+	if c.stream {
+		return nil, false, c.streamFile(filename, in)
+	}
 	var perm os.FileMode = 0644
 	if in == nil {
 		f, err := os.Open(filename)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 		defer f.Close()
 		stat, err := f.Stat()
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 		perm = stat.Mode().Perm()
 		in = f
 	}
 
-	buf1.Reset()
-	buf2.Reset()
-
-	if _, err := io.Copy(&buf1, in); err != nil {
-		return err
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, false, err
 	}
-	r := bytes.NewReader(buf1.Bytes())
-	t, err := parse.Reader(r, filename, parse.IncludeNonSemantic)
+	if c.skipGenerated(filename, src) {
+		if !c.list && !c.diff && !c.write {
+			out = src
+		}
+		return out, false, nil
+	}
+	t, err := c.parse(filename, src)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	p := format.NewPrinter(&buf2)
-	p.IndentChar = ' '
-	p.IndentOverrides = c.indentOverrides
-	p.Transforms = c.transforms
+	var buf bytes.Buffer
+	p := c.newPrinter(&buf, filename, t)
 	if err := p.PrintTree(t); err != nil {
-		return err
+		return nil, false, err
+	}
+	formatted := buf.Bytes()
+	if !c.list && !c.diff && !c.write {
+		out = formatted
+	}
+	if bytes.Equal(src, formatted) {
+		return out, false, nil
+	}
+	if c.list {
+		out = append(out, filename+"\n"...)
+	}
+	if c.diff {
+		out = append(out, diff.Unified(filename, src, formatted)...)
 	}
-	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
-		if c.list {
-			fmt.Println(filename)
+	if c.write {
+		if err := ioutil.WriteFile(filename, formatted, perm); err != nil {
+			return nil, false, err
 		}
-		if c.write {
-			if err := ioutil.WriteFile(filename, buf2.Bytes(), perm); err != nil {
-				return err
-			}
+	}
+	return out, true, nil
+}
+
+// processFiles formats the named files, up to c.workers at a time, printing
+// the output for each in order.
+func (c *config) processFiles(filenames []string) {
+	workers := c.workers
+	if workers < 1 || c.stream {
+		// -stream prints as it goes.
+		workers = 1
+	}
+	type result struct {
+		out     []byte
+		changed bool
+		err     error
+		done    chan struct{}
+	}
+	results := make([]result, len(filenames))
+	for i := range results {
+		results[i].done = make(chan struct{})
+	}
+	work := make(chan int)
+	go func() {
+		for i := range filenames {
+			work <- i
 		}
+		close(work)
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range work {
+				r := &results[i]
+				r.out, r.changed, r.err = c.formatFile(filenames[i], nil)
+				close(r.done)
+			}
+		}()
 	}
-	if !c.list && !c.write {
-		io.Copy(os.Stdout, &buf2)
+	for i := range results {
+		r := &results[i]
+		<-r.done
+		if r.err != nil {
+			log.Fatal(r.err)
+		}
+		os.Stdout.Write(r.out)
+		r.out = nil
+		if r.changed {
+			c.changed = true
+		}
 	}
-	return nil
 }
 
-func (c *config) walkDir(path string) {
-	walk := func(path string, f os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// maxDelimFixes limits the repairs made by -fix-delims to a single file.
+const maxDelimFixes = 100
+
+// parse parses src. With -fix-delims, it first repairs any unbalanced
+// delimiters, one fix at a time.
+func (c *config) parse(filename string, src []byte) (*parse.Tree, error) {
+	for i := 0; ; i++ {
+		t, err := parse.Reader(bytes.NewReader(src), filename, parse.IncludeNonSemantic)
+		de, ok := err.(*parse.DelimError)
+		if !ok || de.Fix == nil {
+			return t, err
 		}
-		if f.IsDir() {
-			return nil
+		if !c.fixDelims {
+			return nil, fmt.Errorf("%s (perhaps %s; see -fix-delims)", err, de.Fix)
 		}
-		name := f.Name()
-		if strings.HasPrefix(name, ".") {
-			return nil
+		if i == maxDelimFixes {
+			return nil, err
 		}
-		for _, ext := range []string{".clj", ".cljs", ".cljc"} {
-			if strings.HasSuffix(name, ext) {
-				return c.processFile(path, nil)
-			}
+		log.Printf("%s: %s", filename, de.Fix)
+		src = de.Fix.Apply(src)
+	}
+}
+
+// skipGenerated reports whether the named file, beginning with src, should
+// be left alone because it is generated (unless -generated is given). The
+// marker of the project config overrides that of the config file.
+func (c *config) skipGenerated(filename string, src []byte) bool {
+	if c.generated {
+		return false
+	}
+	var marker *regexp.Regexp
+	for _, conf := range []*format.Config{c.dotConfig, c.projectConfig(filename)} {
+		if conf != nil && conf.GeneratedMarker != nil {
+			marker = conf.GeneratedMarker
 		}
-		return nil // not a Clojure file
 	}
-	if err := filepath.Walk(path, walk); err != nil {
-		log.Fatal(err)
+	return goclj.Generated(src, marker)
+}
+
+// generatedPeek is the number of bytes that streamFile reads ahead to check
+// whether a file is generated.
+const generatedPeek = 4096
+
+// streamFile formats the given file to stdout using format.PrintStream.
+// If in == nil, the input is the file of the given name.
+func (c *config) streamFile(filename string, in io.Reader) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	br := bufio.NewReader(in)
+	head, _ := br.Peek(generatedPeek)
+	if c.skipGenerated(filename, head) {
+		_, err := io.Copy(os.Stdout, br)
+		return err
+	}
+	s := parse.NewStream(br, filename, parse.IncludeNonSemantic)
+	p := c.newPrinter(os.Stdout, filename, &parse.Tree{})
+	return p.PrintStream(s)
+}
+
+func (c *config) newPrinter(w io.Writer, filename string, t *parse.Tree) *format.Printer {
+	p := format.NewPrinter(w)
+	c.configure(p, filename)
+	p.Dialect = goclj.DetectDialect(filename, t)
+	return p
+}
+
+// configure applies the configuration for the named file to p.
+func (c *config) configure(p *format.Printer, filename string) {
+	p.IndentChar = ' '
+	p.FormAliases = c.formAliases
+	p.DataProfiles = c.dataProfiles
+	p.DataProfile = c.fileDataProfile(filename)
+	p.SortCollation = c.sortCollation
+	p.RequireAliases = c.requireAliases
+	p.PreserveAlignment = c.preserveAlignment
+	p.WhitespaceOnly = c.whitespaceOnly
+	p.ExpandQuotes = c.expandQuotes
+	p.Verbatim = c.verbatim
+	p.MaxBlankLines = c.maxBlankLines
+	if c.blankLinesAfterNS != nil {
+		p.BlankLinesAfterNS = *c.blankLinesAfterNS
+	}
+	for _, conf := range []*format.Config{c.dotConfig, c.projectConfig(filename)} {
+		if conf != nil {
+			conf.Apply(p)
+		}
 	}
+	p.Transforms = c.transformsFor(filename)
 }
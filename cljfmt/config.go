@@ -3,6 +3,11 @@ package main
 import (
 	"fmt"
 	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/cespare/goclj/format"
 	"github.com/cespare/goclj/parse"
@@ -44,8 +49,9 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 		if !ok {
 			continue
 		}
+		// Keep format's commandConfigKeys up to date with these.
 		switch sym.Val {
-		case ":indent-overrides", ":thread-first-overrides":
+		case ":data-profiles", ":file-data-profiles":
 			seq, err := sequence(m.Nodes[i+1])
 			if err != nil {
 				return err
@@ -54,31 +60,311 @@ func (c *config) parseDotConfig(r io.Reader, name string) error {
 			if err != nil {
 				return err
 			}
+			profiles := make(map[string]format.DataProfile)
+			for k, v := range overrides {
+				profile, ok := dataProfiles[v]
+				if !ok {
+					return fmt.Errorf("unknown data profile %q", v)
+				}
+				profiles[k] = profile
+			}
+			if sym.Val == ":data-profiles" {
+				c.dataProfiles = profiles
+			} else {
+				c.fileDataProfiles = profiles
+			}
+		case ":form-aliases":
+			seq, err := sequence(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			aliases, err := parseOverrides(seq, sym.Val)
+			if err != nil {
+				return err
+			}
+			c.formAliases = make(map[string]string)
+			for k, v := range aliases {
+				c.formAliases[k] = strings.TrimPrefix(v, ":")
+			}
+		case ":blank-lines-after-ns":
+			num, ok := m.Nodes[i+1].(*parse.NumberNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
+			n, err := strconv.Atoi(num.Val)
+			if err != nil || n < 0 || n > 2 {
+				return fmt.Errorf(":blank-lines-after-ns must be 0, 1, or 2 (got %s)", num.Val)
+			}
+			c.blankLinesAfterNS = &n
+		case ":max-blank-lines":
+			limits, ok := m.Nodes[i+1].(*parse.MapNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
+			if len(limits.Nodes)%2 != 0 {
+				return fmt.Errorf("%s value has odd number of children", sym.Val)
+			}
+			c.maxBlankLines = make(map[format.BlankLineContext]int)
+			for j := 0; j < len(limits.Nodes); j += 2 {
+				kw, ok := limits.Nodes[j].(*parse.KeywordNode)
+				if !ok {
+					return unexpectedNodeError{limits.Nodes[j]}
+				}
+				ctx, err := format.ParseBlankLineContext(strings.TrimPrefix(kw.Val, ":"))
+				if err != nil {
+					return err
+				}
+				num, ok := limits.Nodes[j+1].(*parse.NumberNode)
+				if !ok {
+					return unexpectedNodeError{limits.Nodes[j+1]}
+				}
+				n, err := strconv.Atoi(num.Val)
+				if err != nil || n < 0 {
+					return fmt.Errorf("%s values must be non-negative integers (got %s)", sym.Val, num.Val)
+				}
+				c.maxBlankLines[ctx] = n
+			}
+		case ":lint":
+			if err := c.lint.parse(m.Nodes[i+1]); err != nil {
+				return err
+			}
+		case ":require-classpath":
+			dirs, err := stringList(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			for j, dir := range dirs {
+				if !filepath.IsAbs(dir) {
+					dirs[j] = filepath.Join(filepath.Dir(name), dir)
+				}
+			}
+			c.requireAliases, err = scanRequireAliases(dirs)
+			if err != nil {
+				return err
+			}
+		case ":preserve-alignment", ":whitespace-only", ":expand-quotes":
+			b, ok := m.Nodes[i+1].(*parse.BoolNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
 			switch sym.Val {
-			case ":indent-overrides":
-				c.indentOverrides = make(map[string]format.IndentStyle)
-				for k, v := range overrides {
-					style, ok := indentStyles[v]
-					if !ok {
-						return fmt.Errorf("unknown indent style %q", v)
-					}
-					c.indentOverrides[k] = style
+			case ":preserve-alignment":
+				c.preserveAlignment = b.Val
+			case ":expand-quotes":
+				c.expandQuotes = b.Val
+			default:
+				if b.Val {
+					// The -whitespace-only flag takes
+					// precedence over {:whitespace-only false}.
+					c.whitespaceOnly = true
 				}
-			case ":thread-first-overrides":
-				c.threadFirstOverrides = make(map[string]format.ThreadFirstStyle)
-				for k, v := range overrides {
-					style, ok := threadFirstStyles[v]
-					if !ok {
-						return fmt.Errorf("unknown thread-first style %q", v)
-					}
-					c.threadFirstOverrides[k] = style
+			}
+		case ":sort-collation":
+			kw, ok := m.Nodes[i+1].(*parse.KeywordNode)
+			if !ok {
+				return unexpectedNodeError{m.Nodes[i+1]}
+			}
+			collation, err := format.ParseCollation(strings.TrimPrefix(kw.Val, ":"))
+			if err != nil {
+				return err
+			}
+			c.sortCollation = collation
+		case ":thread-first-overrides":
+			seq, err := sequence(m.Nodes[i+1])
+			if err != nil {
+				return err
+			}
+			overrides, err := parseOverrides(seq, sym.Val)
+			if err != nil {
+				return err
+			}
+			c.threadFirstOverrides = make(map[string]format.ThreadFirstStyle)
+			for k, v := range overrides {
+				style, ok := threadFirstStyles[v]
+				if !ok {
+					return fmt.Errorf("unknown thread-first style %q", v)
 				}
+				c.threadFirstOverrides[k] = style
 			}
 		}
 	}
 	return nil
 }
 
+// scanRequireAliases returns the alias table for the add-missing-requires
+// transform given the directories of the :require-classpath: the default
+// aliases, overridden by the namespaces declared in the directories' files
+// (aliased by the last segments of their names) and then by the aliases
+// which those files give the namespaces they require.
+func scanRequireAliases(dirs []string) (map[string]string, error) {
+	var trees []*parse.Tree
+	err := walkClojureFiles(dirs, func(path string) error {
+		t, err := parse.File(path, 0)
+		if err != nil {
+			log.Printf("warning: skipping %s: %s", path, err)
+			return nil
+		}
+		trees = append(trees, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]string)
+	for _, table := range []map[string]string{
+		format.DefaultAliases,
+		format.NamespaceAliases(trees),
+		format.ProjectAliases(trees),
+	} {
+		for as, ns := range table {
+			aliases[as] = ns
+		}
+	}
+	return aliases, nil
+}
+
+// lintConfig is the configuration of cljfmt lint, given by the :lint map of
+// the config file:
+//
+//	{:lint {:disable ["sort-import-require"]
+//	        :reflection {:namespaces ["myapp.hot.*"]}
+//	        :deprecated {"old.core/f" "new.core/g", "old.util" nil}
+//	        :complexity {:max-lines 50 :max-depth 6 :max-params 5}}}
+type lintConfig struct {
+	disabled             []string
+	reflectionNamespaces []string
+	deprecated           map[string]string
+	// The complexity limits (zero for no limit).
+	maxLines, maxDepth, maxParams int
+}
+
+func (lc *lintConfig) parse(node parse.Node) error {
+	m, ok := node.(*parse.MapNode)
+	if !ok {
+		return unexpectedNodeError{node}
+	}
+	if len(m.Nodes)%2 != 0 {
+		return fmt.Errorf(":lint map at %s has odd number of children", m.Position())
+	}
+	for i := 0; i < len(m.Nodes); i += 2 {
+		k, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			return unexpectedNodeError{m.Nodes[i]}
+		}
+		v := m.Nodes[i+1]
+		var err error
+		switch k.Val {
+		case ":disable":
+			lc.disabled, err = stringList(v)
+		case ":deprecated":
+			lc.deprecated, err = parseDeprecated(v)
+		case ":complexity":
+			err = forEachOption(v, func(key string, val parse.Node) error {
+				var limit *int
+				switch key {
+				case ":max-lines":
+					limit = &lc.maxLines
+				case ":max-depth":
+					limit = &lc.maxDepth
+				case ":max-params":
+					limit = &lc.maxParams
+				default:
+					return fmt.Errorf("unknown :complexity option %s", key)
+				}
+				num, ok := val.(*parse.NumberNode)
+				if !ok {
+					return unexpectedNodeError{val}
+				}
+				n, err := strconv.Atoi(num.Val)
+				if err != nil || n < 0 {
+					return fmt.Errorf("%s must be a non-negative integer (got %s)", key, num.Val)
+				}
+				*limit = n
+				return nil
+			})
+		case ":reflection":
+			err = forEachOption(v, func(key string, val parse.Node) error {
+				switch key {
+				case ":namespaces":
+					lc.reflectionNamespaces, err = stringList(val)
+					return err
+				}
+				return fmt.Errorf("unknown :reflection option %s", key)
+			})
+		default:
+			return fmt.Errorf("unknown :lint option %s", k.Val)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDeprecated parses a map from the names of deprecated vars and
+// namespaces to their replacements (or nil).
+func parseDeprecated(node parse.Node) (map[string]string, error) {
+	m, ok := node.(*parse.MapNode)
+	if !ok {
+		return nil, unexpectedNodeError{node}
+	}
+	if len(m.Nodes)%2 != 0 {
+		return nil, fmt.Errorf(":deprecated map at %s has odd number of children", m.Position())
+	}
+	deprecated := make(map[string]string)
+	for i := 0; i < len(m.Nodes); i += 2 {
+		name, err := stringNode(m.Nodes[i])
+		if err != nil {
+			return nil, err
+		}
+		var repl string
+		if _, ok := m.Nodes[i+1].(*parse.NilNode); !ok {
+			if repl, err = stringNode(m.Nodes[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		deprecated[name] = repl
+	}
+	return deprecated, nil
+}
+
+// forEachOption calls fn with each key and value of the options map node.
+func forEachOption(node parse.Node, fn func(key string, val parse.Node) error) error {
+	m, ok := node.(*parse.MapNode)
+	if !ok {
+		return unexpectedNodeError{node}
+	}
+	if len(m.Nodes)%2 != 0 {
+		return fmt.Errorf("map at %s has odd number of children", m.Position())
+	}
+	for i := 0; i < len(m.Nodes); i += 2 {
+		k, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			return unexpectedNodeError{m.Nodes[i]}
+		}
+		if err := fn(k.Val, m.Nodes[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringList(node parse.Node) ([]string, error) {
+	seq, err := sequence(node)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, n := range seq {
+		s, err := stringNode(n)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
 func parseOverrides(nodes []parse.Node, name string) (map[string]string, error) {
 	if len(nodes)%2 != 0 {
 		return nil, fmt.Errorf("%s value has odd number of children", name)
@@ -129,20 +415,42 @@ func stringNode(node parse.Node) (string, error) {
 	return sn.Val, nil
 }
 
-var indentStyles = map[string]format.IndentStyle{
-	":normal":    format.IndentNormal,
-	":list":      format.IndentList,
-	":list-body": format.IndentListBody,
-	":let":       format.IndentLet,
-	":letfn":     format.IndentLetfn,
-	":deftype":   format.IndentDeftype,
-	":cond0":     format.IndentCond0,
-	":cond1":     format.IndentCond1,
-	":cond2":     format.IndentCond2,
-	":cond4":     format.IndentCond4,
-}
-
 var threadFirstStyles = map[string]format.ThreadFirstStyle{
 	":normal": format.ThreadFirstNormal,
 	":cond->": format.ThreadFirstCondArrow,
 }
+
+var dataProfiles = map[string]format.DataProfile{
+	":none":         format.DataProfileNone,
+	":hiccup":       format.DataProfileHiccup,
+	":honeysql":     format.DataProfileHoneySQL,
+	":babashka":     format.DataProfileBabashka,
+	":data-readers": format.DataProfileDataReaders,
+}
+
+// fileDataProfile returns the data profile for the named file: that of the
+// first (in sorted order) :file-data-profiles pattern that matches either
+// the whole path or its base name. If none matches, bb.edn files use
+// format.DataProfileBabashka and data_readers.clj and data_readers.cljc
+// files use format.DataProfileDataReaders.
+func (c *config) fileDataProfile(filename string) format.DataProfile {
+	patterns := make([]string, 0, len(c.fileDataProfiles))
+	for pattern := range c.fileDataProfiles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		for _, name := range []string{filename, filepath.Base(filename)} {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return c.fileDataProfiles[pattern]
+			}
+		}
+	}
+	switch filepath.Base(filename) {
+	case "bb.edn":
+		return format.DataProfileBabashka
+	case "data_readers.clj", "data_readers.cljc":
+		return format.DataProfileDataReaders
+	}
+	return format.DataProfileNone
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/edn"
+)
+
+func init() {
+	subcommands["json2edn"] = subcommand{
+		desc: "convert JSON to EDN",
+		run:  json2ednMain,
+	}
+	subcommands["edn2json"] = subcommand{
+		desc: "convert EDN to JSON",
+		run:  edn2jsonMain,
+	}
+}
+
+// convertInput opens the single optional file argument of a conversion
+// subcommand, defaulting to standard input.
+func convertInput(fs *flag.FlagSet) (r io.ReadCloser, name string) {
+	switch fs.NArg() {
+	case 0:
+		return os.Stdin, "<stdin>"
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f, fs.Arg(0)
+	}
+	fs.Usage()
+	os.Exit(2)
+	panic("unreached")
+}
+
+func json2ednMain(args []string) {
+	fs := flag.NewFlagSet("json2edn", flag.ExitOnError)
+	var opts edn.JSONOptions
+	fs.BoolVar(&opts.KeywordizeKeys, "keywordize", false, "convert object keys to keywords")
+	fs.BoolVar(&opts.ParseTags, "tags", false,
+		"convert timestamp and UUID strings to #inst and #uuid values")
+	width := fs.Int("width", edn.DefaultWidth, "maximum line width")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s json2edn [flags] [file]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	r, _ := convertInput(fs)
+	defer r.Close()
+	if err := edn.JSONToEDN(os.Stdout, r, &opts, *width); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func edn2jsonMain(args []string) {
+	fs := flag.NewFlagSet("edn2json", flag.ExitOnError)
+	var opts edn.JSONOptions
+	fs.BoolVar(&opts.TaggedObjects, "tagged-objects", false,
+		`represent tagged values as {"tag": ..., "value": ...} objects`)
+	indent := fs.String("indent", "  ", "indentation string (empty for compact output)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s edn2json [flags] [file]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	r, name := convertInput(fs)
+	defer r.Close()
+	if err := edn.EDNToJSON(os.Stdout, r, name, &opts, *indent); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/docs"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["docs"] = subcommand{
+		desc: "extract API documentation as Markdown or JSON",
+		run:  docsMain,
+	}
+}
+
+func docsMain(args []string) {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	outFormat := fs.String("format", "markdown", "output format (markdown or json)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s docs [flags] paths...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var namespaces []*docs.Namespace
+	err := walkClojureFiles(fs.Args(), func(path string) error {
+		t, err := parse.File(path, 0)
+		if err != nil {
+			return err
+		}
+		if ns := docs.Extract(t); ns != nil {
+			namespaces = append(namespaces, ns)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch *outFormat {
+	case "markdown":
+		err = docs.WriteMarkdown(os.Stdout, namespaces)
+	case "json":
+		err = docs.WriteJSON(os.Stdout, namespaces)
+	default:
+		log.Fatalf("unknown output format %q", *outFormat)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
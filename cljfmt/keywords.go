@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["keywords"] = subcommand{
+		desc: "report the keywords used in Clojure code",
+		run:  keywordsMain,
+	}
+}
+
+type keywordJSON struct {
+	Keyword   string   `json:"keyword"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Count     int      `json:"count"`
+	Uses      []string `json:"uses"`
+}
+
+func keywordsMain(args []string) {
+	fs := flag.NewFlagSet("keywords", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the keywords as a JSON array")
+	typos := fs.Int("typos", 0,
+		"instead of every keyword, list the keywords within this many edits of a more common one")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s keywords [flags] paths...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var trees []*parse.Tree
+	err := walkClojureFiles(fs.Args(), func(path string) error {
+		t, err := parse.File(path, 0)
+		if err != nil {
+			return err
+		}
+		trees = append(trees, t)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	keywords := analysis.Keywords(trees)
+
+	if *typos > 0 {
+		for _, cluster := range analysis.KeywordTypos(keywords, *typos) {
+			common := cluster[0]
+			for _, k := range cluster[1:] {
+				for _, pos := range k.Uses {
+					fmt.Printf("%s: %s may be a typo of %s (used %d times)\n",
+						&pos, k, common, len(common.Uses))
+				}
+			}
+		}
+		return
+	}
+	if *asJSON {
+		out := []keywordJSON{}
+		for _, k := range keywords {
+			kj := keywordJSON{
+				Keyword:   k.String(),
+				Namespace: k.Namespace,
+				Name:      k.Name,
+				Count:     len(k.Uses),
+			}
+			for _, pos := range k.Uses {
+				kj.Uses = append(kj.Uses, pos.String())
+			}
+			out = append(out, kj)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for i, k := range keywords {
+		if i == 0 || k.Namespace != keywords[i-1].Namespace {
+			ns := k.Namespace
+			if ns == "" {
+				ns = "(unqualified)"
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Println(ns)
+		}
+		fmt.Printf("  %-30s %d\n", k, len(k.Uses))
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/lint"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["lint"] = subcommand{
+		desc: "report problems in Clojure code",
+		run:  lintMain,
+	}
+}
+
+type diagnosticJSON struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func lintMain(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `usage: %s lint [flags] paths...
+
+Each transform which is enabled (by the config file) is also a rule, which
+reports the forms that the transform would change. The rules are configured
+by the :lint map of the config file.
+
+Flags:
+`, os.Args[0])
+		fs.PrintDefaults()
+	}
+	var configFile pathFlag
+	if home, ok := os.LookupEnv("HOME"); ok {
+		configFile.p = filepath.Join(home, ".cljfmt")
+	}
+	fs.Var(&configFile, "c", "path to config file")
+	asJSON := fs.Bool("json", false, "print the diagnostics as a JSON array")
+	disable := fs.String("disable", "", "comma-separated IDs of rules to turn off")
+	baselineFile := fs.String("baseline", "",
+		"ignore the diagnostics recorded in this baseline file")
+	writeBaseline := fs.String("write-baseline", "",
+		"record the diagnostics in this baseline file instead of printing them")
+	fix := fs.Bool("fix", false,
+		"fix the problems which can be fixed automatically, rewriting the files, "+
+			"and report the rest")
+	aliasSummary := fs.Bool("aliases", false,
+		"print the aliases of the namespaces which are aliased inconsistently "+
+			"instead of the diagnostics")
+	onlyDiff := fs.Bool("diff", false,
+		"read a unified diff (such as the output of git diff) from stdin and "+
+			"only report problems, including unformatted code, in the top-level "+
+			"forms it changes (linting the changed files if no paths are given)")
+	generated := fs.Bool("generated", false,
+		"lint generated files (see :generated-marker) rather than skipping them")
+	fs.Parse(args)
+	paths := fs.Args()
+	var changed map[string][]lint.LineRange // for -diff
+	if *onlyDiff {
+		var err error
+		changed, err = readDiff(os.Stdin)
+		if err != nil {
+			log.Fatalf("error reading diff: %s", err)
+		}
+		if len(paths) == 0 {
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+		}
+	}
+	if len(paths) == 0 {
+		if *onlyDiff {
+			return
+		}
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conf := config{
+		transforms:        make(map[format.Transform]bool),
+		findProjectConfig: true,
+		generated:         *generated,
+	}
+	conf.parseDotConfigFile(configFile)
+	disabled := make(map[string]bool)
+	for _, id := range conf.lint.disabled {
+		disabled[id] = true
+	}
+	for _, id := range strings.Split(*disable, ",") {
+		disabled[strings.TrimSpace(id)] = true
+	}
+
+	// Find the vars and namespaces marked as deprecated throughout the
+	// project (in addition to those in the config file) and the aliases
+	// of each namespace.
+	deprecated := make(map[string]string)
+	for k, v := range conf.lint.deprecated {
+		deprecated[k] = v
+	}
+	aliases := lint.NewAliases()
+	err := walkClojureFiles(paths, func(path string) error {
+		t, err := parse.File(path, parse.IncludeNonSemantic)
+		if err != nil {
+			return err
+		}
+		lint.FindDeprecated(t, deprecated)
+		aliases.Add(t)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *aliasSummary {
+		printAliasSummary(aliases.Inconsistent(), *asJSON)
+		return
+	}
+
+	var diags []*lint.Diagnostic
+	trees := make(map[string]*parse.Tree) // for -fix
+	err = walkClojureFiles(paths, func(path string) error {
+		lines, ok := changed[filepath.Clean(path)]
+		if *onlyDiff && !ok {
+			return nil
+		}
+		t, err := parse.File(path, parse.IncludeNonSemantic)
+		if err != nil {
+			return err
+		}
+		if conf.skipGenerated(path, t.Source()) {
+			return nil
+		}
+		if *fix {
+			trees[path] = t
+		}
+		newPrinter := func(w io.Writer) *format.Printer {
+			p := format.NewPrinter(w)
+			conf.configure(p, path)
+			p.Dialect = goclj.DetectDialect(path, t)
+			return p
+		}
+		var rules []*lint.Rule
+		transforms := conf.transformsFor(path)
+		for _, tr := range format.AllTransforms() {
+			enabled, ok := transforms[tr]
+			if !ok {
+				enabled = format.DefaultTransforms[tr]
+			}
+			if enabled {
+				rules = append(rules, lint.TransformRule(tr, newPrinter))
+			}
+		}
+		rules = append(rules,
+			lint.ReflectionRule(conf.lint.reflectionNamespaces),
+			lint.DeprecatedRule(deprecated),
+			lint.AliasRule(aliases),
+			lint.FunctionLengthRule(conf.lint.maxLines),
+			lint.NestingDepthRule(conf.lint.maxDepth),
+			lint.ParamCountRule(conf.lint.maxParams),
+			lint.NilEqualityRule(),
+			lint.IfNotRule(),
+			lint.SingleBranchIfRule(),
+			lint.SeqTestRule(),
+			lint.DuplicateKeyRule(),
+			lint.MisplacedDocstringRule(),
+			lint.UnusedPrivateRule(),
+			lint.UnknownAliasRule(goclj.DetectDialect(path, t)),
+		)
+		if *onlyDiff {
+			rules = append(rules, lint.FormatRule(newPrinter))
+		}
+		rules = enabledRules(rules, disabled)
+		fileDiags := lint.Lint(t, rules)
+		if *onlyDiff {
+			fileDiags = lint.FilterChanged(t, fileDiags, lines)
+		}
+		diags = append(diags, fileDiags...)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *writeBaseline != "" {
+		f, err := os.Create(*writeBaseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := lint.NewBaseline(diags).Write(f); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *baselineFile != "" {
+		f, err := os.Open(*baselineFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := lint.ReadBaseline(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("error reading baseline %s: %s", *baselineFile, err)
+		}
+		diags = b.Filter(diags)
+	}
+	if *fix {
+		var err error
+		diags, err = applyFixes(&conf, trees, diags)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *asJSON {
+		out := []diagnosticJSON{}
+		for _, d := range diags {
+			out = append(out, diagnosticJSON{
+				File:    d.Pos.Name,
+				Line:    d.Pos.Line,
+				Col:     d.Pos.Col,
+				Rule:    d.Rule,
+				Message: d.Message,
+				Detail:  d.Detail,
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Println(d)
+			if d.Detail != "" {
+				lines := strings.Split(strings.TrimSuffix(d.Detail, "\n"), "\n")
+				fmt.Printf("\t%s\n", strings.Join(lines, "\n\t"))
+			}
+		}
+	}
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+}
+
+func printAliasSummary(summaries []lint.AliasSummary, asJSON bool) {
+	if asJSON {
+		if summaries == nil {
+			summaries = []lint.AliasSummary{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summaries); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, s := range summaries {
+		var aliases []string
+		for _, a := range s.Aliases {
+			aliases = append(aliases, fmt.Sprintf("%s (%d)", a.Alias, a.Count))
+		}
+		fmt.Printf("%s: %s\n", s.Namespace, strings.Join(aliases, ", "))
+	}
+}
+
+// applyFixes applies the fixes of diags to the trees of their files (keyed by
+// path), rewrites those files, and returns the diagnostics which have no fix.
+func applyFixes(conf *config, trees map[string]*parse.Tree, diags []*lint.Diagnostic) ([]*lint.Diagnostic, error) {
+	var rest []*lint.Diagnostic
+	fixed := make(map[string]bool)
+	var paths []string
+	for _, d := range diags {
+		if d.Fix == nil {
+			rest = append(rest, d)
+			continue
+		}
+		d.Fix()
+		if !fixed[d.Pos.Name] {
+			fixed[d.Pos.Name] = true
+			paths = append(paths, d.Pos.Name)
+		}
+	}
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		t := trees[path]
+		if err := conf.newPrinter(&buf, path, t).PrintTree(t); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, buf.Bytes(), stat.Mode().Perm()); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// readDiff reads a unified diff with lint.ParseDiff, keeping the Clojure
+// files which it changes (keyed by cleaned paths).
+func readDiff(r io.Reader) (map[string][]lint.LineRange, error) {
+	files, err := lint.ParseDiff(r)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string][]lint.LineRange)
+	for name, lines := range files {
+		if isClojureFile(filepath.Base(name)) {
+			changed[filepath.Clean(name)] = lines
+		}
+	}
+	return changed, nil
+}
+
+// enabledRules returns the rules whose IDs are not disabled.
+func enabledRules(rules []*lint.Rule, disabled map[string]bool) []*lint.Rule {
+	var result []*lint.Rule
+	for _, r := range rules {
+		if !disabled[r.ID] {
+			result = append(result, r)
+		}
+	}
+	return result
+}
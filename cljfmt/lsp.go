@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cespare/goclj/index"
+	"github.com/cespare/goclj/lsp"
+)
+
+func init() {
+	subcommands["lsp"] = subcommand{
+		desc: "run a language server on stdin and stdout",
+		run:  lspMain,
+	}
+}
+
+func lspMain(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s lsp [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	verbose := fs.Bool("v", false, "log problems (such as files which can't be parsed) to stderr")
+	noCache := fs.Bool("nocache", false, "don't cache the index of the project on disk")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	s := lsp.New()
+	if *verbose {
+		s.Log = log.New(os.Stderr, "lsp: ", log.LstdFlags)
+	}
+	if !*noCache {
+		s.Cache = openIndexCache(s.Log)
+	}
+	if err := s.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// indexCacheMaxAge is how long an entry of the index cache is kept after it
+// was last used.
+const indexCacheMaxAge = 30 * 24 * time.Hour
+
+// openIndexCache opens the index cache in the default directory and prunes
+// its old entries. If the cache can't be opened, it logs why (to l, if
+// non-nil) and returns nil, since the server works without it.
+func openIndexCache(l *log.Logger) *index.Cache {
+	logf := func(format string, args ...interface{}) {
+		if l != nil {
+			l.Printf(format, args...)
+		}
+	}
+	dir, err := index.DefaultCacheDir()
+	if err != nil {
+		logf("not caching the index: %s", err)
+		return nil
+	}
+	c, err := index.OpenCache(dir)
+	if err != nil {
+		logf("not caching the index: %s", err)
+		return nil
+	}
+	if err := c.Prune(indexCacheMaxAge); err != nil {
+		logf("error pruning the index cache: %s", err)
+	}
+	return c
+}
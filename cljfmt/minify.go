@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["minify"] = subcommand{
+		desc: "strip comments and whitespace from Clojure code",
+		run:  minifyMain,
+	}
+}
+
+func minifyMain(args []string) {
+	fs := flag.NewFlagSet("minify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s minify [file]\n", os.Args[0])
+	}
+	fs.Parse(args)
+	r, name := convertInput(fs)
+	defer r.Close()
+	t, err := parse.Reader(r, name, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := format.Minify(os.Stdout, t); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/server"
+)
+
+func init() {
+	subcommands["serve"] = subcommand{
+		desc: "run an HTTP formatting service",
+		run:  serveMain,
+	}
+}
+
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s serve [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	var configFile pathFlag
+	if home, ok := os.LookupEnv("HOME"); ok {
+		configFile.p = filepath.Join(home, ".cljfmt")
+	}
+	fs.Var(&configFile, "c", "path to config file")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxBytes := fs.Int64("max-request-bytes", server.DefaultMaxRequestBytes,
+		"maximum size of a request body")
+	maxConcurrent := fs.Int("max-concurrent", server.DefaultMaxConcurrent,
+		"maximum number of requests to process at once")
+	budget := fs.Int64("memory-budget", server.DefaultMemoryBudget,
+		"approximate memory available to each request")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conf := config{transforms: make(map[format.Transform]bool)}
+	conf.parseDotConfigFile(configFile)
+	s := server.New()
+	s.MaxRequestBytes = *maxBytes
+	s.MaxConcurrent = *maxConcurrent
+	s.MemoryBudget = *budget
+	s.Configure = conf.configure
+
+	hs := &http.Server{
+		Addr:         *addr,
+		Handler:      s,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: time.Minute,
+	}
+	log.Printf("listening on %s", *addr)
+	log.Fatal(hs.ListenAndServe())
+}
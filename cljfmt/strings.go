@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["strings"] = subcommand{
+		desc: "extract string literals for translation",
+		run:  stringsMain,
+	}
+}
+
+type stringJSON struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Function string `json:"function,omitempty"`
+	Context  string `json:"context,omitempty"`
+	Text     string `json:"text"`
+}
+
+func stringsMain(args []string) {
+	fs := flag.NewFlagSet("strings", flag.ExitOnError)
+	outFormat := fs.String("format", "text", "output format (text, json, or po)")
+	wrappers := fs.String("wrappers", "",
+		"comma-separated functions (such as tr,app.i18n/tr) whose string arguments are extracted; "+
+			"by default, every string is")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s strings [flags] paths...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var names []string
+	if *wrappers != "" {
+		names = strings.Split(*wrappers, ",")
+	}
+
+	strs := []stringJSON{}
+	err := walkClojureFiles(fs.Args(), func(path string) error {
+		t, err := parse.File(path, 0)
+		if err != nil {
+			return err
+		}
+		for _, s := range analysis.Strings(t, names...) {
+			strs = append(strs, stringJSON{
+				File:     path,
+				Line:     s.Pos.Line,
+				Col:      s.Pos.Col,
+				Function: s.Function,
+				Context:  s.Context,
+				Text:     s.Text,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch *outFormat {
+	case "text":
+		for _, s := range strs {
+			fmt.Printf("%s:%d:%d: %q\n", s.File, s.Line, s.Col, s.Text)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(strs)
+	case "po":
+		writePO(strs)
+	default:
+		log.Fatalf("unknown output format %q", *outFormat)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writePO prints strs as a gettext PO template, with one entry for each
+// distinct string (in order of first use) listing where it is used.
+func writePO(strs []stringJSON) {
+	fmt.Println(`msgid ""`)
+	fmt.Println(`msgstr ""`)
+	fmt.Println(`"Content-Type: text/plain; charset=UTF-8\n"`)
+	refs := make(map[string][]string)
+	var texts []string
+	for _, s := range strs {
+		if _, ok := refs[s.Text]; !ok {
+			texts = append(texts, s.Text)
+		}
+		refs[s.Text] = append(refs[s.Text], fmt.Sprintf("%s:%d", s.File, s.Line))
+	}
+	for _, text := range texts {
+		fmt.Println()
+		fmt.Printf("#: %s\n", strings.Join(refs[text], " "))
+		fmt.Printf("msgid %s\n", poQuote(text))
+		fmt.Println(`msgstr ""`)
+	}
+}
+
+// poQuote quotes s as a PO string.
+func poQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A subcommand is an alternative mode of cljfmt, selected by the first
+// command-line argument (for example, cljfmt docs src).
+type subcommand struct {
+	desc string
+	run  func(args []string)
+}
+
+var subcommands = map[string]subcommand{}
+
+func subcommandUsage() string {
+	var names []string
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("  %-10s %s", name, subcommands[name].desc))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var clojureExts = []string{".clj", ".cljs", ".cljc", ".edn", ".bb"}
+
+func isClojureFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, ext := range clojureExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkClojureFiles calls fn for each Clojure file named by paths. Directories
+// are walked recursively; as in the go tool, dir/... (or ...) may be written
+// for the directory dir (or the current directory).
+func walkClojureFiles(paths []string, fn func(path string) error) error {
+	for _, path := range paths {
+		if path == "..." {
+			path = "."
+		} else if strings.HasSuffix(path, "/...") {
+			path = strings.TrimSuffix(path, "/...")
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !stat.IsDir() {
+			if err := fn(path); err != nil {
+				return err
+			}
+			continue
+		}
+		walk := func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if f.IsDir() || !isClojureFile(f.Name()) {
+				return nil
+			}
+			return fn(path)
+		}
+		if err := filepath.Walk(path, walk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+func init() {
+	subcommands["todos"] = subcommand{
+		desc: "list TODO, FIXME, and HACK comments",
+		run:  todosMain,
+	}
+}
+
+type todoJSON struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Tag     string `json:"tag"`
+	Context string `json:"context,omitempty"`
+	Text    string `json:"text"`
+}
+
+func todosMain(args []string) {
+	fs := flag.NewFlagSet("todos", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the comments as a JSON array")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s todos [flags] paths...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	todos := []todoJSON{}
+	err := walkClojureFiles(fs.Args(), func(path string) error {
+		t, err := parse.File(path, parse.IncludeNonSemantic)
+		if err != nil {
+			return err
+		}
+		for _, todo := range analysis.Todos(t) {
+			if !*asJSON {
+				context := ""
+				if todo.Context != "" {
+					context = " (in " + todo.Context + ")"
+				}
+				fmt.Printf("%s: %s%s: %s\n", &todo.Pos, todo.Tag, context, todo.Text)
+				continue
+			}
+			todos = append(todos, todoJSON{
+				File:    path,
+				Line:    todo.Pos.Line,
+				Col:     todo.Pos.Col,
+				Tag:     todo.Tag,
+				Context: todo.Context,
+				Text:    todo.Text,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(todos); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
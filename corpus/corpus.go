@@ -0,0 +1,147 @@
+package corpus
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// Exts are the extensions of the files checked by CheckDir.
+var Exts = []string{".clj", ".cljs", ".cljc", ".edn"}
+
+// A Failure records a file which did not survive formatting.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+func (f Failure) Error() string { return f.Path + ": " + f.Err.Error() }
+
+// Check formats src and verifies that:
+//
+//   - the formatted output parses;
+//   - it contains the same forms and comments as the (transformed) input,
+//     ignoring whitespace (including trailing whitespace in comments,
+//     which the printer removes) and the indentation of continuation
+//     lines in strings, which the printer adjusts for docstrings; and
+//   - formatting the output again leaves it unchanged.
+//
+// If config is non-nil, it is called to configure each Printer used.
+func Check(name string, src []byte, config func(*format.Printer)) error {
+	t, err := parse.Reader(bytes.NewReader(src), name, parse.IncludeNonSemantic)
+	if err != nil {
+		return fmt.Errorf("cannot parse input: %s", err)
+	}
+	out, err := print(t, config)
+	if err != nil {
+		return fmt.Errorf("cannot format input: %s", err)
+	}
+	t2, err := parse.Reader(bytes.NewReader(out), name, parse.IncludeNonSemantic)
+	if err != nil {
+		return fmt.Errorf("cannot parse formatted output: %s", err)
+	}
+	// The printer applies its transforms to t in place, so t is what
+	// the output should contain.
+	if want, got := Forms(t.Roots), Forms(t2.Roots); got != want {
+		return fmt.Errorf("formatted output has different forms: %s", diffLine(got, want))
+	}
+	out2, err := print(t2, config)
+	if err != nil {
+		return fmt.Errorf("cannot format output: %s", err)
+	}
+	if !bytes.Equal(out, out2) {
+		return fmt.Errorf("formatting is not idempotent: %s", diffLine(string(out2), string(out)))
+	}
+	return nil
+}
+
+func print(t *parse.Tree, config func(*format.Printer)) ([]byte, error) {
+	var buf bytes.Buffer
+	p := format.NewPrinter(&buf)
+	if config != nil {
+		config(p)
+	}
+	if err := p.PrintTree(t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckDir runs Check on every file under dir with one of the Exts. It returns
+// a Failure for each file that doesn't pass.
+func CheckDir(dir string, config func(*format.Printer)) ([]Failure, error) {
+	var failures []Failure
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !hasExt(path) {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := Check(path, src, config); err != nil {
+			failures = append(failures, Failure{path, err})
+		}
+		return nil
+	})
+	return failures, err
+}
+
+func hasExt(path string) bool {
+	for _, ext := range Exts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forms gives a line-per-node representation of the structure of nodes,
+// ignoring positions and newlines.
+func Forms(nodes []parse.Node) string {
+	var b strings.Builder
+	writeForms(&b, nodes, 0)
+	return b.String()
+}
+
+var stringIndent = regexp.MustCompile(`\n[ \t]*`)
+
+func writeForms(b *strings.Builder, nodes []parse.Node, depth int) {
+	for _, n := range nodes {
+		desc := n.String()
+		switch n := n.(type) {
+		case *parse.NewlineNode:
+			continue
+		case *parse.StringNode:
+			desc = fmt.Sprintf("string(%q)", stringIndent.ReplaceAllString(n.Val, "\n"))
+		case *parse.CommentNode:
+			desc = fmt.Sprintf("comment(%q)", strings.TrimRight(n.Text, " \t"))
+		}
+		b.WriteString(strings.Repeat(" ", depth))
+		b.WriteString(desc)
+		b.WriteByte('\n')
+		writeForms(b, n.Children(), depth+1)
+	}
+}
+
+// diffLine describes the first line at which got and want differ.
+func diffLine(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("line %d: got %q; want %q", i+1, gotLines[i], wantLines[i])
+		}
+	}
+	return fmt.Sprintf("got %d lines; want %d", len(gotLines), len(wantLines))
+}
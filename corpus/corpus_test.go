@@ -0,0 +1,71 @@
+package corpus
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+)
+
+var (
+	corpusDir   = flag.String("corpus", "", "check the Clojure files in this directory")
+	corpusFetch = flag.Bool("corpus.fetch", false, "download DefaultRepos into the -corpus directory first")
+)
+
+func TestFixtures(t *testing.T) {
+	failures, err := CheckDir("../format/testdata", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+}
+
+func TestCheckAllTransforms(t *testing.T) {
+	all := func(p *format.Printer) {
+		p.Transforms = map[format.Transform]bool{
+			format.TransformUseToRequire:         true,
+			format.TransformRemoveUnusedRequires: true,
+			format.TransformFormatSchemas:        true,
+		}
+	}
+	failures, err := CheckDir("../format/testdata", all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+}
+
+func TestCheckDetectsChanges(t *testing.T) {
+	// The docstring's continuation line is re-indented, which is allowed.
+	src := "(defn f\n  \"Doc\n    more.\"\n  [x]\n  x)\n"
+	if err := Check("ok.clj", []byte(src), nil); err != nil {
+		t.Errorf("Check: unexpected error: %s", err)
+	}
+	err := Check("bad.clj", []byte("(defn f [x]\n  x"), nil)
+	if err == nil || !strings.Contains(err.Error(), "cannot parse input") {
+		t.Errorf("Check with bad input: got error %v", err)
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	if *corpusDir == "" {
+		t.Skip("no -corpus directory given")
+	}
+	if *corpusFetch {
+		if err := Fetch(*corpusDir, DefaultRepos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failures, err := CheckDir(*corpusDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		t.Error(f)
+	}
+}
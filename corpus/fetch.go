@@ -0,0 +1,102 @@
+package corpus
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A Repo is a GitHub repository at a particular ref (a tag or commit).
+type Repo struct {
+	Owner string
+	Name  string
+	Ref   string
+}
+
+func (r Repo) String() string { return r.Owner + "/" + r.Name + "@" + r.Ref }
+
+// DefaultRepos are well-known open-source Clojure projects, pinned to
+// releases so that results are reproducible.
+var DefaultRepos = []Repo{
+	{"clojure", "clojure", "clojure-1.10.1"},
+	{"ring-clojure", "ring", "1.8.0"},
+	{"weavejester", "compojure", "1.6.1"},
+	{"weavejester", "medley", "1.3.0"},
+	{"dakrone", "cheshire", "5.10.0"},
+}
+
+// Fetch downloads each repo from GitHub and extracts its Clojure files (as
+// selected by Exts) into dir/owner/name. Repos which have already been
+// fetched are skipped.
+func Fetch(dir string, repos []Repo) error {
+	for _, repo := range repos {
+		dst := filepath.Join(dir, repo.Owner, repo.Name)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		if err := fetch(dst, repo); err != nil {
+			os.RemoveAll(dst)
+			return fmt.Errorf("fetching %s: %s", repo, err)
+		}
+	}
+	return nil
+}
+
+func fetch(dst string, repo Repo) error {
+	url := fmt.Sprintf("https://github.com/%s/%s/archive/%s.tar.gz", repo.Owner, repo.Name, repo.Ref)
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg || !hasExt(hdr.Name) {
+			continue
+		}
+		// Strip the top-level directory (name-ref/) from the archive.
+		name := path.Clean(hdr.Name)
+		i := strings.IndexByte(name, '/')
+		if i < 0 || strings.HasPrefix(name[i+1:], "../") {
+			continue
+		}
+		if err := extract(filepath.Join(dst, filepath.FromSlash(name[i+1:])), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extract(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
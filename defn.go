@@ -0,0 +1,71 @@
+package goclj
+
+import "github.com/cespare/goclj/parse"
+
+// A Defn describes the parts of a function definition, such as
+//
+//	(defn name doc-string? attr-map? [params*] body)
+//	(defn name doc-string? attr-map? ([params*] body)+ attr-map?)
+//
+// Each part is given as the index of its node in the form's Children(), or
+// -1 if the form doesn't have that part. The name and params may be preceded
+// by metadata nodes (such as ^:private or a ^String type hint).
+type Defn struct {
+	Name      int
+	Docstring int
+	AttrMap   int
+	Params    int   // the params of a single-arity definition
+	Arities   []int // the bodies of a multi-arity definition
+}
+
+// ParseDefn parses the parts of a function definition form (defn, defn-,
+// defmacro, and the like), without regard to its head symbol. It reports
+// whether node has the shape of a function definition.
+func ParseDefn(node parse.Node) (d Defn, ok bool) {
+	d = Defn{Name: -1, Docstring: -1, AttrMap: -1, Params: -1}
+	nodes := node.Children()
+	var idx []int
+	for i, n := range nodes {
+		if i == 0 || !Semantic(n) {
+			continue
+		}
+		idx = append(idx, i)
+	}
+	if len(idx) == 0 || !Symbol(nodes[idx[0]]) {
+		return d, false
+	}
+	d.Name, idx = idx[0], idx[1:]
+	if len(idx) > 1 {
+		if _, ok := nodes[idx[0]].(*parse.StringNode); ok {
+			d.Docstring, idx = idx[0], idx[1:]
+		}
+	}
+	if len(idx) > 1 {
+		if _, ok := nodes[idx[0]].(*parse.MapNode); ok {
+			d.AttrMap, idx = idx[0], idx[1:]
+		}
+	}
+	if len(idx) == 0 {
+		return d, false
+	}
+	switch nodes[idx[0]].(type) {
+	case *parse.VectorNode:
+		d.Params = idx[0]
+		return d, true
+	case *parse.ListNode:
+		for i, j := range idx {
+			switch nodes[j].(type) {
+			case *parse.ListNode:
+				d.Arities = append(d.Arities, j)
+			case *parse.MapNode:
+				if i < len(idx)-1 {
+					return d, false
+				}
+			default:
+				return d, false
+			}
+		}
+		return d, true
+	}
+	return d, false
+}
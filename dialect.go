@@ -0,0 +1,103 @@
+package goclj
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A Dialect is a Clojure variant or environment whose files follow their own
+// conventions.
+type Dialect int
+
+const (
+	DialectClojure Dialect = iota
+	// DialectBabashka is for babashka scripts and bb.edn task files.
+	DialectBabashka
+)
+
+// DetectDialect guesses the dialect of a file from its name and contents:
+// bb.edn, *.bb, and files beginning with a #! line that runs bb are
+// babashka files.
+func DetectDialect(name string, t *parse.Tree) Dialect {
+	base := filepath.Base(name)
+	if base == "bb.edn" || strings.HasSuffix(base, ".bb") {
+		return DialectBabashka
+	}
+	if len(t.Roots) > 0 {
+		if c, ok := t.Roots[0].(*parse.CommentNode); ok && strings.HasPrefix(c.Text, "#!") {
+			for _, field := range strings.Fields(c.Text[2:]) {
+				if filepath.Base(field) == "bb" {
+					return DialectBabashka
+				}
+			}
+		}
+	}
+	return DialectClojure
+}
+
+// BabashkaAliases are the aliases that babashka scripts can use without
+// requiring the namespace.
+var BabashkaAliases = map[string]string{
+	"async":     "clojure.core.async",
+	"csv":       "clojure.data.csv",
+	"edn":       "clojure.edn",
+	"io":        "clojure.java.io",
+	"json":      "cheshire.core",
+	"set":       "clojure.set",
+	"shell":     "clojure.java.shell",
+	"str":       "clojure.string",
+	"tools.cli": "clojure.tools.cli",
+	"transit":   "cognitect.transit",
+	"yaml":      "clj-yaml.core",
+}
+
+// BabashkaNamespaces lists the namespaces (other than those of Clojure
+// itself) that are built into babashka.
+var BabashkaNamespaces = []string{
+	"babashka.classpath",
+	"babashka.cli",
+	"babashka.curl",
+	"babashka.deps",
+	"babashka.fs",
+	"babashka.http-client",
+	"babashka.pods",
+	"babashka.process",
+	"babashka.tasks",
+	"babashka.wait",
+	"bencode.core",
+	"cheshire.core",
+	"clj-yaml.core",
+	"clojure.core.async",
+	"clojure.data.csv",
+	"clojure.data.xml",
+	"clojure.tools.cli",
+	"cognitect.transit",
+	"hiccup.core",
+	"org.httpkit.client",
+	"org.httpkit.server",
+	"selmer.parser",
+	"taoensso.timbre",
+}
+
+// Builtin reports whether the namespace ns is available in d without any
+// dependencies.
+func (d Dialect) Builtin(ns string) bool {
+	if strings.HasPrefix(ns, "clojure.") && !strings.HasPrefix(ns, "clojure.core.") &&
+		!strings.HasPrefix(ns, "clojure.data.") && !strings.HasPrefix(ns, "clojure.tools.") {
+		return true
+	}
+	if ns == "clojure.core.protocols" || ns == "clojure.core.reducers" {
+		return true
+	}
+	if d != DialectBabashka {
+		return false
+	}
+	for _, builtin := range BabashkaNamespaces {
+		if ns == builtin {
+			return true
+		}
+	}
+	return false
+}
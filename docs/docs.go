@@ -0,0 +1,298 @@
+package docs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Namespace is the documentation extracted from a single ns.
+type Namespace struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Doc  string `json:"doc,omitempty"`
+	Vars []*Var `json:"vars"`
+}
+
+// A Var is the documentation for a single public var.
+type Var struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"` // the defining form; e.g., "defn"
+	Line     int      `json:"line"`
+	Arglists []string `json:"arglists,omitempty"`
+	Doc      string   `json:"doc,omitempty"`
+}
+
+// defForms are the defining forms that produce documented vars.
+var defForms = []string{
+	"def",
+	"definterface",
+	"defmacro",
+	"defmulti",
+	"defn",
+	"defonce",
+	"defprotocol",
+	"defrecord",
+	"deftype",
+}
+
+// Extract extracts the namespace documentation from t. The vars are listed in
+// source order. If t has no ns form, Extract returns nil.
+func Extract(t *parse.Tree) *Namespace {
+	var ns *Namespace
+	for _, root := range t.Roots {
+		if ns == nil {
+			if goclj.FnFormSymbol(root, "ns") {
+				ns = &Namespace{File: root.Position().Name}
+				ns.Name, ns.Doc, _ = nameAndDoc(root)
+			}
+			continue
+		}
+		if !goclj.FnFormSymbol(root, defForms...) {
+			continue
+		}
+		if v := extractVar(root); v != nil {
+			ns.Vars = append(ns.Vars, v)
+		}
+	}
+	return ns
+}
+
+func extractVar(form parse.Node) *Var {
+	kind := form.Children()[0].(*parse.SymbolNode).Val
+	name, doc, rest := nameAndDoc(form)
+	if name == "" {
+		return nil
+	}
+	v := &Var{
+		Name: name,
+		Kind: kind,
+		Line: form.Position().Line,
+		Doc:  doc,
+	}
+	switch kind {
+	case "def", "defonce":
+		// A def only has a docstring if it also has a value.
+		if len(rest) == 0 {
+			v.Doc = ""
+		}
+	case "defn", "defmacro":
+		v.Arglists = arglists(rest)
+	}
+	return v
+}
+
+// nameAndDoc returns the name and docstring of a def-like form, along with
+// the semantic nodes following them. If the var is private, the name is
+// empty.
+func nameAndDoc(form parse.Node) (name, doc string, rest []parse.Node) {
+	nodes, _ := parse.SemanticChildren(form)
+	nodes = nodes[1:]
+	private := false
+	for len(nodes) > 0 {
+		m, ok := nodes[0].(*parse.MetadataNode)
+		if !ok {
+			break
+		}
+		if isPrivateMeta(m.Node) {
+			private = true
+		}
+		if s, ok := metaDoc(m.Node); ok {
+			doc = s
+		}
+		nodes = nodes[1:]
+	}
+	if len(nodes) == 0 {
+		return "", "", nil
+	}
+	sym, ok := nodes[0].(*parse.SymbolNode)
+	if !ok || private {
+		return "", "", nil
+	}
+	nodes = nodes[1:]
+	if len(nodes) > 0 {
+		if s, ok := nodes[0].(*parse.StringNode); ok {
+			doc = unescape(s.Val)
+			nodes = nodes[1:]
+		}
+	}
+	return sym.Val, doc, nodes
+}
+
+func isPrivateMeta(n parse.Node) bool {
+	switch n := n.(type) {
+	case *parse.KeywordNode:
+		return n.Val == ":private"
+	case *parse.MapNode:
+		nodes, _ := parse.SemanticChildren(n)
+		for i := 0; i+1 < len(nodes); i += 2 {
+			k, ok := nodes[i].(*parse.KeywordNode)
+			if !ok || k.Val != ":private" {
+				continue
+			}
+			b, ok := nodes[i+1].(*parse.BoolNode)
+			return ok && b.Val
+		}
+	}
+	return false
+}
+
+func metaDoc(n parse.Node) (string, bool) {
+	m, ok := n.(*parse.MapNode)
+	if !ok {
+		return "", false
+	}
+	nodes, _ := parse.SemanticChildren(m)
+	for i := 0; i+1 < len(nodes); i += 2 {
+		k, ok := nodes[i].(*parse.KeywordNode)
+		if !ok || k.Val != ":doc" {
+			continue
+		}
+		if s, ok := nodes[i+1].(*parse.StringNode); ok {
+			return unescape(s.Val), true
+		}
+	}
+	return "", false
+}
+
+// arglists finds the arglists of a defn-like form given the nodes after the
+// name and docstring.
+func arglists(nodes []parse.Node) []string {
+	if len(nodes) > 0 {
+		if _, ok := nodes[0].(*parse.MapNode); ok {
+			nodes = nodes[1:] // attr-map
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	if v, ok := nodes[0].(*parse.VectorNode); ok {
+		return []string{render(v)}
+	}
+	var lists []string
+	for _, n := range nodes {
+		l, ok := n.(*parse.ListNode)
+		if !ok {
+			break
+		}
+		body, _ := parse.SemanticChildren(l)
+		if len(body) == 0 {
+			break
+		}
+		v, ok := body[0].(*parse.VectorNode)
+		if !ok {
+			break
+		}
+		lists = append(lists, render(v))
+	}
+	return lists
+}
+
+// render gives a compact, single-line representation of n.
+func render(n parse.Node) string {
+	switch n := n.(type) {
+	case *parse.VectorNode:
+		return "[" + renderSeq(n) + "]"
+	case *parse.ListNode:
+		return "(" + renderSeq(n) + ")"
+	case *parse.MapNode:
+		return "{" + renderSeq(n) + "}"
+	case *parse.NamespacedMapNode:
+		return "#" + n.Namespace + "{" + renderSeq(n) + "}"
+	case *parse.SetNode:
+		return "#{" + renderSeq(n) + "}"
+	case *parse.MetadataNode:
+		return "^" + render(n.Node)
+	case *parse.SymbolNode:
+		return n.Val
+	case *parse.KeywordNode:
+		return n.Val
+	case *parse.NumberNode:
+		return n.Val
+	case *parse.StringNode:
+		return `"` + n.Val + `"`
+	case *parse.NilNode:
+		return "nil"
+	case *parse.BoolNode:
+		return n.String()
+	case *parse.CharacterNode:
+		return n.Text
+	}
+	return "..."
+}
+
+func renderSeq(n parse.Node) string {
+	nodes, _ := parse.SemanticChildren(n)
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, render(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+// unescape interprets the escapes in a raw string literal and removes the
+// common leading indentation from lines after the first.
+func unescape(raw string) string {
+	s, err := strconv.Unquote(`"` + raw + `"`)
+	if err != nil {
+		s = raw
+	}
+	lines := strings.Split(s, "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// WriteJSON writes namespaces to w as a JSON array.
+func WriteJSON(w io.Writer, namespaces []*Namespace) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(namespaces)
+}
+
+// WriteMarkdown writes namespaces to w as a Markdown document.
+func WriteMarkdown(w io.Writer, namespaces []*Namespace) error {
+	bw := bufio.NewWriter(w)
+	for i, ns := range namespaces {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "# %s\n", ns.Name)
+		if ns.Doc != "" {
+			fmt.Fprintf(bw, "\n%s\n", ns.Doc)
+		}
+		for _, v := range ns.Vars {
+			fmt.Fprintf(bw, "\n## `%s`\n\n", v.Name)
+			if len(v.Arglists) > 0 {
+				for _, args := range v.Arglists {
+					fmt.Fprintf(bw, "    (%s %s)\n", v.Name, args)
+				}
+			} else {
+				fmt.Fprintf(bw, "*%s*\n", v.Kind)
+			}
+			if v.Doc != "" {
+				fmt.Fprintf(bw, "\n%s\n", v.Doc)
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,56 @@
+package docs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+const testNS = `(ns foo.bar
+  "Frobs things.
+  Second line.")
+
+(defn frob
+  "Frob x."
+  [x] x)
+
+(defn- priv [] 1)
+
+(def ^:private also-priv 2)
+
+(def no-doc "not a docstring")
+
+(def answer "The answer." 42)
+
+(defmacro m
+  {:added "1.0"}
+  ([a] a)
+  ([a b] (list a b)))
+`
+
+func TestExtract(t *testing.T) {
+	tree, err := parse.Reader(strings.NewReader(testNS), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Extract(tree)
+	want := &Namespace{
+		Name: "foo.bar",
+		File: "temp",
+		Doc:  "Frobs things.\nSecond line.",
+		Vars: []*Var{
+			{Name: "frob", Kind: "defn", Line: 5, Arglists: []string{"[x]"}, Doc: "Frob x."},
+			{Name: "no-doc", Kind: "def", Line: 13},
+			{Name: "answer", Kind: "def", Line: 15, Doc: "The answer."},
+			{Name: "m", Kind: "defmacro", Line: 17, Arglists: []string{"[a]", "[a b]"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+		for i := range got.Vars {
+			t.Logf("var %d: %+v", i, got.Vars[i])
+		}
+	}
+}
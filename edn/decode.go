@@ -0,0 +1,200 @@
+package edn
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A List is a decoded EDN list.
+type List []interface{}
+
+// A Set is a decoded EDN set. The elements are in source order.
+type Set []interface{}
+
+// A Char is an EDN character literal.
+type Char rune
+
+// Decode parses r and decodes each top-level EDN value it contains.
+func Decode(r io.Reader, name string) ([]interface{}, error) {
+	t, err := parse.Reader(r, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return FromNodes(t.Roots)
+}
+
+// FromNodes decodes a sequence of EDN forms. The decoded types are:
+//
+//   - nil, bool, and string for nil, booleans, and strings
+//   - int64 and float64 for numbers, or *big.Int (for N-suffixed or
+//     overflowing integers), *big.Float (for M-suffixed decimals), and
+//     *big.Rat (for ratios)
+//   - Char, Keyword, and Symbol
+//   - []interface{}, List, and Set for vectors, lists, and sets
+//   - map[interface{}]interface{} for maps
+//   - time.Time for #inst values and Tagged for other tagged values
+//
+// A map whose keys are not valid Go map keys (for instance, vectors) causes an
+// error. Comments, newlines, and #_ forms are ignored.
+func FromNodes(nodes []parse.Node) ([]interface{}, error) {
+	var values []interface{}
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch n := n.(type) {
+		case *parse.NewlineNode, *parse.CommentNode, *parse.ReaderDiscardNode:
+			continue
+		case *parse.TagNode:
+			j := i + 1
+			for j < len(nodes) && (goclj.Newline(nodes[j]) || goclj.Comment(nodes[j])) {
+				j++
+			}
+			if j == len(nodes) {
+				return nil, fmt.Errorf("%s: tag #%s is not followed by a value", n.Position(), n.Val)
+			}
+			inner, err := FromNodes(nodes[j : j+1])
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeTagged(n, inner[0])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			i = j
+			continue
+		case *parse.MetadataNode:
+			// Skip the metadata; it annotates the next value.
+			continue
+		}
+		v, err := fromNode(n)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func fromNode(n parse.Node) (interface{}, error) {
+	switch n := n.(type) {
+	case *parse.NilNode:
+		return nil, nil
+	case *parse.BoolNode:
+		return n.Val, nil
+	case *parse.StringNode:
+		return parse.Unescape(n.Val)
+	case *parse.CharacterNode:
+		return Char(n.Val), nil
+	case *parse.KeywordNode:
+		return Keyword(strings.TrimPrefix(n.Val, ":")), nil
+	case *parse.SymbolNode:
+		return Symbol(n.Val), nil
+	case *parse.NumberNode:
+		v, err := parseNumber(n.Val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", n.Position(), err)
+		}
+		return v, nil
+	case *parse.VectorNode:
+		vals, err := FromNodes(n.Nodes)
+		if vals == nil && err == nil {
+			vals = []interface{}{}
+		}
+		return vals, err
+	case *parse.ListNode:
+		vals, err := FromNodes(n.Nodes)
+		return List(vals), err
+	case *parse.SetNode:
+		vals, err := FromNodes(n.Nodes)
+		return Set(vals), err
+	case *parse.MapNode:
+		vals, err := FromNodes(n.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		if len(vals)%2 != 0 {
+			return nil, fmt.Errorf("%s: map literal has an odd number of forms", n.Position())
+		}
+		m := make(map[interface{}]interface{}, len(vals)/2)
+		for i := 0; i < len(vals); i += 2 {
+			k := vals[i]
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, fmt.Errorf("%s: unsupported map key type %T", n.Position(), k)
+			}
+			m[k] = vals[i+1]
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported EDN form (%s)", n.Position(), n)
+}
+
+func decodeTagged(tag *parse.TagNode, v interface{}) (interface{}, error) {
+	if tag.Val == "inst" {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: #inst value must be a string", tag.Position())
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad #inst value: %s", tag.Position(), err)
+		}
+		return t, nil
+	}
+	return Tagged{Tag: tag.Val, Value: v}, nil
+}
+
+// parseNumber parses a Clojure numeric literal.
+func parseNumber(s string) (interface{}, error) {
+	switch {
+	case strings.HasSuffix(s, "N"):
+		n, ok := new(big.Int).SetString(s[:len(s)-1], 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return n, nil
+	case strings.HasSuffix(s, "M"):
+		f, ok := new(big.Float).SetString(s[:len(s)-1])
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return f, nil
+	case strings.Contains(s, "/"):
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return r, nil
+	}
+	if i := strings.IndexAny(s, "rR"); i > 0 {
+		base, err := strconv.Atoi(strings.TrimLeft(s[:i], "+-"))
+		if err == nil {
+			n, err := strconv.ParseInt(s[i+1:], base, 64)
+			if err == nil {
+				if strings.HasPrefix(s, "-") {
+					n = -n
+				}
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n, nil
+	}
+	if n, ok := new(big.Int).SetString(s, 0); ok {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
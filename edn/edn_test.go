@@ -0,0 +1,201 @@
+package edn
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespare/goclj/parse"
+)
+
+type server struct {
+	Name     string
+	HostPort string `edn:"addr"`
+	Tags     []Keyword
+	Limits   map[string]int
+	Started  time.Time
+	Backup   *server `edn:",omitempty"`
+	internal int
+}
+
+func TestPprint(t *testing.T) {
+	v := server{
+		Name:     "alpha \"one\"",
+		HostPort: "localhost:8080",
+		Tags:     []Keyword{"a", "b"},
+		Limits:   map[string]int{"requests": 100, "conns": 10},
+		Started:  time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	for _, tc := range []struct {
+		width int
+		want  string
+	}{
+		{
+			200,
+			`{:name "alpha \"one\"" :addr "localhost:8080" :tags [:a :b] :limits {"conns" 10 "requests" 100} :started #inst "2017-01-02T03:04:05Z"}` + "\n",
+		},
+		{
+			40,
+			`{:name "alpha \"one\""
+ :addr "localhost:8080"
+ :tags [:a :b]
+ :limits {"conns" 10 "requests" 100}
+ :started #inst "2017-01-02T03:04:05Z"}
+`,
+		},
+		{
+			30,
+			`{:name "alpha \"one\""
+ :addr "localhost:8080"
+ :tags [:a :b]
+ :limits {"conns" 10
+          "requests" 100}
+ :started #inst "2017-01-02T03:04:05Z"}
+`,
+		},
+	} {
+		var buf bytes.Buffer
+		if err := Pprint(&buf, v, tc.width); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("width %d: got\n%s\nwant\n%s", tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	v := map[Keyword]interface{}{
+		"name":  "db \"main\"",
+		"ports": []int{5432, 5433},
+		"tags":  Set{Symbol("a"), Char('b')},
+		"opts":  map[string]interface{}{"ssl": true, "timeout": 1.5, "pool": nil},
+	}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{:name "db \"main\"" :opts {"pool" nil "ssl" true "timeout" 1.5} :ports [5432 5433] :tags #{a \b}}`
+	if string(got) != want {
+		t.Errorf("Marshal: got\n%s\nwant\n%s", got, want)
+	}
+	vals, err := Decode(bytes.NewReader(got), "temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Marshal(vals[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != want {
+		t.Errorf("Marshal of decoded value: got\n%s\nwant\n%s", again, want)
+	}
+
+	got, err = MarshalIndent(v, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantIndent = `{:name "db \"main\""
+ :opts {"pool" nil
+        "ssl" true
+        "timeout" 1.5}
+ :ports [5432 5433]
+ :tags #{a \b}}`
+	if string(got) != wantIndent {
+		t.Errorf("MarshalIndent: got\n%s\nwant\n%s", got, wantIndent)
+	}
+
+	if _, err := Marshal(math.Inf(1)); err == nil {
+		t.Error("Marshal(+Inf): got nil error")
+	}
+}
+
+func TestPprintTree(t *testing.T) {
+	const input = "[1 2\n 3] ; comment\n{:a [\"aaaa\" \"bbbb\" \"cccc\"] :b #{1 2}}\n[#:user{:id 1 :name \"x\"}]"
+	tree, err := parse.Reader(strings.NewReader(input), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := PprintTree(&buf, tree, 20); err != nil {
+		t.Fatal(err)
+	}
+	const want = `[1 2 3]
+{:a ["aaaa"
+     "bbbb"
+     "cccc"]
+ :b #{1 2}}
+[#:user{:id 1
+        :name "x"}]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Name", "name"},
+		{"FooBar", "foo-bar"},
+		{"ServerID", "server-id"},
+		{"HTTPServer", "http-server"},
+	} {
+		if got := kebabCase(tc.in); got != tc.want {
+			t.Errorf("kebabCase(%q) = %q; want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestJSONToEDN(t *testing.T) {
+	const input = `{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "at": "2017-01-02T03:04:05Z",
+"big": 12345678901234567890, "f": 1.5, "a b": [1, null, true], "ok": "x"}`
+	var buf bytes.Buffer
+	opts := &JSONOptions{KeywordizeKeys: true, ParseTags: true}
+	if err := JSONToEDN(&buf, strings.NewReader(input), opts, 100); err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"a b" [1 nil true]
+ :at #inst "2017-01-02T03:04:05Z"
+ :big 12345678901234567890N
+ :f 1.5
+ :id #uuid "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+ :ok "x"}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEDNToJSON(t *testing.T) {
+	const input = `{:a/b [1 2.5 1/2 "s\n"] "k" #{:x} :t #foo/bar {:x 1} 1 (\c sym) :i #inst "2017-01-02T03:04:05Z"}`
+	for _, tc := range []struct {
+		opts *JSONOptions
+		want string
+	}{
+		{
+			nil,
+			`{"1":["c","sym"],"a/b":[1,2.5,0.5,"s\n"],"i":"2017-01-02T03:04:05Z","k":["x"],"t":{"x":1}}` + "\n",
+		},
+		{
+			&JSONOptions{TaggedObjects: true},
+			`{"1":["c","sym"],"a/b":[1,2.5,0.5,"s\n"],"i":"2017-01-02T03:04:05Z","k":["x"],"t":{"tag":"foo/bar","value":{"x":1}}}` + "\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if err := EDNToJSON(&buf, strings.NewReader(input), "temp", tc.opts, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+		}
+	}
+}
+
+func TestDecodeUnhashableKey(t *testing.T) {
+	_, err := Decode(strings.NewReader("{[1] 2}"), "temp")
+	if err == nil || !strings.Contains(err.Error(), "unsupported map key") {
+		t.Fatalf("got err=%v; want unsupported map key error", err)
+	}
+}
@@ -0,0 +1,257 @@
+package edn
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A Keyword is an EDN keyword. The value does not include the leading colon.
+type Keyword string
+
+// A Symbol is an EDN symbol.
+type Symbol string
+
+// A Tagged is a value with an EDN tag, such as #uuid "...". The Tag does not
+// include the leading #.
+type Tagged struct {
+	Tag   string
+	Value interface{}
+}
+
+// ToNode converts v to an EDN parse tree node. The conversion is as follows:
+//
+//   - nil pointers and interfaces become nil
+//   - bools, numbers, and strings become the corresponding EDN literals
+//   - Keyword and Symbol become keywords and symbols
+//   - Tagged values and time.Time (as #inst) become tagged literals
+//   - slices and arrays become vectors
+//   - maps become maps with entries sorted by their printed keys
+//   - structs become maps from keywords to the exported field values
+//
+// Struct fields may be customized using an edn struct tag, which works like
+// the json tag: `edn:"name,omitempty"` or `edn:"-"`. Without a tag, the key is
+// the field name converted to kebab-case (FooBar becomes :foo-bar).
+//
+// ToNode returns a list of nodes because tagged literals are represented as
+// a TagNode followed by the tagged value.
+func ToNode(v interface{}) ([]parse.Node, error) {
+	return toNodes(reflect.ValueOf(v))
+}
+
+// Marshal returns the EDN encoding of v, as converted by ToNode, on a single
+// line. See MarshalIndent for output laid out across lines.
+func Marshal(v interface{}) ([]byte, error) {
+	nodes, err := ToNode(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(compactSeq(nodes)), nil
+}
+
+func toNodes(v reflect.Value) ([]parse.Node, error) {
+	one := func(n parse.Node) ([]parse.Node, error) { return []parse.Node{n}, nil }
+	if !v.IsValid() {
+		return one(&parse.NilNode{})
+	}
+	switch x := v.Interface().(type) {
+	case Keyword:
+		return one(&parse.KeywordNode{Val: ":" + string(x)})
+	case Symbol:
+		return one(&parse.SymbolNode{Val: string(x)})
+	case Tagged:
+		nodes, err := toNodes(reflect.ValueOf(x.Value))
+		if err != nil {
+			return nil, err
+		}
+		return append([]parse.Node{&parse.TagNode{Val: x.Tag}}, nodes...), nil
+	case time.Time:
+		return []parse.Node{
+			&parse.TagNode{Val: "inst"},
+			&parse.StringNode{Val: x.Format(time.RFC3339Nano)},
+		}, nil
+	case Char:
+		return one(parse.Char(rune(x)))
+	case List:
+		nodes, err := toNodes(reflect.ValueOf([]interface{}(x)))
+		if err != nil {
+			return nil, err
+		}
+		if vec, ok := nodes[0].(*parse.VectorNode); ok {
+			return one(&parse.ListNode{Nodes: vec.Nodes})
+		}
+		return one(&parse.ListNode{})
+	case Set:
+		nodes, err := toNodes(reflect.ValueOf([]interface{}(x)))
+		if err != nil {
+			return nil, err
+		}
+		if vec, ok := nodes[0].(*parse.VectorNode); ok {
+			return one(&parse.SetNode{Nodes: vec.Nodes})
+		}
+		return one(&parse.SetNode{})
+	case *big.Int:
+		return one(&parse.NumberNode{Val: x.String() + "N"})
+	case *big.Float:
+		return one(&parse.NumberNode{Val: x.Text('g', -1) + "M"})
+	case *big.Rat:
+		if x.IsInt() {
+			return one(&parse.NumberNode{Val: x.Num().String()})
+		}
+		return one(&parse.NumberNode{Val: x.String()})
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return one(&parse.NilNode{})
+		}
+		return toNodes(v.Elem())
+	case reflect.Bool:
+		return one(&parse.BoolNode{Val: v.Bool()})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return one(&parse.NumberNode{Val: strconv.FormatInt(v.Int(), 10)})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return one(&parse.NumberNode{Val: strconv.FormatUint(v.Uint(), 10)})
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("edn: unsupported float value %v", f)
+		}
+		s := strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return one(&parse.NumberNode{Val: s})
+	case reflect.String:
+		return one(parse.String(v.String()))
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return one(&parse.NilNode{})
+		}
+		vec := &parse.VectorNode{}
+		for i := 0; i < v.Len(); i++ {
+			nodes, err := toNodes(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			vec.Nodes = append(vec.Nodes, nodes...)
+		}
+		return one(vec)
+	case reflect.Map:
+		if v.IsNil() {
+			return one(&parse.NilNode{})
+		}
+		var entries []mapEntry
+		for _, k := range v.MapKeys() {
+			kn, err := toNodes(k)
+			if err != nil {
+				return nil, err
+			}
+			vn, err := toNodes(v.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, mapEntry{compactSeq(kn), kn, vn})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].sortKey < entries[j].sortKey })
+		m := &parse.MapNode{}
+		for _, e := range entries {
+			m.Nodes = append(m.Nodes, e.k...)
+			m.Nodes = append(m.Nodes, e.v...)
+		}
+		return one(m)
+	case reflect.Struct:
+		return structToNodes(v)
+	}
+	return nil, fmt.Errorf("edn: unsupported type %s", v.Type())
+}
+
+type mapEntry struct {
+	sortKey string
+	k, v    []parse.Node
+}
+
+func structToNodes(v reflect.Value) ([]parse.Node, error) {
+	m := &parse.MapNode{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name, omitEmpty := parseTag(f)
+		if name == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		nodes, err := toNodes(fv)
+		if err != nil {
+			return nil, err
+		}
+		m.Nodes = append(m.Nodes, &parse.KeywordNode{Val: ":" + name})
+		m.Nodes = append(m.Nodes, nodes...)
+	}
+	return []parse.Node{m}, nil
+}
+
+func parseTag(f reflect.StructField) (name string, omitEmpty bool) {
+	tag := f.Tag.Get("edn")
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	if name == "" {
+		name = kebabCase(f.Name)
+	}
+	return name, omitEmpty
+}
+
+// kebabCase converts a Go identifier such as FooBarID to foo-bar-id.
+func kebabCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
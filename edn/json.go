@@ -0,0 +1,230 @@
+package edn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// JSONOptions control the conversion between JSON and EDN.
+type JSONOptions struct {
+	// KeywordizeKeys makes FromJSON convert JSON object keys to keywords
+	// (if they are valid keywords; other keys remain strings).
+	KeywordizeKeys bool
+	// ParseTags makes FromJSON convert strings which look like RFC 3339
+	// timestamps or UUIDs into #inst and #uuid values.
+	ParseTags bool
+	// TaggedObjects makes ToJSON represent tagged values (other than #inst
+	// and #uuid) as objects of the form {"tag": "foo", "value": ...}
+	// rather than dropping the tag.
+	TaggedObjects bool
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// FromJSON converts a value decoded by encoding/json (preferably using
+// json.Decoder.UseNumber, in order to preserve numeric precision) into the
+// equivalent EDN value suitable for ToNode or Pprint.
+func FromJSON(v interface{}, opts *JSONOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &JSONOptions{}
+	}
+	switch v := v.(type) {
+	case nil, bool, float64:
+		return v, nil
+	case json.Number:
+		return parseNumber(string(v))
+	case string:
+		if opts.ParseTags {
+			if uuidRegexp.MatchString(v) {
+				return Tagged{Tag: "uuid", Value: v}, nil
+			}
+			if strings.Contains(v, "T") {
+				if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					return t, nil
+				}
+			}
+		}
+		return v, nil
+	case []interface{}:
+		vec := make([]interface{}, len(v))
+		for i, elem := range v {
+			e, err := FromJSON(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			vec[i] = e
+		}
+		return vec, nil
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for k, elem := range v {
+			e, err := FromJSON(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			if opts.KeywordizeKeys && isKeywordName(k) {
+				m[Keyword(k)] = e
+			} else {
+				m[k] = e
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("edn: unexpected JSON value of type %T", v)
+}
+
+// isKeywordName reports whether :s would be read as a keyword named s.
+func isKeywordName(s string) bool {
+	if s == "" || strings.HasPrefix(s, ":") || strings.HasSuffix(s, "/") {
+		return false
+	}
+	for _, r := range s {
+		if r <= ' ' || strings.ContainsRune(`",;@^~()[]{}\`+"`'#", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ToJSON converts a decoded EDN value (as produced by FromNodes) into a value
+// that can be encoded with encoding/json. Keywords and symbols become strings
+// (without the leading colon), lists and sets become arrays, and map keys
+// that are not strings, keywords, or symbols are converted to strings using
+// their EDN representation.
+func ToJSON(v interface{}, opts *JSONOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &JSONOptions{}
+	}
+	switch v := v.(type) {
+	case nil, bool, string, int64:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("edn: cannot represent %v in JSON", v)
+		}
+		return v, nil
+	case *big.Int:
+		return json.Number(v.String()), nil
+	case *big.Float:
+		return json.Number(v.Text('g', -1)), nil
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f, nil
+	case Keyword:
+		return string(v), nil
+	case Symbol:
+		return string(v), nil
+	case Char:
+		return string(rune(v)), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case Tagged:
+		inner, err := ToJSON(v.Value, opts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.TaggedObjects && v.Tag != "uuid" {
+			return map[string]interface{}{"tag": v.Tag, "value": inner}, nil
+		}
+		return inner, nil
+	case []interface{}:
+		return toJSONArray(v, opts)
+	case List:
+		return toJSONArray(v, opts)
+	case Set:
+		return toJSONArray(v, opts)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			key, err := jsonKey(k)
+			if err != nil {
+				return nil, err
+			}
+			e, err := ToJSON(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = e
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("edn: cannot convert %T to JSON", v)
+}
+
+func toJSONArray(vals []interface{}, opts *JSONOptions) ([]interface{}, error) {
+	arr := make([]interface{}, len(vals))
+	for i, v := range vals {
+		e, err := ToJSON(v, opts)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = e
+	}
+	return arr, nil
+}
+
+func jsonKey(k interface{}) (string, error) {
+	switch k := k.(type) {
+	case string:
+		return k, nil
+	case Keyword:
+		return string(k), nil
+	case Symbol:
+		return string(k), nil
+	}
+	nodes, err := ToNode(k)
+	if err != nil {
+		return "", err
+	}
+	return compactSeq(nodes), nil
+}
+
+// JSONToEDN reads a stream of JSON values from r and pretty-prints each one
+// as EDN to w.
+func JSONToEDN(w io.Writer, r io.Reader, opts *JSONOptions, width int) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		e, err := FromJSON(v, opts)
+		if err != nil {
+			return err
+		}
+		if err := Pprint(w, e, width); err != nil {
+			return err
+		}
+	}
+}
+
+// EDNToJSON reads the EDN values in r and writes each one to w as JSON. If
+// indent is non-empty, the JSON is indented using it.
+func EDNToJSON(w io.Writer, r io.Reader, name string, opts *JSONOptions, indent string) error {
+	vals, err := Decode(r, name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", indent)
+	for _, v := range vals {
+		j, err := ToJSON(v, opts)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package edn
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// DefaultWidth is the line width used by Pprint if width is not positive.
+const DefaultWidth = 80
+
+// Pprint writes an indented EDN representation of v (as converted by ToNode)
+// to w. Collections that don't fit within width columns are broken across
+// lines with their elements aligned, in the same style that format.Printer
+// uses for Clojure code.
+func Pprint(w io.Writer, v interface{}, width int) error {
+	nodes, err := ToNode(v)
+	if err != nil {
+		return err
+	}
+	return PprintNodes(w, nodes, width)
+}
+
+// MarshalIndent is like Marshal, but it lays out the EDN as Pprint does, so
+// that it fits within width columns (or DefaultWidth, if width is not
+// positive) where possible. The result has no trailing newline.
+func MarshalIndent(v interface{}, width int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Pprint(&buf, v, width); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// PprintTree is like Pprint, but it lays out parsed EDN data. The existing
+// line breaks and comments in t are discarded.
+func PprintTree(w io.Writer, t *parse.Tree, width int) error {
+	return PprintNodes(w, t.Roots, width)
+}
+
+// PprintNodes lays out and prints a sequence of top-level EDN forms. Each
+// form begins on a new line.
+func PprintNodes(w io.Writer, nodes []parse.Node, width int) error {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	var roots []parse.Node
+	for _, unit := range units(stripNonSemantic(nodes)) {
+		layoutUnit(unit, 0, width)
+		roots = append(roots, unit...)
+		roots = append(roots, &parse.NewlineNode{})
+	}
+	p := format.NewPrinter(w)
+	p.Transforms = map[format.Transform]bool{
+		format.TransformSortImportRequire:              false,
+		format.TransformFixDefnArglistNewline:          false,
+		format.TransformFixDefmethodDispatchValNewline: false,
+	}
+	return p.PrintTree(&parse.Tree{Roots: roots})
+}
+
+func stripNonSemantic(nodes []parse.Node) []parse.Node {
+	var result []parse.Node
+	for _, n := range nodes {
+		if goclj.Newline(n) || goclj.Comment(n) {
+			continue
+		}
+		if children := n.Children(); children != nil {
+			n.SetChildren(stripNonSemantic(children))
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// units groups nodes into units which must be kept together on a line:
+// tags and metadata are grouped with the following form.
+func units(nodes []parse.Node) [][]parse.Node {
+	var result [][]parse.Node
+	var cur []parse.Node
+	for _, n := range nodes {
+		cur = append(cur, n)
+		switch n.(type) {
+		case *parse.TagNode, *parse.MetadataNode:
+			continue
+		}
+		result = append(result, cur)
+		cur = nil
+	}
+	if len(cur) > 0 {
+		result = append(result, cur)
+	}
+	return result
+}
+
+// layoutUnit breaks up the forms of unit, which starts at column col, so
+// that they fit within width if possible.
+func layoutUnit(unit []parse.Node, col, width int) {
+	for _, n := range unit {
+		layout(n, col, width)
+		col += len(compact(n)) + 1
+	}
+}
+
+func layout(n parse.Node, col, width int) {
+	if col+len(compact(n)) <= width {
+		return
+	}
+	switch n := n.(type) {
+	case *parse.MapNode:
+		n.Nodes = layoutPairs(n.Nodes, col+1, width)
+	case *parse.NamespacedMapNode:
+		n.Nodes = layoutPairs(n.Nodes, col+len("#"+n.Namespace+"{"), width)
+	case *parse.VectorNode:
+		n.Nodes = layoutElems(n.Nodes, col+1, width)
+	case *parse.SetNode:
+		n.Nodes = layoutElems(n.Nodes, col+2, width)
+	case *parse.ListNode:
+		n.Nodes = layoutList(n.Nodes, col+1, width)
+	case *parse.FnLiteralNode:
+		n.Nodes = layoutList(n.Nodes, col+2, width)
+	default:
+		if children := n.Children(); len(children) == 1 {
+			prefix := len(compact(n)) - len(compact(children[0]))
+			layout(children[0], col+prefix, width)
+		}
+	}
+}
+
+// layoutElems puts each element on its own line, aligned at col.
+func layoutElems(nodes []parse.Node, col, width int) []parse.Node {
+	var result []parse.Node
+	for i, unit := range units(nodes) {
+		if i > 0 {
+			result = append(result, &parse.NewlineNode{})
+		}
+		layoutUnit(unit, col, width)
+		result = append(result, unit...)
+	}
+	return result
+}
+
+// layoutPairs puts each key/value pair on its own line, aligned at col.
+func layoutPairs(nodes []parse.Node, col, width int) []parse.Node {
+	var result []parse.Node
+	us := units(nodes)
+	for i := 0; i < len(us); i += 2 {
+		if i > 0 {
+			result = append(result, &parse.NewlineNode{})
+		}
+		layoutUnit(us[i], col, width)
+		result = append(result, us[i]...)
+		if i+1 < len(us) {
+			layoutUnit(us[i+1], col+len(compactSeq(us[i]))+1, width)
+			result = append(result, us[i+1]...)
+		}
+	}
+	return result
+}
+
+// layoutList lays out a list the way format.Printer indents lists: if the
+// first element is a symbol or keyword, the remaining elements are aligned
+// with the second one.
+func layoutList(nodes []parse.Node, col, width int) []parse.Node {
+	us := units(nodes)
+	if len(us) < 3 {
+		return layoutElems(nodes, col, width)
+	}
+	switch us[0][0].(type) {
+	case *parse.SymbolNode, *parse.KeywordNode:
+	default:
+		return layoutElems(nodes, col, width)
+	}
+	result := append([]parse.Node(nil), us[0]...)
+	col += len(compactSeq(us[0])) + 1
+	var rest []parse.Node
+	for _, unit := range us[1:] {
+		rest = append(rest, unit...)
+	}
+	return append(result, layoutElems(rest, col, width)...)
+}
+
+// compact gives the single-line representation of n.
+func compact(n parse.Node) string {
+	switch n := n.(type) {
+	case *parse.BoolNode, *parse.NilNode:
+		return n.String()
+	case *parse.CharacterNode:
+		return n.Text
+	case *parse.CommentNode:
+		return n.Text
+	case *parse.KeywordNode:
+		return n.Val
+	case *parse.NumberNode:
+		return n.Val
+	case *parse.SymbolNode:
+		return n.Val
+	case *parse.StringNode:
+		return `"` + n.Val + `"`
+	case *parse.RegexNode:
+		return `#"` + n.Val + `"`
+	case *parse.TagNode:
+		return "#" + n.Val
+	case *parse.VarQuoteNode:
+		return "#'" + n.Val
+	case *parse.ListNode:
+		return "(" + compactSeq(n.Nodes) + ")"
+	case *parse.VectorNode:
+		return "[" + compactSeq(n.Nodes) + "]"
+	case *parse.MapNode:
+		return "{" + compactSeq(n.Nodes) + "}"
+	case *parse.SetNode:
+		return "#{" + compactSeq(n.Nodes) + "}"
+	case *parse.NamespacedMapNode:
+		return "#" + n.Namespace + "{" + compactSeq(n.Nodes) + "}"
+	case *parse.FnLiteralNode:
+		return "#(" + compactSeq(n.Nodes) + ")"
+	case *parse.DerefNode:
+		return "@" + compact(n.Node)
+	case *parse.MetadataNode:
+		return "^" + compact(n.Node)
+	case *parse.QuoteNode:
+		return "'" + compact(n.Node)
+	case *parse.SyntaxQuoteNode:
+		return "`" + compact(n.Node)
+	case *parse.UnquoteNode:
+		return "~" + compact(n.Node)
+	case *parse.UnquoteSpliceNode:
+		return "~@" + compact(n.Node)
+	case *parse.ReaderDiscardNode:
+		return "#_" + compact(n.Node)
+	case *parse.ReaderEvalNode:
+		return "#=" + compact(n.Node)
+	}
+	return ""
+}
+
+func compactSeq(nodes []parse.Node) string {
+	parts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if goclj.Newline(n) {
+			continue
+		}
+		parts = append(parts, compact(n))
+	}
+	return strings.Join(parts, " ")
+}
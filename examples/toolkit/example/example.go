@@ -0,0 +1,86 @@
+// Command example is a custom checker built with the toolkit package. It
+// reports calls to println and prn (which are usually debugging leftovers)
+// and functions which nest forms more deeply than the :max-depth option of
+// the nearest .examplecheck file (4 by default), along with goclj's if-not
+// rule.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cespare/goclj/examples/toolkit"
+	"github.com/cespare/goclj/lint"
+	"github.com/cespare/goclj/parse"
+)
+
+func main() {
+	log.SetFlags(0)
+	asJSON := flag.Bool("json", false, "print the diagnostics as a JSON array")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] paths...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conf, err := toolkit.FindConfig(".", ".examplecheck")
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxDepth, err := conf.Int("max-depth", 4)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := &toolkit.Checker{
+		Rules: []*lint.Rule{
+			debugPrintRule(),
+			lint.NestingDepthRule(maxDepth),
+			lint.IfNotRule(),
+		},
+		Config: conf,
+	}
+	diags, err := c.Check(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		err = toolkit.PrintJSON(os.Stdout, diags)
+	} else {
+		err = toolkit.Print(os.Stdout, diags)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(diags) > 0 {
+		os.Exit(1)
+	}
+}
+
+// debugPrintRule returns a rule which reports calls to println and prn.
+func debugPrintRule() *lint.Rule {
+	return &lint.Rule{
+		ID:  "debug-print",
+		Doc: "reports calls to println and prn",
+		Run: func(pass *lint.Pass) {
+			var walk func(n parse.Node)
+			walk = func(n parse.Node) {
+				if pass.Resolver.FnFormSymbol(n, "println", "prn") {
+					head := n.Children()[0].(*parse.SymbolNode)
+					pass.Report(n, "call to %s", head.Val)
+				}
+				for _, child := range n.Children() {
+					walk(child)
+				}
+			}
+			for _, root := range pass.Tree.Roots {
+				walk(root)
+			}
+		},
+	}
+}
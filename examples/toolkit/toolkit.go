@@ -0,0 +1,363 @@
+// Package toolkit shows how to build a custom checker for Clojure code on
+// goclj, and provides the pieces most checkers need: it loads a
+// configuration file, finds and parses the files to check in parallel, runs
+// lint rules on them, and prints the diagnostics.
+//
+// A checker is a set of lint.Rules (goclj's own or new ones) run by a
+// Checker:
+//
+//	conf, err := toolkit.FindConfig(".", ".mycheck")
+//	...
+//	c := &toolkit.Checker{
+//		Rules:  []*lint.Rule{noPrintlnRule(), lint.IfNotRule()},
+//		Config: conf,
+//	}
+//	diags, err := c.Check(os.Args[1:])
+//	...
+//	toolkit.Print(os.Stdout, diags)
+//
+// The example directory holds a complete checker.
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cespare/goclj/lint"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Config is the configuration of a checker, read from a file holding a
+// single map:
+//
+//	{:disable ["if-not"]         ; IDs of rules to turn off
+//	 :baseline "baseline.json"   ; a lint.Baseline of diagnostics to ignore
+//	 :options {:max-depth 4}}    ; settings for the checker's own rules
+//
+// All the keys are optional, and other keys are ignored.
+type Config struct {
+	// Path is the file from which the configuration was read.
+	Path     string
+	Disabled map[string]bool
+	// Baseline is the path of the baseline file, relative to the current
+	// directory (the file gives it relative to the config file), or "".
+	Baseline string
+	// Options holds the values of the :options map, keyed by name
+	// without the colon.
+	Options map[string]parse.Node
+}
+
+// LoadConfig reads the configuration in the named file.
+func LoadConfig(path string) (*Config, error) {
+	t, err := parse.File(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{
+		Path:     path,
+		Disabled: make(map[string]bool),
+		Options:  make(map[string]parse.Node),
+	}
+	if len(t.Roots) == 0 {
+		return c, nil
+	}
+	m, ok := t.Roots[0].(*parse.MapNode)
+	if !ok || len(t.Roots) > 1 {
+		return nil, configError(t.Roots[0], "config is not a single map")
+	}
+	if len(m.Nodes)%2 != 0 {
+		return nil, configError(m, "map has an odd number of forms")
+	}
+	for i := 0; i < len(m.Nodes); i += 2 {
+		k, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		v := m.Nodes[i+1]
+		switch k.Val {
+		case ":disable":
+			if _, ok := v.(*parse.VectorNode); !ok {
+				return nil, configError(v, ":disable must be a vector of rule IDs")
+			}
+			for _, n := range v.Children() {
+				s, ok := n.(*parse.StringNode)
+				if !ok {
+					return nil, configError(n, "rule ID is not a string")
+				}
+				c.Disabled[s.Val] = true
+			}
+		case ":baseline":
+			s, ok := v.(*parse.StringNode)
+			if !ok {
+				return nil, configError(v, ":baseline must be a string")
+			}
+			c.Baseline = s.Val
+			if !filepath.IsAbs(c.Baseline) {
+				c.Baseline = filepath.Join(filepath.Dir(path), c.Baseline)
+			}
+		case ":options":
+			opts, ok := v.(*parse.MapNode)
+			if !ok || len(opts.Nodes)%2 != 0 {
+				return nil, configError(v, ":options must be a map")
+			}
+			for j := 0; j < len(opts.Nodes); j += 2 {
+				name, ok := opts.Nodes[j].(*parse.KeywordNode)
+				if !ok {
+					return nil, configError(opts.Nodes[j], "option name is not a keyword")
+				}
+				c.Options[strings.TrimPrefix(name.Val, ":")] = opts.Nodes[j+1]
+			}
+		}
+	}
+	return c, nil
+}
+
+// FindConfig looks for a file with the given name in dir and then in each of
+// its parent directories in turn, and reads the first it finds. If there is
+// none, it returns an empty Config.
+func FindConfig(dir, name string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return LoadConfig(path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Config{
+				Disabled: make(map[string]bool),
+				Options:  make(map[string]parse.Node),
+			}, nil
+		}
+		dir = parent
+	}
+}
+
+// Int returns the value of the named option, which must be an integer, or
+// def if it isn't set.
+func (c *Config) Int(name string, def int) (int, error) {
+	v, ok := c.Options[name]
+	if !ok {
+		return def, nil
+	}
+	if num, ok := v.(*parse.NumberNode); ok {
+		if n, err := strconv.Atoi(num.Val); err == nil {
+			return n, nil
+		}
+	}
+	return 0, configError(v, fmt.Sprintf(":%s must be an integer", name))
+}
+
+// String returns the value of the named option, which must be a string, or
+// def if it isn't set.
+func (c *Config) String(name, def string) (string, error) {
+	v, ok := c.Options[name]
+	if !ok {
+		return def, nil
+	}
+	if s, ok := v.(*parse.StringNode); ok {
+		return s.Val, nil
+	}
+	return "", configError(v, fmt.Sprintf(":%s must be a string", name))
+}
+
+func configError(n parse.Node, msg string) error {
+	return fmt.Errorf("%s: %s", n.Position(), msg)
+}
+
+// Exts are the extensions of the files that Files finds in directories.
+var Exts = []string{".clj", ".cljs", ".cljc", ".edn", ".bb"}
+
+// Files returns the Clojure files named by paths, in order. Directories are
+// walked recursively for files with one of Exts (skipping hidden files and
+// directories); as in the go tool, dir/... (or ...) may be written for the
+// directory dir (or the current directory).
+func Files(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if path == "..." {
+			path = "."
+		} else if strings.HasSuffix(path, "/...") {
+			path = strings.TrimSuffix(path, "/...")
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		walk := func(p string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			hidden := p != path && strings.HasPrefix(f.Name(), ".")
+			if f.IsDir() {
+				if hidden {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !hidden && hasExt(f.Name()) {
+				files = append(files, p)
+			}
+			return nil
+		}
+		if err := filepath.Walk(path, walk); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func hasExt(name string) bool {
+	for _, ext := range Exts {
+		if filepath.Ext(name) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// A Checker runs lint rules on files.
+type Checker struct {
+	// Rules are the rules to run. Since files are checked in parallel,
+	// they must be safe to run on different trees at once.
+	Rules []*lint.Rule
+	// Config, if non-nil, disables rules and gives a baseline of
+	// diagnostics to ignore.
+	Config *Config
+	// Workers is the number of files checked at once. If it is zero,
+	// runtime.NumCPU() is used.
+	Workers int
+}
+
+// Check checks the files named by paths (as for Files) and returns the
+// diagnostics, in the order of the files and then of position. If a file
+// can't be read or parsed, Check returns the error for the first such file.
+func (c *Checker) Check(paths []string) ([]*lint.Diagnostic, error) {
+	files, err := Files(paths)
+	if err != nil {
+		return nil, err
+	}
+	rules := c.Rules
+	if c.Config != nil {
+		rules = nil
+		for _, r := range c.Rules {
+			if !c.Config.Disabled[r.ID] {
+				rules = append(rules, r)
+			}
+		}
+	}
+
+	type result struct {
+		diags []*lint.Diagnostic
+		err   error
+	}
+	results := make([]result, len(files))
+	workers := c.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				t, err := parse.File(files[i], parse.IncludeNonSemantic)
+				if err != nil {
+					results[i].err = err
+					continue
+				}
+				results[i].diags = lint.Lint(t, rules)
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var diags []*lint.Diagnostic
+	for _, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		diags = append(diags, r.diags...)
+	}
+	if c.Config != nil && c.Config.Baseline != "" {
+		f, err := os.Open(c.Config.Baseline)
+		if err != nil {
+			return nil, err
+		}
+		b, err := lint.ReadBaseline(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading baseline %s: %s", c.Config.Baseline, err)
+		}
+		diags = b.Filter(diags)
+	}
+	return diags, nil
+}
+
+// Print writes diags to w, one per line, as file:line:col: message (rule),
+// followed by the indented detail of each, if any.
+func Print(w io.Writer, diags []*lint.Diagnostic) error {
+	for _, d := range diags {
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+		if d.Detail != "" {
+			lines := strings.Split(strings.TrimSuffix(d.Detail, "\n"), "\n")
+			if _, err := fmt.Fprintf(w, "\t%s\n", strings.Join(lines, "\n\t")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A JSONDiagnostic is a diagnostic as printed by PrintJSON. It has the same
+// fields as the JSON output of cljfmt lint.
+type JSONDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// PrintJSON writes diags to w as a JSON array of JSONDiagnostics.
+func PrintJSON(w io.Writer, diags []*lint.Diagnostic) error {
+	out := []JSONDiagnostic{}
+	for _, d := range diags {
+		out = append(out, JSONDiagnostic{
+			File:    d.Pos.Name,
+			Line:    d.Pos.Line,
+			Col:     d.Pos.Col,
+			Rule:    d.Rule,
+			Message: d.Message,
+			Detail:  d.Detail,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,105 @@
+package toolkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/lint"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toolkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		".check":           `{:disable ["seq-test"] :baseline "baseline.json" :options {:depth 3}}`,
+		"baseline.json":    `{"entries": [{"file": "` + filepath.Join(dir, "src/b.clj") + `", "rule": "if-not", "message": "use (if-not x ...) rather than (if (not x) ...)", "count": 1}]}`,
+		"src/a.clj":        "(if (not x) 1 2)\n(= x nil)\n",
+		"src/b.clj":        "(if (not x) 1 2)\n(if (not y) 1 2)\n",
+		"src/c.cljs":       "(if (seq xs) 1 2)\n",
+		"src/README.md":    "(= x nil)\n",
+		"src/.hidden.clj":  "(= x nil)\n",
+		"src/.old/old.clj": "(= x nil)\n",
+	})
+
+	conf, err := FindConfig(filepath.Join(dir, "src"), ".check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := conf.Int("depth", 1); got != 3 || err != nil {
+		t.Errorf(`conf.Int("depth", 1): got (%d, %v); want (3, nil)`, got, err)
+	}
+	if got, err := conf.Int("width", 80); got != 80 || err != nil {
+		t.Errorf(`conf.Int("width", 80): got (%d, %v); want (80, nil)`, got, err)
+	}
+	if _, err := conf.String("depth", ""); err == nil {
+		t.Error(`conf.String("depth", ""): got no error`)
+	}
+
+	files, err := Files([]string{filepath.Join(dir, "src") + "/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	if want := []string{"a.clj", "b.clj", "c.cljs"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Files: got %q; want %q", names, want)
+	}
+
+	c := &Checker{
+		Rules:   []*lint.Rule{lint.IfNotRule(), lint.NilEqualityRule(), lint.SeqTestRule()},
+		Config:  conf,
+		Workers: 2,
+	}
+	diags, err := c.Check([]string{filepath.Join(dir, "src")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, strings.TrimPrefix(d.String(), dir+"/"))
+	}
+	want := []string{
+		"src/a.clj:1:1: use (if-not x ...) rather than (if (not x) ...) (if-not)",
+		"src/a.clj:2:1: use (nil? x) rather than (= x nil) (nil-equality)",
+		"src/b.clj:2:1: use (if-not x ...) rather than (if (not x) ...) (if-not)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check: got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFindConfigMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toolkit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf, err := FindConfig(dir, ".no-such-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Path != "" || len(conf.Disabled) != 0 || conf.Baseline != "" {
+		t.Errorf("got %+v; want an empty config", conf)
+	}
+}
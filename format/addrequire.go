@@ -0,0 +1,291 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// DefaultAliases is a table of conventional aliases for common namespaces.
+// It may be used (possibly merged with ProjectAliases) as the alias table for
+// AddMissingRequires.
+var DefaultAliases = map[string]string{
+	"edn":    "clojure.edn",
+	"io":     "clojure.java.io",
+	"pprint": "clojure.pprint",
+	"set":    "clojure.set",
+	"str":    "clojure.string",
+	"walk":   "clojure.walk",
+	"zip":    "clojure.zip",
+}
+
+// requireAliases returns the alias table of TransformAddMissingRequires.
+func (p *Printer) requireAliases() map[string]string {
+	if p.RequireAliases == nil {
+		return DefaultAliases
+	}
+	return p.RequireAliases
+}
+
+// missingRequireAliases returns the aliases of requireAliases for which
+// TransformAddMissingRequires adds requires: in babashka, those other than
+// the built-in aliases.
+func (p *Printer) missingRequireAliases() map[string]string {
+	aliases := p.requireAliases()
+	if p.Dialect != goclj.DialectBabashka {
+		return aliases
+	}
+	result := make(map[string]string)
+	for as, ns := range aliases {
+		if _, ok := goclj.BabashkaAliases[as]; !ok {
+			result[as] = ns
+		}
+	}
+	return result
+}
+
+// AddMissingRequires looks for namespace-qualified symbols and keywords (such
+// as str/join or ::str/foo) in t whose alias is not declared by t's ns form.
+// For each such alias that is present in aliases (a map from alias to
+// namespace name), a [namespace :as alias] require is inserted into the ns
+// form in sorted position. AddMissingRequires returns the aliases that were
+// added, in sorted order.
+//
+// If t has no ns form, AddMissingRequires does nothing.
+func AddMissingRequires(t *parse.Tree, aliases map[string]string) []string {
+	var ns parse.Node
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") {
+			ns = root
+			break
+		}
+	}
+	if ns == nil {
+		return nil
+	}
+	declared := declaredAliases(ns)
+	missing := make(map[string]struct{})
+	var find func(n parse.Node)
+	find = func(n parse.Node) {
+		var name string
+		switch n := n.(type) {
+		case *parse.SymbolNode:
+			name = n.Val
+		case *parse.VarQuoteNode:
+			name = n.Val
+		case *parse.KeywordNode:
+			if !strings.HasPrefix(n.Val, "::") {
+				return
+			}
+			name = n.Val[2:]
+		default:
+			for _, child := range n.Children() {
+				find(child)
+			}
+			return
+		}
+		i := strings.IndexByte(name, '/')
+		if i <= 0 {
+			return
+		}
+		alias := name[:i]
+		if _, ok := declared[alias]; ok {
+			return
+		}
+		if _, ok := aliases[alias]; ok {
+			missing[alias] = struct{}{}
+		}
+	}
+	for _, root := range t.Roots {
+		if root != ns {
+			find(root)
+		}
+	}
+	added := sortStringSet(missing)
+	for _, alias := range added {
+		insertRequire(ns, &parse.VectorNode{
+			Nodes: []parse.Node{
+				&parse.SymbolNode{Val: aliases[alias]},
+				&parse.KeywordNode{Val: ":as"},
+				&parse.SymbolNode{Val: alias},
+			},
+		})
+	}
+	return added
+}
+
+// ProjectAliases builds an alias table from the ns forms of the given trees.
+// If a single alias is used for more than one namespace, the most common
+// mapping wins (ties are broken by namespace name).
+func ProjectAliases(trees []*parse.Tree) map[string]string {
+	counts := make(map[string]map[string]int)
+	for _, t := range trees {
+		for _, root := range t.Roots {
+			if !goclj.FnFormSymbol(root, "ns") {
+				continue
+			}
+			for _, r := range nsRequires(root) {
+				for as := range r.as {
+					if counts[as] == nil {
+						counts[as] = make(map[string]int)
+					}
+					counts[as][r.name]++
+				}
+			}
+		}
+	}
+	aliases := make(map[string]string)
+	for as, m := range counts {
+		best, bestCount := "", 0
+		for name, n := range m {
+			if n > bestCount || (n == bestCount && name < best) {
+				best, bestCount = name, n
+			}
+		}
+		aliases[as] = best
+	}
+	return aliases
+}
+
+// NamespaceAliases builds an alias table from the namespaces declared by
+// the ns forms of the given trees, aliasing each namespace by the last
+// segment of its name (app.util by util), the way goimports finds packages
+// by their names. Segments shared by several namespaces are left out.
+func NamespaceAliases(trees []*parse.Tree) map[string]string {
+	byAlias := make(map[string]map[string]struct{})
+	for _, t := range trees {
+		for _, root := range t.Roots {
+			if !goclj.FnFormSymbol(root, "ns") {
+				continue
+			}
+			for _, n := range root.Children()[1:] {
+				if _, ok := n.(*parse.MetadataNode); ok || !goclj.Semantic(n) {
+					continue
+				}
+				sym, ok := n.(*parse.SymbolNode)
+				if !ok {
+					break
+				}
+				as := sym.Val[strings.LastIndexByte(sym.Val, '.')+1:]
+				if byAlias[as] == nil {
+					byAlias[as] = make(map[string]struct{})
+				}
+				byAlias[as][sym.Val] = struct{}{}
+				break
+			}
+		}
+	}
+	aliases := make(map[string]string)
+	for as, names := range byAlias {
+		if len(names) == 1 {
+			for name := range names {
+				aliases[as] = name
+			}
+		}
+	}
+	return aliases
+}
+
+// nsRequires returns the recognized requires in the :require clauses of ns.
+func nsRequires(ns parse.Node) []*require {
+	var reqs []*require
+	for _, n := range ns.Children()[1:] {
+		if !goclj.FnFormKeyword(n, ":require") {
+			continue
+		}
+		for _, spec := range n.Children()[1:] {
+			if r, ok := parseRequire(spec); ok {
+				reqs = append(reqs, r)
+			}
+		}
+	}
+	return reqs
+}
+
+// declaredAliases returns the set of names that may appear before a / in a
+// qualified symbol in a namespace with the given ns form: required namespace
+// names, their aliases, and imported class names.
+func declaredAliases(ns parse.Node) map[string]struct{} {
+	declared := make(map[string]struct{})
+	for _, r := range nsRequires(ns) {
+		declared[r.name] = struct{}{}
+		for as := range r.as {
+			declared[as] = struct{}{}
+		}
+	}
+	for _, n := range ns.Children()[1:] {
+		if !goclj.FnFormKeyword(n, ":import") {
+			continue
+		}
+		for _, spec := range n.Children()[1:] {
+			switch spec := spec.(type) {
+			case *parse.SymbolNode:
+				declared[spec.Val[strings.LastIndexByte(spec.Val, '.')+1:]] = struct{}{}
+			case *parse.ListNode, *parse.VectorNode:
+				for _, class := range spec.Children()[1:] {
+					if sym, ok := class.(*parse.SymbolNode); ok {
+						declared[sym.Val] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	return declared
+}
+
+// insertRequire adds spec to the first :require clause of ns, before the
+// first existing libspec that sorts after it. If ns has no :require clause,
+// one is added at the end of the ns form.
+func insertRequire(ns parse.Node, spec parse.Node) {
+	key, _ := getImportRequireSortKey(spec)
+	for _, n := range ns.Children()[1:] {
+		if !goclj.FnFormKeyword(n, ":require") {
+			continue
+		}
+		nodes := n.Children()
+		last := 0
+		for i, node := range nodes[1:] {
+			if !goclj.Semantic(node) {
+				continue
+			}
+			if rank, k := importRequireRank(node); rank != rankNamespace || key < k {
+				// Insert above any comments attached to node.
+				j := i + 1
+				for j >= 4 && goclj.Newline(nodes[j-1]) &&
+					goclj.Comment(nodes[j-2]) && goclj.Newline(nodes[j-3]) {
+					j -= 2
+				}
+				n.SetChildren(insertNodes(nodes, j, spec, &parse.NewlineNode{}))
+				return
+			}
+			last = i + 1
+		}
+		if last == 0 {
+			n.SetChildren(insertNodes(nodes, 1, spec))
+			return
+		}
+		// Skip past a comment beside the last libspec.
+		if last+1 < len(nodes) && goclj.Comment(nodes[last+1]) {
+			last++
+		}
+		n.SetChildren(insertNodes(nodes, last+1, &parse.NewlineNode{}, spec))
+		return
+	}
+	nodes := ns.Children()
+	i := len(nodes)
+	for i > 1 && goclj.Newline(nodes[i-1]) {
+		i--
+	}
+	clause := &parse.ListNode{
+		Nodes: []parse.Node{&parse.KeywordNode{Val: ":require"}, spec},
+	}
+	ns.SetChildren(insertNodes(nodes, i, &parse.NewlineNode{}, clause))
+}
+
+func insertNodes(nodes []parse.Node, i int, ins ...parse.Node) []parse.Node {
+	result := make([]parse.Node, 0, len(nodes)+len(ins))
+	result = append(result, nodes[:i]...)
+	result = append(result, ins...)
+	return append(result, nodes[i:]...)
+}
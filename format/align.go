@@ -0,0 +1,114 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// markAlignment finds blocks of rows in the input which were aligned into
+// columns by hand, such as
+//
+//	{:a    1
+//	 :bcd  2}
+//
+// and records the spacing needed to keep them aligned. A block is a run of
+// consecutive lines of a sequence with the same number (at least two) of
+// forms, where each column begins at the same input column on every line.
+// Every form but the last on each line must be a single-line atom, so that
+// its printed width is its input width.
+func (p *Printer) markAlignment(n parse.Node) {
+	nodes := n.Children()
+	switch n.(type) {
+	case *parse.ListNode, *parse.VectorNode, *parse.MapNode, *parse.SetNode, *parse.FnLiteralNode,
+		*parse.NamespacedMapNode:
+		var rows [][]parse.Node
+		var row []parse.Node
+		for _, node := range nodes {
+			switch {
+			case goclj.Newline(node):
+				rows = append(rows, row)
+				row = nil
+			case goclj.Comment(node):
+				// A comment ends the line.
+			default:
+				row = append(row, node)
+			}
+		}
+		rows = append(rows, row)
+		if goclj.FnFormSymbol(n) {
+			// The first line of a list holds its head and arguments,
+			// not a row.
+			rows = rows[1:]
+		}
+		for i := 0; i < len(rows); {
+			j := i + 1
+			for j < len(rows) && len(rows[j]) == len(rows[i]) {
+				j++
+			}
+			if j-i > 1 && len(rows[i]) > 1 {
+				p.alignBlock(rows[i:j])
+			}
+			i = j
+		}
+	}
+	for _, node := range nodes {
+		p.markAlignment(node)
+	}
+}
+
+func (p *Printer) alignBlock(rows [][]parse.Node) {
+	cols := len(rows[0])
+	for _, row := range rows {
+		line := row[0].Position().Line
+		if line == 0 {
+			return // created by a transform
+		}
+		for c, n := range row {
+			pos := n.Position()
+			if pos.Line != line || pos.Col != rows[0][c].Position().Col {
+				return
+			}
+		}
+	}
+	gaps := make([][]int, len(rows))
+	for r, row := range rows {
+		gaps[r] = make([]int, cols)
+		for c := 0; c < cols-1; c++ {
+			w, ok := atomWidth(row[c])
+			if !ok {
+				return
+			}
+			gap := row[c+1].Position().Col - row[c].Position().Col - w
+			if gap < 1 {
+				return
+			}
+			gaps[r][c+1] = gap
+		}
+	}
+	for r, row := range rows {
+		for c, n := range row {
+			if gaps[r][c] > 1 {
+				p.alignSpaces[n] = gaps[r][c]
+			}
+		}
+	}
+}
+
+// atomWidth returns the printed width of n if it is an atom which is
+// printed on a single line.
+func atomWidth(n parse.Node) (int, bool) {
+	switch n.(type) {
+	case *parse.BoolNode, *parse.CharacterNode, *parse.KeywordNode,
+		*parse.NilNode, *parse.NumberNode, *parse.RegexNode,
+		*parse.StringNode, *parse.SymbolNode, *parse.VarQuoteNode:
+	default:
+		return 0, false
+	}
+	s := sortKey(n)
+	if strings.Contains(s, "\n") {
+		return 0, false
+	}
+	return len(s), true
+}
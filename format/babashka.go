@@ -0,0 +1,54 @@
+package format
+
+import (
+	"github.com/cespare/goclj/parse"
+)
+
+// sortTaskRequires sorts the :requires of the tasks in a bb.edn file. These
+// may be given for all tasks or for individual ones:
+//
+//	{:tasks {:requires ([babashka.fs :as fs])
+//	         clean {:requires ([clojure.string :as str])
+//	                :task (fs/delete-tree "target")}}}
+func sortTaskRequires(root parse.Node, c Collation) {
+	m, ok := root.(*parse.MapNode)
+	if !ok {
+		return
+	}
+	tasks, ok := mapValue(m, ":tasks").(*parse.MapNode)
+	if !ok {
+		return
+	}
+	sortRequiresEntry(tasks, c)
+	for _, n := range tasks.Nodes {
+		if task, ok := n.(*parse.MapNode); ok {
+			sortRequiresEntry(task, c)
+		}
+	}
+}
+
+func sortRequiresEntry(m *parse.MapNode, c Collation) {
+	switch reqs := mapValue(m, ":requires").(type) {
+	case *parse.ListNode, *parse.VectorNode:
+		reqs.SetChildren(sortLibspecs(reqs.Children(), c))
+	}
+}
+
+// mapValue returns the value of the entry of m whose key is the keyword kw,
+// or nil if there is no such entry.
+func mapValue(m *parse.MapNode, kw string) parse.Node {
+	var semantic []parse.Node
+	for _, n := range m.Nodes {
+		switch n.(type) {
+		case *parse.NewlineNode, *parse.CommentNode:
+			continue
+		}
+		semantic = append(semantic, n)
+	}
+	for i := 0; i+1 < len(semantic); i += 2 {
+		if k, ok := semantic[i].(*parse.KeywordNode); ok && k.Val == kw {
+			return semantic[i+1]
+		}
+	}
+	return nil
+}
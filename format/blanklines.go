@@ -0,0 +1,95 @@
+package format
+
+import (
+	"fmt"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A BlankLineContext is a kind of sequence of forms in which
+// TransformRemoveExtraBlankLines limits the number of consecutive blank
+// lines. See Printer.MaxBlankLines.
+type BlankLineContext int
+
+const (
+	// BlankLinesTopLevel is the top level of a file.
+	BlankLinesTopLevel BlankLineContext = iota
+	// BlankLinesNS is the inside of an ns form (but not of the forms
+	// within it, such as a :require clause).
+	BlankLinesNS
+	// BlankLinesLet is the inside of a let form or another form with a
+	// binding vector, such as loop or when-let: the space between the
+	// bindings and the body and between the forms of the body. The
+	// binding vector itself is BlankLinesOther.
+	BlankLinesLet
+	// BlankLinesOther is the inside of any other form.
+	BlankLinesOther
+)
+
+var blankLineContextNames = map[BlankLineContext]string{
+	BlankLinesTopLevel: "top-level",
+	BlankLinesNS:       "ns",
+	BlankLinesLet:      "let",
+	BlankLinesOther:    "other",
+}
+
+func (c BlankLineContext) String() string {
+	if name, ok := blankLineContextNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("BlankLineContext(%d)", int(c))
+}
+
+// ParseBlankLineContext returns the BlankLineContext with the given name,
+// as given by BlankLineContext.String.
+func ParseBlankLineContext(name string) (BlankLineContext, error) {
+	for c, s := range blankLineContextNames {
+		if s == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized blank line context %q", name)
+}
+
+// DefaultMaxBlankLines is the number of consecutive blank lines
+// TransformRemoveExtraBlankLines leaves in each context unless overridden
+// by Printer.MaxBlankLines.
+var DefaultMaxBlankLines = map[BlankLineContext]int{
+	BlankLinesTopLevel: 1,
+	BlankLinesNS:       0,
+	BlankLinesLet:      0,
+	BlankLinesOther:    1,
+}
+
+// maxBlankLines returns the number of consecutive blank lines to leave in
+// the context c.
+func (p *Printer) maxBlankLines(c BlankLineContext) int {
+	n, ok := p.MaxBlankLines[c]
+	if !ok {
+		n = DefaultMaxBlankLines[c]
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// letForms are the forms whose bodies are in the BlankLinesLet context.
+var letForms = []string{
+	"let", "let*", "loop", "loop*", "letfn", "binding", "with-redefs",
+	"with-local-vars", "with-open", "when-let", "if-let", "when-some",
+	"if-some", "when-first", "dotimes",
+}
+
+// blankLineContext returns the context of the children of n, resolving
+// head symbols using r.
+func blankLineContext(n parse.Node, r *goclj.Resolver) BlankLineContext {
+	switch {
+	case r.FnFormSymbol(n, "ns"):
+		return BlankLinesNS
+	case r.FnFormSymbol(n, letForms...):
+		return BlankLinesLet
+	}
+	return BlankLinesOther
+}
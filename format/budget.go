@@ -0,0 +1,52 @@
+package format
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// Format parses the Clojure source read from r and writes it, formatted, to
+// p's writer. The filename is used in error messages and to choose
+// file-specific formatting.
+//
+// If p.MemoryBudget is positive and the parsed input would not fit within it,
+// Format falls back to formatting the input one top-level form at a time,
+// as PrintStream does. If a single form does not fit within the budget,
+// Format returns a *parse.BudgetError. (To return the error rather than
+// falling back to streaming, use parse.ReaderBudget and PrintTree.) Since
+// Format keeps a copy of the input it has read, so that it can start over,
+// the parse and that copy each get half of the budget.
+func (p *Printer) Format(r io.Reader, filename string) error {
+	if p.MemoryBudget <= 0 {
+		end := p.trace("parse")
+		t, err := parse.Reader(r, filename, parse.IncludeNonSemantic)
+		end()
+		if err != nil {
+			return err
+		}
+		return p.PrintTree(t)
+	}
+	// The copy in read is no larger than the source kept by the parse,
+	// which ReaderBudget counts against its half.
+	budget := p.MemoryBudget / 2
+	if budget == 0 {
+		budget = 1 // not 0, which is no limit
+	}
+	var read bytes.Buffer
+	end := p.trace("parse")
+	t, err := parse.ReaderBudget(io.TeeReader(r, &read), filename, parse.IncludeNonSemantic, budget)
+	end()
+	if err == nil {
+		return p.PrintTree(t)
+	}
+	if _, ok := err.(*parse.BudgetError); !ok {
+		return err
+	}
+	// Start over, streaming the input that has already been read
+	// followed by the rest of r.
+	s := parse.NewStream(io.MultiReader(&read, r), filename, parse.IncludeNonSemantic)
+	s.SetBudget(budget)
+	return p.PrintStream(s)
+}
@@ -0,0 +1,74 @@
+package format
+
+import "sort"
+
+// FeaturesVersion is the version of the layout of Features. Fields may be
+// added to Features without changing it; it changes only if the meaning of
+// an existing field does.
+const FeaturesVersion = 1
+
+// Features describes what this version of the package supports, for
+// clients (such as editor plugins, which may be used with several versions
+// of goclj) which need to know whether an option is available before using
+// it. Its fields have JSON names so that it can be passed on as it is.
+type Features struct {
+	// Version is FeaturesVersion.
+	Version int `json:"version"`
+	// Transforms are the transforms, in order.
+	Transforms []TransformInfo `json:"transforms"`
+	// IndentStyles, BlankLineContexts, and Collations are the names of
+	// the IndentStyles, BlankLineContexts, and Collations, sorted.
+	IndentStyles      []string `json:"indent-styles"`
+	BlankLineContexts []string `json:"blank-line-contexts"`
+	Collations        []string `json:"collations"`
+	// ConfigKeys are the keys of a ConfigFile which ParseConfig reads,
+	// and so which apply wherever a project's ConfigFile is used.
+	ConfigKeys []string `json:"config-keys"`
+	// CommandConfigKeys are the other keys which the cljfmt command reads
+	// from its own config file ($HOME/.cljfmt or the file given by -c).
+	CommandConfigKeys []string `json:"command-config-keys"`
+}
+
+// A TransformInfo describes a Transform.
+type TransformInfo struct {
+	Name    string `json:"name"`    // as given by Transform.String
+	Default bool   `json:"default"` // whether it is in DefaultTransforms
+}
+
+// configKeys are the keys that ParseConfig reads.
+var configKeys = []string{
+	":transforms", ":indent-overrides", ":line-width", ":require-aliases", ":generated-marker",
+}
+
+// commandConfigKeys are the keys that only the cljfmt command reads (in
+// cljfmt/config.go), sorted.
+var commandConfigKeys = []string{
+	":blank-lines-after-ns", ":data-profiles", ":expand-quotes", ":file-data-profiles",
+	":form-aliases", ":lint", ":max-blank-lines", ":preserve-alignment",
+	":require-classpath", ":sort-collation", ":thread-first-overrides", ":whitespace-only",
+}
+
+// Capabilities returns the Features of the package.
+func Capabilities() *Features {
+	f := &Features{
+		Version:           FeaturesVersion,
+		ConfigKeys:        append([]string(nil), configKeys...),
+		CommandConfigKeys: append([]string(nil), commandConfigKeys...),
+	}
+	for _, t := range AllTransforms() {
+		f.Transforms = append(f.Transforms, TransformInfo{t.String(), DefaultTransforms[t]})
+	}
+	for _, name := range indentStyleNames {
+		f.IndentStyles = append(f.IndentStyles, name)
+	}
+	for _, name := range blankLineContextNames {
+		f.BlankLineContexts = append(f.BlankLineContexts, name)
+	}
+	for _, name := range collationNames {
+		f.Collations = append(f.Collations, name)
+	}
+	sort.Strings(f.IndentStyles)
+	sort.Strings(f.BlankLineContexts)
+	sort.Strings(f.Collations)
+	return f
+}
@@ -0,0 +1,53 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Collation is an order for comparing the names of namespaces and
+// classes when sorting them.
+type Collation int
+
+const (
+	// CollationASCII compares names byte by byte, so that uppercase
+	// letters sort before lowercase ones. This matches the order of
+	// Clojure's compare (and cljfmt's sorting) for ASCII names.
+	CollationASCII Collation = iota
+	// CollationCaseInsensitive compares names ignoring case, as Cursive
+	// does. Names which differ only in case are ordered as by
+	// CollationASCII.
+	CollationCaseInsensitive
+)
+
+var collationNames = map[Collation]string{
+	CollationASCII:           "ascii",
+	CollationCaseInsensitive: "case-insensitive",
+}
+
+func (c Collation) String() string {
+	if name, ok := collationNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Collation(%d)", int(c))
+}
+
+// ParseCollation returns the Collation with the given name, as given by
+// Collation.String.
+func ParseCollation(name string) (Collation, error) {
+	for c, s := range collationNames {
+		if s == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized collation %q", name)
+}
+
+func (c Collation) less(a, b string) bool {
+	if c == CollationCaseInsensitive {
+		if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+			return la < lb
+		}
+	}
+	return a < b
+}
@@ -0,0 +1,297 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// ConfigFile is the name of the project configuration file that FindConfig
+// looks for.
+const ConfigFile = ".cljfmt"
+
+// A Config is the formatting configuration of a project, as read from its
+// ConfigFile. The file holds a single map, in the same format as the
+// $HOME/.cljfmt file read by the cljfmt command, of which these keys are
+// used:
+//
+//	:transforms       a map from transform names (as keywords) to booleans
+//	:indent-overrides pairs of a name (or a vector of names) and an indent
+//	                  style, such as :list-body
+//	:line-width       the Printer's LineWidth
+//	:require-aliases  a map from aliases to namespaces (as symbols) for
+//	                  TransformAddMissingRequires
+//	:generated-marker a regex which marks generated files (see
+//	                  goclj.Generated)
+//
+// Other keys are ignored, so the file may also configure other tools.
+type Config struct {
+	// Path is the file from which the configuration was read.
+	Path            string
+	Transforms      map[Transform]bool
+	IndentOverrides map[string]IndentStyle
+	// LineWidth is 0 if the file doesn't give one.
+	LineWidth int
+	// RequireAliases maps aliases to namespaces.
+	RequireAliases map[string]string
+	// GeneratedMarker is nil if the file doesn't give one. It isn't used
+	// by Apply, but by the tools which leave generated files alone.
+	GeneratedMarker *regexp.Regexp
+}
+
+var indentStyleNames = map[IndentStyle]string{
+	IndentNormal:   "normal",
+	IndentList:     "list",
+	IndentListBody: "list-body",
+	IndentLet:      "let",
+	IndentLetfn:    "letfn",
+	IndentDeftype:  "deftype",
+	IndentCond0:    "cond0",
+	IndentCond1:    "cond1",
+	IndentCond2:    "cond2",
+	IndentCond4:    "cond4",
+}
+
+func (s IndentStyle) String() string {
+	if name, ok := indentStyleNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("IndentStyle(%d)", int(s))
+}
+
+// ParseIndentStyle returns the IndentStyle with the given name, as given by
+// IndentStyle.String.
+func ParseIndentStyle(name string) (IndentStyle, error) {
+	for s, n := range indentStyleNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown indent style %q", name)
+}
+
+// Apply applies c to p. The transforms and indent overrides are added to
+// those of p, replacing any for the same transforms and names.
+func (c *Config) Apply(p *Printer) {
+	if len(c.Transforms) > 0 {
+		transforms := make(map[Transform]bool)
+		for t, on := range p.Transforms {
+			transforms[t] = on
+		}
+		for t, on := range c.Transforms {
+			transforms[t] = on
+		}
+		p.Transforms = transforms
+	}
+	if len(c.IndentOverrides) > 0 {
+		overrides := make(map[string]IndentStyle)
+		for name, style := range p.IndentOverrides {
+			overrides[name] = style
+		}
+		for name, style := range c.IndentOverrides {
+			overrides[name] = style
+		}
+		p.IndentOverrides = overrides
+	}
+	if c.LineWidth > 0 {
+		p.LineWidth = c.LineWidth
+	}
+	if len(c.RequireAliases) > 0 {
+		aliases := make(map[string]string)
+		for as, ns := range p.requireAliases() {
+			aliases[as] = ns
+		}
+		for as, ns := range c.RequireAliases {
+			aliases[as] = ns
+		}
+		p.RequireAliases = aliases
+	}
+}
+
+// LoadConfig reads the configuration in the named file.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConfig(f, path)
+}
+
+// FindConfig looks for a ConfigFile in dir and then in each of its parent
+// directories in turn, and reads the first it finds. If there is none, it
+// returns nil and no error.
+func FindConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, ConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return LoadConfig(path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// ParseConfig reads a configuration from r. The name is used for the
+// positions in errors and as the Path of the Config.
+func ParseConfig(r io.Reader, name string) (*Config, error) {
+	c := &Config{Path: name}
+	t, err := parse.Reader(r, name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Roots) == 0 {
+		return c, nil
+	}
+	if len(t.Roots) > 1 {
+		return nil, configError(t.Roots[1], "more than one form")
+	}
+	m, ok := t.Roots[0].(*parse.MapNode)
+	if !ok {
+		return nil, configError(t.Roots[0], "config is not a map")
+	}
+	if len(m.Nodes)%2 != 0 {
+		return nil, configError(m, "map has an odd number of forms")
+	}
+	for i := 0; i < len(m.Nodes); i += 2 {
+		k, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		v := m.Nodes[i+1]
+		// Keep configKeys up to date with these.
+		switch k.Val {
+		case ":transforms":
+			if err := c.parseTransforms(v); err != nil {
+				return nil, err
+			}
+		case ":indent-overrides":
+			if err := c.parseIndentOverrides(v); err != nil {
+				return nil, err
+			}
+		case ":line-width":
+			n := 0
+			if num, ok := v.(*parse.NumberNode); ok {
+				n, _ = strconv.Atoi(num.Val)
+			}
+			if n < 1 {
+				return nil, configError(v, ":line-width must be a positive integer")
+			}
+			c.LineWidth = n
+		case ":require-aliases":
+			if err := c.parseRequireAliases(v); err != nil {
+				return nil, err
+			}
+		case ":generated-marker":
+			re, ok := v.(*parse.RegexNode)
+			if !ok {
+				return nil, configError(v, ":generated-marker must be a regex")
+			}
+			marker, err := regexp.Compile(re.Val)
+			if err != nil {
+				return nil, configError(v, "bad :generated-marker: "+err.Error())
+			}
+			c.GeneratedMarker = marker
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) parseTransforms(v parse.Node) error {
+	m, ok := v.(*parse.MapNode)
+	if !ok || len(m.Nodes)%2 != 0 {
+		return configError(v, ":transforms must be a map from transform names to booleans")
+	}
+	c.Transforms = make(map[Transform]bool)
+	for i := 0; i < len(m.Nodes); i += 2 {
+		k, ok := m.Nodes[i].(*parse.KeywordNode)
+		if !ok {
+			return configError(m.Nodes[i], "transform name is not a keyword")
+		}
+		t, err := ParseTransform(strings.TrimPrefix(k.Val, ":"))
+		if err != nil {
+			return configError(k, err.Error())
+		}
+		b, ok := m.Nodes[i+1].(*parse.BoolNode)
+		if !ok {
+			return configError(m.Nodes[i+1], "transform setting is not a boolean")
+		}
+		c.Transforms[t] = b.Val
+	}
+	return nil
+}
+
+func (c *Config) parseIndentOverrides(v parse.Node) error {
+	nodes := v.Children()
+	switch v.(type) {
+	case *parse.VectorNode, *parse.ListNode:
+	default:
+		return configError(v, ":indent-overrides must be a vector")
+	}
+	if len(nodes)%2 != 0 {
+		return configError(v, ":indent-overrides has an odd number of forms")
+	}
+	c.IndentOverrides = make(map[string]IndentStyle)
+	for i := 0; i < len(nodes); i += 2 {
+		names := []parse.Node{nodes[i]}
+		switch nodes[i].(type) {
+		case *parse.VectorNode, *parse.ListNode:
+			names = nodes[i].Children()
+		}
+		k, ok := nodes[i+1].(*parse.KeywordNode)
+		if !ok {
+			return configError(nodes[i+1], "indent style is not a keyword")
+		}
+		style, err := ParseIndentStyle(strings.TrimPrefix(k.Val, ":"))
+		if err != nil {
+			return configError(k, err.Error())
+		}
+		for _, name := range names {
+			s, ok := name.(*parse.StringNode)
+			if !ok {
+				return configError(name, "name is not a string")
+			}
+			c.IndentOverrides[s.Val] = style
+		}
+	}
+	return nil
+}
+
+func (c *Config) parseRequireAliases(v parse.Node) error {
+	m, ok := v.(*parse.MapNode)
+	if !ok || len(m.Nodes)%2 != 0 {
+		return configError(v, ":require-aliases must be a map from aliases to namespaces")
+	}
+	c.RequireAliases = make(map[string]string)
+	for i := 0; i < len(m.Nodes); i += 2 {
+		as, ok := m.Nodes[i].(*parse.SymbolNode)
+		if !ok {
+			return configError(m.Nodes[i], "alias is not a symbol")
+		}
+		ns, ok := m.Nodes[i+1].(*parse.SymbolNode)
+		if !ok {
+			return configError(m.Nodes[i+1], "namespace is not a symbol")
+		}
+		c.RequireAliases[as.Val] = ns.Val
+	}
+	return nil
+}
+
+func configError(n parse.Node, msg string) error {
+	return fmt.Errorf("%s: %s", n.Position(), msg)
+}
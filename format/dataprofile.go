@@ -0,0 +1,300 @@
+package format
+
+import (
+	"sort"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A DataProfile is a layout for a data DSL embedded in code. Profiles
+// prefer one element per line, which is easier to read and diff for
+// deeply nested data.
+type DataProfile int
+
+const (
+	// DataProfileNone leaves the data alone.
+	DataProfileNone DataProfile = iota
+	// DataProfileHiccup puts the children of each hiccup element on
+	// separate lines, if there are several and any of them is a nested
+	// element. The attribute map stays with the tag:
+	//   [:ul {:class "nav"}
+	//    [:li "one"]
+	//    [:li "two"]]
+	DataProfileHiccup
+	// DataProfileHoneySQL puts each clause of a HoneySQL query map on its
+	// own line, with the clause keywords aligned:
+	//   {:select [:id :name]
+	//    :from [:users]
+	//    :where [:= :id 1]}
+	DataProfileHoneySQL
+	// DataProfileBabashka lays out a bb.edn file, which mixes data with
+	// code. The entries of the top-level map, of the maps nested in its
+	// data, and of the :tasks map and each task map go on separate lines,
+	// and the tasks are sorted by name:
+	//   {:paths ["script"]
+	//    :tasks {build {:doc "Build"
+	//                   :task (shell "make")}
+	//            clean (fs/delete-tree "target")}}
+	// The code of the tasks (such as :task bodies and :init) is formatted
+	// as code, as usual.
+	DataProfileBabashka
+	// DataProfileDataReaders lays out a data_readers.clj or
+	// data_readers.cljc file, which maps reader tags to the vars that read
+	// them. The map is sorted by tag and has one mapping per line:
+	//   {app/id app.readers/read-id
+	//    app/money app.readers/read-money}
+	// Since the file is data, only the transforms in dataTransforms apply
+	// to it.
+	DataProfileDataReaders
+)
+
+// dataTransforms are the transforms which tidy data rather than code, and
+// so apply to files laid out with DataProfileDataReaders.
+var dataTransforms = map[Transform]bool{
+	TransformRemoveTrailingNewlines:  true,
+	TransformRemoveExtraBlankLines:   true,
+	TransformSortMarkedCollections:   true,
+	TransformCompactEmptyCollections: true,
+}
+
+// honeySQLClauses are the keywords which may begin a HoneySQL query map.
+var honeySQLClauses = map[string]bool{
+	":select":          true,
+	":select-distinct": true,
+	":insert-into":     true,
+	":update":          true,
+	":delete-from":     true,
+	":with":            true,
+	":union":           true,
+	":union-all":       true,
+}
+
+// applyDataProfiles lays out the data DSLs in t. The arguments of forms
+// named in p.DataProfiles use the corresponding profile. If p.DataProfile is
+// set, it is also used for every hiccup vector, HoneySQL query map, or (for
+// DataProfileBabashka and DataProfileDataReaders) top-level map in the file.
+func (p *Printer) applyDataProfiles(t *parse.Tree) {
+	if len(p.DataProfiles) == 0 && p.DataProfile == DataProfileNone {
+		return
+	}
+	heads := make([]string, 0, len(p.DataProfiles))
+	for head := range p.DataProfiles {
+		heads = append(heads, head)
+	}
+	sort.Strings(heads)
+	var visit func(n parse.Node)
+	visit = func(n parse.Node) {
+		if len(heads) > 0 && p.resolver.FnFormSymbol(n, heads...) {
+			profile := p.dataProfileFor(n.(*parse.ListNode), heads)
+			for _, arg := range n.Children()[1:] {
+				if m, ok := arg.(*parse.MapNode); ok && profile == DataProfileBabashka {
+					layoutBabashka(m, p.SortCollation)
+					continue
+				}
+				layoutData(arg, profile)
+			}
+			return
+		}
+		switch p.DataProfile {
+		case DataProfileBabashka:
+			if m, ok := n.(*parse.MapNode); ok {
+				layoutBabashka(m, p.SortCollation)
+				return
+			}
+		case DataProfileDataReaders:
+			if m, ok := n.(*parse.MapNode); ok {
+				sortCollection(m, p.SortCollation)
+				breakEntries(m)
+				return
+			}
+		case DataProfileHiccup:
+			if isHiccup(n) {
+				layoutData(n, DataProfileHiccup)
+				return
+			}
+		case DataProfileHoneySQL:
+			if isHoneySQLQuery(n) {
+				layoutData(n, DataProfileHoneySQL)
+				return
+			}
+		}
+		for _, child := range n.Children() {
+			visit(child)
+		}
+	}
+	for _, root := range t.Roots {
+		visit(root)
+	}
+}
+
+func (p *Printer) dataProfileFor(form *parse.ListNode, heads []string) DataProfile {
+	head := form.Nodes[0].(*parse.SymbolNode).Val
+	if profile, ok := p.DataProfiles[head]; ok {
+		return profile
+	}
+	for _, name := range heads {
+		if p.resolver.FnFormSymbol(form, name) {
+			return p.DataProfiles[name]
+		}
+	}
+	return DataProfileNone
+}
+
+// layoutData applies profile to n and the data nested within it.
+func layoutData(n parse.Node, profile DataProfile) {
+	for _, child := range n.Children() {
+		layoutData(child, profile)
+	}
+	switch profile {
+	case DataProfileHiccup:
+		if isHiccup(n) {
+			layoutHiccup(n.(*parse.VectorNode))
+		}
+	case DataProfileHoneySQL:
+		if m, ok := n.(*parse.MapNode); ok && keywordKeys(m) {
+			layoutHoneySQL(m)
+		}
+	}
+}
+
+func isHiccup(n parse.Node) bool {
+	v, ok := n.(*parse.VectorNode)
+	if !ok {
+		return false
+	}
+	_, idx := parse.SemanticChildren(v)
+	return len(idx) > 0 && goclj.Keyword(v.Nodes[idx[0]])
+}
+
+func isHoneySQLQuery(n parse.Node) bool {
+	m, ok := n.(*parse.MapNode)
+	if !ok {
+		return false
+	}
+	_, idx := parse.SemanticChildren(m)
+	if len(idx) == 0 {
+		return false
+	}
+	k, ok := m.Nodes[idx[0]].(*parse.KeywordNode)
+	return ok && honeySQLClauses[k.Val]
+}
+
+func keywordKeys(m *parse.MapNode) bool {
+	_, idx := parse.SemanticChildren(m)
+	for i := 0; i < len(idx); i += 2 {
+		if !goclj.Keyword(m.Nodes[idx[i]]) {
+			return false
+		}
+	}
+	return len(idx) > 0
+}
+
+func layoutHiccup(v *parse.VectorNode) {
+	_, children := parse.SemanticChildren(v)
+	children = children[1:]
+	if len(children) > 0 {
+		if _, ok := v.Nodes[children[0]].(*parse.MapNode); ok {
+			children = children[1:] // attributes
+		}
+	}
+	if len(children) < 2 {
+		return
+	}
+	nested := false
+	for _, i := range children {
+		switch v.Nodes[i].(type) {
+		case *parse.VectorNode, *parse.ListNode:
+			nested = true
+		}
+	}
+	if !nested {
+		return
+	}
+	for j := len(children) - 1; j >= 0; j-- {
+		v.Nodes = breakBefore(v.Nodes, children[j])
+	}
+}
+
+func layoutHoneySQL(m *parse.MapNode) {
+	breakEntries(m)
+}
+
+// breakEntries puts each entry of m on its own line.
+func breakEntries(m *parse.MapNode) {
+	elems, ok := elements(m)
+	if !ok {
+		return
+	}
+	for i := (len(elems) - 1) / 2 * 2; i >= 2; i -= 2 {
+		m.Nodes = breakBefore(m.Nodes, elems[i][0])
+	}
+}
+
+// babashkaCode are the keys of the :tasks map and of task maps whose values
+// are code.
+var babashkaCode = map[string]bool{
+	":requires": true,
+	":init":     true,
+	":enter":    true,
+	":leave":    true,
+	":task":     true,
+}
+
+// layoutBabashka lays out the top-level map of a bb.edn file.
+func layoutBabashka(m *parse.MapNode, c Collation) {
+	breakEntries(m)
+	nodes, _ := parse.SemanticChildren(m)
+	for i := 0; i+1 < len(nodes); i += 2 {
+		v, ok := nodes[i+1].(*parse.MapNode)
+		if !ok {
+			continue
+		}
+		if k, ok := nodes[i].(*parse.KeywordNode); ok && k.Val == ":tasks" {
+			layoutTasks(v, c)
+			continue
+		}
+		layoutDataMap(v)
+	}
+}
+
+// layoutTasks sorts the tasks of the :tasks map of a bb.edn file and puts
+// each entry of it and of the task maps on its own line.
+func layoutTasks(tasks *parse.MapNode, c Collation) {
+	sortCollection(tasks, c)
+	breakEntries(tasks)
+	nodes, _ := parse.SemanticChildren(tasks)
+	for i := 0; i+1 < len(nodes); i += 2 {
+		if _, ok := nodes[i].(*parse.KeywordNode); ok {
+			continue // an option such as :requires or :init
+		}
+		task, ok := nodes[i+1].(*parse.MapNode)
+		if !ok {
+			continue // a task given as a single form
+		}
+		breakEntries(task)
+		entries, _ := parse.SemanticChildren(task)
+		for j := 0; j+1 < len(entries); j += 2 {
+			if k, ok := entries[j].(*parse.KeywordNode); ok && babashkaCode[k.Val] {
+				continue
+			}
+			if v, ok := entries[j+1].(*parse.MapNode); ok {
+				layoutDataMap(v)
+			}
+		}
+	}
+}
+
+// layoutDataMap puts each entry of m, and of the maps nested in it, on its
+// own line if m has more than one entry.
+func layoutDataMap(m *parse.MapNode) {
+	nodes, _ := parse.SemanticChildren(m)
+	if len(nodes) > 2 {
+		breakEntries(m)
+	}
+	for i := 1; i < len(nodes); i += 2 {
+		if v, ok := nodes[i].(*parse.MapNode); ok {
+			layoutDataMap(v)
+		}
+	}
+}
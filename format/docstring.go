@@ -8,7 +8,13 @@ import (
 )
 
 func (p *Printer) markDocstrings(n parse.Node) {
-	if !goclj.FnFormSymbol(n, "ns", "defmulti", "def", "defmacro", "defn") {
+	if p.resolver.FnFormSymbol(n, "defmacro", "defn", "defn-") {
+		if d, ok := goclj.ParseDefn(n); ok && d.Docstring >= 0 {
+			p.docstrings[n.Children()[d.Docstring].(*parse.StringNode)] = struct{}{}
+		}
+		return
+	}
+	if !p.resolver.FnFormSymbol(n, "ns", "defmulti", "def") {
 		return
 	}
 	nodes := n.Children()
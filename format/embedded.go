@@ -0,0 +1,213 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// CodeBlockLangs are the languages of the code blocks that
+// FormatCodeBlocks formats.
+var CodeBlockLangs = []string{"clojure", "clj", "cljs", "cljc", "clojurescript", "edn"}
+
+// FormatCodeBlocks formats the Clojure code blocks of doc, a Markdown or
+// AsciiDoc document, and returns the rewritten document. The blocks it
+// formats are Markdown fenced code blocks (``` or ~~~) and AsciiDoc source
+// listings ([source,clojure] followed by a ---- delimited block) whose
+// language is one of CodeBlockLangs. The rest of doc, including the other
+// code blocks, is unchanged. If config is non-nil, it is called to
+// configure the Printer for each block.
+//
+// A block which can't be parsed (perhaps it's an incomplete example) is
+// left as it is. The document is returned all the same, along with a
+// parse.ErrorList giving the line of doc at which each such block starts.
+func FormatCodeBlocks(doc []byte, config func(*Printer)) ([]byte, error) {
+	lines := strings.SplitAfter(string(doc), "\n")
+	var out bytes.Buffer
+	var errs parse.ErrorList
+	write := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+	for i := 0; i < len(lines); {
+		b, ok := openCodeBlock(lines, i)
+		if !ok {
+			write(lines[i : i+1])
+			i++
+			continue
+		}
+		write(lines[i:b.start])
+		end := b.start
+		for end < len(lines) && !b.isClose(lines[end]) {
+			end++
+		}
+		if end == len(lines) {
+			// An unclosed block runs to the end of the document; leave
+			// it alone.
+			write(lines[b.start:])
+			break
+		}
+		code := lines[b.start:end]
+		if b.clojure && len(code) > 0 {
+			formatted, err := formatCodeBlock(code, b.indent, config)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("code block at line %d: %s", b.start, err))
+			} else {
+				code = []string{formatted}
+			}
+		}
+		write(code)
+		write(lines[end : end+1])
+		i = end + 1
+	}
+	if len(errs) > 0 {
+		return out.Bytes(), errs
+	}
+	return out.Bytes(), nil
+}
+
+// A codeBlock is a code block of a document, as found by openCodeBlock.
+type codeBlock struct {
+	start   int  // the index of the first line of code
+	clojure bool // whether the block's language is in CodeBlockLangs
+	// indent is the number of spaces by which a Markdown fence, and so the
+	// code inside it, is indented.
+	indent  int
+	isClose func(line string) bool
+}
+
+// openCodeBlock reports whether lines[i] opens a code block and, if so,
+// returns the block.
+func openCodeBlock(lines []string, i int) (codeBlock, bool) {
+	line := strings.TrimRight(lines[i], " \t\r\n")
+	if b, ok := openFence(line); ok {
+		b.start = i + 1
+		return b, true
+	}
+	// An AsciiDoc listing only counts as a code block after a
+	// [source,lang] line, since in Markdown a line of dashes underlines a
+	// heading.
+	if i > 0 && isListingDelim(line) && asciidocSourceLang(lines[i-1]) != "" {
+		b := codeBlock{
+			start:   i + 1,
+			clojure: isCodeBlockLang(asciidocSourceLang(lines[i-1])),
+		}
+		b.isClose = func(l string) bool { return strings.TrimRight(l, " \t\r\n") == line }
+		return b, true
+	}
+	return codeBlock{}, false
+}
+
+// openFence reports whether line (without its newline) is the opening
+// fence of a Markdown fenced code block.
+func openFence(line string) (codeBlock, bool) {
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	if indent > 3 {
+		return codeBlock{}, false
+	}
+	line = line[indent:]
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return codeBlock{}, false
+	}
+	c := line[0]
+	n := len(line) - len(strings.TrimLeft(line, string(c)))
+	info := strings.TrimSpace(line[n:])
+	if c == '`' && strings.Contains(info, "`") {
+		return codeBlock{}, false
+	}
+	var lang string
+	if fields := strings.Fields(info); len(fields) > 0 {
+		lang = strings.Trim(fields[0], "{}.")
+	}
+	b := codeBlock{
+		clojure: isCodeBlockLang(lang),
+		indent:  indent,
+		isClose: func(l string) bool {
+			l = strings.TrimRight(l, " \t\r\n")
+			trimmed := strings.TrimLeft(l, " ")
+			if len(l)-len(trimmed) > 3 {
+				return false
+			}
+			return len(trimmed) >= n && strings.Trim(trimmed, string(c)) == ""
+		},
+	}
+	return b, true
+}
+
+// isListingDelim reports whether line (without its newline) delimits an
+// AsciiDoc listing block.
+func isListingDelim(line string) bool {
+	return len(line) >= 4 && strings.Trim(line, "-") == ""
+}
+
+// asciidocSourceLang returns the language given by line if it is an
+// AsciiDoc source block attribute list such as [source,clojure], or ""
+// otherwise.
+func asciidocSourceLang(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return ""
+	}
+	attrs := strings.Split(line[1:len(line)-1], ",")
+	if len(attrs) < 2 || strings.TrimSpace(attrs[0]) != "source" {
+		return ""
+	}
+	return strings.TrimSpace(attrs[1])
+}
+
+func isCodeBlockLang(lang string) bool {
+	lang = strings.ToLower(lang)
+	for _, l := range CodeBlockLangs {
+		if lang == l {
+			return true
+		}
+	}
+	return false
+}
+
+// formatCodeBlock formats the lines of code of a code block whose fence is
+// indented by indent spaces, and returns the formatted lines.
+func formatCodeBlock(lines []string, indent int, config func(*Printer)) (string, error) {
+	var src strings.Builder
+	for _, line := range lines {
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if n > indent {
+			n = indent
+		}
+		src.WriteString(line[n:])
+	}
+	if strings.TrimSpace(src.String()) == "" {
+		return strings.Join(lines, ""), nil
+	}
+	tree, err := parse.Reader(strings.NewReader(src.String()), "code", parse.IncludeNonSemantic)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	if config != nil {
+		config(p)
+	}
+	if err := p.PrintTree(tree); err != nil {
+		return "", err
+	}
+	formatted := buf.String()
+	if !strings.HasSuffix(formatted, "\n") {
+		formatted += "\n"
+	}
+	if indent == 0 {
+		return formatted, nil
+	}
+	var out strings.Builder
+	prefix := strings.Repeat(" ", indent)
+	for _, line := range strings.SplitAfter(formatted, "\n") {
+		if line != "" && line != "\n" {
+			out.WriteString(prefix)
+		}
+		out.WriteString(line)
+	}
+	return out.String(), nil
+}
@@ -1,10 +1,12 @@
 package format
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/parse"
@@ -12,11 +14,15 @@ import (
 
 // A Printer writes a parse tree with proper indentation.
 type Printer struct {
-	*bufWriter
 	// IndentChar is the character used for indentation
 	// (by default, ' ' is used).
 	IndentChar rune
 	// IndentOverrides allow setting specific indentation styles for forms.
+	// Each key is the head symbol of a form, either unqualified (as
+	// "with-thing"), to match it whatever its namespace, or qualified (as
+	// "my.lib/with-thing"), to match only a head symbol which resolves to
+	// it through the ns form's aliases and refers. Qualified keys take
+	// precedence.
 	IndentOverrides map[string]IndentStyle
 	// ThreadFirstStyleOverrides allow specifying custom thread-first
 	// macros.
@@ -25,6 +31,114 @@ type Printer struct {
 	// Transforms toggles the set of transformations to apply.
 	// This map overrides values in DefaultTransforms.
 	Transforms map[Transform]bool
+	// FormAliases makes the transforms and indentation rules for built-in
+	// forms apply to user macros which behave like them. Each key is the
+	// head symbol of a macro (qualified, as "my.macros/defhandler", or
+	// not), and its value is the form it is like, such as "defn". See
+	// goclj.Resolver.TreatAs. IndentOverrides take precedence.
+	FormAliases map[string]string
+	// DataProfiles selects a DataProfile for the arguments of forms with
+	// the given head symbols, such as "html" or "sql/format".
+	DataProfiles map[string]DataProfile
+	// DataProfile, if set, is applied to every hiccup vector or HoneySQL
+	// query map in the tree (or, for DataProfileBabashka and
+	// DataProfileDataReaders, to its top-level map).
+	DataProfile DataProfile
+
+	// MaxBlankLines sets the number of consecutive blank lines that
+	// TransformRemoveExtraBlankLines leaves in each context. This map
+	// overrides values in DefaultMaxBlankLines.
+	MaxBlankLines map[BlankLineContext]int
+	// BlankLinesAfterNS is the number of blank lines (0, 1, or 2) that
+	// TransformBlankLinesAfterNS leaves after the ns form. NewPrinter
+	// sets it to 1.
+	BlankLinesAfterNS int
+	// LineWidth is the width, in characters, to which
+	// TransformReflowComments wraps comments. NewPrinter sets it to 80.
+	LineWidth int
+	// ExpandQuotes makes TransformNormalizeQuotes rewrite 'x and #'x as
+	// (quote x) and (var x), rather than the reverse.
+	ExpandQuotes bool
+
+	// SortCollation is the order used by TransformSortImportRequire to
+	// sort libspecs and imports.
+	SortCollation Collation
+	// RequireAliases maps aliases to the namespaces for which
+	// TransformAddMissingRequires adds requires. If it is nil,
+	// DefaultAliases is used.
+	RequireAliases map[string]string
+
+	// Dialect selects dialect-specific formatting rules. For
+	// goclj.DialectBabashka, the :requires of bb.edn tasks are sorted
+	// along with ns forms.
+	Dialect goclj.Dialect
+
+	// TransformWorkers is the number of goroutines used to apply
+	// Transforms to the top-level forms of a tree. Each form is
+	// transformed independently, so the output is the same for any
+	// value; values of 1 or less transform the forms one at a time.
+	TransformWorkers int
+
+	// MemoryBudget, if positive, is the approximate number of bytes
+	// Format may use to hold the input and its parse. See Format.
+	MemoryBudget int64
+
+	// Tracer, if non-nil, is called around each phase of formatting so
+	// that its time can be attributed in the caller's profiles.
+	Tracer Tracer
+
+	// PrintedPositions, if non-nil, is filled in with the position in the
+	// output of each node that is printed (after transformation). The
+	// Name of each position is that of the node's original position.
+	PrintedPositions map[parse.Node]parse.Pos
+	// UpdatePositions sets the position of each printed node to its
+	// position in the output, so that a transformed tree is consistent
+	// with the formatted code. Otherwise, nodes keep their positions in
+	// the input (and nodes created by transforms have zero positions).
+	// It has no effect if KeepTree is set.
+	UpdatePositions bool
+	// SourceMap, if non-nil, is filled in with the input and output
+	// positions of the printed nodes.
+	SourceMap *SourceMap
+
+	// PreserveAlignment keeps forms which were aligned into columns in
+	// the input (such as the values of a map, the bindings of a let, or
+	// the rows of an are table) aligned, rather than separating them by
+	// single spaces.
+	PreserveAlignment bool
+
+	// WhitespaceOnly limits formatting to whitespace: the indentation of
+	// each line, the spacing between forms on a line, and trailing
+	// whitespace. No Transforms or data profiles are applied and
+	// docstrings are left as they are, so the output has the same forms,
+	// in the same order, on the same lines as the input.
+	WhitespaceOnly bool
+
+	// KeepTree makes PrintTree leave its tree unchanged by applying the
+	// Transforms to a copy of it, so that the same tree can be printed
+	// several times with different configurations (say, to preview
+	// compact and expanded output) without parsing it again. The keys of
+	// PrintedPositions are still the nodes of the given tree, apart from
+	// nodes created by transforms.
+	KeepTree bool
+
+	// Verbatim prints each form which the Transforms and data profiles
+	// leave unchanged exactly as it appears in the input, with its
+	// original indentation, spacing, commas, and comments, along with the
+	// whitespace between such forms. Only the forms which were changed
+	// are formatted, so if nothing is changed the output is identical to
+	// the input. This requires a tree parsed by parse.Reader or
+	// parse.File with parse.IncludeNonSemantic; for trees without their
+	// source, Verbatim has no effect.
+	Verbatim bool
+	// Snapshot, if non-nil, records the tree as it was before the caller
+	// edited it (say, to add a dependency to a project file). With
+	// Verbatim, the forms which the caller's edits changed are then
+	// formatted along with those which the Transforms change; otherwise,
+	// edits made before PrintTree is called go unnoticed, and the edited
+	// forms are printed as they appear in the input. It has no effect with
+	// KeepTree.
+	Snapshot *Snapshot
 
 	// indentStyles is the union of defaultIndents and IndentOverrides.
 	indentStyles map[string]IndentStyle
@@ -34,21 +148,116 @@ type Printer struct {
 	specialIndent     map[parse.Node]IndentStyle
 	threadFirst       map[*parse.ListNode]struct{}
 	docstrings        map[*parse.StringNode]struct{}
+	// alignSpaces is the number of spaces to print before each node
+	// which is aligned with the nodes above it (if more than one).
+	alignSpaces map[parse.Node]int
+	// resolver resolves aliased and referred head symbols using the ns
+	// form of the tree being printed.
+	resolver *goclj.Resolver
+	// For Verbatim printing, src is the source of the tree being
+	// printed, before maps each node of the tree to a copy made before
+	// the transforms, and intact records which nodes are unchanged.
+	src    []byte
+	before map[parse.Node]parse.Node
+	intact map[parse.Node]bool
+
+	// The output is built up in buf, which is written to w whenever it
+	// grows past flushSize and at the end of PrintTree.
+	w   io.Writer
+	buf []byte
+	// indent holds the longest run of IndentChars written so far.
+	indent []byte
+	// positions records the output positions of nodes, and ends their
+	// output ends (for UpdatePositions). The position of the output up to
+	// buf[posBuf] is outPos.
+	positions map[parse.Node]parse.Pos
+	ends      map[parse.Node]parse.Pos
+	outPos    parse.Pos
+	posBuf    int
 }
 
 // NewPrinter creates a printer to the given writer.
 func NewPrinter(w io.Writer) *Printer {
 	return &Printer{
-		bufWriter:     &bufWriter{bufio.NewWriter(w)},
-		IndentChar:    ' ',
-		specialIndent: make(map[parse.Node]IndentStyle),
-		threadFirst:   make(map[*parse.ListNode]struct{}),
-		docstrings:    make(map[*parse.StringNode]struct{}),
+		w:                 w,
+		IndentChar:        ' ',
+		BlankLinesAfterNS: 1,
+		LineWidth:         80,
+		specialIndent:     make(map[parse.Node]IndentStyle),
+		threadFirst:       make(map[*parse.ListNode]struct{}),
+		docstrings:        make(map[*parse.StringNode]struct{}),
+		alignSpaces:       make(map[parse.Node]int),
 	}
 }
 
-// PrintTree writes t to p's writer.
+// PrintTree writes t to p's writer. Unless p.KeepTree is set, the
+// Transforms are applied to t itself.
 func (p *Printer) PrintTree(t *parse.Tree) (err error) {
+	p.init()
+	defer p.recoverErr(&err)
+	var orig map[parse.Node]parse.Node
+	if p.KeepTree {
+		cp := t.Copy()
+		if p.PrintedPositions != nil {
+			orig = make(map[parse.Node]parse.Node)
+			pairNodes(orig, cp.Roots, t.Roots)
+		}
+		t = cp
+	}
+	p.resolver = p.newResolver(t)
+	p.printRoots(t, p.Transforms)
+	p.flush()
+	for n, pos := range p.PrintedPositions {
+		if o, ok := orig[n]; ok {
+			delete(p.PrintedPositions, n)
+			p.PrintedPositions[o] = pos
+		}
+	}
+	return nil
+}
+
+// A Snapshot records the nodes of a tree as they were when it was taken, for
+// Printer.Snapshot.
+type Snapshot struct {
+	nodes map[parse.Node]parse.Node // each node to a copy of it
+}
+
+// NewSnapshot takes a snapshot of t.
+func NewSnapshot(t *parse.Tree) *Snapshot {
+	s := &Snapshot{nodes: make(map[parse.Node]parse.Node)}
+	pairNodes(s.nodes, t.Roots, t.Copy().Roots)
+	return s
+}
+
+// pairNodes records in m the node of to which corresponds to each node of
+// from (and their descendants), where one is a copy of the other (see
+// parse.Copy).
+func pairNodes(m map[parse.Node]parse.Node, from, to []parse.Node) {
+	for i, n := range from {
+		m[n] = to[i]
+		pairNodes(m, n.Children(), to[i].Children())
+	}
+}
+
+// newResolver returns a Resolver for t which treats p.FormAliases like the
+// forms they stand for. If t is nil, it returns a Resolver which matches
+// head symbols literally (nil, unless there are FormAliases).
+func (p *Printer) newResolver(t *parse.Tree) *goclj.Resolver {
+	if t == nil {
+		if len(p.FormAliases) == 0 {
+			return nil
+		}
+		t = &parse.Tree{}
+	}
+	r := goclj.NewResolver(t)
+	for name, form := range p.FormAliases {
+		r.TreatAs(name, form)
+	}
+	return r
+}
+
+// init sets up p's styles and transforms at the start of printing.
+func (p *Printer) init() {
 	p.indentStyles = make(map[string]IndentStyle)
 	for k, v := range defaultIndents {
 		p.indentStyles[k] = v
@@ -63,6 +272,19 @@ func (p *Printer) PrintTree(t *parse.Tree) (err error) {
 	for k, v := range p.ThreadFirstStyleOverrides {
 		p.threadFirstStyles[k] = v
 	}
+	for name, form := range p.FormAliases {
+		name = goclj.SymbolName(name)
+		if _, ok := p.IndentOverrides[name]; !ok {
+			if style, ok := p.indentStyles[form]; ok {
+				p.indentStyles[name] = style
+			}
+		}
+		if _, ok := p.ThreadFirstStyleOverrides[name]; !ok {
+			if style, ok := p.threadFirstStyles[form]; ok {
+				p.threadFirstStyles[name] = style
+			}
+		}
+	}
 	if p.Transforms == nil {
 		p.Transforms = DefaultTransforms
 	} else {
@@ -72,56 +294,159 @@ func (p *Printer) PrintTree(t *parse.Tree) (err error) {
 			}
 		}
 	}
-	defer func() {
-		if e := recover(); e != nil {
-			switch e := e.(type) {
-			case bufErr:
-				err = e
-			case fmtErr:
-				err = e
-			default:
-				panic(e)
-			}
+	p.buf = p.buf[:0]
+	p.outPos = parse.Pos{Line: 1, Col: 1}
+	p.posBuf = 0
+}
+
+// recoverErr turns the panics used to abort printing into an error.
+func (p *Printer) recoverErr(err *error) {
+	if e := recover(); e != nil {
+		switch e := e.(type) {
+		case writeErr:
+			*err = e.error
+		case fmtErr:
+			*err = e
+		default:
+			panic(e)
 		}
-	}()
-	applyTransforms(t, p.Transforms)
+	}
+}
+
+// printRoots applies transforms to the top-level forms of t and prints them.
+func (p *Printer) printRoots(t *parse.Tree, transforms map[Transform]bool) {
+	p.src, p.before, p.intact = nil, nil, nil
+	if p.Verbatim && t.Source() != nil {
+		p.src = t.Source()
+		p.intact = make(map[parse.Node]bool)
+		if p.Snapshot != nil && !p.KeepTree {
+			p.before = p.Snapshot.nodes
+		} else {
+			p.before = make(map[parse.Node]parse.Node)
+			pairNodes(p.before, t.Roots, t.Copy().Roots)
+		}
+	}
+	if !p.WhitespaceOnly {
+		p.applyTransforms(t, transforms)
+		end := p.trace("data-profiles")
+		p.applyDataProfiles(t)
+		end()
+	}
+	end := p.trace("print")
+	defer end()
 	for _, node := range t.Roots {
-		p.markDocstrings(node)
+		if !p.WhitespaceOnly {
+			p.markDocstrings(node)
+		}
 		p.markThreadFirsts(node)
+		if p.PreserveAlignment {
+			p.markAlignment(node)
+		}
+	}
+	p.positions = p.PrintedPositions
+	if p.positions == nil && (p.UpdatePositions || p.SourceMap != nil) {
+		p.positions = make(map[parse.Node]parse.Pos)
+	}
+	if p.UpdatePositions && !p.KeepTree {
+		p.ends = make(map[parse.Node]parse.Pos)
+	}
+	if len(t.Roots) > 0 {
+		if gap, ok := p.verbatimGap(nil, t.Roots[0]); ok {
+			p.writeString(gap)
+		}
 	}
 	p.printSequence(t.Roots, 0, IndentNormal)
-	return p.bw.Flush()
+	if len(t.Roots) > 0 {
+		if gap, ok := p.verbatimGap(t.Roots[len(t.Roots)-1], nil); ok {
+			p.writeString(gap)
+		}
+	}
+	if p.UpdatePositions && !p.KeepTree {
+		for n, pos := range p.positions {
+			*n.Position() = pos
+		}
+		for n, end := range p.ends {
+			*n.End() = end
+		}
+		p.ends = nil
+	}
+	if p.PrintedPositions == nil {
+		p.positions = nil
+	}
+}
+
+// recordPosition records the output position of n, which is about to be
+// printed.
+func (p *Printer) recordPosition(n parse.Node) {
+	p.advancePosition()
+	in := *n.Position()
+	pos := p.outPos
+	pos.Name = in.Name
+	p.positions[n] = pos
+	if p.SourceMap != nil && in.Line > 0 {
+		p.SourceMap.add(in, pos)
+	}
+}
+
+// advancePosition updates outPos to the end of buf.
+// recordEnd records the output end of n, which has just been printed.
+func (p *Printer) recordEnd(n parse.Node) {
+	p.advancePosition()
+	end := p.outPos
+	end.Name = n.Position().Name
+	p.ends[n] = end
+}
+
+func (p *Printer) advancePosition() {
+	for _, b := range p.buf[p.posBuf:] {
+		p.outPos.Offset++
+		p.outPos.Col++
+		if b == '\n' {
+			p.outPos.Line++
+			p.outPos.Col = 1
+		}
+	}
+	p.posBuf = len(p.buf)
 }
 
 // printNode prints a representation of node using w, the given indent level
 // as a baseline. It returns the new indent.
 func (p *Printer) printNode(node parse.Node, w int) int {
+	if p.ends != nil {
+		defer p.recordEnd(node)
+	}
+	if p.isIntact(node) {
+		return p.printVerbatim(node, w)
+	}
+	if p.positions != nil {
+		p.recordPosition(node)
+	}
 	switch node := node.(type) {
 	case *parse.BoolNode:
 		if node.Val {
-			return w + p.WriteString("true")
+			return w + p.writeString("true")
 		} else {
-			return w + p.WriteString("false")
+			return w + p.writeString("false")
 		}
 	case *parse.CharacterNode:
-		return w + p.WriteString(node.Text)
+		return w + p.writeString(node.Text)
 	case *parse.CommentNode:
-		return w + p.WriteString(node.Text)
+		return w + p.writeString(strings.TrimRight(node.Text, " \t"))
 	case *parse.DerefNode:
-		w += p.WriteByte('@')
+		w += p.writeByte('@')
 		return p.printNode(node.Node, w)
 	case *parse.FnLiteralNode:
-		w += p.WriteString("#(")
+		w += p.writeString("#(")
 		w = p.printSequence(node.Nodes, w, p.chooseIndent(node.Nodes))
-		return w + p.WriteString(")")
+		return w + p.writeString(")")
 	case *parse.ReaderDiscardNode:
-		w += p.WriteString("#_")
+		w += p.writeString("#_")
 		return p.printNode(node.Node, w)
 	case *parse.ReaderEvalNode:
-		w += p.WriteString("#=")
+		w += p.writeString("#=")
 		return p.printNode(node.Node, w)
 	case *parse.KeywordNode:
-		return w + p.WriteString(node.Val)
+		return w + p.writeString(node.Val)
 	case *parse.ListNode:
 		p.applySpecialIndentRules(node)
 		var style IndentStyle
@@ -134,53 +459,61 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		if _, ok := p.threadFirst[node]; ok {
 			style = style.threadFirstTransform()
 		}
-		w += p.WriteString("(")
+		w += p.writeString("(")
 		w = p.printSequence(node.Nodes, w, style)
-		return w + p.WriteString(")")
+		return w + p.writeString(")")
 	case *parse.MapNode:
-		w += p.WriteString("{")
+		w += p.writeString("{")
+		w = p.printSequence(node.Nodes, w, indentBindings)
+		return w + p.writeString("}")
+	case *parse.NamespacedMapNode:
+		w += p.writeString("#" + node.Namespace + "{")
 		w = p.printSequence(node.Nodes, w, indentBindings)
-		return w + p.WriteString("}")
+		return w + p.writeString("}")
 	case *parse.MetadataNode:
-		w += p.WriteByte('^')
+		w += p.writeByte('^')
 		return p.printNode(node.Node, w)
 	case *parse.NewlineNode:
 		panic("should not happen")
 	case *parse.NilNode:
-		return w + p.WriteString("nil")
+		return w + p.writeString("nil")
 	case *parse.NumberNode:
-		return w + p.WriteString(node.Val)
+		return w + p.writeString(node.Val)
 	case *parse.QuoteNode:
-		w += p.WriteByte('\'')
+		w += p.writeByte('\'')
 		return p.printNode(node.Node, w)
 	case *parse.RegexNode:
-		return w + p.WriteString(`#"`+node.Val+`"`)
+		return w + p.writeString(`#"`+node.Val+`"`)
 	case *parse.SetNode:
-		w += p.WriteString("#{")
+		w += p.writeString("#{")
 		w = p.printSequence(node.Nodes, w, IndentNormal)
-		return w + p.WriteString("}")
+		return w + p.writeString("}")
 	case *parse.StringNode:
 		val := node.Val
 		if _, ok := p.docstrings[node]; ok {
 			val = p.alignDocstring(val, w)
 			delete(p.docstrings, node)
 		}
-		return w + p.WriteString(`"`+val+`"`)
+		return w + p.writeString(`"`+val+`"`)
 	case *parse.SymbolNode:
-		return w + p.WriteString(node.Val)
+		return w + p.writeString(node.Val)
 	case *parse.SyntaxQuoteNode:
-		w += p.WriteByte('`')
+		w += p.writeByte('`')
 		return p.printNode(node.Node, w)
 	case *parse.TagNode:
-		return w + p.WriteString("#"+node.Val)
+		return w + p.writeString("#"+node.Val)
 	case *parse.UnquoteNode:
-		w += p.WriteByte('~')
+		w += p.writeByte('~')
+		if _, ok := node.Node.(*parse.DerefNode); ok {
+			// Otherwise it would read as ~@ (unquote-splicing).
+			w += p.writeByte(' ')
+		}
 		return p.printNode(node.Node, w)
 	case *parse.UnquoteSpliceNode:
-		w += p.WriteString("~@")
+		w += p.writeString("~@")
 		return p.printNode(node.Node, w)
 	case *parse.VarQuoteNode:
-		return w + p.WriteString("#'"+node.Val)
+		return w + p.writeString("#'"+node.Val)
 	case *parse.VectorNode:
 		style, ok := p.specialIndent[node]
 		if ok {
@@ -188,9 +521,17 @@ func (p *Printer) printNode(node parse.Node, w int) int {
 		} else {
 			style = IndentNormal
 		}
-		w += p.WriteString("[")
+		w += p.writeString("[")
 		w = p.printSequence(node.Nodes, w, style)
-		return w + p.WriteString("]")
+		return w + p.writeString("]")
+	case *parse.ErrorNode:
+		// Text with a syntax error (see parse.Recover) is printed as
+		// it was written.
+		p.writeString(node.Text)
+		if i := strings.LastIndexByte(node.Text, '\n'); i >= 0 {
+			return len(node.Text) - i - 1
+		}
+		return w + len(node.Text)
 	default:
 		fmtErrf("%s: unhandled node type %T", node.Position(), node)
 	}
@@ -208,7 +549,7 @@ func (p *Printer) applySpecialIndentRules(node *parse.ListNode) {
 	if !ok {
 		return
 	}
-	if style, ok := p.indentStyles[symbolName(s.Val)]; ok {
+	if style, ok := p.indentStyle(s.Val); ok {
 		switch style {
 		case IndentLet:
 			p.applySpecialLet(node.Nodes)
@@ -271,10 +612,10 @@ func (p *Printer) chooseIndent(nodes []parse.Node) IndentStyle {
 }
 
 func (p *Printer) chooseListIndent(name string) IndentStyle {
-	name = symbolName(name)
-	if style, ok := p.indentStyles[name]; ok {
+	if style, ok := p.indentStyle(name); ok {
 		return style
 	}
+	name = goclj.SymbolName(p.resolver.Resolve(name))
 	for _, prefix := range []string{"def", "let", "send-", "with-", "when-"} {
 		if strings.HasPrefix(name, prefix) {
 			return IndentListBody
@@ -283,11 +624,15 @@ func (p *Printer) chooseListIndent(name string) IndentStyle {
 	return IndentList
 }
 
-func symbolName(sym string) string {
-	if i := strings.LastIndex(sym, "/"); i >= 0 {
-		return sym[i+1:]
+// indentStyle returns the indentation style given for the head symbol sym
+// (by its fully-qualified name, or otherwise by its name alone), if any.
+func (p *Printer) indentStyle(sym string) (IndentStyle, bool) {
+	resolved := p.resolver.Resolve(sym)
+	if style, ok := p.indentStyles[resolved]; ok {
+		return style, true
 	}
-	return sym
+	style, ok := p.indentStyles[goclj.SymbolName(resolved)]
+	return style, ok
 }
 
 // A ThreadFirst style represents a variety of thread-first macro.
@@ -424,6 +769,7 @@ var defaultIndents = map[string]IndentStyle{
 	"extend":          IndentListBody,
 	"extend-protocol": IndentDeftype,
 	"extend-type":     IndentDeftype,
+	"fdef":            IndentListBody,
 	"fn":              IndentListBody,
 	"for":             IndentListBody,
 	"if":              IndentListBody,
@@ -537,7 +883,18 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 				}
 			}
 			w2 = w
-			p.WriteByte('\n')
+			if i > 0 {
+				if gap, ok := p.verbatimGap(nodes[i-1], n); ok {
+					p.writeString(gap)
+				}
+			}
+			if p.positions != nil {
+				p.recordPosition(n)
+			}
+			p.writeByte('\n')
+			if p.ends != nil {
+				p.recordEnd(n)
+			}
 			needIndent = true
 			needSpace = false
 			continue
@@ -561,11 +918,26 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 				w++
 			}
 		}
-		if needIndent {
-			p.WriteString(strings.Repeat(string(p.IndentChar), w))
+		gap, verbatim := "", false
+		if i > 0 {
+			gap, verbatim = p.verbatimGap(nodes[i-1], n)
+		}
+		if verbatim {
+			if needIndent {
+				w2 = 0
+			}
+			w2 += p.writeString(gap)
+		} else if needIndent {
+			p.writeIndent(w)
 		}
-		if needSpace {
-			w2 += p.WriteByte(' ')
+		if needSpace && !verbatim {
+			w2 += p.writeByte(' ')
+			if p.PreserveAlignment {
+				for i := p.alignSpaces[n]; i > 1; i-- {
+					w2 += p.writeByte(' ')
+				}
+				delete(p.alignSpaces, n)
+			}
 		}
 		w2 = p.printNode(n, w2)
 		if i == 0 {
@@ -582,39 +954,181 @@ func (p *Printer) printSequence(nodes []parse.Node, w int, style IndentStyle) in
 	// We need to put in a trailing indent here; the next token cannot be a
 	// newline (it will need to be the closing delimiter for this sequence).
 	if needIndent {
-		p.WriteString(strings.Repeat(string(p.IndentChar), w))
+		p.writeIndent(w)
 	}
 	return w2
 }
 
-type bufWriter struct {
-	bw *bufio.Writer
+// isIntact reports whether node is printed verbatim: whether it is
+// unchanged since before the transforms.
+func (p *Printer) isIntact(node parse.Node) bool {
+	if p.src == nil {
+		return false
+	}
+	intact, ok := p.intact[node]
+	if !ok {
+		before, ok := p.before[node]
+		intact = ok && reflect.DeepEqual(node, before)
+		p.intact[node] = intact
+	}
+	return intact
 }
 
-type bufErr struct{ error }
+// verbatimGap returns the text of the input between the nodes prev and next
+// (either of which may be nil, for the start or end of the input), and
+// reports whether it should be printed in place of the usual spacing:
+// whether they were next to each other in the input, separated only by
+// spaces and commas on the same line. Both must be intact, except that the
+// space between two forms on a line is kept even if the forms have been
+// changed (as long as they are still where they were in the input), so
+// that changing a form doesn't disturb the alignment of those after it.
+func (p *Printer) verbatimGap(prev, next parse.Node) (string, bool) {
+	if p.src == nil {
+		return "", false
+	}
+	kept := p.isIntact
+	if prev != nil && next != nil && !goclj.Newline(prev) && !goclj.Newline(next) {
+		kept = p.fromInput
+	}
+	start, end := 0, len(p.src)
+	if prev != nil {
+		if !kept(prev) {
+			return "", false
+		}
+		// prev may have been changed, so its end is that of the
+		// original.
+		start = parse.End(p.before[prev], p.src)
+	}
+	if next != nil {
+		if !kept(next) {
+			return "", false
+		}
+		end = p.start(next)
+	}
+	if start > end {
+		return "", false
+	}
+	for _, b := range p.src[start:end] {
+		if b != ' ' && b != '\t' && b != ',' && b != '\r' {
+			return "", false
+		}
+	}
+	return string(p.src[start:end]), true
+}
+
+// fromInput reports whether node was in the input, where it is still
+// positioned, for Verbatim printing.
+func (p *Printer) fromInput(node parse.Node) bool {
+	before, ok := p.before[node]
+	return ok && *before.Position() == *node.Position()
+}
 
-func (bw *bufWriter) Write(b []byte) (int, error) {
-	n, err := bw.bw.Write(b)
-	if err != nil {
-		panic(bufErr{err})
+// start returns the offset in the input at which node begins.
+func (p *Printer) start(node parse.Node) int {
+	off := node.Position().Offset
+	if _, ok := node.(*parse.TagNode); ok {
+		// The position of a tag is that of its name, after the #.
+		off = bytes.LastIndexByte(p.src[:off], '#')
 	}
-	return n, nil
+	return off
 }
 
-func (bw *bufWriter) WriteString(s string) int {
-	n, err := bw.bw.WriteString(s)
-	if err != nil {
-		panic(bufErr{err})
+// printVerbatim prints the intact node as it appears in the input, starting
+// at column w, and returns the column after it.
+func (p *Printer) printVerbatim(node parse.Node, w int) int {
+	start := p.start(node)
+	text := p.src[start:parse.End(node, p.src)]
+	if p.positions != nil {
+		p.advancePosition()
+		pos, off := p.outPos, start
+		var record func(n parse.Node)
+		record = func(n parse.Node) {
+			for _, b := range p.src[off:p.start(n)] {
+				pos.Offset++
+				pos.Col++
+				if b == '\n' {
+					pos.Line++
+					pos.Col = 1
+				}
+			}
+			off = p.start(n)
+			in := *n.Position()
+			out := pos
+			out.Name = in.Name
+			p.positions[n] = out
+			if p.SourceMap != nil && in.Line > 0 {
+				p.SourceMap.add(in, out)
+			}
+			if p.ends != nil {
+				// The text of n is the same in the output.
+				end := out
+				for _, b := range p.src[off:parse.End(n, p.src)] {
+					end.Offset++
+					end.Col++
+					if b == '\n' {
+						end.Line++
+						end.Col = 1
+					}
+				}
+				p.ends[n] = end
+			}
+			for _, child := range n.Children() {
+				record(child)
+			}
+		}
+		record(node)
 	}
-	return n
+	p.writeString(string(text))
+	if i := bytes.LastIndexByte(text, '\n'); i >= 0 {
+		return len(text) - i - 1
+	}
+	return w + len(text)
+}
+
+// flushSize is the size to which the output buffer may grow before it is
+// written out.
+const flushSize = 64 << 10
+
+type writeErr struct{ error }
+
+func (p *Printer) flush() {
+	if p.positions != nil {
+		p.advancePosition()
+	}
+	if _, err := p.w.Write(p.buf); err != nil {
+		panic(writeErr{err})
+	}
+	p.buf = p.buf[:0]
+	p.posBuf = 0
 }
-func (bw *bufWriter) WriteByte(b byte) int {
-	if err := bw.bw.WriteByte(b); err != nil {
-		panic(bufErr{err})
+
+// writeString appends s to the output and returns its length.
+func (p *Printer) writeString(s string) int {
+	p.buf = append(p.buf, s...)
+	if len(p.buf) >= flushSize {
+		p.flush()
 	}
+	return len(s)
+}
+
+func (p *Printer) writeByte(b byte) int {
+	p.buf = append(p.buf, b)
 	return 1
 }
 
+// writeIndent appends w IndentChars to the output.
+func (p *Printer) writeIndent(w int) {
+	var c [utf8.UTFMax]byte
+	n := utf8.EncodeRune(c[:], p.IndentChar)
+	for len(p.indent) < w*n {
+		p.indent = append(p.indent, c[:n]...)
+	}
+	p.buf = append(p.buf, p.indent[:w*n]...)
+	if len(p.buf) >= flushSize {
+		p.flush()
+	}
+}
+
 type fmtErr string
 
 func (e fmtErr) Error() string { return string(e) }
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/parse"
 )
 
@@ -32,6 +36,9 @@ func TestFixture(t *testing.T) {
 		"issue21",
 		"issue23",
 		"issue49",
+		"tags",
+		"nsmap",
+		"syntaxquote",
 	} {
 		t.Run(fixture, func(t *testing.T) {
 			testFixture(t, fixture+".clj")
@@ -50,6 +57,8 @@ func TestChange(t *testing.T) {
 		"issue26",
 		"issue32",
 		"issue37",
+		"resolve",
+		"sortmarked",
 	} {
 		t.Run(fixture, func(t *testing.T) {
 			testChange(t, fixture+"_before.clj", fixture+"_after.clj")
@@ -57,6 +66,52 @@ func TestChange(t *testing.T) {
 	}
 }
 
+func TestClojureScript(t *testing.T) {
+	testChange(t, "cljs_before.cljs", "cljs_after.cljs")
+}
+
+func TestTransformsFormatSchemas(t *testing.T) {
+	transforms := map[Transform]bool{TransformFormatSchemas: true}
+	testChangeTransforms(t, "schema_before.clj", "schema_after.clj", transforms)
+}
+
+func TestDataProfiles(t *testing.T) {
+	testChangeCustom(t, "dataprofile_before.clj", "dataprofile_after.clj", func(p *Printer) {
+		p.DataProfiles = map[string]DataProfile{
+			"hiccup.core/html": DataProfileHiccup,
+			"honey.sql/format": DataProfileHoneySQL,
+		}
+	})
+	testChangeCustom(t, "dataprofile_before.clj", "dataprofile_file_after.clj", func(p *Printer) {
+		p.DataProfile = DataProfileHiccup
+	})
+}
+
+func TestBabashkaTasks(t *testing.T) {
+	testChangeCustom(t, "bb_before.edn", "bb_after.edn", func(p *Printer) {
+		p.Dialect = goclj.DialectBabashka
+	})
+	// Without the dialect, the tasks are left alone.
+	testChange(t, "bb_before.edn", "bb_before.edn")
+}
+
+func TestBabashkaProfile(t *testing.T) {
+	testChangeCustom(t, "bbprofile_before.edn", "bbprofile_after.edn", func(p *Printer) {
+		p.Dialect = goclj.DialectBabashka
+		p.DataProfile = DataProfileBabashka
+	})
+}
+
+func TestFormAliases(t *testing.T) {
+	testChangeCustom(t, "formaliases_before.clj", "formaliases_after.clj", func(p *Printer) {
+		p.FormAliases = map[string]string{
+			"my.macros/defhandler": "defn",
+			"defcase":              "defmethod",
+			"mlet":                 "let",
+		}
+	})
+}
+
 func TestTransformsUseToRequire(t *testing.T) {
 	testChangeTransforms(
 		t,
@@ -66,6 +121,18 @@ func TestTransformsUseToRequire(t *testing.T) {
 	)
 }
 
+func TestTransformsSortReferLists(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"transform/referlists_before.clj",
+		"transform/referlists_after.clj",
+		map[Transform]bool{
+			TransformSortImportRequire: true,
+			TransformSortReferLists:    true,
+		},
+	)
+}
+
 func TestTransformsRemoveUnusedRequires(t *testing.T) {
 	testChangeTransforms(
 		t,
@@ -78,6 +145,170 @@ func TestTransformsRemoveUnusedRequires(t *testing.T) {
 	)
 }
 
+func TestTransformsCompactEmptyCollections(t *testing.T) {
+	testChangeTransforms(
+		t,
+		"transform/emptycoll_before.clj",
+		"transform/emptycoll_after.clj",
+		map[Transform]bool{
+			TransformRemoveTrailingNewlines:  false,
+			TransformCompactEmptyCollections: true,
+		},
+	)
+}
+
+func TestTransformsReflowComments(t *testing.T) {
+	testChangeCustom(
+		t,
+		"transform/reflow_before.clj",
+		"transform/reflow_after.clj",
+		func(p *Printer) {
+			p.Transforms = map[Transform]bool{TransformReflowComments: true}
+			p.LineWidth = 50
+		},
+	)
+}
+
+func TestTransformWorkers(t *testing.T) {
+	for _, fixture := range []string{"styleguide", "newline", "resolve"} {
+		t.Run(fixture, func(t *testing.T) {
+			testChangeCustom(t, fixture+"_before.clj", fixture+"_after.clj", func(p *Printer) {
+				p.TransformWorkers = 4
+			})
+		})
+	}
+	testChangeCustom(
+		t,
+		"transform/unusedrequires_before.clj",
+		"transform/unusedrequires_after.clj",
+		func(p *Printer) {
+			p.Transforms = map[Transform]bool{
+				TransformUseToRequire:         true,
+				TransformRemoveUnusedRequires: true,
+			}
+			p.TransformWorkers = 4
+		},
+	)
+}
+
+func TestPrintStream(t *testing.T) {
+	for _, fixture := range []string{
+		"simple1.clj",
+		"let.clj",
+		"threadfirst.clj",
+		"issue17.clj",
+		"styleguide_before.clj",
+		"newline_before.clj",
+		"require_before.clj",
+		"resolve_before.clj",
+		"sortmarked_before.clj",
+		"cljs_before.cljs",
+		"bb_before.edn",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := NewPrinter(&want).PrintTree(parseFile(t, fixture)); err != nil {
+				t.Fatal(err)
+			}
+			b := readFile(t, fixture)
+			s := parse.NewStream(bytes.NewReader(b), fixture, parse.IncludeNonSemantic)
+			var got bytes.Buffer
+			if err := NewPrinter(&got).PrintStream(s); err != nil {
+				t.Fatal(err)
+			}
+			check(t, fixture, got.Bytes(), want.Bytes())
+		})
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	const fixture = "styleguide_before.clj"
+	want := readFile(t, "styleguide_after.clj")
+	src := readFile(t, fixture)
+	// 20000 bytes is enough for each form but not for the whole file, so
+	// Format falls back to streaming.
+	for _, budget := range []int64{0, 1 << 20, 20000} {
+		var got bytes.Buffer
+		p := NewPrinter(&got)
+		p.MemoryBudget = budget
+		if err := p.Format(bytes.NewReader(src), fixture); err != nil {
+			t.Fatalf("budget %d: %s", budget, err)
+		}
+		check(t, fmt.Sprintf("%s (budget %d)", fixture, budget), got.Bytes(), want)
+	}
+	p := NewPrinter(ioutil.Discard)
+	p.MemoryBudget = 100
+	err := p.Format(bytes.NewReader(src), fixture)
+	if _, ok := err.(*parse.BudgetError); !ok {
+		t.Fatalf("with a tiny budget, got error %v; want *parse.BudgetError", err)
+	}
+}
+
+func TestPrintBuiltTree(t *testing.T) {
+	tree := parse.NewTree(
+		parse.Comment(";; Code generated by gen. DO NOT EDIT."),
+		parse.List(parse.Symbol("ns"), parse.Symbol("gen.api")),
+		parse.List(
+			parse.Symbol("def"), parse.Meta(parse.Keyword("private")), parse.Symbol("names"),
+			parse.Set(parse.String("a \"b\"\n"), parse.Char('\n'), parse.Char('x')),
+		),
+		parse.Tag("test"),
+		parse.List(
+			parse.Symbol("defn"), parse.Symbol("f"), parse.Vector(parse.Symbol("x")), parse.Newline(),
+			parse.List(
+				parse.Symbol("when"), parse.Symbol("x"), parse.Newline(),
+				parse.Map(parse.Keyword("n"), parse.Int(-1), parse.Keyword(":k"), parse.Nil()),
+			),
+		),
+	)
+	var buf bytes.Buffer
+	if err := NewPrinter(&buf).PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	const want = `;; Code generated by gen. DO NOT EDIT.
+(ns gen.api)
+
+(def ^:private names #{"a \"b\"\n" \newline \x})
+
+#test (defn f [x]
+        (when x
+          {:n -1 ::k nil}))
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var phases []string
+	p := NewPrinter(ioutil.Discard)
+	p.Tracer = func(phase string) func() {
+		phases = append(phases, phase)
+		return func() { phases = append(phases, "end "+phase) }
+	}
+	if err := p.Format(bytes.NewReader(readFile(t, "styleguide_before.clj")), "x.clj"); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, phase := range []string{
+		"parse",
+		"transform:sort-import-require",
+		"transform:sort-marked-collections",
+		"transform:remove-trailing-newlines",
+		"transform:fix-defn-arglist-newline",
+		"transform:fix-defmethod-dispatch-val-newline",
+		"transform:remove-extra-blank-lines",
+		"transform:blank-lines-after-ns",
+		"data-profiles",
+		"print",
+	} {
+		want = append(want, phase, "end "+phase)
+	}
+	if !reflect.DeepEqual(phases, want) {
+		t.Errorf("got phases\n%s\nwant\n%s", strings.Join(phases, "\n"), strings.Join(want, "\n"))
+	}
+}
+
 func TestCustomIndent(t *testing.T) {
 	const file0 = "indent1.clj"
 	const file1 = "indent1_custom.clj"
@@ -92,6 +323,121 @@ func TestCustomIndent(t *testing.T) {
 	testChangeCustom(t, file0, file1, f)
 }
 
+func TestQualifiedIndent(t *testing.T) {
+	const src = `(ns foo
+  (:require [my.lib :as t]
+            [my.lib2 :refer [with-thing]]
+            [other.lib :as o]))
+
+(t/with-thing a
+  b)
+
+(o/with-thing a
+              b)
+
+(with-thing a
+            b)
+
+(my.lib/with-thing a
+  b)
+`
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.IndentOverrides = map[string]IndentStyle{
+		"my.lib/with-thing": IndentListBody,
+		"with-thing":        IndentList,
+	}
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("got\n%s\nwant\n%s", got, src)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goclj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "src", "foo")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const conf = `{:transforms {:reflow-comments true :sort-import-require false}
+ :indent-overrides ["with-thing" :list-body
+                    ["GET" "POST"] :list]
+ :line-width 100
+ :require-aliases {json cheshire.core}
+ :generated-marker #"^;; @generated"
+ :lint {:disable ["unused-binding"]}}`
+	path := filepath.Join(dir, ConfigFile)
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := FindConfig(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Path: path,
+		Transforms: map[Transform]bool{
+			TransformReflowComments:    true,
+			TransformSortImportRequire: false,
+		},
+		IndentOverrides: map[string]IndentStyle{
+			"with-thing": IndentListBody,
+			"GET":        IndentList,
+			"POST":       IndentList,
+		},
+		LineWidth:      100,
+		RequireAliases: map[string]string{"json": "cheshire.core"},
+	}
+	if c.GeneratedMarker == nil || c.GeneratedMarker.String() != "^;; @generated" {
+		t.Errorf("got generated marker %v; want ^;; @generated", c.GeneratedMarker)
+	}
+	want.GeneratedMarker = c.GeneratedMarker
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got config %+v; want %+v", c, want)
+	}
+
+	p := NewPrinter(nil)
+	p.IndentOverrides = map[string]IndentStyle{"GET": IndentListBody, "PUT": IndentListBody}
+	c.Apply(p)
+	wantOverrides := map[string]IndentStyle{
+		"with-thing": IndentListBody,
+		"GET":        IndentList,
+		"POST":       IndentList,
+		"PUT":        IndentListBody,
+	}
+	if !reflect.DeepEqual(p.IndentOverrides, wantOverrides) || p.LineWidth != 100 ||
+		!p.Transforms[TransformReflowComments] {
+		t.Errorf("after Apply, got overrides %v, line width %d, transforms %v",
+			p.IndentOverrides, p.LineWidth, p.Transforms)
+	}
+	if p.RequireAliases["json"] != "cheshire.core" || p.RequireAliases["str"] != "clojure.string" {
+		t.Errorf("after Apply, got require aliases %v", p.RequireAliases)
+	}
+
+	for _, bad := range []string{
+		"[]",
+		"{:transforms {:no-such-transform true}}",
+		"{:transforms {:reflow-comments 1}}",
+		`{:indent-overrides ["x" :sideways]}`,
+		"{:line-width 0}",
+		`{:require-aliases {"json" cheshire.core}}`,
+	} {
+		if _, err := ParseConfig(strings.NewReader(bad), "temp"); err == nil {
+			t.Errorf("got nil error parsing config %s", bad)
+		}
+	}
+}
+
 func TestCustomTransforms(t *testing.T) {
 	const before = "transforms_before.clj"
 	const after = "transforms_after.clj"
@@ -101,6 +447,360 @@ func TestCustomTransforms(t *testing.T) {
 	})
 }
 
+func TestCapabilities(t *testing.T) {
+	f := Capabilities()
+	if len(f.Transforms) != len(AllTransforms()) {
+		t.Fatalf("got %d transforms; want %d", len(f.Transforms), len(AllTransforms()))
+	}
+	for _, info := range f.Transforms {
+		tr, err := ParseTransform(info.Name)
+		if err != nil {
+			t.Errorf("transform %q: %s", info.Name, err)
+			continue
+		}
+		if info.Default != DefaultTransforms[tr] {
+			t.Errorf("transform %q: got default %t", info.Name, info.Default)
+		}
+	}
+	for _, name := range f.IndentStyles {
+		if _, err := ParseIndentStyle(name); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, name := range f.BlankLineContexts {
+		if _, err := ParseBlankLineContext(name); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, name := range f.Collations {
+		if _, err := ParseCollation(name); err != nil {
+			t.Error(err)
+		}
+	}
+	values := map[string]string{
+		":transforms":       "{}",
+		":indent-overrides": "[]",
+		":line-width":       "80",
+		":require-aliases":  "{str clojure.string}",
+		":generated-marker": `#"^;; @generated"`,
+	}
+	for _, key := range f.ConfigKeys {
+		v, ok := values[key]
+		if !ok {
+			t.Errorf("no test value for config key %s", key)
+			continue
+		}
+		src := fmt.Sprintf("{%s %s}", key, v)
+		if _, err := ParseConfig(strings.NewReader(src), "config"); err != nil {
+			t.Errorf("config key %s: %s", key, err)
+		}
+	}
+	for _, key := range f.CommandConfigKeys {
+		if _, ok := values[key]; ok {
+			t.Errorf("config key %s is listed as read by both ParseConfig and cljfmt", key)
+		}
+	}
+}
+
+func TestSortCollation(t *testing.T) {
+	const src = `(ns foo
+  (:require [b.core]
+            [Zebra.core]
+            [a.core]))
+`
+	for _, tc := range []struct {
+		collation Collation
+		want      []string
+	}{
+		{CollationASCII, []string{"Zebra.core", "a.core", "b.core"}},
+		{CollationCaseInsensitive, []string{"a.core", "b.core", "Zebra.core"}},
+	} {
+		tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.SortCollation = tc.collation
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("(ns foo\n  (:require [%s]\n            [%s]\n            [%s]))\n",
+			tc.want[0], tc.want[1], tc.want[2])
+		if got := buf.String(); got != want {
+			t.Errorf("with %s collation: got\n%s\nwant\n%s", tc.collation, got, want)
+		}
+		c, err := ParseCollation(tc.collation.String())
+		if err != nil || c != tc.collation {
+			t.Errorf("ParseCollation(%q) = %v, %v", tc.collation, c, err)
+		}
+	}
+}
+
+func TestPrintRecovered(t *testing.T) {
+	const src = "(defn f [x]\n(g x ] \"y)\n  (h x))\n"
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic|parse.Recover)
+	if _, ok := err.(parse.ErrorList); !ok {
+		t.Fatalf("got error %v; want parse.ErrorList", err)
+	}
+	var buf bytes.Buffer
+	if err := NewPrinter(&buf).PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	want := "(defn f [x]\n  (g x ] \"y)\n  (h x))\n))"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSplitTopLevelForms(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"(def a 1) (def b 2) ; c\n", "(def a 1)\n(def b 2) ; c\n"},
+		{"(f) 1 :k\n", "(f)\n1\n:k\n"},
+		{"#inst \"2020\" #_(x) ^:m (y)\n", "#inst \"2020\" #_(x)\n^:m (y)\n"},
+		{"'^:m x @#t y\n", "'^:m x\n@#t y\n"},
+		{"(ns foo) (def x 1)\n", "(ns foo)\n\n(def x 1)\n"},
+		{"[1 2] [3\n4]\n", "[1 2]\n[3\n 4]\n"},
+	} {
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.Transforms = map[Transform]bool{TransformSplitTopLevelForms: true}
+		tree, err := parse.Reader(strings.NewReader(tc.src), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintTree of %q: got %q; want %q", tc.src, got, tc.want)
+		}
+
+		buf.Reset()
+		s := parse.NewStream(strings.NewReader(tc.src), "temp", parse.IncludeNonSemantic)
+		if err := p.PrintStream(s); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintStream of %q: got %q; want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeQuotes(t *testing.T) {
+	for _, tc := range []struct {
+		src    string
+		expand bool
+		want   string
+	}{
+		{"(quote x)\n(f (quote (a b)) (var g))\n", false, "'x\n(f '(a b) #'g)\n"},
+		{"(quote)\n(quote a b)\n(var (f))\n(quote ; c\n x)\n", false, "(quote)\n(quote a b)\n(var (f))\n(quote ; c\n       x)\n"},
+		{"'x\n(f '(a b) #'g)\n", true, "(quote x)\n(f (quote (a b)) (var g))\n"},
+		{"'^:m x\n", true, "'^:m x\n"},
+	} {
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.Transforms = map[Transform]bool{TransformNormalizeQuotes: true}
+		p.ExpandQuotes = tc.expand
+		tree, err := parse.Reader(strings.NewReader(tc.src), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("for %q with expand=%t: got %q; want %q", tc.src, tc.expand, got, tc.want)
+		}
+	}
+}
+
+func TestBlankLinesAfterNS(t *testing.T) {
+	for _, tc := range []struct {
+		src   string
+		blank int
+		want  string
+	}{
+		{"(ns foo)\n(def x 1)\n", 1, "(ns foo)\n\n(def x 1)\n"},
+		{"(ns foo)\n\n\n\n(def x 1)\n", 0, "(ns foo)\n(def x 1)\n"},
+		{"(ns foo)\n(def x 1)\n", 2, "(ns foo)\n\n\n(def x 1)\n"},
+		{"(ns foo) (def x 1)\n", 1, "(ns foo)\n\n(def x 1)\n"},
+		{"(ns foo) ; a\n;; b\n(def x 1)\n", 1, "(ns foo) ; a\n\n;; b\n(def x 1)\n"},
+		{"(ns foo)\n\n\n", 2, "(ns foo)\n\n"},
+		{"(def x 1)\n(def y 2)\n", 1, "(def x 1)\n(def y 2)\n"},
+	} {
+		tree, err := parse.Reader(strings.NewReader(tc.src), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.BlankLinesAfterNS = tc.blank
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintTree of %q with %d blank lines: got %q; want %q", tc.src, tc.blank, got, tc.want)
+		}
+
+		buf.Reset()
+		s := parse.NewStream(strings.NewReader(tc.src), "temp", parse.IncludeNonSemantic)
+		if err := p.PrintStream(s); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintStream of %q with %d blank lines: got %q; want %q", tc.src, tc.blank, got, tc.want)
+		}
+	}
+}
+
+func TestMaxBlankLines(t *testing.T) {
+	const src = "(def x 1)\n\n\n\n(let [a 1\n\n      b 2]\n\n  a\n\n\n  (f\n\n\n   b))\n"
+	for _, tc := range []struct {
+		max  map[BlankLineContext]int
+		want string
+	}{
+		{nil, "(def x 1)\n\n(let [a 1\n\n      b 2]\n  a\n  (f\n\n    b))\n"},
+		{
+			map[BlankLineContext]int{BlankLinesTopLevel: 2, BlankLinesLet: 1, BlankLinesOther: 0},
+			"(def x 1)\n\n\n(let [a 1\n      b 2]\n\n  a\n\n  (f\n    b))\n",
+		},
+	} {
+		tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.MaxBlankLines = tc.max
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintTree with %v: got %q; want %q", tc.max, got, tc.want)
+		}
+
+		buf.Reset()
+		s := parse.NewStream(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+		if err := p.PrintStream(s); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("PrintStream with %v: got %q; want %q", tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestApplyTransform(t *testing.T) {
+	const src = "(ns foo\n  (:require [b] [a]))\n\n;; goclj:sort\n[:d :c]\n"
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := tree.Roots[0]
+	ApplyTransform(ns, TransformSortMarkedCollections)
+	ApplyTransform(ns, TransformSortImportRequire)
+	var buf bytes.Buffer
+	if err := Minify(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	// Only the ns form is changed.
+	want := "(ns foo(:require[a][b]))[:d :c]"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestPrintedPositions(t *testing.T) {
+	for _, verbatim := range []bool{false, true} {
+		t.Run(fmt.Sprintf("verbatim=%t", verbatim), func(t *testing.T) {
+			testPrintedPositions(t, verbatim)
+		})
+	}
+}
+
+func testPrintedPositions(t *testing.T, verbatim bool) {
+	const fixture = "styleguide_before.clj"
+	tree := parseFile(t, fixture)
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.PrintedPositions = make(map[parse.Node]parse.Pos)
+	p.UpdatePositions = true
+	p.Verbatim = verbatim
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	out, err := parse.Reader(&buf, filepath.Join("testdata", fixture), parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compare func(got, want parse.Node)
+	compare = func(got, want parse.Node) {
+		if *got.Position() != *want.Position() {
+			t.Errorf("%s: got position %s; want %s", want, got.Position(), want.Position())
+		}
+		if *got.End() != *want.End() {
+			t.Errorf("%s: got end %s; want %s", want, got.End(), want.End())
+		}
+		if pos, ok := p.PrintedPositions[got]; !ok || pos != *want.Position() {
+			t.Errorf("%s: got printed position %s; want %s", want, &pos, want.Position())
+		}
+		gotChildren, _ := parse.SemanticChildren(got)
+		wantChildren, _ := parse.SemanticChildren(want)
+		if len(gotChildren) != len(wantChildren) {
+			t.Fatalf("%s: got %d children; want %d", want, len(gotChildren), len(wantChildren))
+		}
+		for i := range gotChildren {
+			compare(gotChildren[i], wantChildren[i])
+		}
+	}
+	for i, root := range out.Roots {
+		compare(tree.Roots[i], root)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	tree := parseFile(t, "styleguide_before.clj")
+	p := NewPrinter(ioutil.Discard)
+	p.PrintedPositions = make(map[parse.Node]parse.Pos)
+	p.SourceMap = new(SourceMap)
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.SourceMap.Mappings) == 0 {
+		t.Fatal("no mappings")
+	}
+	for n, want := range p.PrintedPositions {
+		in := *n.Position()
+		if in.Line == 0 {
+			continue // created by a transform
+		}
+		got, ok := p.SourceMap.Translate(in)
+		if !ok || got != want {
+			t.Errorf("%s: Translate(%s) = %s, %t; want %s", n, &in, &got, ok, &want)
+		}
+	}
+	if _, ok := p.SourceMap.Translate(parse.Pos{Offset: -1}); ok {
+		t.Error("Translate succeeded for a position before the input")
+	}
+}
+
+func TestPreserveAlignment(t *testing.T) {
+	testChangeCustom(t, "align_before.clj", "align_after.clj", func(p *Printer) {
+		p.PreserveAlignment = true
+	})
+}
+
+func TestWhitespaceOnly(t *testing.T) {
+	testChangeCustom(t, "whitespace_before.clj", "whitespace_after.clj", func(p *Printer) {
+		p.WhitespaceOnly = true
+		p.DataProfile = DataProfileHiccup
+	})
+}
+
 func TestIssue41(t *testing.T) {
 	const file = "issue41.clj"
 	f := func(p *Printer) {
@@ -111,6 +811,181 @@ func TestIssue41(t *testing.T) {
 	testChangeCustom(t, file, file, f)
 }
 
+func TestAddMissingRequires(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		want    []string
+	}{
+		{"addrequire", []string{"set", "str", "walk"}},
+		{"addrequire_noclause", []string{"str"}},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			tree := parseFile(t, tc.fixture+"_before.clj")
+			added := AddMissingRequires(tree, DefaultAliases)
+			if !reflect.DeepEqual(added, tc.want) {
+				t.Errorf("got added aliases %q; want %q", added, tc.want)
+			}
+			var buf bytes.Buffer
+			p := NewPrinter(&buf)
+			p.Transforms = map[Transform]bool{TransformSortImportRequire: false}
+			if err := p.PrintTree(tree); err != nil {
+				t.Fatal(err)
+			}
+			check(t, tc.fixture, buf.Bytes(), readFile(t, tc.fixture+"_after.clj"))
+		})
+	}
+}
+
+func TestTransformsAddMissingRequires(t *testing.T) {
+	testChangeTransforms(t, "addrequire_before.clj", "addrequire_after.clj", map[Transform]bool{
+		TransformAddMissingRequires: true,
+		TransformSortImportRequire:  false,
+	})
+
+	tree, err := parse.Reader(strings.NewReader("(ns a)\n\n(json/encode (str/join []))\n"), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.Transforms = map[Transform]bool{TransformAddMissingRequires: true}
+	p.RequireAliases = map[string]string{"json": "cheshire.core"}
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	want := "(ns a\n  (:require [cheshire.core :as json]))\n\n(json/encode (str/join []))\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// Babashka provides json and str without a require.
+	src := "(ns a)\n\n(json/encode (csk/->kebab-case (str/join [])))\n"
+	tree, err = parse.Reader(strings.NewReader(src), "temp.bb", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	p.Dialect = goclj.DialectBabashka
+	p.RequireAliases = map[string]string{"csk": "camel-snake-kebab.core", "json": "jsonista.core"}
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	want = "(ns a\n  (:require [camel-snake-kebab.core :as csk]))\n\n" +
+		"(json/encode (csk/->kebab-case (str/join [])))\n"
+	if got := buf.String(); got != want {
+		t.Errorf("babashka: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestProjectAliases(t *testing.T) {
+	var trees []*parse.Tree
+	for _, s := range []string{
+		"(ns a (:require [clojure.string :as s]))",
+		"(ns b (:require [clojure.string :as s] [clojure.set :as set]))",
+		"(ns c (:require [clojure.spec.alpha :as s]))",
+	} {
+		tree, err := parse.Reader(strings.NewReader(s), "temp", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees = append(trees, tree)
+	}
+	got := ProjectAliases(trees)
+	want := map[string]string{"s": "clojure.string", "set": "clojure.set"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestNamespaceAliases(t *testing.T) {
+	var trees []*parse.Tree
+	for _, s := range []string{
+		"(ns app.util)",
+		"(ns ^:no-doc app.db)",
+		"(ns app.core)",
+		"(ns lib.core)",
+		"(ns app.http (:require [app.util :as u]))",
+		"(def x 1)",
+	} {
+		tree, err := parse.Reader(strings.NewReader(s), "temp", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees = append(trees, tree)
+	}
+	got := NamespaceAliases(trees)
+	want := map[string]string{"util": "app.util", "db": "app.db", "http": "app.http"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	src := `(ns foo.bar
+  (:require [clojure.string :as str])) ; comment
+
+(defn f
+  "Doc."
+  [x & {:keys [a b]}]
+  #_(debug x)
+  (let [y @(atom 'x)
+        z #"a b"]
+    ^:private [\a \space "s" #{1 2} #(inc %) ~@xs :k]))
+`
+	want := `(ns foo.bar(:require[clojure.string :as str]))(defn f"Doc."[x &{:keys[a b]}](let[y@(atom 'x)z #"a b"]^:private[\a \space"s"#{1 2}#(inc %)~@xs :k]))`
+	tree, err := parse.Reader(strings.NewReader(src), "minify", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Minify(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("Minify: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMinifyRoundTrip(t *testing.T) {
+	names, err := filepath.Glob("testdata/*.clj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		tree := parseFile(t, filepath.Base(name))
+		var buf bytes.Buffer
+		if err := Minify(&buf, tree); err != nil {
+			t.Fatal(err)
+		}
+		minified, err := parse.Reader(&buf, name, parse.IncludeNonSemantic)
+		if err != nil {
+			t.Errorf("%s: cannot parse minified output: %s", name, err)
+			continue
+		}
+		if got, want := dumpNodes(minified.Roots), dumpNodes(tree.Roots); got != want {
+			t.Errorf("%s: minified forms differ: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+// dumpNodes gives a representation of the structure of nodes, ignoring
+// positions, comments, newlines, and #_ forms.
+func dumpNodes(nodes []parse.Node) string {
+	var parts []string
+	for _, n := range nodes {
+		switch n.(type) {
+		case *parse.CommentNode, *parse.NewlineNode, *parse.ReaderDiscardNode:
+			continue
+		}
+		part := n.String()
+		if children := n.Children(); children != nil {
+			part += "[" + dumpNodes(children) + "]"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
 func testFixture(t *testing.T, filename string) {
 	testChange(t, filename, filename)
 }
@@ -184,3 +1059,220 @@ func formatLines(contents []byte) []byte {
 	}
 	return result
 }
+
+func TestIndentLine(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		line int
+		want int
+	}{
+		{"(ns foo)\n", 2, 0},
+		{"(defn f [x]\n", 2, 2},
+		{"(defn f [x]\n  (let [y (inc x)\n", 3, 8},
+		{"(defn f [x]\n  (let [y (inc x)]\n", 3, 4},
+		{"(foo bar\n", 2, 5},
+		{"(foo\n", 2, 2},
+		{"[1 2\n", 2, 1},
+		{"{:a 1\n", 2, 1},
+		// The indentation follows the code above, even if it isn't
+		// formatted.
+		{"    (defn f [x]\n", 2, 6},
+		{"(defn f [x]\n    (cond\n", 3, 6},
+		{"(def s \"abc\n", 2, -1},
+		{"(def s \"(\" ; (\n", 2, 2},
+		{"(def c \\( \n", 2, 2},
+		{"(foo) (bar\n", 2, 8},
+		{"(foo)\n\n(bar baz\n  qux\n", 5, 5},
+	} {
+		got, err := IndentLine([]byte(tt.src), tt.line, nil)
+		if err != nil {
+			t.Errorf("IndentLine(%q, %d): %s", tt.src, tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("IndentLine(%q, %d): got %d; want %d", tt.src, tt.line, got, tt.want)
+		}
+	}
+	p := NewPrinter(nil)
+	p.IndentOverrides = map[string]IndentStyle{"foo": IndentListBody}
+	if got, err := IndentLine([]byte("(foo bar\n"), 2, p); err != nil || got != 2 {
+		t.Errorf("IndentLine with overrides: got %d, %v; want 2", got, err)
+	}
+	if _, err := IndentLine([]byte("(foo\n"), 3, nil); err == nil {
+		t.Error("IndentLine past the end: got nil error")
+	}
+}
+
+func TestKeepTree(t *testing.T) {
+	const fixture = "styleguide_before.clj"
+	tree := parseFile(t, fixture)
+	orig := tree.String()
+	print := func(tree *parse.Tree, keep, whitespaceOnly bool) (string, *Printer) {
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.KeepTree = keep
+		p.WhitespaceOnly = whitespaceOnly
+		p.PrintedPositions = make(map[parse.Node]parse.Pos)
+		if err := p.PrintTree(tree); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String(), p
+	}
+	for _, whitespaceOnly := range []bool{false, true, false} {
+		got, p := print(tree, true, whitespaceOnly)
+		if s := tree.String(); s != orig {
+			t.Fatalf("tree changed after printing (whitespaceOnly=%t)", whitespaceOnly)
+		}
+		want, _ := print(parseFile(t, fixture), false, whitespaceOnly)
+		if got != want {
+			t.Errorf("whitespaceOnly=%t: got\n%s\nwant\n%s", whitespaceOnly, got, want)
+		}
+		if _, ok := p.PrintedPositions[tree.Roots[0]]; !ok {
+			t.Errorf("whitespaceOnly=%t: no printed position for the first root", whitespaceOnly)
+		}
+	}
+}
+
+func TestVerbatim(t *testing.T) {
+	noTransforms := make(map[Transform]bool)
+	for _, tr := range AllTransforms() {
+		noTransforms[tr] = false
+	}
+	names, err := filepath.Glob(filepath.Join("testdata", "*.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		want, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		p := NewPrinter(&buf)
+		p.Verbatim = true
+		p.Transforms = noTransforms
+		if err := p.Format(bytes.NewReader(want), name); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != string(want) {
+			t.Errorf("%s: output differs from the input:\n%s", name, got)
+		}
+	}
+
+	// Only the forms changed by transforms are formatted.
+	testChangeCustom(t, "verbatim_before.clj", "verbatim_after.clj", func(p *Printer) {
+		p.Verbatim = true
+	})
+
+	// With a Snapshot, so are the forms changed by the caller's edits.
+	const src = "(def a  {:x  1   :y 2})   ; aligned\n(def  b\n     2)\n"
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := NewSnapshot(tree)
+	m := tree.Roots[0].(*parse.ListNode).Nodes[2].(*parse.MapNode)
+	m.Nodes[1] = parse.Int(10)
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	p.Transforms = noTransforms
+	p.Verbatim = true
+	p.Snapshot = snap
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	const want = "(def a  {:x 10 :y 2})   ; aligned\n(def  b\n     2)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("with Snapshot: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatCodeBlocks(t *testing.T) {
+	const doc = "# Example\n" +
+		"\n" +
+		"```clojure\n" +
+		"(defn f [x]\n" +
+		"(inc x))\n" +
+		"```\n" +
+		"\n" +
+		"Heading\n" +
+		"-------\n" +
+		"\n" +
+		"```python\n" +
+		"def f(x):\n" +
+		"   return x\n" +
+		"```\n" +
+		"\n" +
+		"1. A list item:\n" +
+		"\n" +
+		"   ~~~~ clj\n" +
+		"   (let [a 1\n" +
+		"   b 2]\n" +
+		"   a)\n" +
+		"   ~~~~\n" +
+		"\n" +
+		"[source,clojure]\n" +
+		"----\n" +
+		"(ns foo (:require [b] [a]))\n" +
+		"----\n" +
+		"\n" +
+		"```clojure\n" +
+		"(foo\n" +
+		"```\n" +
+		"\n" +
+		"```edn\n" +
+		"{:a 1"
+	const want = "# Example\n" +
+		"\n" +
+		"```clojure\n" +
+		"(defn f [x]\n" +
+		"  (inc x))\n" +
+		"```\n" +
+		"\n" +
+		"Heading\n" +
+		"-------\n" +
+		"\n" +
+		"```python\n" +
+		"def f(x):\n" +
+		"   return x\n" +
+		"```\n" +
+		"\n" +
+		"1. A list item:\n" +
+		"\n" +
+		"   ~~~~ clj\n" +
+		"   (let [a 1\n" +
+		"         b 2]\n" +
+		"     a)\n" +
+		"   ~~~~\n" +
+		"\n" +
+		"[source,clojure]\n" +
+		"----\n" +
+		"(ns foo (:require [a]\n" +
+		"                  [b]))\n" +
+		"----\n" +
+		"\n" +
+		"```clojure\n" +
+		"(foo\n" +
+		"```\n" +
+		"\n" +
+		"```edn\n" +
+		"{:a 1"
+	got, err := FormatCodeBlocks([]byte(doc), nil)
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	errs, ok := err.(parse.ErrorList)
+	if !ok || len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "code block at line 29: ") {
+		t.Errorf("got error %v; want one for the block at line 29", err)
+	}
+}
+
+func TestDataReadersProfile(t *testing.T) {
+	testChangeCustom(t, "datareaders_before.cljc", "datareaders_after.cljc", func(p *Printer) {
+		p.DataProfile = DataProfileDataReaders
+		p.Transforms = make(map[Transform]bool)
+		for _, tr := range AllTransforms() {
+			p.Transforms[tr] = true
+		}
+	})
+}
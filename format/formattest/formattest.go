@@ -0,0 +1,204 @@
+// Package formattest provides golden-file testing for code that configures
+// a format.Printer, such as a project's custom transforms or indentation
+// rules.
+//
+// A golden test formats an input file and compares the output to a golden
+// file holding the expected output. The usual layout is a testdata
+// directory in which each name_before.clj is formatted to give
+// name_after.clj, and each other file (a fixture) is already formatted:
+//
+//	func TestFormat(t *testing.T) {
+//		formattest.Dir(t, "testdata", func(p *format.Printer) {
+//			p.IndentOverrides = map[string]format.IndentStyle{
+//				"my.lib/with-thing": format.IndentListBody,
+//			}
+//		})
+//	}
+//
+// When the output changes deliberately, set UpdateGolden (say, with a
+// -update flag) to rewrite the golden files rather than compare them.
+package formattest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// UpdateGolden makes Check write the output to each golden file rather
+// than compare it with the file's contents. A package's tests typically
+// set it from a flag:
+//
+//	func init() {
+//		flag.BoolVar(&formattest.UpdateGolden, "update", false, "update golden files")
+//	}
+//
+// Fixtures, whose input and golden files are the same, are never written.
+var UpdateGolden bool
+
+// Exts are the extensions of the files used by Dir.
+var Exts = []string{".clj", ".cljs", ".cljc", ".edn"}
+
+// A Case is a single golden test.
+type Case struct {
+	// Name names the subtest run by Run. If it is empty, the base name of
+	// Input is used.
+	Name string
+	// Input is the path of the file to format.
+	Input string
+	// Golden is the path of the file holding the expected output. If it
+	// is empty, Input is a fixture: its formatted output must be the
+	// same as the input.
+	Golden string
+	// Config, if non-nil, is called to configure the Printer.
+	Config func(*format.Printer)
+}
+
+// Run runs each of cases as a subtest of t.
+func Run(t *testing.T, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		name := c.Name
+		if name == "" {
+			name = filepath.Base(c.Input)
+		}
+		t.Run(name, func(t *testing.T) {
+			golden := c.Golden
+			if golden == "" {
+				golden = c.Input
+			}
+			Check(t, c.Input, golden, c.Config)
+		})
+	}
+}
+
+// Dir runs a golden test for each file in dir with one of Exts: each
+// name_before.ext is formatted and compared with name_after.ext, and each
+// other file (apart from the name_after.ext files) is a fixture. If config
+// is non-nil, it is called to configure each Printer.
+func Dir(t *testing.T, dir string, config func(*format.Printer)) {
+	t.Helper()
+	cases, err := DirCases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cases {
+		cases[i].Config = config
+	}
+	Run(t, cases)
+}
+
+// DirCases returns the cases that Dir runs for the files in dir, in order
+// of their input file names, without a Config.
+func DirCases(dir string) ([]Case, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, e := range entries {
+		if !e.IsDir() && hasExt(e.Name()) {
+			names[e.Name()] = true
+		}
+	}
+	var cases []Case
+	for name := range names {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		c := Case{Input: filepath.Join(dir, name)}
+		switch {
+		case strings.HasSuffix(base, "_after") && names[strings.TrimSuffix(base, "_after")+"_before"+ext]:
+			continue
+		case strings.HasSuffix(base, "_before"):
+			// If there's no golden file yet, Check reports it (or,
+			// with UpdateGolden, creates it).
+			after := strings.TrimSuffix(base, "_before") + "_after" + ext
+			c.Name = strings.TrimSuffix(base, "_before") + ext
+			c.Golden = filepath.Join(dir, after)
+		}
+		cases = append(cases, c)
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Input < cases[j].Input })
+	return cases, nil
+}
+
+func hasExt(name string) bool {
+	for _, ext := range Exts {
+		if filepath.Ext(name) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Check formats the file input, using a Printer configured by config (if
+// non-nil), and reports an error to t unless the output matches the
+// contents of the file golden. If UpdateGolden is set and golden is not
+// input, it writes the output to golden instead.
+func Check(t testing.TB, input, golden string, config func(*format.Printer)) {
+	t.Helper()
+	got, err := Format(input, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if UpdateGolden && golden != input {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		if os.IsNotExist(err) {
+			t.Fatalf("%s does not exist (set UpdateGolden to create it)", golden)
+		}
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("formatting %s: got\n%s\nwant (%s)\n%s\n%s",
+			input, got, golden, want, diff(string(got), string(want)))
+	}
+}
+
+// Format returns the formatted contents of the file input, using a Printer
+// configured by config (if non-nil).
+func Format(input string, config func(*format.Printer)) ([]byte, error) {
+	tree, err := parse.File(input, parse.IncludeNonSemantic)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	p := format.NewPrinter(&buf)
+	if config != nil {
+		config(p)
+	}
+	if err := p.PrintTree(tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// diff describes the first line at which got and want differ.
+func diff(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		if gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("first difference at line %d:\n got: %s\nwant: %s",
+				i+1, gotLines[i], wantLines[i])
+		}
+	}
+	if len(gotLines) != len(wantLines) {
+		return fmt.Sprintf("got %d lines; want %d", len(gotLines), len(wantLines))
+	}
+	return "no difference"
+}
@@ -0,0 +1,67 @@
+package formattest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+)
+
+func withThing(p *format.Printer) {
+	p.IndentOverrides = map[string]format.IndentStyle{
+		"with-thing": format.IndentListBody,
+	}
+}
+
+func TestDir(t *testing.T) {
+	Dir(t, "testdata", withThing)
+}
+
+func TestDirCases(t *testing.T) {
+	cases, err := DirCases("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Case{
+		{Input: filepath.Join("testdata", "fixture.clj")},
+		{
+			Name:   "with.clj",
+			Input:  filepath.Join("testdata", "with_before.clj"),
+			Golden: filepath.Join("testdata", "with_after.clj"),
+		},
+	}
+	if !reflect.DeepEqual(cases, want) {
+		t.Errorf("got cases %+v; want %+v", cases, want)
+	}
+}
+
+func TestUpdateGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "formattest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "x_before.clj")
+	golden := filepath.Join(dir, "x_after.clj")
+	if err := ioutil.WriteFile(input, []byte("(foo   1\n 2)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(golden, []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	UpdateGolden = true
+	Check(t, input, golden, nil)
+	UpdateGolden = false
+	Check(t, input, golden, nil)
+	b, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(foo 1\n     2)\n"; string(b) != want {
+		t.Errorf("golden file is %q; want %q", b, want)
+	}
+}
@@ -0,0 +1,4 @@
+(defn f
+  [x]
+  (t/with-thing x
+    (g x)))
@@ -0,0 +1,5 @@
+(ns example
+  (:require [my.lib :as t]))
+
+(t/with-thing [x 1]
+              (f x))
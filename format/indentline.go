@@ -0,0 +1,120 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// IndentLine returns the indentation, in columns, that config would give the
+// given line (counting from 1) of src, based on the lines before it. This
+// lets editors indent a new or changed line without reformatting the rest of
+// the buffer. The code before the line needn't be complete: forms still open
+// at the start of the line are taken to continue on it. If config is nil, the
+// default configuration (that of NewPrinter) is used.
+//
+// The indentation is relative to where the enclosing form actually starts,
+// so it lines up with the code above it even if that code isn't formatted.
+// If the line begins inside a string, where indentation is part of the
+// string, IndentLine returns -1.
+func IndentLine(src []byte, line int, config *Printer) (int, error) {
+	start := 0
+	for i := 1; i < line; i++ {
+		j := bytes.IndexByte(src[start:], '\n')
+		if j < 0 {
+			return 0, fmt.Errorf("line %d is past the end of the input", line)
+		}
+		start += j + 1
+	}
+	if line < 1 {
+		return 0, fmt.Errorf("invalid line %d", line)
+	}
+	opens, inString := openDelims(src[:start])
+	if inString {
+		return -1, nil
+	}
+	if len(opens) == 0 {
+		return 0, nil
+	}
+
+	// Print the top-level form which is open at the line, up to the
+	// line, with a placeholder on the line and the open forms closed.
+	formStart := bytes.LastIndexByte(src[:opens[0]], '\n') + 1
+	text := append([]byte(nil), src[formStart:start]...)
+	text = append(text, 'x')
+	for i := len(opens) - 1; i >= 0; i-- {
+		text = append(text, closers[src[opens[i]]])
+	}
+	t, err := parse.Reader(bytes.NewReader(text), "", parse.IncludeNonSemantic)
+	if err != nil {
+		return 0, err
+	}
+	placeholderLine := bytes.Count(text, []byte("\n")) + 1
+	forms := t.EnclosingForms(placeholderLine, 1)
+	var coll parse.Node
+	for _, n := range forms {
+		if parse.KindOf(n).Is(parse.CategoryCollection) {
+			coll = n
+			break
+		}
+	}
+	if len(forms) == 0 || coll == nil {
+		return 0, fmt.Errorf("cannot find the form enclosing line %d", line)
+	}
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+	if config != nil {
+		p.IndentChar = config.IndentChar
+		p.IndentOverrides = config.IndentOverrides
+		p.ThreadFirstStyleOverrides = config.ThreadFirstStyleOverrides
+		p.Dialect = config.Dialect
+		p.PreserveAlignment = config.PreserveAlignment
+	}
+	p.WhitespaceOnly = true
+	p.PrintedPositions = make(map[parse.Node]parse.Pos)
+	if err := p.PrintTree(t); err != nil {
+		return 0, err
+	}
+	placeholder, form := p.PrintedPositions[forms[0]], p.PrintedPositions[coll]
+	indent := placeholder.Col - 1 + coll.Position().Col - form.Col
+	if indent < 0 {
+		indent = 0
+	}
+	return indent, nil
+}
+
+// closers maps the opening delimiters to the closing ones.
+var closers = map[byte]byte{'(': ')', '[': ']', '{': '}'}
+
+// openDelims scans src and returns the offsets of the opening delimiters of
+// the forms which are still open at its end, outermost first. It also
+// reports whether src ends inside a string.
+func openDelims(src []byte) (opens []int, inString bool) {
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '"':
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) {
+				return opens, true
+			}
+		case ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case '\\':
+			i++ // a character literal, such as \( or \"
+		case '(', '[', '{':
+			opens = append(opens, i)
+		case ')', ']', '}':
+			if len(opens) > 0 {
+				opens = opens[:len(opens)-1]
+			}
+		}
+	}
+	return opens, false
+}
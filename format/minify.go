@@ -0,0 +1,139 @@
+package format
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// Minify writes t to w in the most compact form which reads back as the same
+// forms. Comments and #_ forms are removed, and forms are separated by a
+// single space only where one is required to keep them apart. No transforms
+// are applied and no trailing newline is written.
+func Minify(w io.Writer, t *parse.Tree) error {
+	bw := bufio.NewWriter(w)
+	minifySeq(bw, t.Roots)
+	return bw.Flush()
+}
+
+func minifySeq(w *bufio.Writer, nodes []parse.Node) {
+	var prev parse.Node
+	for _, node := range nodes {
+		switch node.(type) {
+		case *parse.CommentNode, *parse.NewlineNode, *parse.ReaderDiscardNode:
+			continue
+		}
+		if prev != nil && !closesWithDelim(prev) && !opensWithDelim(node) {
+			w.WriteByte(' ')
+		}
+		minifyNode(w, node)
+		prev = node
+	}
+}
+
+func minifyNode(w *bufio.Writer, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.BoolNode, *parse.NilNode:
+		w.WriteString(node.String())
+	case *parse.CharacterNode:
+		w.WriteString(node.Text)
+	case *parse.KeywordNode:
+		w.WriteString(node.Val)
+	case *parse.NumberNode:
+		w.WriteString(node.Val)
+	case *parse.SymbolNode:
+		w.WriteString(node.Val)
+	case *parse.StringNode:
+		w.WriteString(`"` + node.Val + `"`)
+	case *parse.RegexNode:
+		w.WriteString(`#"` + node.Val + `"`)
+	case *parse.TagNode:
+		w.WriteString("#" + node.Val)
+	case *parse.VarQuoteNode:
+		w.WriteString("#'" + node.Val)
+	case *parse.ErrorNode:
+		w.WriteString(node.Text)
+	case *parse.ListNode:
+		minifyColl(w, "(", node.Nodes, ")")
+	case *parse.VectorNode:
+		minifyColl(w, "[", node.Nodes, "]")
+	case *parse.MapNode:
+		minifyColl(w, "{", node.Nodes, "}")
+	case *parse.NamespacedMapNode:
+		minifyColl(w, "#"+node.Namespace+"{", node.Nodes, "}")
+	case *parse.SetNode:
+		minifyColl(w, "#{", node.Nodes, "}")
+	case *parse.FnLiteralNode:
+		minifyColl(w, "#(", node.Nodes, ")")
+	case *parse.DerefNode:
+		w.WriteByte('@')
+		minifyNode(w, node.Node)
+	case *parse.MetadataNode:
+		w.WriteByte('^')
+		minifyNode(w, node.Node)
+	case *parse.QuoteNode:
+		w.WriteByte('\'')
+		minifyNode(w, node.Node)
+	case *parse.SyntaxQuoteNode:
+		w.WriteByte('`')
+		minifyNode(w, node.Node)
+	case *parse.UnquoteNode:
+		w.WriteByte('~')
+		if _, ok := node.Node.(*parse.DerefNode); ok {
+			// Otherwise it would read as ~@ (unquote-splicing).
+			w.WriteByte(' ')
+		}
+		minifyNode(w, node.Node)
+	case *parse.UnquoteSpliceNode:
+		w.WriteString("~@")
+		minifyNode(w, node.Node)
+	case *parse.ReaderEvalNode:
+		w.WriteString("#=")
+		minifyNode(w, node.Node)
+	default:
+		panic("unexpected node type")
+	}
+}
+
+func minifyColl(w *bufio.Writer, open string, nodes []parse.Node, close string) {
+	w.WriteString(open)
+	minifySeq(w, nodes)
+	w.WriteString(close)
+}
+
+// opensWithDelim reports whether the printed form of node begins with a
+// character that terminates a preceding token.
+func opensWithDelim(node parse.Node) bool {
+	switch node.(type) {
+	case *parse.ListNode, *parse.VectorNode, *parse.MapNode, *parse.StringNode,
+		*parse.DerefNode, *parse.MetadataNode, *parse.UnquoteNode, *parse.UnquoteSpliceNode:
+		return true
+	}
+	return false
+}
+
+// closesWithDelim reports whether the printed form of node ends with a
+// closing delimiter, so that no space is needed before the next form.
+func closesWithDelim(node parse.Node) bool {
+	switch node := node.(type) {
+	case *parse.ListNode, *parse.VectorNode, *parse.MapNode, *parse.SetNode,
+		*parse.FnLiteralNode, *parse.NamespacedMapNode, *parse.StringNode, *parse.RegexNode:
+		return true
+	case *parse.DerefNode:
+		return closesWithDelim(node.Node)
+	case *parse.MetadataNode:
+		return closesWithDelim(node.Node)
+	case *parse.QuoteNode:
+		return closesWithDelim(node.Node)
+	case *parse.SyntaxQuoteNode:
+		return closesWithDelim(node.Node)
+	case *parse.UnquoteNode:
+		return closesWithDelim(node.Node)
+	case *parse.UnquoteSpliceNode:
+		return closesWithDelim(node.Node)
+	case *parse.ReaderEvalNode:
+		return closesWithDelim(node.Node)
+	}
+	return false
+}
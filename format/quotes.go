@@ -0,0 +1,63 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// normalizeQuotesRecursive applies normalizeQuote to the descendants of n.
+func normalizeQuotesRecursive(n parse.Node, expand bool) {
+	nodes := n.Children()
+	if len(nodes) == 0 {
+		return
+	}
+	for i, node := range nodes {
+		nodes[i] = normalizeQuote(node, expand)
+		normalizeQuotesRecursive(nodes[i], expand)
+	}
+	n.SetChildren(nodes)
+}
+
+// normalizeQuote returns the short form of n if it is a (quote x) or
+// (var x) form, or, if expand is set, the long form of n if it is a 'x or
+// #'x form. Otherwise it returns n.
+func normalizeQuote(n parse.Node, expand bool) parse.Node {
+	if expand {
+		switch n := n.(type) {
+		case *parse.QuoteNode:
+			switch n.Node.(type) {
+			case *parse.MetadataNode, *parse.TagNode:
+				// The quoted form follows the quote node.
+				return n
+			}
+			return &parse.ListNode{Nodes: []parse.Node{&parse.SymbolNode{Val: "quote"}, n.Node}}
+		case *parse.VarQuoteNode:
+			return &parse.ListNode{Nodes: []parse.Node{
+				&parse.SymbolNode{Val: "var"},
+				&parse.SymbolNode{Val: n.Val},
+			}}
+		}
+		return n
+	}
+	if !goclj.FnFormSymbol(n, "quote", "var") {
+		return n
+	}
+	nodes := n.Children()
+	if len(nodes) != 2 {
+		// Comments, newlines, or more than one argument.
+		return n
+	}
+	head := nodes[0].(*parse.SymbolNode).Val
+	switch arg := nodes[1].(type) {
+	case *parse.MetadataNode, *parse.TagNode, *parse.ReaderDiscardNode:
+		return n
+	case *parse.SymbolNode:
+		if head == "var" {
+			return &parse.VarQuoteNode{Val: arg.Val}
+		}
+	}
+	if head == "quote" {
+		return &parse.QuoteNode{Node: nodes[1]}
+	}
+	return n
+}
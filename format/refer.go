@@ -0,0 +1,90 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// referListKeys are the libspec options whose values are lists of symbols
+// which TransformSortReferLists sorts.
+var referListKeys = map[string]bool{
+	":refer":        true,
+	":exclude":      true,
+	":only":         true,
+	":refer-macros": true,
+}
+
+// sortReferLists sorts and removes the duplicates from the symbol lists of
+// the libspecs in the :require, :require-macros, :use, :use-macros, and
+// :refer-clojure clauses of the ns form ns.
+func sortReferLists(ns parse.Node, c Collation) {
+	var visit func(n parse.Node)
+	visit = func(n parse.Node) {
+		nodes, _ := parse.SemanticChildren(n)
+		for i, child := range nodes {
+			if k, ok := child.(*parse.KeywordNode); ok && referListKeys[k.Val] && i+1 < len(nodes) {
+				switch list := nodes[i+1].(type) {
+				case *parse.VectorNode, *parse.ListNode:
+					if symbolsOnly(list) {
+						removeDuplicateSymbols(list)
+						// sortCollection only sorts vectors (since
+						// the head of a list is usually special).
+						v := &parse.VectorNode{Nodes: list.Children()}
+						sortCollection(v, c)
+						list.SetChildren(v.Nodes)
+					}
+				}
+			}
+			switch child.(type) {
+			case *parse.VectorNode, *parse.ListNode:
+				visit(child)
+			}
+		}
+	}
+	for _, clause := range ns.Children() {
+		if goclj.FnFormKeyword(clause, ":require", ":require-macros", ":use", ":use-macros", ":refer-clojure") {
+			visit(clause)
+		}
+	}
+}
+
+// symbolsOnly reports whether the forms of n are all symbols.
+func symbolsOnly(n parse.Node) bool {
+	nodes, _ := parse.SemanticChildren(n)
+	for _, node := range nodes {
+		if !goclj.Symbol(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeDuplicateSymbols removes each symbol among the children of n which
+// repeats an earlier one, along with a line break next to it if it was on
+// a line of its own.
+func removeDuplicateSymbols(n parse.Node) {
+	nodes := n.Children()
+	seen := make(map[string]bool)
+	var result []parse.Node
+	for i := 0; i < len(nodes); i++ {
+		sym, ok := nodes[i].(*parse.SymbolNode)
+		if !ok || !seen[sym.Val] {
+			if ok {
+				seen[sym.Val] = true
+			}
+			result = append(result, nodes[i])
+			continue
+		}
+		startsLine := len(result) == 0 || goclj.Newline(result[len(result)-1])
+		switch {
+		case !startsLine:
+		case i+1 < len(nodes) && goclj.Newline(nodes[i+1]):
+			i++
+		case i+1 == len(nodes) && len(result) > 0:
+			result = result[:len(result)-1]
+		}
+	}
+	if len(result) < len(nodes) {
+		n.SetChildren(result)
+	}
+}
@@ -0,0 +1,129 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// reflowCommentsRecursive applies reflowComments to the children of n and
+// of its descendants.
+func reflowCommentsRecursive(n parse.Node, width int) {
+	nodes := n.Children()
+	if len(nodes) == 0 {
+		return
+	}
+	nodes = reflowComments(nodes, width)
+	n.SetChildren(nodes)
+	for _, node := range nodes {
+		reflowCommentsRecursive(node, width)
+	}
+}
+
+// reflowComments rewraps each block of comment lines among nodes (comments
+// on lines of their own, separated only by newlines) so that they fit
+// within width columns. The block starts at the column of its first comment
+// in the input.
+func reflowComments(nodes []parse.Node, width int) []parse.Node {
+	var newNodes []parse.Node
+	changed := false
+	for i := 0; i < len(nodes); i++ {
+		c, ok := nodes[i].(*parse.CommentNode)
+		if !ok || (i > 0 && !goclj.Newline(nodes[i-1])) {
+			newNodes = append(newNodes, nodes[i])
+			continue
+		}
+		prefix := commentPrefix(c.Text)
+		block := []*parse.CommentNode{c}
+		for i+2 < len(nodes) && goclj.Newline(nodes[i+1]) {
+			next, ok := nodes[i+2].(*parse.CommentNode)
+			if !ok || commentPrefix(next.Text) != prefix {
+				break
+			}
+			block = append(block, next)
+			i += 2
+		}
+		col := c.Col
+		if col < 1 {
+			col = 1
+		}
+		lines := reflowCommentLines(block, prefix, width-(col-1))
+		if len(lines) != len(block) {
+			changed = true
+		}
+		for j, line := range lines {
+			if j > 0 {
+				newNodes = append(newNodes, &parse.NewlineNode{})
+			}
+			if j < len(block) && block[j].Text == line {
+				newNodes = append(newNodes, block[j])
+				continue
+			}
+			changed = true
+			newNodes = append(newNodes, &parse.CommentNode{Text: line})
+		}
+	}
+	if !changed {
+		return nodes
+	}
+	return newNodes
+}
+
+// commentPrefix returns the run of semicolons starting comment, or "" if it
+// doesn't start with at least two (as ;; and ;;; comments do).
+func commentPrefix(comment string) string {
+	i := 0
+	for i < len(comment) && comment[i] == ';' {
+		i++
+	}
+	if i < 2 {
+		return ""
+	}
+	return comment[:i]
+}
+
+// reflowCommentLines returns the lines of a block of comments which all
+// start with prefix, rewrapped to fit within width columns. Only lines
+// whose text follows the prefix and a single space are rewrapped; the
+// others, such as blank comment lines, indented examples, commented-out
+// code (starting with a parenthesis), and goclj: directives, are left as
+// they are and separate paragraphs. Blocks without a prefix of two or more
+// semicolons are left alone.
+func reflowCommentLines(block []*parse.CommentNode, prefix string, width int) []string {
+	var lines, words []string
+	flush := func() {
+		line := prefix
+		for _, word := range words {
+			if line != prefix && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+				lines = append(lines, line)
+				line = prefix
+			}
+			line += " " + word
+		}
+		if line != prefix {
+			lines = append(lines, line)
+		}
+		words = nil
+	}
+	for _, c := range block {
+		if prefix == "" {
+			lines = append(lines, c.Text)
+			continue
+		}
+		text := strings.TrimRight(c.Text[len(prefix):], " \t")
+		if !strings.HasPrefix(text, " ") ||
+			strings.HasPrefix(text, "  ") ||
+			strings.HasPrefix(text, " \t") ||
+			strings.HasPrefix(text, " (") ||
+			strings.HasPrefix(text, " goclj:") {
+			flush()
+			lines = append(lines, c.Text)
+			continue
+		}
+		words = append(words, strings.Fields(text)...)
+	}
+	flush()
+	return lines
+}
@@ -347,7 +347,9 @@ func parseUseSeq(nodes []parse.Node) (r *require, ok bool) {
 			if !ok {
 				return nil, false
 			}
+			// use refers everything even when it also gives an alias.
 			r.as = map[string]struct{}{n.Val: struct{}{}}
+			r.referAll = true
 		case ":only":
 			switch nodes[2].(type) {
 			case *parse.ListNode, *parse.VectorNode:
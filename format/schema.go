@@ -0,0 +1,107 @@
+package format
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+var specKeysForms = []string{
+	"clojure.spec.alpha/keys",
+	"clojure.spec.alpha/keys*",
+	"cljs.spec.alpha/keys",
+	"cljs.spec.alpha/keys*",
+}
+
+// specKeyLists are the options of s/keys whose values are lists of keys.
+var specKeyLists = map[string]bool{
+	":req":    true,
+	":opt":    true,
+	":req-un": true,
+	":opt-un": true,
+}
+
+// formatSchemas lays out clojure.spec s/keys forms and malli :map schemas
+// found in n so that each option and each key or entry is on its own line.
+// Malli schemas are only recognized in files that require malli.core.
+func formatSchemas(n parse.Node, r *goclj.Resolver) {
+	for _, child := range n.Children() {
+		formatSchemas(child, r)
+	}
+	switch {
+	case r.FnFormSymbol(n, specKeysForms...):
+		formatSpecKeys(n.(*parse.ListNode))
+	case r.Requires("malli.core"):
+		if v, ok := n.(*parse.VectorNode); ok {
+			formatMalliMap(v)
+		}
+	}
+}
+
+// formatSpecKeys puts each option of an s/keys form on its own line, and
+// each key in the :req/:opt lists on its own line:
+//
+//	(s/keys :req [::a
+//	              ::b]
+//	        :opt [::c])
+func formatSpecKeys(form *parse.ListNode) {
+	_, idx := parse.SemanticChildren(form)
+	// Work backwards so that the indexes remain valid.
+	for i := len(idx) - 2; i >= 1; i -= 2 {
+		k, ok := form.Nodes[idx[i]].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		if v, ok := form.Nodes[idx[i+1]].(*parse.VectorNode); ok && specKeyLists[k.Val] {
+			_, vidx := parse.SemanticChildren(v)
+			for j := len(vidx) - 1; j >= 1; j-- {
+				v.Nodes = breakBefore(v.Nodes, vidx[j])
+			}
+		}
+		if i > 1 {
+			form.Nodes = breakBefore(form.Nodes, idx[i])
+		}
+	}
+}
+
+// formatMalliMap puts each entry of a malli :map schema with more than one
+// entry on its own line. The optional properties map stays on the first
+// line:
+//
+//	[:map {:closed true}
+//	 [:id int?]
+//	 [:name string?]]
+func formatMalliMap(v *parse.VectorNode) {
+	_, idx := parse.SemanticChildren(v)
+	if len(idx) == 0 {
+		return
+	}
+	if k, ok := v.Nodes[idx[0]].(*parse.KeywordNode); !ok || k.Val != ":map" {
+		return
+	}
+	entries := idx[1:]
+	if len(entries) > 0 {
+		if _, ok := v.Nodes[entries[0]].(*parse.MapNode); ok {
+			entries = entries[1:]
+		}
+	}
+	if len(entries) < 2 {
+		return
+	}
+	for _, i := range entries {
+		if !goclj.Vector(v.Nodes[i]) {
+			return
+		}
+	}
+	for j := len(entries) - 1; j >= 0; j-- {
+		v.Nodes = breakBefore(v.Nodes, entries[j])
+	}
+}
+
+// breakBefore inserts a newline before nodes[i] unless it already begins a
+// line.
+func breakBefore(nodes []parse.Node, i int) []parse.Node {
+	if i > 0 && goclj.Newline(nodes[i-1]) {
+		return nodes
+	}
+	return insertNodes(nodes, i, &parse.NewlineNode{})
+}
@@ -0,0 +1,164 @@
+package format
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// sortMarker is the text of a comment that marks the collection on the
+// following line as sorted:
+//
+//	;; goclj:sort
+//	[:b :a :c]
+const sortMarker = "goclj:sort"
+
+func isSortMarker(n parse.Node) bool {
+	c, ok := n.(*parse.CommentNode)
+	if !ok {
+		return false
+	}
+	return strings.TrimSpace(strings.TrimLeft(c.Text, ";")) == sortMarker
+}
+
+func sortMarkedRecursive(n parse.Node, c Collation) {
+	nodes := n.Children()
+	sortMarked(nodes, c)
+	for _, node := range nodes {
+		sortMarkedRecursive(node, c)
+	}
+}
+
+// sortMarked sorts the collections among nodes which follow a sort marker.
+func sortMarked(nodes []parse.Node, c Collation) {
+	for i, n := range nodes {
+		if !isSortMarker(n) {
+			continue
+		}
+		j := i + 1
+		for j < len(nodes) && goclj.Newline(nodes[j]) {
+			j++
+		}
+		if j < len(nodes) {
+			sortCollection(nodes[j], c)
+		}
+	}
+}
+
+// sortCollection sorts the elements of a vector or set, or the entries of a
+// map by key, comparing their printed forms using c. Comments on the lines
+// above an element and beside it move with it; the line breaks between the
+// elements stay where they are.
+func sortCollection(n parse.Node, c Collation) {
+	var size int // nodes per entry
+	switch n.(type) {
+	case *parse.VectorNode, *parse.SetNode:
+		size = 1
+	case *parse.MapNode, *parse.NamespacedMapNode:
+		size = 2
+	default:
+		return
+	}
+	nodes := n.Children()
+	elems, ok := elements(n)
+	if !ok || len(elems)%size != 0 {
+		return
+	}
+
+	type entry struct {
+		above []parse.Node // comment lines
+		nodes []parse.Node // the element(s) and a comment beside them
+		key   string
+	}
+	var (
+		entries []*entry
+		layout  []parse.Node // the newlines around the entries; nil for each entry
+		prev    int
+	)
+	for e := 0; e < len(elems); e += size {
+		start, end := elems[e][0], elems[e+size-1][1]
+		if end < len(nodes) && goclj.Comment(nodes[end]) {
+			end++
+		}
+		ent := &entry{nodes: nodes[start:end], key: sortKey(nodes[start])}
+		for i := prev; i < start; i++ {
+			if goclj.Comment(nodes[i]) {
+				// A comment is always followed by a newline.
+				ent.above = append(ent.above, nodes[i], nodes[i+1])
+				i++
+				continue
+			}
+			layout = append(layout, nodes[i])
+		}
+		layout = append(layout, nil)
+		entries = append(entries, ent)
+		prev = end
+	}
+	layout = append(layout, nodes[prev:]...)
+
+	less := func(i, j int) bool { return c.less(entries[i].key, entries[j].key) }
+	if sort.SliceIsSorted(entries, less) {
+		return
+	}
+	sort.SliceStable(entries, less)
+
+	var result []parse.Node
+	for i, l := range layout {
+		if l != nil {
+			result = append(result, l)
+			continue
+		}
+		ent := entries[0]
+		entries = entries[1:]
+		if len(ent.above) > 0 && len(result) > 0 && !goclj.Newline(result[len(result)-1]) {
+			result = append(result, &parse.NewlineNode{})
+		}
+		result = append(result, ent.above...)
+		result = append(result, ent.nodes...)
+		// A comment must end its line.
+		if goclj.Comment(ent.nodes[len(ent.nodes)-1]) &&
+			(i+1 == len(layout) || !goclj.Newline(layout[i+1])) {
+			result = append(result, &parse.NewlineNode{})
+		}
+	}
+	n.SetChildren(result)
+}
+
+// elements returns the elements of the collection n, each given by the
+// indexes in n.Children() of its first node and of the node after its last.
+// An element is a semantic child of n along with any tags before it, as in
+// #inst "2020-01-01" or a reader conditional. ok is false if an element
+// can't be told apart: if n has metadata or a discarded form among its
+// children (which go with the form after them, or with nothing), or ends
+// with a tag.
+func elements(n parse.Node) (elems [][2]int, ok bool) {
+	nodes := n.Children()
+	_, idx := parse.SemanticChildren(n)
+	start := -1
+	for _, i := range idx {
+		switch nodes[i].(type) {
+		case *parse.MetadataNode, *parse.ReaderDiscardNode:
+			return nil, false
+		case *parse.TagNode:
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		elems = append(elems, [2]int{start, i + 1})
+		start = -1
+	}
+	return elems, start < 0
+}
+
+// sortKey returns the text by which n is sorted.
+func sortKey(n parse.Node) string {
+	var b strings.Builder
+	Minify(&b, &parse.Tree{Roots: []parse.Node{n}})
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package format
+
+import (
+	"sort"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A SourceMap maps positions in the input of a formatting pass to positions
+// in the output, so that tools can translate stack traces, lint findings,
+// coverage data, and the like from one to the other.
+type SourceMap struct {
+	// Mappings holds the input and output positions of each printed node
+	// which came from the input (nodes created by transforms are not
+	// included).
+	Mappings []Mapping `json:"mappings"`
+
+	sorted bool // whether Mappings is sorted by input offset
+}
+
+// A Mapping gives the output position of the node at an input position.
+type Mapping struct {
+	In  parse.Pos `json:"in"`
+	Out parse.Pos `json:"out"`
+}
+
+func (m *SourceMap) add(in, out parse.Pos) {
+	m.Mappings = append(m.Mappings, Mapping{In: in, Out: out})
+	m.sorted = false
+}
+
+// Translate returns the output position corresponding to the input
+// position pos. A position within a node is translated relative to the
+// start of the node; a position between nodes is translated relative to
+// the preceding node, so it is only approximate. Translate reports false if
+// pos precedes every node in m.
+func (m *SourceMap) Translate(pos parse.Pos) (parse.Pos, bool) {
+	if !m.sorted {
+		sort.SliceStable(m.Mappings, func(i, j int) bool {
+			return m.Mappings[i].In.Offset < m.Mappings[j].In.Offset
+		})
+		m.sorted = true
+	}
+	i := sort.Search(len(m.Mappings), func(i int) bool {
+		return m.Mappings[i].In.Offset > pos.Offset
+	})
+	if i == 0 {
+		return parse.Pos{}, false
+	}
+	mp := m.Mappings[i-1]
+	out := mp.Out
+	out.Name = pos.Name
+	out.Offset += pos.Offset - mp.In.Offset
+	if pos.Line == mp.In.Line {
+		out.Col += pos.Col - mp.In.Col
+	} else {
+		out.Line += pos.Line - mp.In.Line
+		out.Col = pos.Col
+	}
+	return out, true
+}
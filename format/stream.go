@@ -0,0 +1,101 @@
+package format
+
+import (
+	"io"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// PrintStream formats the top-level forms read from s and writes them to p's
+// writer. The forms are transformed and printed a line at a time, so the
+// memory used depends on the size of the largest form rather than the size
+// of the input. This makes it suitable for very large files, such as EDN
+// dumps.
+//
+// The output is the same as that of PrintTree on the whole input, except
+// that TransformRemoveUnusedRequires and TransformAddMissingRequires (which
+// need to see every form) are not applied.
+func (p *Printer) PrintStream(s *parse.Stream) (err error) {
+	p.init()
+	defer p.recoverErr(&err)
+	transforms := make(map[Transform]bool)
+	for k, v := range p.Transforms {
+		transforms[k] = v
+	}
+	transforms[TransformRemoveUnusedRequires] = false
+	transforms[TransformAddMissingRequires] = false
+
+	p.resolver = p.newResolver(nil)
+	maxNewlines := p.maxBlankLines(BlankLinesTopLevel) + 1
+	var (
+		batch    []parse.Node
+		newlines int
+		sawNS    bool
+		marked   bool // after a sort marker
+		afterNS  bool // between an ns form and the next form or comment
+	)
+	for {
+		n, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if goclj.Newline(n) {
+			newlines++
+		} else {
+			newlines = 0
+		}
+		if newlines > maxNewlines && transforms[TransformRemoveExtraBlankLines] {
+			continue
+		}
+		// A sort marker and the collection it marks may be in
+		// different batches.
+		if marked && !goclj.Newline(n) && transforms[TransformSortMarkedCollections] {
+			sortCollection(n, p.SortCollation)
+		}
+		marked = isSortMarker(n) || (marked && goclj.Newline(n))
+		// The newlines after an ns form are replaced along with it, so
+		// keep them in the same batch as the ns form and the form after
+		// them.
+		switch {
+		case !transforms[TransformBlankLinesAfterNS]:
+		case goclj.FnFormSymbol(n, "ns"):
+			afterNS = true
+		case goclj.Newline(n):
+		case goclj.Comment(n) && len(batch) > 0 && goclj.FnFormSymbol(batch[len(batch)-1], "ns"):
+		default:
+			afterNS = false
+		}
+		batch = append(batch, n)
+		if !sawNS && goclj.FnFormSymbol(n, "ns") {
+			p.resolver = p.newResolver(&parse.Tree{Roots: []parse.Node{n}})
+			sawNS = true
+		}
+		// Printing a top-level newline resets all the printing state, so
+		// the forms up to each newline may be printed independently.
+		if newlines > 0 && !afterNS {
+			p.printBatch(batch, transforms)
+			batch = batch[:0]
+		}
+	}
+	p.printBatch(batch, transforms)
+	p.flush()
+	return nil
+}
+
+func (p *Printer) printBatch(nodes []parse.Node, transforms map[Transform]bool) {
+	p.printRoots(&parse.Tree{Roots: nodes}, transforms)
+	// Forget the printed nodes.
+	for k := range p.specialIndent {
+		delete(p.specialIndent, k)
+	}
+	for k := range p.threadFirst {
+		delete(p.threadFirst, k)
+	}
+	for k := range p.docstrings {
+		delete(p.docstrings, k)
+	}
+}
@@ -0,0 +1,13 @@
+(ns foo.bar
+  (:require [clojure.java.io :as io]
+            [clojure.set :as set]
+            [clojure.string :as str]
+            [clojure.walk :as walk]
+            ; comment about zzz
+            [zzz.core :as z])
+  (:import (java.util UUID)))
+
+(defn f [x]
+  (str/join "," (set/union x (io/file "a")))
+  (UUID/randomUUID)
+  (unknown/thing ::walk/kw))
@@ -0,0 +1,10 @@
+(ns foo.bar
+  (:require [clojure.java.io :as io]
+            ; comment about zzz
+            [zzz.core :as z])
+  (:import (java.util UUID)))
+
+(defn f [x]
+  (str/join "," (set/union x (io/file "a")))
+  (UUID/randomUUID)
+  (unknown/thing ::walk/kw))
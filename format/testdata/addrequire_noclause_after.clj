@@ -0,0 +1,4 @@
+(ns foo.bar
+  (:require [clojure.string :as str]))
+
+(str/join "," [1 2])
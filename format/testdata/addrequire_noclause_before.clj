@@ -0,0 +1,3 @@
+(ns foo.bar)
+
+(str/join "," [1 2])
@@ -0,0 +1,24 @@
+(def config
+  {:host    "localhost"
+   :port    8080
+   :timeout 30})
+
+(let [a     1
+      bcd   (foo a)
+      efghi 3]
+  (+ a bcd))
+
+(deftest addition
+  (are [x y z] (= z (+ x y))
+    1   2   3
+    10  20  30
+    100 200 300))
+
+(def not-aligned
+  {:a  1
+   :bc 2
+   :def  3})
+
+(def single-spaced
+  {:a 1
+   :bcd 2})
@@ -0,0 +1,12 @@
+(ns foo.views
+  (:require [hiccup.core :refer [html]]
+            [honey.sql :as sql]))
+
+(defn page [items]
+  (html [:div {:id "main"} [:h1 "Items"] [:ul (for [i items] [:li i])]]
+        [:p "plain text" "more"]))
+
+(defn query [id]
+  (sql/format {:select [:id :name] :from [:users] :where [:= :id id]}))
+
+(def not-data [:a [:b] [:c]])
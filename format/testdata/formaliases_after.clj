@@ -0,0 +1,18 @@
+(ns foo.core
+  (:require [my.macros :as m :refer [defhandler]]))
+
+(defhandler index [req]
+  (ok req))
+
+(m/defhandler show [req]
+  (ok req))
+
+(other/defhandler edit
+  [req] (ok req))
+
+(m/defcase handle :index
+  [req]
+  (index req))
+
+(mlet [a 1]
+  a)
@@ -0,0 +1,12 @@
+(ns foo.nsmap
+  (:require [clojure.string :as s]))
+
+(def user
+  #:user{:id 1
+         :name "a"
+         :address/city "b"})
+
+(defn f [m]
+  (merge m #::{:x 1 :_/y 2} #::s{:k [1 2]}))
+
+(def empty-map #:user{})
@@ -0,0 +1,17 @@
+(ns foo.core
+  (:require [methodical.core :refer [defmethod] :rename {defmethod mdefmethod}]
+            [schema.core :as s]))
+
+(s/defn add :- s/Int
+  [x :- s/Int]
+  (inc x))
+
+(s/defn f [x]
+  x)
+
+(mdefmethod area :square
+  [shape]
+  (* (:side shape) (:side shape)))
+
+(other/defn g
+  [x] x)
@@ -0,0 +1,18 @@
+(ns foo.core
+  (:require [schema.core :as s]
+            [methodical.core :refer [defmethod] :rename {defmethod mdefmethod}]))
+
+(s/defn add :- s/Int
+  [x :- s/Int]
+  (inc x))
+
+(s/defn f
+  [x] x)
+
+(mdefmethod area
+  :square
+  [shape]
+  (* (:side shape) (:side shape)))
+
+(other/defn g
+  [x] x)
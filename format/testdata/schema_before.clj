@@ -0,0 +1,19 @@
+(ns foo.schema
+  (:require [clojure.spec.alpha :as s]
+            [malli.core :as m]))
+
+(s/def ::user (s/keys :req [::id ::name] :opt [::email]))
+
+(s/def ::opts
+  (s/keys :req-un [::a (or ::b ::c)]
+          :opt-un [::d]))
+
+(s/fdef create-user
+        :args (s/cat :name string?)
+        :ret ::user)
+
+(def User
+  [:map {:closed true} [:id int?] [:name string?]
+   [:address [:map [:street string?] [:zip int?]]]])
+
+(def Single [:map [:id int?]])
@@ -0,0 +1,21 @@
+;; goclj:sort
+[:a :b :c]
+
+(def config
+  ;; goclj:sort
+  {:debug true ; for now
+   ;; The host to bind.
+   :host "localhost"
+   :port 8080})
+
+(def features
+  ;; goclj:sort
+  #{"Mango"
+    "apple"
+    "zebra"})
+
+(def unsorted [:c :a :b])
+
+(def with-metadata
+  ;; goclj:sort
+  [^:private b a])
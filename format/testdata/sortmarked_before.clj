@@ -0,0 +1,22 @@
+;; goclj:sort
+[:c :a :b]
+
+(def config
+  ;; goclj:sort
+  {:port 8080
+   ;; The host to bind.
+   :host "localhost"
+   :debug true ; for now
+   })
+
+(def features
+  ;; goclj:sort
+  #{"zebra"
+    "apple"
+    "Mango"})
+
+(def unsorted [:c :a :b])
+
+(def with-metadata
+  ;; goclj:sort
+  [^:private b a])
@@ -36,6 +36,79 @@
   [x]
   (baz x))
 
+(defn foo [x] ; A comment after the name.
+  (bar x))
+
+(defn foo [x]
+  ;; A comment before the arglist.
+  (bar x))
+
+(defmethod foo :bar ; A comment after the name.
+  [x]
+  (baz x))
+
+(defmethod foo :bar ; A comment after the dispatch-val.
+  [x]
+  (baz x))
+
+(defmethod foo :bar ; A comment after the name.
+  ; A comment after the dispatch-val.
+  [x] (baz x))
+
+(defn foo
+  [x] ; A comment after the arglist.
+  (bar x))
+
+(defmethod foo [:a :b]
+  [x]
+  (baz x))
+
+(defmethod foo String
+  [x]
+  (baz x))
+
+(defmethod foo "bar"
+  [x]
+  (baz x))
+
+(defmethod foo 42
+  [x]
+  (baz x))
+
+(defmethod foo 'bar
+  [x]
+  (baz x))
+
+(defmethod foo nil
+  [x]
+  (baz x))
+
+(defn- foo [x]
+  (bar x))
+
+(defn ^:private ^{:added "1.0"} foo ^String [x]
+  (bar x))
+
+(defn foo
+  "Docstring."
+  [x]
+  (bar x))
+
+(defn foo
+  {:added "1.0"}
+  [x]
+  (bar x))
+
+(defn- ^:private foo
+  "A docstring after
+  metadata."
+  [x]
+  (bar x))
+
+(defn foo
+  ([x] (foo x 1))
+  ([x y] (+ x y)))
+
 (defn foo
   "I have two arities."
   ([x]
@@ -0,0 +1,22 @@
+(defmacro with-resource
+  [[sym init] & body]
+  `(let [res# ~init
+         ~sym res#]
+     (try
+       ~@body
+       (finally
+         (close! res#)))))
+
+(defmacro deflogger
+  [name & forms]
+  `(defmacro ~name
+     [& args#]
+     `(do (log ~'~name ~@args#)
+          ~@'~forms
+          ~~(count forms))))
+
+(defmacro deref-in
+  [a]
+  `(f ~ @~a ~@[@~a] ~(deref a)))
+
+`[~@() foo# ~'bar# ~`baz#]
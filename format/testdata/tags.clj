@@ -0,0 +1,12 @@
+{:a #inst "x"
+ :b 1}
+
+(let [a #inst "2020"
+      bb 2
+      ccc #uuid "00000000-0000-0000-0000-000000000000"
+      d ^:m {}]
+  a)
+
+(let [a #foo #bar 1
+      b 2]
+  a)
@@ -0,0 +1,14 @@
+(def empty-map {})
+
+(def empties [[] () {} #{} #:a{}
+              []])
+
+(defn f []
+  #())
+
+(def kept [; nothing yet
+           ])
+
+(comment
+  (f)
+  )
@@ -0,0 +1,12 @@
+(ns a
+  (:refer-clojure :exclude [get update])
+  (:require [bar :as b :refer [; why
+                               y
+                               z]]
+            [baz :exclude [p q] :refer :all]
+            [foo :refer [a b c]]
+            [mixed :refer [b (quote a)]]
+            [qux [one :refer [m n]] [two :refer (j k)]])
+  (:use [old :only [x y]]))
+
+(require '[not-ns :refer [b a]])
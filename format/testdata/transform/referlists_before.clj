@@ -0,0 +1,13 @@
+(ns a
+  (:refer-clojure :exclude [update get get])
+  (:require [foo :refer [c a b a]]
+            [bar :as b :refer [z
+                               ; why
+                               y
+                               z]]
+            [baz :exclude [q p] :refer :all]
+            [qux [one :refer [n m]] [two :refer (k j)]]
+            [mixed :refer [b (quote a)]])
+  (:use [old :only [y x]]))
+
+(require '[not-ns :refer [b a]])
@@ -0,0 +1,22 @@
+;; This namespace holds the helpers which
+;; are shared between the handlers.
+;;
+;; They are
+;; pure.
+(ns foo.util)
+
+;;; A section comment that runs on for rather longer than the width allows it to.
+
+(defn f [x]
+  ;; Commented-out code is left alone:
+  ;; (println "debugging" x)
+  ;;   indented lines too
+  ;; but this
+  ;; is joined.
+  (inc x)) ; a trailing comment stays where it is
+
+;; goclj:sort
+;; is a directive.
+[:b :a]
+; A single-semicolon comment
+; is not reflowed.
@@ -5,9 +5,15 @@
             [foo-bar.x-y]
             [foo-bar2.x-y]
             [k :refer :all]
-            [o :as p])
+            [o :as p]
+            [q :as r]
+            [s :as t]
+            [u.v])
   (:import foo_bar.x_y.Z
            [foo_bar2.x_y A B C]))
 
 (e/x #'p/x)
 (h 3)
+(def m {::r/key 1})
+(def m2 #::t{:a 1})
+(u.v/f :xy/k)
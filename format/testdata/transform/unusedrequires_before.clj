@@ -10,7 +10,14 @@
   (:import foo_bar.x_y.Z
            [foo_bar2.x_y A B C])
   (:require [m :as n]
-            [o :as p]))
+            [o :as p]
+            [q :as r]
+            [s :as t]
+            [u.v :as w]
+            [x.y :as xy]))
 
 (e/x #'p/x)
 (h 3)
+(def m {::r/key 1})
+(def m2 #::t{:a 1})
+(u.v/f :xy/k)
@@ -10,7 +10,7 @@
             [c :as d :refer :all]
             ; i
             [i]
-            [q0 :as q1]
+            [q0 :as q1 :refer :all]
             [x :refer [z
                        y]] ; g
             [z :refer :all]
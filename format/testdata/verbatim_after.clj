@@ -0,0 +1,7 @@
+(ns foo
+  (:require [a.b]
+            [b.c]))
+
+(def  x ,1)   ; hi
+(defn f [a]
+      #inst "2020" {:a 1,  :b   2})
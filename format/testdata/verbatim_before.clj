@@ -0,0 +1,8 @@
+(ns foo
+    (:require [b.c]  [a.b]))
+
+
+
+(def  x ,1)   ; hi
+(defn f [a]
+      #inst "2020" {:a 1,  :b   2})
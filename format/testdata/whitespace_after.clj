@@ -0,0 +1,17 @@
+(ns foo.core
+  (:require [foo.z :as z]
+            [foo.a :as a]))
+(defn f
+  "Adds
+      one."
+  [x]
+  (let [y (inc x)]
+    (z/g y
+         )))
+
+
+
+(defn g [x] ; comment
+  (a/h x))
+
+(def page [:div {:class "x"} [:p "a"] [:p "b"]])
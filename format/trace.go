@@ -0,0 +1,36 @@
+package format
+
+import (
+	"context"
+	"runtime/trace"
+)
+
+// A Tracer is called at the start of each phase of formatting with the name
+// of the phase, and the function it returns is called at the end of the
+// phase. The phases are:
+//
+//	parse                   parsing (and lexing) the input, in Format
+//	transform:<name>        applying a Transform, such as
+//	                        "transform:sort-import-require"
+//	data-profiles           applying the DataProfiles
+//	print                   laying out and writing the forms
+//
+// PrintStream reports the transform, data-profiles, and print phases
+// once for each line of forms that it prints.
+type Tracer func(phase string) (end func())
+
+// RuntimeTracer returns a Tracer which records each phase as a
+// runtime/trace region (of the calling goroutine) in ctx, so that formatting
+// time shows up in the execution traces of programs which use this package.
+func RuntimeTracer(ctx context.Context) Tracer {
+	return func(phase string) func() {
+		return trace.StartRegion(ctx, "goclj/format: "+phase).End
+	}
+}
+
+func (p *Printer) trace(phase string) func() {
+	if p.Tracer == nil {
+		return func() {}
+	}
+	return p.Tracer(phase)
+}
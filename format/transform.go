@@ -1,7 +1,9 @@
 package format
 
 import (
+	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/cespare/goclj"
 	"github.com/cespare/goclj/parse"
@@ -14,8 +16,8 @@ import (
 type Transform int
 
 const (
-	// TransformSortImportRequire sorts :import and :require declarations
-	// in ns blocks.
+	// TransformSortImportRequire sorts :import, :require, and
+	// :require-macros declarations in ns blocks.
 	TransformSortImportRequire Transform = iota
 
 	// TransformRemoveTrailingNewlines removes extra newlines following
@@ -27,14 +29,16 @@ const (
 	//   (foo bar)
 	TransformRemoveTrailingNewlines
 
-	// TransformFixDefnArglistNewline moves the arg vector of defns to the
-	// same line, if appropriate:
+	// TransformFixDefnArglistNewline moves the arg vector of defns (and
+	// defn-s) to the same line, if appropriate:
 	//   (defn foo
 	//     [x] ...)
 	// becomes
 	//   (defn foo [x]
 	//     ...)
-	// if there's no newline after the arg list.
+	// if there's no newline after the arg list. If the defn has a
+	// docstring or attr-map, the arg vector stays on its own line and the
+	// body is moved to the next line instead.
 	TransformFixDefnArglistNewline
 
 	// TransformFixDefmethodDispatchValNewline moves the dispatch-val of a
@@ -45,67 +49,358 @@ const (
 	// becomes
 	//   (defmethod foo :bar
 	//     [x] ...)
+	// The dispatch-val may be a keyword, symbol, vector, string, number,
+	// nil, boolean, or quoted form.
 	TransformFixDefmethodDispatchValNewline
 
-	// TransformRemoveExtraBlankLines consolidates consecutive blank lines
-	// into a single blank line.
+	// TransformRemoveExtraBlankLines consolidates consecutive blank lines,
+	// leaving at most the number given by the Printer's MaxBlankLines for
+	// the context: by default, a single blank line between top-level
+	// forms and within most forms, and none within ns forms and the
+	// bodies of let forms.
 	TransformRemoveExtraBlankLines
 
 	// TransformUseToRequire consolidates :require and :use blocks inside ns
-	// declarations, rewriting them using :require if possible.
-	// It is not enabled by default.
+	// declarations, rewriting them using :require if possible: (:use foo)
+	// becomes (:require [foo :refer :all]), [foo :only [x]] becomes
+	// [foo :refer [x]], and [foo :as f] becomes [foo :as f :refer :all].
+	// Libspecs it can't rewrite, such as those with :exclude, stay in
+	// :use. It is not enabled by default.
 	TransformUseToRequire
 
 	// TransformRemoveUnusedRequires uses some simple heuristics to remove
 	// some unused :require statements:
 	//   [foo :as x] ; if there is no x/y in the ns, this is removed
 	//   [foo :refer [x]] ; if x does not appear in the ns, this is removed
+	// An alias is also used by auto-resolved keywords (::x/k) and
+	// namespaced maps (#::x{...}), and a namespace which qualifies
+	// symbols itself (foo/y) keeps its require, without the unused alias.
+	// It is not enabled by default.
 	TransformRemoveUnusedRequires
+
+	// TransformFormatSchemas puts each option of a clojure.spec s/keys
+	// form, and each key in its :req and :opt vectors, on its own line.
+	// In files that require malli.core, the entries of :map schemas are
+	// also placed one per line:
+	//   (s/keys :req [::a ::b] :opt [::c])
+	// becomes
+	//   (s/keys :req [::a
+	//                 ::b]
+	//           :opt [::c])
+	// It is not enabled by default.
+	TransformFormatSchemas
+
+	// TransformSortMarkedCollections keeps the elements of a vector or
+	// set, or the entries of a map, sorted if the collection is on the
+	// line after a goclj:sort comment:
+	//   ;; goclj:sort
+	//   [:c :a :b]
+	// becomes
+	//   ;; goclj:sort
+	//   [:a :b :c]
+	// Elements are compared by their text using the Printer's
+	// SortCollation, and comments move with the elements they annotate.
+	TransformSortMarkedCollections
+
+	// TransformBlankLinesAfterNS puts the Printer's BlankLinesAfterNS
+	// blank lines (by default, one) between a top-level ns form and
+	// whatever follows it:
+	//   (ns foo)
+	//   (def x 1)
+	// becomes
+	//   (ns foo)
+	//
+	//   (def x 1)
+	TransformBlankLinesAfterNS
+
+	// TransformReflowComments rewraps paragraphs of ;; comments (comment
+	// lines of their own with the same number of semicolons) to fit
+	// within the Printer's LineWidth, counting from the column of the
+	// first comment in the input:
+	//   ;; This comment is
+	//   ;; broken up too much.
+	// becomes
+	//   ;; This comment is broken up too much.
+	// Blank comment lines, lines indented after the semicolons, and lines
+	// that look like commented-out code (starting with a parenthesis) are
+	// left as they are. It is not enabled by default.
+	TransformReflowComments
+
+	// TransformSplitTopLevelForms puts each top-level form which shares a
+	// line with the form before it (as pasted REPL snippets often do) on
+	// a line of its own:
+	//   (def a 1) (def b 2)
+	// becomes
+	//   (def a 1)
+	//   (def b 2)
+	// Tags and metadata stay on the line of the form they apply to, and
+	// comments and #_ forms stay where they are. It is not enabled by
+	// default.
+	TransformSplitTopLevelForms
+
+	// TransformNormalizeQuotes rewrites (quote x) as 'x and (var x) as
+	// #'x, which read as the same forms, or, if the Printer's
+	// ExpandQuotes is set, rewrites 'x and #'x the other way. It is not
+	// enabled by default.
+	TransformNormalizeQuotes
+
+	// TransformSortReferLists sorts the symbols of the :refer, :exclude,
+	// and :only vectors of the libspecs in ns forms (and of the
+	// :refer-clojure clause) and removes duplicates:
+	//   (:require [foo :refer [c a b a]])
+	// becomes
+	//   (:require [foo :refer [a b c]])
+	// Symbols are compared using the Printer's SortCollation, and comments
+	// move with the symbols they annotate. It is not enabled by default.
+	TransformSortReferLists
+
+	// TransformAddMissingRequires adds a [namespace :as alias] require to
+	// the ns form for each alias which qualifies a symbol or keyword (as
+	// in str/join or ::str/k) but isn't declared, if the alias is in the
+	// Printer's RequireAliases, as AddMissingRequires does. For
+	// goclj.DialectBabashka, the aliases babashka provides without a
+	// require (goclj.BabashkaAliases) are left alone. It is not enabled by
+	// default.
+	TransformAddMissingRequires
+
+	// TransformCompactEmptyCollections removes the newlines from
+	// collections which contain nothing else, so that
+	//   {
+	//   }
+	// becomes
+	//   {}
+	// even if TransformRemoveTrailingNewlines is disabled (to keep the
+	// closing parenthesis of rich comment blocks on its own line, say).
+	// Collections with comments or discarded forms are left alone. It is
+	// not enabled by default.
+	TransformCompactEmptyCollections
 )
 
+var transformNames = map[Transform]string{
+	TransformSortImportRequire:              "sort-import-require",
+	TransformRemoveTrailingNewlines:         "remove-trailing-newlines",
+	TransformFixDefnArglistNewline:          "fix-defn-arglist-newline",
+	TransformFixDefmethodDispatchValNewline: "fix-defmethod-dispatch-val-newline",
+	TransformRemoveExtraBlankLines:          "remove-extra-blank-lines",
+	TransformUseToRequire:                   "use-to-require",
+	TransformRemoveUnusedRequires:           "remove-unused-requires",
+	TransformFormatSchemas:                  "format-schemas",
+	TransformSortMarkedCollections:          "sort-marked-collections",
+	TransformBlankLinesAfterNS:              "blank-lines-after-ns",
+	TransformReflowComments:                 "reflow-comments",
+	TransformSplitTopLevelForms:             "split-top-level-forms",
+	TransformNormalizeQuotes:                "normalize-quotes",
+	TransformSortReferLists:                 "sort-refer-lists",
+	TransformAddMissingRequires:             "add-missing-requires",
+	TransformCompactEmptyCollections:        "compact-empty-collections",
+}
+
+// String returns the name of t as used by cljfmt, such as
+// "sort-import-require".
+func (t Transform) String() string {
+	if name, ok := transformNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Transform(%d)", int(t))
+}
+
+// ParseTransform returns the Transform with the given name, as given by
+// Transform.String.
+func ParseTransform(name string) (Transform, error) {
+	for t, s := range transformNames {
+		if s == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized transform %q", name)
+}
+
+// AllTransforms returns every Transform, in the order they are declared.
+func AllTransforms() []Transform {
+	ts := make([]Transform, 0, len(transformNames))
+	for t := range transformNames {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+	return ts
+}
+
 var DefaultTransforms = map[Transform]bool{
 	TransformSortImportRequire:              true,
 	TransformRemoveTrailingNewlines:         true,
 	TransformFixDefnArglistNewline:          true,
 	TransformFixDefmethodDispatchValNewline: true,
 	TransformRemoveExtraBlankLines:          true,
+	TransformSortMarkedCollections:          true,
+	TransformBlankLinesAfterNS:              true,
 }
 
-func applyTransforms(t *parse.Tree, transforms map[Transform]bool) {
+// applyTransforms applies the enabled transforms to t. Each transform is
+// applied to the top-level forms independently, so if p.TransformWorkers > 1
+// it is applied to up to that many forms concurrently.
+func (p *Printer) applyTransforms(t *parse.Tree, transforms map[Transform]bool) {
 	var syms *symbolCache
 	if transforms[TransformRemoveUnusedRequires] {
 		syms = findSymbols(t.Roots)
 	}
-	for _, root := range t.Roots {
-		if goclj.FnFormSymbol(root, "ns") {
-			if transforms[TransformUseToRequire] {
-				useToRequire(root)
-			}
-			if transforms[TransformRemoveUnusedRequires] {
-				removeUnusedRequires(root, syms)
-			}
-			if transforms[TransformSortImportRequire] {
-				sortNS(root)
-			}
+	for _, step := range p.transformSteps(p.resolver, syms) {
+		if !transforms[step.transform] {
+			continue
+		}
+		if p.DataProfile == DataProfileDataReaders && !dataTransforms[step.transform] {
+			continue
 		}
-		if transforms[TransformRemoveTrailingNewlines] {
-			removeTrailingNewlines(root)
+		end := p.trace("transform:" + step.transform.String())
+		forEachRoot(t.Roots, p.TransformWorkers, step.apply)
+		switch step.transform {
+		case TransformSortMarkedCollections:
+			sortMarked(t.Roots, p.SortCollation)
+		case TransformRemoveExtraBlankLines:
+			t.Roots = removeExtraBlankLines(t.Roots, p.maxBlankLines(BlankLinesTopLevel))
+		case TransformBlankLinesAfterNS:
+			t.Roots = fixBlankLinesAfterNS(t.Roots, p.BlankLinesAfterNS)
+		case TransformReflowComments:
+			t.Roots = reflowComments(t.Roots, p.LineWidth)
+		case TransformSplitTopLevelForms:
+			t.Roots = splitTopLevelForms(t.Roots)
+		case TransformAddMissingRequires:
+			AddMissingRequires(t, p.missingRequireAliases())
+		case TransformNormalizeQuotes:
+			for i, root := range t.Roots {
+				t.Roots[i] = normalizeQuote(root, p.ExpandQuotes)
+			}
 		}
-		if transforms[TransformFixDefnArglistNewline] &&
-			goclj.FnFormSymbol(root, "defn") {
-			fixDefnArglist(root)
+		end()
+	}
+}
+
+// ApplyTransform applies the single transform t to n, which is typically a
+// top-level form such as an ns form that was just edited. It uses the
+// default Printer configuration; see Printer.ApplyTransform.
+func ApplyTransform(n parse.Node, t Transform) {
+	NewPrinter(nil).ApplyTransform(n, t)
+}
+
+// ApplyTransform applies the single transform t to n (whether or not t is
+// enabled in p.Transforms), using p's other configuration, such as
+// SortCollation and FormAliases. Only n is examined, so head symbols such as
+// defn are not resolved through the file's ns form, and
+// TransformRemoveUnusedRequires (which needs to see every form in the
+// file), TransformAddMissingRequires (which needs to see every form and
+// changes the ns form), TransformSplitTopLevelForms, and
+// TransformBlankLinesAfterNS (which only change the top level of a file)
+// have no effect. Transforms which replace forms, such as
+// TransformNormalizeQuotes, only replace the descendants of n.
+func (p *Printer) ApplyTransform(n parse.Node, t Transform) {
+	switch t {
+	case TransformRemoveUnusedRequires, TransformAddMissingRequires,
+		TransformSplitTopLevelForms, TransformBlankLinesAfterNS:
+		return
+	}
+	for _, step := range p.transformSteps(p.newResolver(nil), nil) {
+		if step.transform == t {
+			step.apply(n)
+			return
 		}
-		if transforms[TransformFixDefmethodDispatchValNewline] &&
-			goclj.FnFormSymbol(root, "defmethod") {
-			fixDefmethodDispatchVal(root)
+	}
+}
+
+type transformStep struct {
+	transform Transform
+	apply     func(root parse.Node)
+}
+
+// transformSteps returns the transforms, in the order they are applied,
+// with functions that apply each to a top-level form. Head symbols are
+// resolved using r, and syms holds the symbols of the whole tree (for
+// TransformRemoveUnusedRequires).
+func (p *Printer) transformSteps(r *goclj.Resolver, syms *symbolCache) []transformStep {
+	ns := func(f func(root parse.Node)) func(root parse.Node) {
+		return func(root parse.Node) {
+			if goclj.FnFormSymbol(root, "ns") {
+				f(root)
+			}
 		}
-		if transforms[TransformRemoveExtraBlankLines] {
-			removeExtraBlankLinesRecursive(root)
+	}
+	return []transformStep{
+		{TransformUseToRequire, ns(useToRequire)},
+		{TransformRemoveUnusedRequires, ns(func(root parse.Node) {
+			removeUnusedRequires(root, syms)
+		})},
+		// This works on the whole tree (see applyTransforms).
+		{TransformAddMissingRequires, func(parse.Node) {}},
+		{TransformSortImportRequire, func(root parse.Node) {
+			if goclj.FnFormSymbol(root, "ns") {
+				sortNS(root, p.SortCollation)
+			}
+			if p.Dialect == goclj.DialectBabashka {
+				sortTaskRequires(root, p.SortCollation)
+			}
+		}},
+		{TransformSortReferLists, ns(func(root parse.Node) {
+			sortReferLists(root, p.SortCollation)
+		})},
+		{TransformSortMarkedCollections, func(root parse.Node) {
+			sortMarkedRecursive(root, p.SortCollation)
+		}},
+		{TransformCompactEmptyCollections, compactEmptyCollections},
+		{TransformRemoveTrailingNewlines, removeTrailingNewlines},
+		{TransformFixDefnArglistNewline, func(root parse.Node) {
+			if r.FnFormSymbol(root, "defn", "defn-") {
+				fixDefnArglist(root)
+			}
+		}},
+		{TransformFixDefmethodDispatchValNewline, func(root parse.Node) {
+			if r.FnFormSymbol(root, "defmethod") {
+				fixDefmethodDispatchVal(root)
+			}
+		}},
+		{TransformFormatSchemas, func(root parse.Node) {
+			formatSchemas(root, r)
+		}},
+		{TransformNormalizeQuotes, func(root parse.Node) {
+			normalizeQuotesRecursive(root, p.ExpandQuotes)
+		}},
+		{TransformReflowComments, func(root parse.Node) {
+			reflowCommentsRecursive(root, p.LineWidth)
+		}},
+		{TransformRemoveExtraBlankLines, func(root parse.Node) {
+			p.removeExtraBlankLinesRecursive(root, r)
+		}},
+		// These only change the top level (see applyTransforms), after
+		// TransformRemoveExtraBlankLines has had its say.
+		{TransformSplitTopLevelForms, func(parse.Node) {}},
+		{TransformBlankLinesAfterNS, func(parse.Node) {}},
+	}
+}
+
+// forEachRoot calls f on each of roots, using up to workers goroutines.
+func forEachRoot(roots []parse.Node, workers int, f func(root parse.Node)) {
+	if workers > len(roots) {
+		workers = len(roots)
+	}
+	if workers <= 1 {
+		for _, root := range roots {
+			f(root)
 		}
+		return
+	}
+	ch := make(chan parse.Node)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for root := range ch {
+				f(root)
+			}
+		}()
 	}
-	if transforms[TransformRemoveExtraBlankLines] {
-		t.Roots = removeExtraBlankLines(t.Roots)
+	for _, root := range roots {
+		ch <- root
 	}
+	close(ch)
+	wg.Wait()
 }
 
 func useToRequire(ns parse.Node) {
@@ -157,22 +452,29 @@ func removeUnusedRequires(ns parse.Node, syms *symbolCache) {
 	ns.SetChildren(nodes)
 }
 
-func sortNS(ns parse.Node) {
+func sortNS(ns parse.Node, c Collation) {
 	for _, n := range ns.Children()[1:] {
-		if goclj.FnFormKeyword(n, ":require", ":import") {
-			sortImportRequire(n.(*parse.ListNode))
+		if goclj.FnFormKeyword(n, ":require", ":require-macros", ":import") {
+			sortImportRequire(n.(*parse.ListNode), c)
 		}
 	}
 }
 
-func sortImportRequire(n *parse.ListNode) {
+func sortImportRequire(n *parse.ListNode, c Collation) {
+	nodes := n.Children()
+	n.SetChildren(append([]parse.Node{nodes[0]}, sortLibspecs(nodes[1:], c)...))
+}
+
+// sortLibspecs sorts a sequence of libspecs (or imports), placing each on
+// its own line and keeping comments attached to the libspecs they annotate.
+// Names are compared using c.
+func sortLibspecs(nodes []parse.Node, c Collation) []parse.Node {
 	var (
-		nodes             = n.Children()
 		sorted            = make(importRequireList, 0, len(nodes)/2)
 		lineComments      []*parse.CommentNode
 		afterSemanticNode = false
 	)
-	for _, node := range nodes[1:] {
+	for _, node := range nodes {
 		switch node := node.(type) {
 		case *parse.CommentNode:
 			if afterSemanticNode {
@@ -192,8 +494,8 @@ func sortImportRequire(n *parse.ListNode) {
 			afterSemanticNode = true
 		}
 	}
-	sort.Stable(sorted)
-	newNodes := []parse.Node{nodes[0]}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted.less(i, j, c) })
+	var newNodes []parse.Node
 	for _, ir := range sorted {
 		for _, cn := range ir.commentsAbove {
 			newNodes = append(newNodes, cn, &parse.NewlineNode{})
@@ -212,7 +514,7 @@ func sortImportRequire(n *parse.ListNode) {
 	if len(newNodes) >= 2 && !goclj.Comment(newNodes[len(newNodes)-2]) {
 		newNodes = newNodes[:len(newNodes)-1]
 	}
-	n.SetChildren(newNodes)
+	return newNodes
 }
 
 func removeTrailingNewlines(n parse.Node) {
@@ -221,7 +523,8 @@ func removeTrailingNewlines(n parse.Node) {
 		return
 	}
 	switch n.(type) {
-	case *parse.ListNode, *parse.MapNode, *parse.VectorNode, *parse.FnLiteralNode, *parse.SetNode:
+	case *parse.ListNode, *parse.MapNode, *parse.VectorNode, *parse.FnLiteralNode, *parse.SetNode,
+		*parse.NamespacedMapNode:
 		for ; len(nodes) > 0; nodes = nodes[:len(nodes)-1] {
 			if len(nodes) >= 2 && goclj.Comment(nodes[len(nodes)-2]) {
 				break
@@ -237,58 +540,135 @@ func removeTrailingNewlines(n parse.Node) {
 	}
 }
 
+func compactEmptyCollections(n parse.Node) {
+	nodes := n.Children()
+	switch n.(type) {
+	case *parse.ListNode, *parse.MapNode, *parse.VectorNode, *parse.FnLiteralNode, *parse.SetNode,
+		*parse.NamespacedMapNode:
+		empty := len(nodes) > 0
+		for _, node := range nodes {
+			if !goclj.Newline(node) {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			n.SetChildren(nil)
+			return
+		}
+	}
+	for _, node := range nodes {
+		compactEmptyCollections(node)
+	}
+}
+
 func fixDefnArglist(defn parse.Node) {
+	d, ok := goclj.ParseDefn(defn)
+	if !ok || d.Params < 0 {
+		// Multi-arity bodies each begin with their arglist.
+		return
+	}
 	nodes := defn.Children()
-	if len(nodes) < 5 {
+	args := d.Params
+	// A comment beside the arglist ends its line as well as a newline.
+	if args+1 == len(nodes) || goclj.Newline(nodes[args+1]) || goclj.Comment(nodes[args+1]) {
 		return
 	}
-	if !goclj.Newline(nodes[2]) || goclj.Newline(nodes[4]) {
+	// Include a type hint on the arglist.
+	start := args
+	for start > 0 && isMetadata(nodes[start-1]) {
+		start--
+	}
+	// Only comments and newlines are between the preceding part and the
+	// arglist, so if there are any, the arglist is on a later line.
+	prev := max(d.Name, d.Docstring, d.AttrMap)
+	if start == prev+1 {
 		return
 	}
-	if !goclj.Vector(nodes[3]) {
+	if prev != d.Name {
+		// After a docstring or attr-map, the arglist stays on its own
+		// line; move the body to the next line instead.
+		defn.SetChildren(insertNodes(nodes, args+1, &parse.NewlineNode{}))
 		return
 	}
-	// Move the newline to be after the arglist.
-	nodes[2], nodes[3] = nodes[3], nodes[2]
+	// Move the arglist up to the name's line; the newline that preceded
+	// it now follows it.
+	moveNodesBack(nodes, start, args+1, prev+1)
 	defn.SetChildren(nodes)
 }
 
 func fixDefmethodDispatchVal(defmethod parse.Node) {
-	nodes := defmethod.Children()
-	if len(nodes) < 5 {
+	sem, idx := parse.SemanticChildren(defmethod)
+	// The dispatch-val must be followed by the method's params (or
+	// bodies), which also distinguishes a vector dispatch-val from params.
+	if len(sem) < 4 || !dispatchVal(sem[2]) {
 		return
 	}
-	if !goclj.Newline(nodes[2]) {
+	nodes := defmethod.Children()
+	name, val := idx[1], idx[2]
+	if val == name+1 || val+1 == len(nodes) {
 		return
 	}
-	if !goclj.Keyword(nodes[3]) {
-		return
+	// Bring a comment beside the dispatch-val along with it, unless there
+	// is a comment on the name's line already.
+	end := val + 1
+	if goclj.Comment(nodes[end]) && !goclj.Comment(nodes[name+1]) {
+		end++
 	}
 	// Move the dispatch-val up to the same line.
-	// Insert a newline after if there wasn't one already.
-	if goclj.Newline(nodes[4]) {
-		nodes = append(nodes[:2], nodes[3:]...)
-	} else {
-		nodes[2], nodes[3] = nodes[3], nodes[2]
+	// The newline that preceded it now follows it; drop that newline if
+	// there was one after the dispatch-val already.
+	moveNodesBack(nodes, val, end, name+1)
+	if end < len(nodes) && goclj.Newline(nodes[end]) && goclj.Newline(nodes[end-1]) {
+		nodes = append(nodes[:end-1], nodes[end:]...)
 	}
 	defmethod.SetChildren(nodes)
 }
 
-func removeExtraBlankLinesRecursive(n parse.Node) {
+// dispatchVal reports whether n is a typical defmethod dispatch-val.
+func dispatchVal(n parse.Node) bool {
+	switch n.(type) {
+	case *parse.KeywordNode, *parse.SymbolNode, *parse.VectorNode,
+		*parse.StringNode, *parse.NumberNode, *parse.QuoteNode,
+		*parse.NilNode, *parse.BoolNode:
+		return true
+	}
+	return false
+}
+
+// moveNodesBack moves nodes[i:j] back to index k (where k <= i), shifting
+// the nodes in between forward.
+func moveNodesBack(nodes []parse.Node, i, j, k int) {
+	moved := append([]parse.Node(nil), nodes[i:j]...)
+	copy(nodes[k+j-i:j], nodes[k:i])
+	copy(nodes[k:], moved)
+}
+
+func isMetadata(n parse.Node) bool {
+	_, ok := n.(*parse.MetadataNode)
+	return ok
+}
+
+// removeExtraBlankLinesRecursive applies removeExtraBlankLines to the
+// children of n and of its descendants, with the limit for the context of
+// each (see blankLineContext).
+func (p *Printer) removeExtraBlankLinesRecursive(n parse.Node, r *goclj.Resolver) {
 	nodes := n.Children()
 	if len(nodes) == 0 {
 		return
 	}
 	if len(nodes) > 2 {
-		nodes = removeExtraBlankLines(nodes)
+		nodes = removeExtraBlankLines(nodes, p.maxBlankLines(blankLineContext(n, r)))
 		n.SetChildren(nodes)
 	}
 	for _, node := range nodes {
-		removeExtraBlankLinesRecursive(node)
+		p.removeExtraBlankLinesRecursive(node, r)
 	}
 }
 
-func removeExtraBlankLines(nodes []parse.Node) []parse.Node {
+// removeExtraBlankLines removes newlines from nodes to leave at most max
+// blank lines in a row.
+func removeExtraBlankLines(nodes []parse.Node, max int) []parse.Node {
 	newNodes := make([]parse.Node, 0, len(nodes))
 	newlines := 0
 	for _, node := range nodes {
@@ -297,13 +677,91 @@ func removeExtraBlankLines(nodes []parse.Node) []parse.Node {
 		} else {
 			newlines = 0
 		}
-		if newlines <= 2 {
+		if newlines <= max+1 {
+			newNodes = append(newNodes, node)
+		}
+	}
+	return newNodes
+}
+
+// splitTopLevelForms inserts a newline between each pair of adjacent forms
+// among nodes, unless the first is a tag or metadata (which applies to the
+// second) or the second is a #_ form (which often annotates the first).
+func splitTopLevelForms(nodes []parse.Node) []parse.Node {
+	var newNodes []parse.Node
+	for i, node := range nodes {
+		if i > 0 && splitsFrom(nodes[i-1], node) {
+			if newNodes == nil {
+				newNodes = append(newNodes, nodes[:i]...)
+			}
+			newNodes = append(newNodes, &parse.NewlineNode{})
+		}
+		if newNodes != nil {
 			newNodes = append(newNodes, node)
 		}
 	}
+	if newNodes == nil {
+		return nodes
+	}
 	return newNodes
 }
 
+func splitsFrom(prev, n parse.Node) bool {
+	switch prev.(type) {
+	case *parse.NewlineNode, *parse.CommentNode:
+		return false
+	}
+	// A tag or metadata may be wrapped by reader macros, as in '^:m x.
+	for !parse.KindOf(prev).Is(parse.CategoryCollection) {
+		switch prev.(type) {
+		case *parse.TagNode, *parse.MetadataNode:
+			return false
+		}
+		children := prev.Children()
+		if len(children) == 0 {
+			break
+		}
+		prev = children[len(children)-1]
+	}
+	switch n.(type) {
+	case *parse.NewlineNode, *parse.CommentNode, *parse.ReaderDiscardNode:
+		return false
+	}
+	return true
+}
+
+// fixBlankLinesAfterNS replaces the newlines between each ns form among
+// nodes (and a comment beside it) and the next form or comment with enough
+// newlines to leave blank lines between them.
+func fixBlankLinesAfterNS(nodes []parse.Node, blank int) []parse.Node {
+	if blank < 0 {
+		blank = 0
+	}
+	for i := 0; i < len(nodes); i++ {
+		if !goclj.FnFormSymbol(nodes[i], "ns") {
+			continue
+		}
+		j := i + 1
+		if j < len(nodes) && goclj.Comment(nodes[j]) {
+			j++
+		}
+		k := j
+		for k < len(nodes) && goclj.Newline(nodes[k]) {
+			k++
+		}
+		if k == len(nodes) {
+			continue // nothing follows the ns form
+		}
+		newNodes := make([]parse.Node, 0, len(nodes)+blank+1)
+		newNodes = append(newNodes, nodes[:j]...)
+		for n := 0; n <= blank; n++ {
+			newNodes = append(newNodes, &parse.NewlineNode{})
+		}
+		nodes = append(newNodes, nodes[k:]...)
+	}
+	return nodes
+}
+
 // An importRequire is an import/require with associated comment nodes.
 type importRequire struct {
 	commentsAbove []*parse.CommentNode
@@ -313,22 +771,60 @@ type importRequire struct {
 
 type importRequireList []*importRequire
 
-func (l importRequireList) Len() int      { return len(l) }
-func (l importRequireList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
-
-func (l importRequireList) Less(i, j int) bool {
+func (l importRequireList) less(i, j int, c Collation) bool {
 	// We only consider nodes comparable if they are symbols or
-	// lists/vectors with a symbol as a first child. Everything else
-	// compares as greater than one of these (and equal to one another).
-	k0, ok0 := getImportRequireSortKey(l[i].node)
-	k1, ok1 := getImportRequireSortKey(l[j].node)
-	if ok0 {
-		if ok1 {
-			return k0 < k1
+	// lists/vectors with a symbol as a first child, or (in ClojureScript)
+	// JS module libspecs such as ["react" :as react], which sort after
+	// the namespaces. A quoted libspec sorts as if it were unquoted.
+	// Everything else compares as greater than one of these and equal to
+	// one another, so (since the sort is stable) it stays in its original
+	// order at the end.
+	r0, k0 := importRequireRank(l[i].node)
+	r1, k1 := importRequireRank(l[j].node)
+	if r0 != r1 {
+		return r0 < r1
+	}
+	return r0 < rankJunk && c.less(k0, k1) // junk == junk
+}
+
+const (
+	rankNamespace = iota
+	rankJSModule
+	rankJunk
+)
+
+func importRequireRank(n parse.Node) (rank int, key string) {
+	if q, ok := n.(*parse.QuoteNode); ok {
+		n = q.Node
+	}
+	if key, ok := getImportRequireSortKey(n); ok {
+		return rankNamespace, key
+	}
+	if key, ok := getJSModuleSortKey(n); ok {
+		return rankJSModule, key
+	}
+	return rankJunk, ""
+}
+
+// getJSModuleSortKey returns the module name of a ClojureScript string
+// libspec: "react" or ["react" :as react].
+func getJSModuleSortKey(n parse.Node) (key string, ok bool) {
+	switch n := n.(type) {
+	case *parse.StringNode:
+		return n.Val, true
+	case *parse.ListNode, *parse.VectorNode:
+		children := n.Children()
+		if len(children) == 0 {
+			return "", false
 		}
-		return true // valid < junk
+		s, ok := children[0].(*parse.StringNode)
+		if !ok {
+			return "", false
+		}
+		return s.Val, true
+	default:
+		return "", false
 	}
-	return false // junk == junk, junk > valid
 }
 
 func getImportRequireSortKey(n parse.Node) (key string, ok bool) {
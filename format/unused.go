@@ -8,9 +8,12 @@ import (
 )
 
 type symbolCache struct {
-	imports  map[string]struct{} // packages appearing in :imports
-	symbols  map[string]struct{} // symbols without a / in them; e.g., foo
-	prefixes map[string]struct{} // symbol prefixes; e.g., a/foo -> a
+	imports map[string]struct{} // packages appearing in :imports
+	symbols map[string]struct{} // symbols without a / in them; e.g., foo
+	// prefixes holds the namespaces and aliases which qualify symbols
+	// (a/foo -> a), auto-resolved keywords (::a/foo -> a), and
+	// namespaced maps (#::a{...} -> a).
+	prefixes map[string]struct{}
 }
 
 func findSymbols(roots []parse.Node) *symbolCache {
@@ -27,6 +30,21 @@ func findSymbols(roots []parse.Node) *symbolCache {
 			name = n.Val
 		case *parse.VarQuoteNode:
 			name = n.Val
+		case *parse.KeywordNode:
+			if strings.HasPrefix(n.Val, "::") {
+				if i := strings.IndexRune(n.Val, '/'); i > 2 {
+					syms.prefixes[n.Val[2:i]] = struct{}{}
+				}
+			}
+			return
+		case *parse.NamespacedMapNode:
+			if strings.HasPrefix(n.Namespace, "::") && len(n.Namespace) > 2 {
+				syms.prefixes[n.Namespace[2:]] = struct{}{}
+			}
+			for _, child := range n.Children() {
+				find(child)
+			}
+			return
 		default:
 			for _, child := range n.Children() {
 				find(child)
@@ -89,7 +107,9 @@ func (sc *symbolCache) hasRequireAsImport(name string) bool {
 }
 
 // unused removes unused :as and :refer aliases from r,
-// and also returns whether the require is no longer needed at all.
+// and also returns whether the require is no longer needed at all. A
+// require is still needed if its namespace qualifies symbols itself (as in
+// clojure.string/join), even if its alias is unused.
 func (sc *symbolCache) unused(r *require) bool {
 	if len(r.as) == 0 && r.origRefer == nil && len(r.refer) == 0 {
 		// For requires like [foo], which are presumably to load Java
@@ -123,5 +143,6 @@ func (sc *symbolCache) unused(r *require) bool {
 	return len(r.as) == 0 &&
 		!r.referAll &&
 		r.origRefer == nil && len(r.refer) == 0 &&
+		!sc.hasAs(r.name) &&
 		!sc.hasRequireAsImport(r.name)
 }
@@ -0,0 +1,42 @@
+//go:build js && wasm
+
+// This program exposes the formatter to JavaScript when compiled to
+// WebAssembly:
+//
+//	GOOS=js GOARCH=wasm go build -o goclj.wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Then serve this directory and open index.html.
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+
+	"github.com/cespare/goclj/format"
+)
+
+func main() {
+	js.Global().Set("gocljFormat", js.FuncOf(formatJS))
+	// Keep running so that the function may be called.
+	select {}
+}
+
+// formatJS implements gocljFormat(src, [filename]), which returns an object
+// with either an output or an error string.
+func formatJS(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 {
+		return map[string]interface{}{"error": "gocljFormat: missing source"}
+	}
+	filename := "input.clj"
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		filename = args[1].String()
+	}
+	var buf bytes.Buffer
+	p := format.NewPrinter(&buf)
+	if err := p.Format(strings.NewReader(args[0].String()), filename); err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return map[string]interface{}{"output": buf.String()}
+}
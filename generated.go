@@ -0,0 +1,37 @@
+package goclj
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// GeneratedLines is the number of lines at the start of a file in which
+// Generated looks for a marker.
+const GeneratedLines = 5
+
+// DefaultGeneratedMarker matches the comment which marks a file as generated
+// by Go's convention, such as ";; Code generated by gen-api. DO NOT EDIT."
+// Other conventions are left to custom markers, since looser patterns would
+// match ordinary comments such as "; Do not edit the output of this fn".
+var DefaultGeneratedMarker = regexp.MustCompile(`^;+ Code generated .* DO NOT EDIT\.$`)
+
+// Generated reports whether src looks like the source of a generated file:
+// whether any of its first GeneratedLines lines matches marker (or, if marker
+// is nil, DefaultGeneratedMarker).
+func Generated(src []byte, marker *regexp.Regexp) bool {
+	if marker == nil {
+		marker = DefaultGeneratedMarker
+	}
+	for i := 0; i < GeneratedLines && len(src) > 0; i++ {
+		line := src
+		if j := bytes.IndexByte(src, '\n'); j >= 0 {
+			line, src = src[:j], src[j+1:]
+		} else {
+			src = nil
+		}
+		if marker.Match(bytes.TrimSuffix(line, []byte("\r"))) {
+			return true
+		}
+	}
+	return false
+}
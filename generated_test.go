@@ -0,0 +1,31 @@
+package goclj
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerated(t *testing.T) {
+	custom := regexp.MustCompile(`^;; @generated`)
+	for _, tt := range []struct {
+		src    string
+		marker *regexp.Regexp
+		want   bool
+	}{
+		{";; Code generated by gen-api. DO NOT EDIT.\n(ns a)\n", nil, true},
+		{"; Code generated by protoc-gen-clj. DO NOT EDIT.", nil, true},
+		{"(ns a)\n\n\n\n\n;; Code generated by gen-api. DO NOT EDIT.\n", nil, false},
+		{"(ns a)\n\n\n\n;; Code generated by gen-api. DO NOT EDIT.\n", nil, true},
+		{";; Code generated by gen-api. DO NOT EDIT.\r\n(ns a)\r\n", nil, true},
+		{";; This file is autogenerated\n(ns a)\n", nil, false},
+		{";; code generated by gen-api. do not edit.\n(ns a)\n", nil, false},
+		{"(ns a)\n\n(defn f [] 1) ; Code generated by hand. DO NOT EDIT.\n", nil, false},
+		{";; @generated by gen-api\n(ns a)\n", custom, true},
+		{";; Code generated by gen-api. DO NOT EDIT.\n(ns a)\n", custom, false},
+		{"", nil, false},
+	} {
+		if got := Generated([]byte(tt.src), tt.marker); got != tt.want {
+			t.Errorf("Generated(%q, %v) = %t; want %t", tt.src, tt.marker, got, tt.want)
+		}
+	}
+}
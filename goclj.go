@@ -76,11 +76,12 @@ func Comment(node parse.Node) bool {
 }
 
 // Semantic returns whether a node changes the semantics of the code.
-// NOTE: right now this is only used for let indenting.
-// It might have to be adjusted if used for other purposes.
+// Metadata and reader tags are not semantic by themselves, since they apply
+// to the form which follows them: skipping them leaves one node per form, as
+// when pairing up let bindings.
 func Semantic(node parse.Node) bool {
 	switch node.(type) {
-	case *parse.NewlineNode, *parse.CommentNode, *parse.MetadataNode:
+	case *parse.NewlineNode, *parse.CommentNode, *parse.MetadataNode, *parse.TagNode:
 		return false
 	}
 	return true
@@ -0,0 +1,279 @@
+package highlight
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A Class is a syntactic category of a piece of Clojure source.
+type Class int
+
+const (
+	None      Class = iota // whitespace and anything unclassified
+	Comment                // ; foo
+	String                 // "foo"
+	Regex                  // #"foo"
+	Number                 // 123
+	Keyword                // :foo
+	Character              // \c
+	Constant               // nil, true, false
+	Symbol                 // foo
+	Head                   // a symbol in function position: (foo ...)
+	Tag                    // #inst
+	Delimiter              // ( ) [ ] { } #{ #(
+	Macro                  // reader macro characters: ' ` ~ ~@ @ ^ #_ #' #=
+)
+
+var classNames = [...]string{
+	None:      "none",
+	Comment:   "comment",
+	String:    "string",
+	Regex:     "regex",
+	Number:    "number",
+	Keyword:   "keyword",
+	Character: "character",
+	Constant:  "constant",
+	Symbol:    "symbol",
+	Head:      "head",
+	Tag:       "tag",
+	Delimiter: "delimiter",
+	Macro:     "macro",
+}
+
+func (c Class) String() string { return classNames[c] }
+
+// A Span is a classified range [Start, End) of byte offsets in the source.
+type Span struct {
+	Start int
+	End   int
+	Class Class
+}
+
+// Spans splits src into classified spans which cover all of src, in order.
+// It works from the tokens of src (see parse.Scanner) rather than parsing
+// it, so incomplete or unbalanced code is highlighted too; text which
+// doesn't lex, such as an unterminated string, is left unclassified.
+func Spans(src []byte, name string) []Span {
+	toks := scan(src, name)
+	var tokens []Span
+	add := func(start, end int, class Class) {
+		tokens = append(tokens, Span{start, end, class})
+	}
+	head := false // the next symbol is in function position
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		off := tok.Pos.Offset
+		end := off + len(tok.Val)
+		var next *parse.Token
+		if i+1 < len(toks) {
+			next = &toks[i+1]
+		}
+		switch tok.Type {
+		case parse.TokenComment:
+			add(off, end, Comment)
+		case parse.TokenString:
+			add(off, end, String)
+		case parse.TokenNumber:
+			add(off, end, Number)
+		case parse.TokenKeyword:
+			add(off, end, Keyword)
+		case parse.TokenCharLiteral:
+			add(off, end, Character)
+		case parse.TokenSymbol:
+			switch {
+			case tok.Val == "nil" || tok.Val == "true" || tok.Val == "false":
+				add(off, end, Constant)
+			case head:
+				add(off, end, Head)
+			default:
+				add(off, end, Symbol)
+			}
+		case parse.TokenLeftParen, parse.TokenLeftBracket, parse.TokenLeftBrace,
+			parse.TokenRightParen, parse.TokenRightBracket, parse.TokenRightBrace:
+			add(off, end, Delimiter)
+		case parse.TokenDispatch:
+			if tok.Val != "#" || next == nil || next.Pos.Offset != end {
+				add(off, end, Macro) // #' #_ #^ #=
+				break
+			}
+			switch next.Type {
+			case parse.TokenString:
+				add(off, next.Pos.Offset+len(next.Val), Regex)
+				i++
+			case parse.TokenLeftParen, parse.TokenLeftBrace:
+				add(off, end, Delimiter) // #( #{
+			default:
+				add(off, end, Macro)
+			}
+		case parse.TokenOctothorpe:
+			// The tag name or map namespace may follow whitespace.
+			if next == nil {
+				break
+			}
+			switch next.Type {
+			case parse.TokenSymbol:
+				add(off, next.Pos.Offset+len(next.Val), Tag)
+				i++
+			case parse.TokenKeyword:
+				add(off, next.Pos.Offset+len(next.Val), Macro) // #:ns{
+				i++
+			}
+		case parse.TokenTilde:
+			if next != nil && next.Type == parse.TokenAtSign && next.Pos.Offset == end {
+				end++ // ~@
+				i++
+			}
+			add(off, end, Macro)
+		case parse.TokenApostrophe, parse.TokenBacktick, parse.TokenAtSign, parse.TokenCircumflex:
+			add(off, end, Macro)
+		}
+		switch tok.Type {
+		case parse.TokenNewline, parse.TokenComment:
+		default:
+			head = tok.Type == parse.TokenLeftParen
+		}
+	}
+
+	// Fill in the gaps between tokens, which are whitespace, commas, and
+	// anything which doesn't lex, and merge adjacent delimiters.
+	var spans []Span
+	appendSpan := func(s Span) {
+		if n := len(spans); n > 0 && spans[n-1].Class == s.Class && spans[n-1].End == s.Start &&
+			(s.Class == None || s.Class == Delimiter) {
+			spans[n-1].End = s.End
+			return
+		}
+		spans = append(spans, s)
+	}
+	pos := 0
+	for _, tok := range tokens {
+		if tok.Start < pos {
+			continue // shouldn't happen
+		}
+		if pos < tok.Start {
+			appendSpan(Span{pos, tok.Start, None})
+		}
+		appendSpan(tok)
+		pos = tok.End
+	}
+	if pos < len(src) {
+		appendSpan(Span{pos, len(src), None})
+	}
+	return spans
+}
+
+// scan returns the tokens of src. Where some text doesn't lex, it skips to
+// the next whitespace (or, for an unterminated string, to the end) and
+// carries on from there.
+func scan(src []byte, name string) []parse.Token {
+	var toks []parse.Token
+	base := 0
+	for base < len(src) {
+		s := parse.NewScanner(bytes.NewReader(src[base:]), name, 0)
+		pos := base // the end of the last token
+		for {
+			tok, err := s.Next()
+			if err == io.EOF {
+				return toks
+			}
+			if err != nil {
+				break
+			}
+			tok.Pos.Offset += base
+			toks = append(toks, tok)
+			pos = tok.Pos.Offset + len(tok.Val)
+		}
+		// Lexing failed at the first token after pos.
+		bad := bytes.IndexFunc(src[pos:], func(r rune) bool { return !isSpace(r) })
+		if bad < 0 {
+			break
+		}
+		bad += pos
+		if src[bad] == '"' {
+			break
+		}
+		_, size := utf8.DecodeRune(src[bad:])
+		n := bytes.IndexFunc(src[bad+size:], isSpace)
+		if n < 0 {
+			break
+		}
+		base = bad + size + n
+	}
+	return toks
+}
+
+func isSpace(r rune) bool { return unicode.IsSpace(r) || r == ',' }
+
+// HTML writes src to w as HTML, wrapping each classified span in a <span>
+// element whose CSS class is the class name with the given prefix (for
+// instance, with the prefix "clj-", keywords are wrapped in
+// <span class="clj-keyword">). The output is not wrapped in a <pre> block.
+func HTML(w io.Writer, src []byte, name, classPrefix string) error {
+	spans := Spans(src, name)
+	bw := bufio.NewWriter(w)
+	for _, s := range spans {
+		text := html.EscapeString(string(src[s.Start:s.End]))
+		if s.Class == None {
+			bw.WriteString(text)
+			continue
+		}
+		bw.WriteString(`<span class="` + classPrefix + s.Class.String() + `">`)
+		bw.WriteString(text)
+		bw.WriteString("</span>")
+	}
+	return bw.Flush()
+}
+
+// DefaultANSIColors are the SGR escape sequences used by ANSI.
+var DefaultANSIColors = map[Class]string{
+	Comment:   "\x1b[90m",
+	String:    "\x1b[32m",
+	Regex:     "\x1b[32m",
+	Number:    "\x1b[36m",
+	Keyword:   "\x1b[35m",
+	Character: "\x1b[32m",
+	Constant:  "\x1b[36m",
+	Head:      "\x1b[1;34m",
+	Tag:       "\x1b[33m",
+	Macro:     "\x1b[33m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// ANSI writes src to w with terminal color escape sequences. The colors are
+// looked up in colors; if colors is nil, DefaultANSIColors is used.
+func ANSI(w io.Writer, src []byte, name string, colors map[Class]string) error {
+	spans := Spans(src, name)
+	if colors == nil {
+		colors = DefaultANSIColors
+	}
+	bw := bufio.NewWriter(w)
+	for _, s := range spans {
+		text := src[s.Start:s.End]
+		color, ok := colors[s.Class]
+		if !ok {
+			bw.Write(text)
+			continue
+		}
+		// Reset before newlines in multi-line tokens so that colors
+		// don't bleed into line prefixes added by other tools.
+		lines := bytes.Split(text, []byte("\n"))
+		for i, line := range lines {
+			if i > 0 {
+				bw.WriteByte('\n')
+			}
+			if len(line) > 0 {
+				bw.WriteString(color)
+				bw.Write(line)
+				bw.WriteString(ansiReset)
+			}
+		}
+	}
+	return bw.Flush()
+}
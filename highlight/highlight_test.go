@@ -0,0 +1,122 @@
+package highlight
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+func TestHTML(t *testing.T) {
+	const src = "(defn f [x] ; c\n  #{'x @y #_ \"s<\" ^:k #' z})\n"
+	var buf bytes.Buffer
+	if err := HTML(&buf, []byte(src), "temp", ""); err != nil {
+		t.Fatal(err)
+	}
+	const want = `<span class="delimiter">(</span><span class="head">defn</span> ` +
+		`<span class="symbol">f</span> <span class="delimiter">[</span>` +
+		`<span class="symbol">x</span><span class="delimiter">]</span> ` +
+		`<span class="comment">; c</span>` + "\n  " +
+		`<span class="delimiter">#{</span><span class="macro">&#39;</span>` +
+		`<span class="symbol">x</span> <span class="macro">@</span>` +
+		`<span class="symbol">y</span> <span class="macro">#_</span> ` +
+		`<span class="string">&#34;s&lt;&#34;</span> <span class="macro">^</span>` +
+		`<span class="keyword">:k</span> <span class="macro">#&#39;</span> ` +
+		`<span class="symbol">z</span><span class="delimiter">})</span>` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSpansCoverSource(t *testing.T) {
+	const src = "(ns foo)\n\n(let [a 1, b #inst \"2017\"]\n  (+ a b \\c 1.5 nil true #\"re\"))"
+	spans := Spans([]byte(src), "temp")
+	pos := 0
+	for _, s := range spans {
+		if s.Start != pos || s.End <= s.Start {
+			t.Fatalf("bad span %+v at position %d", s, pos)
+		}
+		pos = s.End
+	}
+	if pos != len(src) {
+		t.Fatalf("spans end at %d; want %d", pos, len(src))
+	}
+}
+
+func TestSpansMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		src  string
+		want []string
+	}{
+		{
+			"(defn f [x]\n  (inc x",
+			[]string{"( delimiter", "defn head", "f symbol", "[ delimiter", "x symbol",
+				"] delimiter", "( delimiter", "inc head", "x symbol"},
+		},
+		{
+			"(f x))] :k",
+			[]string{"( delimiter", "f head", "x symbol", "))] delimiter", ":k keyword"},
+		},
+		{
+			"(f #<obj> 'x \"abc",
+			[]string{"( delimiter", "f head", "#<obj> none", "' macro", "x symbol", "\"abc none"},
+		},
+		{
+			"#:user{:a ~@b} #?(:clj 1) #inst \"2017\" #\"re\" #(%)",
+			[]string{"#:user macro", "{ delimiter", ":a keyword", "~@ macro", "b symbol",
+				"} delimiter", "#? tag", "( delimiter", ":clj keyword", "1 number",
+				") delimiter", "#inst tag", "\"2017\" string", "#\"re\" regex",
+				"#( delimiter", "% head", ") delimiter"},
+		},
+	} {
+		var got []string
+		pos := 0
+		for _, s := range Spans([]byte(tt.src), "temp") {
+			if s.Start != pos {
+				t.Fatalf("%q: bad span %+v at position %d", tt.src, s, pos)
+			}
+			pos = s.End
+			if text := strings.TrimSpace(tt.src[s.Start:s.End]); text != "" {
+				got = append(got, text+" "+s.Class.String())
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q:\ngot  %q\nwant %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	const src = `(ns foo.core
+  (:require [clojure.string :as str]
+            (clojure [set :as set])))
+
+(defmacro m [x] x)
+
+(defn f [a & more]
+  (when-let [b (str/join a)]
+    (m (a b :k) 'c (map inc more))))
+`
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range SemanticTokens(tree) {
+		got = append(got, src[tok.Start:tok.End]+" "+tok.Type.String())
+	}
+	want := []string{
+		"ns macro", "foo.core namespace",
+		":require keyword", "clojure.string namespace", ":as keyword", "str namespace",
+		"clojure namespace", "set namespace", ":as keyword", "set namespace",
+		"defmacro macro", "x local", "x local",
+		"defn macro", "a local", "more local",
+		"when-let macro", "b local", "str namespace", "join function", "a local",
+		"m macro", "a function", "b local", ":k keyword", "map function", "more local",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package highlight
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/index"
+	"github.com/cespare/goclj/parse"
+)
+
+// A TokenType is a semantic category of a symbol or keyword. Unlike a Class,
+// it depends on what the symbol refers to (as far as can be determined from
+// the file alone) and not only on the syntax.
+type TokenType int
+
+const (
+	// TokenNamespace is for namespace names and aliases, including the
+	// qualifier of a qualified symbol (str in str/join).
+	TokenNamespace TokenType = iota
+	// TokenMacro is for macros and special forms in function position.
+	TokenMacro
+	// TokenFunction is for other symbols in function position.
+	TokenFunction
+	TokenKeyword
+	// TokenLocal is for symbols which bind locals (in let, fn, and the
+	// like) and those which refer to them.
+	TokenLocal
+)
+
+var tokenTypeNames = [...]string{
+	TokenNamespace: "namespace",
+	TokenMacro:     "macro",
+	TokenFunction:  "function",
+	TokenKeyword:   "keyword",
+	TokenLocal:     "local",
+}
+
+func (t TokenType) String() string { return tokenTypeNames[t] }
+
+// A Token is a classified range [Start, End) of byte offsets in the source.
+// A token never spans lines.
+type Token struct {
+	Start int
+	End   int
+	Type  TokenType
+}
+
+// coreMacros are the special forms and the macros of clojure.core.
+var coreMacros = make(map[string]bool)
+
+func init() {
+	for _, name := range strings.Fields(`
+		. def do fn* if let* letfn* loop* monitor-enter monitor-exit new quote
+		recur set! throw try catch finally var case* deftype* reify* import*
+
+		-> ->> .. and as-> assert binding case comment cond cond-> cond->>
+		condp declare definline definterface defmacro defmethod defmulti defn
+		defn- defonce defprotocol defrecord defstruct deftype delay doseq dosync
+		dotimes doto extend-protocol extend-type fn for future gen-class
+		gen-interface if-let if-not if-some import io! lazy-cat lazy-seq let
+		letfn locking loop memfn ns or proxy proxy-super pvalues refer-clojure
+		reify some-> some->> sync time vswap! when when-first when-let when-not
+		when-some while with-bindings with-in-str with-local-vars with-open
+		with-out-str with-precision with-redefs`) {
+		coreMacros[name] = true
+	}
+}
+
+// SemanticTokens classifies the symbols and keywords of t. The tokens are in
+// order of position. Symbols which are none of the TokenTypes (such as those
+// which refer to vars outside function position) aren't included.
+func SemanticTokens(t *parse.Tree) []Token {
+	r := goclj.NewResolver(t)
+	locals := index.Locals(t)
+	// The macros defined in the file.
+	macros := make(map[string]bool)
+	ns := ""
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") && ns == "" {
+			if sym, ok := firstSemantic(root.Children()[1:]).(*parse.SymbolNode); ok {
+				ns = sym.Val
+			}
+		}
+		if goclj.FnFormSymbol(root, "defmacro") {
+			if sym, ok := firstSemantic(root.Children()[1:]).(*parse.SymbolNode); ok {
+				macros[sym.Val] = true
+			}
+		}
+	}
+	isMacro := func(sym string) bool {
+		name := r.Resolve(sym)
+		if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+			switch name[:i] {
+			case "clojure.core":
+				return coreMacros[name[i+1:]]
+			case ns:
+				return macros[name[i+1:]]
+			}
+			return false
+		}
+		return macros[name] || coreMacros[name]
+	}
+
+	var tokens []Token
+	add := func(start, end int, typ TokenType) {
+		tokens = append(tokens, Token{start, end, typ})
+	}
+	// symbol adds the tokens of a symbol: its qualifier (if any) and the
+	// name with the given type (unless it is -1).
+	symbol := func(sym *parse.SymbolNode, typ TokenType) {
+		off := sym.Offset
+		name := sym.Val
+		if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+			add(off, off+i, TokenNamespace)
+			off += i + 1
+			name = name[i+1:]
+		}
+		if typ >= 0 {
+			add(off, off+len(name), typ)
+		}
+	}
+	var visit func(n parse.Node, quoted bool)
+	visit = func(n parse.Node, quoted bool) {
+		switch n := n.(type) {
+		case *parse.KeywordNode:
+			add(n.Offset, n.Offset+len(n.Val), TokenKeyword)
+			return
+		case *parse.SymbolNode:
+			switch {
+			case locals[n] && !quoted:
+				symbol(n, TokenLocal)
+			default:
+				symbol(n, -1)
+			}
+			return
+		case *parse.QuoteNode:
+			visit(n.Node, true)
+			return
+		case *parse.UnquoteNode:
+			visit(n.Node, false)
+			return
+		case *parse.UnquoteSpliceNode:
+			visit(n.Node, false)
+			return
+		}
+		nodes := n.Children()
+		switch n.(type) {
+		case *parse.ListNode, *parse.FnLiteralNode:
+			if quoted {
+				break
+			}
+			head, ok := firstSemantic(nodes).(*parse.SymbolNode)
+			if !ok {
+				break
+			}
+			switch {
+			case locals[head]:
+				symbol(head, TokenFunction)
+			case isMacro(head.Val):
+				symbol(head, TokenMacro)
+			default:
+				symbol(head, TokenFunction)
+			}
+			if head.Val == "ns" {
+				// The clauses of the ns form are data, apart from
+				// the namespaces.
+				namespaces(n, add)
+				quoted = true
+			}
+			for _, child := range nodes {
+				if child != head {
+					visit(child, quoted)
+				}
+			}
+			return
+		}
+		for _, child := range nodes {
+			visit(child, quoted)
+		}
+	}
+	for _, root := range t.Roots {
+		visit(root, false)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Start < tokens[j].Start })
+	return tokens
+}
+
+// namespaces adds the namespace names and aliases of an ns form: the name
+// of the namespace and the namespaces and aliases of its libspecs.
+func namespaces(ns parse.Node, add func(start, end int, typ TokenType)) {
+	sym := func(n parse.Node) {
+		if s, ok := n.(*parse.SymbolNode); ok {
+			add(s.Offset, s.Offset+len(s.Val), TokenNamespace)
+		}
+	}
+	sym(firstSemantic(ns.Children()[1:]))
+	var libspec func(n parse.Node)
+	libspec = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.SymbolNode:
+			sym(n)
+		case *parse.VectorNode, *parse.ListNode:
+			var nodes []parse.Node
+			for _, child := range n.Children() {
+				if goclj.Semantic(child) {
+					nodes = append(nodes, child)
+				}
+			}
+			if len(nodes) == 0 {
+				return
+			}
+			sym(nodes[0])
+			// A prefix list, such as (clojure [string :as str]).
+			if len(nodes) > 1 {
+				switch nodes[1].(type) {
+				case *parse.VectorNode, *parse.ListNode, *parse.SymbolNode:
+					for _, sub := range nodes[1:] {
+						libspec(sub)
+					}
+					return
+				}
+			}
+			for i := 1; i+1 < len(nodes); i++ {
+				if kw, ok := nodes[i].(*parse.KeywordNode); ok && (kw.Val == ":as" || kw.Val == ":as-alias") {
+					sym(nodes[i+1])
+				}
+			}
+		}
+	}
+	for _, clause := range ns.Children() {
+		if goclj.FnFormKeyword(clause, ":require", ":require-macros", ":use") {
+			for _, n := range clause.Children()[1:] {
+				libspec(n)
+			}
+		}
+	}
+}
+
+func firstSemantic(nodes []parse.Node) parse.Node {
+	for _, n := range nodes {
+		if goclj.Semantic(n) {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A Cache stores the indexes of files on disk so that loading an Index of a
+// large project again only parses the files which have changed. Each entry
+// is keyed by a hash of a file's path and contents, so an edited file simply
+// misses the cache; stale entries are removed by Prune.
+//
+// A Cache may be shared by several processes at once.
+type Cache struct {
+	dir string
+}
+
+// cacheVersion is part of the key of every entry. It must change whenever
+// indexFile or the encoding of a File changes, so that older entries are
+// no longer used.
+const cacheVersion = "goclj-index-1"
+
+// DefaultCacheDir returns the directory in which goclj's tools keep their
+// index caches: goclj/index in the user's cache directory (see
+// os.UserCacheDir).
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goclj", "index"), nil
+}
+
+// OpenCache returns a Cache which keeps its entries in dir, creating the
+// directory if needed.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the directory of c.
+func (c *Cache) Dir() string { return c.dir }
+
+func cacheKey(path string, src []byte) string {
+	h := sha256.New()
+	h.Write([]byte(cacheVersion))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// entryPath returns the path of the entry with the given key. The entries
+// are spread over subdirectories named by the first byte of the key to
+// keep the directories small.
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// get returns the cached File for key, or nil if there is none (or it can't
+// be read).
+func (c *Cache) get(key string) *File {
+	path := c.entryPath(key)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var f File
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil
+	}
+	// Record the use so that Prune keeps the entry.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return &f
+}
+
+// put stores f under key. Errors are ignored: the cache is only an
+// optimization.
+func (c *Cache) put(key string, f *File) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return
+	}
+	path := c.entryPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// Write the entry to a temporary file and rename it into place so
+	// that other processes never see a partial entry.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Prune removes the entries of c which haven't been used for longer than
+// maxAge.
+func (c *Cache) Prune(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	return filepath.Walk(c.dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // removed by another process
+			}
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		// Temporary files are left behind by processes which died while
+		// writing an entry.
+		if !strings.HasSuffix(f.Name(), ".json") && !strings.HasPrefix(f.Name(), "tmp-") {
+			return nil
+		}
+		if f.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddFileCached is like AddFile, but it uses the index of the file in c if
+// the file hasn't changed since it was cached, and otherwise caches the new
+// index.
+func (ix *Index) AddFileCached(path string, c *Cache) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	key := cacheKey(path, src)
+	f := c.get(key)
+	if f == nil {
+		t, err := parse.Reader(bytes.NewReader(src), path, 0)
+		if err != nil {
+			return err
+		}
+		f = indexFile(path, t)
+		c.put(key, f)
+	}
+	f.src = src
+	ix.files[path] = f
+	return nil
+}
+
+// LoadCached is like Load, but it uses c as AddFileCached does.
+func LoadCached(c *Cache, paths ...string) (*Index, error) {
+	ix := New()
+	return ix.load(paths, func(path string) error { return ix.AddFileCached(path, c) })
+}
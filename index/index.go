@@ -0,0 +1,411 @@
+// Package index finds the vars defined by a set of Clojure files (typically,
+// a whole project) and the places which refer to them.
+//
+// The index is purely static: it sees the ns forms and top-level definitions
+// of the files, not the vars of a running program. It resolves symbols
+// through the aliases and refers of each file's ns form, and it knows which
+// symbols are bound as locals by the binding forms of clojure.core, but it
+// knows nothing of the vars of libraries which aren't indexed (such as
+// clojure.core itself) or of namespaces which are :use'd or referred with
+// :refer :all.
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Var is a var defined at the top level of a file.
+type Var struct {
+	Namespace string
+	Name      string
+	Kind      string // the defining form; e.g., "defn"
+	Private   bool
+	Pos       parse.Pos // the position of the name
+	// Protocol is the name of the protocol of a protocol method (which
+	// is defined by the defprotocol form).
+	Protocol string
+}
+
+// A Ref is a symbol which refers to a var.
+type Ref struct {
+	Namespace string // the namespace of the var
+	Name      string // the name of the var
+	// Text is the symbol as written, such as "str/join" or "#'f".
+	Text string
+	Pos  parse.Pos
+}
+
+// A File is the part of an Index contributed by a single file.
+type File struct {
+	Path      string
+	Namespace string // the name in the ns form, or "" if there isn't one
+	Vars      []*Var // in source order
+	Refs      []*Ref // in source order
+
+	src []byte // the source of the file, if the tree kept it
+}
+
+// An Index holds the vars defined by a set of files and the references to
+// them. Add files with Add or AddFile, or create an Index from a directory
+// with Load.
+type Index struct {
+	files map[string]*File
+}
+
+// New returns an empty Index.
+func New() *Index {
+	return &Index{files: make(map[string]*File)}
+}
+
+// sourceExts are the extensions of the files which Load indexes.
+var sourceExts = []string{".clj", ".cljs", ".cljc", ".bb"}
+
+// Load returns an Index of the Clojure files named by paths. Each path is a
+// file or a directory, which is searched recursively (skipping hidden files
+// and directories). Files which cannot be parsed are left out; Load indexes
+// the others and returns the first such error along with the Index.
+func Load(paths ...string) (*Index, error) {
+	return New().load(paths, nil)
+}
+
+// load adds the files named by paths to ix, as described for Load, using
+// addFile (or, if it is nil, ix.AddFile) to add each one.
+func (ix *Index) load(paths []string, addFile func(path string) error) (*Index, error) {
+	if addFile == nil {
+		addFile = ix.AddFile
+	}
+	var firstErr error
+	add := func(path string) {
+		if err := addFile(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, path := range paths {
+		walk := func(path string, f os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			hidden := strings.HasPrefix(f.Name(), ".") && f.Name() != "." && f.Name() != ".."
+			if f.IsDir() {
+				if hidden {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !hidden && isSource(f.Name()) {
+				add(path)
+			}
+			return nil
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			add(path)
+			continue
+		}
+		if err := filepath.Walk(path, walk); err != nil {
+			return nil, err
+		}
+	}
+	return ix, firstErr
+}
+
+func isSource(name string) bool {
+	for _, ext := range sourceExts {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFile parses the named file and adds it to ix, replacing the previous
+// version of the file, if any.
+func (ix *Index) AddFile(path string) error {
+	t, err := parse.File(path, 0)
+	if err != nil {
+		return err
+	}
+	ix.Add(path, t)
+	return nil
+}
+
+// Add adds the file at path, parsed as t, to ix, replacing the previous
+// version of the file, if any.
+func (ix *Index) Add(path string, t *parse.Tree) {
+	f := indexFile(path, t)
+	f.src = t.Source()
+	ix.files[path] = f
+}
+
+// Remove removes the file at path from ix.
+func (ix *Index) Remove(path string) {
+	delete(ix.files, path)
+}
+
+// File returns the indexed file at path, or nil if there isn't one.
+func (ix *Index) File(path string) *File {
+	return ix.files[path]
+}
+
+// Files returns the paths of the indexed files in sorted order.
+func (ix *Index) Files() []string {
+	var paths []string
+	for path := range ix.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// NamespaceOf returns the namespace of the file at path, or "" if it isn't
+// indexed or has no ns form.
+func (ix *Index) NamespaceOf(path string) string {
+	if f := ix.files[path]; f != nil {
+		return f.Namespace
+	}
+	return ""
+}
+
+// DefinitionOf returns the definition of the var ns/name, or nil if it isn't
+// defined by an indexed file. If the var is defined more than once, the
+// first definition (by path, then position) is returned.
+func (ix *Index) DefinitionOf(ns, name string) *Var {
+	for _, path := range ix.Files() {
+		f := ix.files[path]
+		if f.Namespace != ns {
+			continue
+		}
+		for _, v := range f.Vars {
+			if v.Name == name {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// ReferencesTo returns the references to the var ns/name, sorted by path
+// and then position. The definition of the var is not a reference.
+func (ix *Index) ReferencesTo(ns, name string) []*Ref {
+	var refs []*Ref
+	for _, path := range ix.Files() {
+		for _, r := range ix.files[path].Refs {
+			if r.Namespace == ns && r.Name == name {
+				refs = append(refs, r)
+			}
+		}
+	}
+	return refs
+}
+
+// Vars returns all the indexed vars, sorted by path and then position.
+func (ix *Index) Vars() []*Var {
+	var vars []*Var
+	for _, path := range ix.Files() {
+		vars = append(vars, ix.files[path].Vars...)
+	}
+	return vars
+}
+
+func indexFile(path string, t *parse.Tree) *File {
+	f := &File{Path: path}
+	r := goclj.NewResolver(t)
+	// Find the definitions first so that the references to the file's own
+	// vars are known even if they precede the definitions.
+	own := make(map[string]bool)
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") {
+			if f.Namespace == "" {
+				f.Namespace = formName(root)
+			}
+			continue
+		}
+		for _, v := range definitions(root) {
+			v.Namespace = f.Namespace
+			f.Vars = append(f.Vars, v)
+			own[v.Name] = true
+		}
+	}
+	for _, root := range t.Roots {
+		if goclj.FnFormSymbol(root, "ns") {
+			f.Refs = append(f.Refs, nsRefs(root)...)
+			continue
+		}
+		defined := definedName(root)
+		walkRefs(root, func(text string, n, binding parse.Node) {
+			if binding != nil || n == defined {
+				return
+			}
+			name := strings.TrimPrefix(text, "#'")
+			qualified := r.Resolve(name)
+			var ref *Ref
+			if i := strings.Index(qualified, "/"); i > 0 && i < len(qualified)-1 {
+				ref = &Ref{Namespace: qualified[:i], Name: qualified[i+1:]}
+			} else if own[name] {
+				ref = &Ref{Namespace: f.Namespace, Name: name}
+			} else {
+				return
+			}
+			ref.Text = text
+			ref.Pos = *n.Position()
+			f.Refs = append(f.Refs, ref)
+		})
+	}
+	sort.SliceStable(f.Refs, func(i, j int) bool {
+		return f.Refs[i].Pos.Offset < f.Refs[j].Pos.Offset
+	})
+	return f
+}
+
+// definitions returns the vars defined by a top-level form (without their
+// namespace). A defprotocol form defines the protocol and its methods.
+func definitions(root parse.Node) []*Var {
+	name, ok := definedName(root).(*parse.SymbolNode)
+	if !ok {
+		return nil
+	}
+	kind := goclj.SymbolName(root.Children()[0].(*parse.SymbolNode).Val)
+	v := &Var{
+		Name:    name.Val,
+		Kind:    kind,
+		Private: kind == "defn-" || private(root.Children()[1:], name),
+		Pos:     name.Pos,
+	}
+	vars := []*Var{v}
+	if kind == "defprotocol" {
+		for _, n := range root.Children() {
+			if !goclj.FnFormSymbol(n) {
+				continue
+			}
+			sym := n.Children()[0].(*parse.SymbolNode)
+			vars = append(vars, &Var{Name: sym.Val, Kind: kind, Pos: sym.Pos, Protocol: name.Val})
+		}
+	}
+	return vars
+}
+
+// definedName returns the name symbol of root if it is a def-like form
+// (other than defmethod, which refers to its multimethod) and nil
+// otherwise.
+func definedName(root parse.Node) parse.Node {
+	if !goclj.FnFormSymbol(root) {
+		return nil
+	}
+	head := goclj.SymbolName(root.Children()[0].(*parse.SymbolNode).Val)
+	if !strings.HasPrefix(head, "def") || head == "defmethod" || head == "default" {
+		return nil
+	}
+	for _, n := range root.Children()[1:] {
+		if goclj.Semantic(n) {
+			if sym, ok := n.(*parse.SymbolNode); ok && !strings.Contains(sym.Val, "/") {
+				return sym
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// private reports whether the metadata among nodes (those preceding the name)
+// marks a private var, as with ^:private or ^{:private true}.
+func private(nodes []parse.Node, name parse.Node) bool {
+	for _, n := range nodes {
+		if n == name {
+			break
+		}
+		m, ok := n.(*parse.MetadataNode)
+		if !ok {
+			continue
+		}
+		switch m := m.Node.(type) {
+		case *parse.KeywordNode:
+			if m.Val == ":private" {
+				return true
+			}
+		case *parse.MapNode:
+			for i, k := range m.Nodes {
+				if kw, ok := k.(*parse.KeywordNode); ok && kw.Val == ":private" && i+1 < len(m.Nodes) {
+					if b, ok := nextSemantic(m.Nodes[i+1:]).(*parse.BoolNode); ok && b.Val {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// nsRefs returns the references of the :refer lists of the ns form, as in
+// (:require [foo.core :refer [f g]]).
+func nsRefs(ns parse.Node) []*Ref {
+	var refs []*Ref
+	for _, clause := range ns.Children() {
+		if !goclj.FnFormKeyword(clause, ":require", ":require-macros") {
+			continue
+		}
+		for _, spec := range clause.Children()[1:] {
+			v, ok := spec.(*parse.VectorNode)
+			if !ok {
+				continue
+			}
+			nodes, _ := parse.SemanticChildren(v)
+			if len(nodes) == 0 {
+				continue
+			}
+			lib, ok := nodes[0].(*parse.SymbolNode)
+			if !ok {
+				continue
+			}
+			for i := 1; i+1 < len(nodes); i++ {
+				kw, ok := nodes[i].(*parse.KeywordNode)
+				if !ok || kw.Val != ":refer" {
+					continue
+				}
+				vec, ok := nodes[i+1].(*parse.VectorNode)
+				if !ok {
+					continue
+				}
+				for _, n := range vec.Nodes {
+					if sym, ok := n.(*parse.SymbolNode); ok {
+						refs = append(refs, &Ref{
+							Namespace: lib.Val,
+							Name:      sym.Val,
+							Text:      sym.Val,
+							Pos:       sym.Pos,
+						})
+					}
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// formName returns the name symbol of a form such as (ns ^:meta foo ...),
+// or "" if there isn't one.
+func formName(form parse.Node) string {
+	if sym, ok := nextSemantic(form.Children()[1:]).(*parse.SymbolNode); ok {
+		return sym.Val
+	}
+	return ""
+}
+
+// nextSemantic returns the first node of nodes which is a form (rather than
+// a comment, newline, or metadata), or nil if there isn't one.
+func nextSemantic(nodes []parse.Node) parse.Node {
+	for _, n := range nodes {
+		if goclj.Semantic(n) {
+			return n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cespare/goclj/parse"
+	"github.com/cespare/goclj/structedit"
+)
+
+func TestIndex(t *testing.T) {
+	ix, err := Load(filepath.Join("testdata", "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := filepath.Join("testdata", "src", "app", "core.clj")
+	util := filepath.Join("testdata", "src", "app", "util.clj")
+	if got, want := ix.Files(), []string{core, util}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Files: got %q; want %q", got, want)
+	}
+	if got := ix.NamespaceOf(core); got != "app.core" {
+		t.Errorf("NamespaceOf(core): got %q", got)
+	}
+
+	var vars []string
+	for _, v := range ix.Vars() {
+		vars = append(vars, fmt.Sprintf("%s/%s %s private=%t %s", v.Namespace, v.Name, v.Kind, v.Private, &v.Pos))
+	}
+	wantVars := []string{
+		"app.core/run defn private=false " + core + ":5:7",
+		"app.core/main defn private=false " + core + ":12:7",
+		"app.util/helper defn private=false " + util + ":5:7",
+		"app.util/twice defn- private=true " + util + ":7:8",
+		"app.util/secret def private=true " + util + ":9:16",
+		"app.util/Shape defprotocol private=false " + util + ":11:14",
+		"app.util/area defprotocol private=false " + util + ":12:4",
+	}
+	if !reflect.DeepEqual(vars, wantVars) {
+		t.Errorf("Vars: got\n%q\nwant\n%q", vars, wantVars)
+	}
+
+	if v := ix.DefinitionOf("app.util", "twice"); v == nil || v.Pos.Line != 7 {
+		t.Errorf("DefinitionOf(app.util, twice): got %v", v)
+	}
+	if v := ix.DefinitionOf("app.util", "nope"); v != nil {
+		t.Errorf("DefinitionOf(app.util, nope): got %v", v)
+	}
+
+	for _, tt := range []struct {
+		ns, name string
+		want     []string
+	}{
+		{"app.util", "twice", []string{
+			"u/twice@" + core + ":8:17",
+			"u/twice@" + core + ":9:28",
+			"twice@" + util + ":3:10",
+			"twice@" + util + ":5:19",
+		}},
+		{"app.util", "helper", []string{
+			"helper@" + core + ":2:37",
+			"helper@" + core + ":13:9",
+		}},
+		{"app.core", "run", []string{
+			"run@" + core + ":13:4",
+			"#'run@" + core + ":14:4",
+		}},
+		{"clojure.string", "join", []string{
+			"str/join@" + core + ":10:14",
+		}},
+		{"app.util", "secret", nil},
+	} {
+		var got []string
+		for _, r := range ix.ReferencesTo(tt.ns, tt.name) {
+			got = append(got, r.Text+"@"+r.Pos.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReferencesTo(%s, %s): got\n%q\nwant\n%q", tt.ns, tt.name, got, tt.want)
+		}
+	}
+
+	ix.Remove(core)
+	if refs := ix.ReferencesTo("app.util", "helper"); len(refs) != 0 {
+		t.Errorf("after Remove, got references %v", refs)
+	}
+}
+
+func TestLocals(t *testing.T) {
+	tree, err := parse.Reader(strings.NewReader(`(defn f [a {:keys [b] :or {b c}} & more]
+  (let [d (g a b)
+        h (fn h [] (h))]
+    (for [e more :let [k e]] (+ d e k 'a))))`), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for sym := range Locals(tree) {
+		got = append(got, fmt.Sprintf("%s@%d:%d", sym.Val, sym.Line, sym.Col))
+	}
+	sort.Strings(got)
+	want := []string{
+		"a@1:10", "a@2:14", "b@1:20", "b@1:28", "b@2:16", "d@2:9", "d@4:33",
+		"e@4:11", "e@4:26", "e@4:35", "h@3:15", "h@3:21", "h@3:9",
+		"k@4:24", "k@4:37", "more@1:36", "more@4:13",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestRenameNamespace(t *testing.T) {
+	files := map[string]string{
+		filepath.Join("src", "app", "util.clj"): `(ns app.util)
+
+(defn f [] ::x)
+(def k :app.util/k)
+`,
+		filepath.Join("src", "app", "core.clj"): `(ns app.core
+  (:require [app.util :as u]
+            [app [util :as u2]]
+            app.util))
+
+(require '[app.util :refer [f]])
+(in-ns 'app.util)
+(app.util/f #'app.util/f :app.util/k :app.utility/k app.utility/g)
+(def m #:app.util{:a #:app.utility{:b 1}})
+`,
+	}
+	ix := New()
+	for path, src := range files {
+		tree, err := parse.Reader(strings.NewReader(src), path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ix.Add(path, tree)
+	}
+	rn, err := ix.RenameNamespace("app.util", "app.tools-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		filepath.Join("src", "app", "util.clj"): `(ns app.tools-x)
+
+(defn f [] ::x)
+(def k :app.tools-x/k)
+`,
+		filepath.Join("src", "app", "core.clj"): `(ns app.core
+  (:require [app.tools-x :as u]
+            [app [tools-x :as u2]]
+            app.tools-x))
+
+(require '[app.tools-x :refer [f]])
+(in-ns 'app.tools-x)
+(app.tools-x/f #'app.tools-x/f :app.tools-x/k :app.utility/k app.utility/g)
+(def m #:app.tools-x{:a #:app.utility{:b 1}})
+`,
+	}
+	for path, src := range files {
+		if got := string(structedit.Apply([]byte(src), rn.Edits[path])); got != want[path] {
+			t.Errorf("%s: got\n%s\nwant\n%s", path, got, want[path])
+		}
+	}
+	wantMoves := map[string]string{
+		filepath.Join("src", "app", "util.clj"): filepath.Join("src", "app", "tools_x.clj"),
+	}
+	if !reflect.DeepEqual(rn.Moves, wantMoves) {
+		t.Errorf("got moves %q; want %q", rn.Moves, wantMoves)
+	}
+
+	if _, err := ix.RenameNamespace("app.util", "other.util"); err == nil {
+		t.Error("renaming within a prefix list to a new prefix succeeded")
+	}
+	if _, err := ix.RenameNamespace("app.util", "app.core"); err == nil {
+		t.Error("renaming to an existing namespace succeeded")
+	}
+	if _, err := ix.RenameNamespace("app.nope", "app.other"); err == nil {
+		t.Error("renaming an undeclared namespace succeeded")
+	}
+}
+
+func TestRenameLocal(t *testing.T) {
+	for _, tt := range []struct {
+		// The cursor is at the |.
+		in   string
+		new  string
+		want string // empty for an error
+	}{
+		{"(defn f [|x y] (* x y))", "z", "(defn f [z y] (* z y))"},
+		{"(let [a 1] (+ |a (let [a 2] a)))", "b", "(let [b 1] (+ b (let [a 2] a)))"},
+		{"(let [a 1] (+ a (let [|a 2] a)))", "b", "(let [a 1] (+ a (let [b 2] b)))"},
+		{"(let [[a & |more] xs] (apply + a more))", "rest", "(let [[a & rest] xs] (apply + a rest))"},
+		{"(letfn [(g [x] (h x)) (h [y] y)] (g |1))", "k", ""},
+		{"(letfn [(g [x] (|h x)) (h [y] y)] (g 1))", "k", "(letfn [(g [x] (k x)) (k [y] y)] (g 1))"},
+		{"(fn [{|a :a :or {a 1}}] a)", "b", "(fn [{b :a :or {b 1}}] b)"},
+		{
+			"(let [{:keys [a b] :or {a 1}} m] (+ |a b))", "c",
+			"(let [{:keys [b] :or {c 1} c :a} m] (+ c b))",
+		},
+		{"(fn [{:strs [a]}] |a)", "b", `(fn [{:strs [] b "a"}] b)`},
+		{"(fn [{:keys [x/a]}] |a)", "b", "(fn [{:keys [] b :x/a}] b)"},
+		{"(fn [{:x/keys [:a]}] |a)", "b", "(fn [{:x/keys [] b :a}] b)"},
+		{"(fn [{:syms [a c]}] [|a c])", "b", "(fn [{:syms [c] b 'a}] [b c])"},
+		// The new name would capture b.
+		{"(let [|a 1 b 2] (+ a b))", "b", ""},
+		// The new name would shadow the outer x.
+		{"(fn [x] (let [|y 1] (+ x y)))", "x", ""},
+		// The new name would shadow the var inc.
+		{"(let [|a 1] (inc a))", "inc", ""},
+		{"(let [|a 1] a)", "ns/b", ""},
+		{"(|f x)", "g", ""},
+		{"(f 'x |'y)", "g", ""},
+	} {
+		off := strings.Index(tt.in, "|")
+		src := []byte(tt.in[:off] + tt.in[off+1:])
+		tree, err := parse.Reader(strings.NewReader(string(src)), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits, err := RenameLocal(tree, src, off, tt.new)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("RenameLocal(%q, %q): got %q; want error", tt.in, tt.new, structedit.Apply(src, edits))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RenameLocal(%q, %q): %s", tt.in, tt.new, err)
+			continue
+		}
+		if got := string(structedit.Apply(src, edits)); got != tt.want {
+			t.Errorf("RenameLocal(%q, %q): got %q; want %q", tt.in, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goclj-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := filepath.Join(src, "a.clj")
+	b := filepath.Join(src, "b.clj")
+	write := func(path, contents string) {
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(a, "(ns a (:require [b :as bb]))\n(defn f [] (bb/g))\n")
+	write(b, "(ns b)\n(defn g [])\n")
+
+	c, err := OpenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := func() int {
+		n := 0
+		filepath.Walk(c.Dir(), func(path string, f os.FileInfo, err error) error {
+			if err == nil && !f.IsDir() {
+				n++
+			}
+			return nil
+		})
+		return n
+	}
+	vars := func(ix *Index) []string {
+		var names []string
+		for _, v := range ix.Vars() {
+			names = append(names, v.Namespace+"/"+v.Name+"@"+v.Pos.String())
+		}
+		return names
+	}
+
+	want, err := Load(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		ix, err := LoadCached(c, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := vars(ix); !reflect.DeepEqual(got, vars(want)) {
+			t.Errorf("load %d: got vars %q; want %q", i, got, vars(want))
+		}
+		if got := ix.ReferencesTo("b", "g"); len(got) != 1 || got[0].Text != "bb/g" {
+			t.Errorf("load %d: got references %v", i, got)
+		}
+		if n := entries(); n != 2 {
+			t.Errorf("load %d: got %d cache entries; want 2", i, n)
+		}
+	}
+
+	// A changed file is indexed again.
+	write(b, "(ns b)\n(defn g [])\n(defn h [])\n")
+	ix, err := LoadCached(c, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ix.DefinitionOf("b", "h"); v == nil {
+		t.Error("DefinitionOf(b, h) after the change: got nil")
+	}
+	if n := entries(); n != 3 {
+		t.Errorf("after the change: got %d cache entries; want 3", n)
+	}
+
+	// The entry for the old version of b.clj is unused, so it is pruned.
+	old := time.Now().Add(-time.Hour)
+	filepath.Walk(c.Dir(), func(path string, f os.FileInfo, err error) error {
+		if err == nil && !f.IsDir() {
+			os.Chtimes(path, old, old)
+		}
+		return nil
+	})
+	if _, err := LoadCached(c, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Prune(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n := entries(); n != 2 {
+		t.Errorf("after pruning: got %d cache entries; want 2", n)
+	}
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// Locals returns the symbols of t which bind locals (in let, fn, and the
+// other binding forms of clojure.core) or refer to them.
+func Locals(t *parse.Tree) map[*parse.SymbolNode]bool {
+	locals := make(map[*parse.SymbolNode]bool)
+	walkAll(t.Roots, func(_ string, n, binding parse.Node) {
+		if binding != nil {
+			locals[n.(*parse.SymbolNode)] = true
+		}
+	})
+	return locals
+}
+
+// A visitor is called by walkRefs for each symbol and var quote. The text
+// is the symbol or var quote as written. If the symbol binds a local or
+// refers to one, binding is the node which binds it (n itself, for a
+// binding); otherwise it is nil. The node which binds a local is a symbol
+// or, for a keyword in a :keys vector (as in {:keys [:a]}), a keyword.
+type visitor func(text string, n, binding parse.Node)
+
+// walkRefs calls fn for each symbol in n which isn't quoted or metadata: the
+// locals (bound by let, fn, and the other binding forms of clojure.core) and
+// the symbols which may refer to vars. It also calls fn for each var quote,
+// such as #'f.
+func walkRefs(n parse.Node, fn visitor) {
+	analysis.WalkScopes(n, nil, func(n parse.Node, s *analysis.Scope) bool {
+		switch n := n.(type) {
+		case *parse.SymbolNode:
+			var binding parse.Node
+			if s.Binds(n) {
+				binding = n
+			} else if l := s.Lookup(n.Val); l != nil {
+				binding = l.Node
+			}
+			fn(n.Val, n, binding)
+		case *parse.VarQuoteNode:
+			fn("#'"+n.Val, n, nil)
+		case *parse.QuoteNode, *parse.MetadataNode, *parse.TagNode:
+			return false
+		}
+		return true
+	})
+}
+
+func walkAll(nodes []parse.Node, fn visitor) {
+	for _, n := range nodes {
+		walkRefs(n, fn)
+	}
+}
@@ -0,0 +1,402 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+	"github.com/cespare/goclj/structedit"
+)
+
+// A NamespaceRename holds the changes which rename a namespace throughout
+// the indexed files.
+type NamespaceRename struct {
+	// Edits holds the edits to each file which must change, keyed by
+	// path.
+	Edits map[string][]structedit.Edit
+	// Moves maps the path of each file which declares the namespace to
+	// the path it should have under the new name. A file is left out if
+	// its path doesn't match the old name to begin with.
+	Moves map[string]string
+}
+
+// nsFns are the functions which take a namespace name (typically quoted) as
+// their first argument.
+var nsFns = []string{
+	"in-ns", "find-ns", "the-ns", "remove-ns", "create-ns", "ns-name",
+	"ns-publics", "ns-interns", "ns-map", "ns-aliases", "ns-refers",
+	"ns-imports", "ns-resolve",
+}
+
+// RenameNamespace works out the changes which rename the namespace old to
+// new in the indexed files: the name in the ns form which declares it, the
+// libspecs which require it (in ns forms and in calls to require and use),
+// the arguments of functions such as in-ns, the symbols qualified by it (as
+// in old/f or #'old/f), and the keywords namespaced by it (as in :old/k).
+// Aliases of the namespace need no change. The files themselves are left
+// alone; it's up to the caller to apply the edits and move the files.
+func (ix *Index) RenameNamespace(old, new string) (*NamespaceRename, error) {
+	for _, name := range []string{old, new} {
+		if name == "" || strings.ContainsAny(name, "/ \t\n") {
+			return nil, fmt.Errorf("invalid namespace name %q", name)
+		}
+	}
+	declared := false
+	for _, f := range ix.files {
+		switch f.Namespace {
+		case old:
+			declared = true
+		case new:
+			return nil, fmt.Errorf("namespace %s is already declared by %s", new, f.Path)
+		}
+	}
+	if !declared {
+		return nil, fmt.Errorf("namespace %s is not declared by any indexed file", old)
+	}
+	rn := &NamespaceRename{
+		Edits: make(map[string][]structedit.Edit),
+		Moves: make(map[string]string),
+	}
+	for _, path := range ix.Files() {
+		f := ix.files[path]
+		src := f.src
+		if src == nil {
+			var err error
+			if src, err = ioutil.ReadFile(path); err != nil {
+				return nil, err
+			}
+		}
+		t, err := parse.Reader(bytes.NewReader(src), path, 0)
+		if err != nil {
+			return nil, err
+		}
+		r := &renamer{old: old, new: new, src: src}
+		for _, root := range t.Roots {
+			if goclj.FnFormSymbol(root, "ns") && f.Namespace == old {
+				if sym, ok := nextSemantic(root.Children()[1:]).(*parse.SymbolNode); ok {
+					r.replace(sym, sym.Val, new)
+				}
+			}
+			r.walk(root)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(r.edits) > 0 {
+			sort.Slice(r.edits, func(i, j int) bool { return r.edits[i].Start < r.edits[j].Start })
+			rn.Edits[path] = r.edits
+		}
+		if f.Namespace == old {
+			ext := filepath.Ext(path)
+			oldPath := filepath.FromSlash(NamespacePath(old)) + ext
+			if strings.HasSuffix(path, oldPath) {
+				root := strings.TrimSuffix(path, oldPath)
+				if root == "" || strings.HasSuffix(root, string(filepath.Separator)) {
+					rn.Moves[path] = root + filepath.FromSlash(NamespacePath(new)) + ext
+				}
+			}
+		}
+	}
+	return rn, nil
+}
+
+// NamespacePath returns the path, relative to a source directory and without
+// an extension, of the file which declares the namespace ns by Clojure's
+// convention: app.foo-bar is declared by app/foo_bar.clj (or .cljs, and so
+// on). The path uses slashes.
+func NamespacePath(ns string) string {
+	return strings.Replace(strings.Replace(ns, "-", "_", -1), ".", "/", -1)
+}
+
+// A renamer collects the edits which rename a namespace in a single file.
+type renamer struct {
+	old, new string
+	src      []byte
+	edits    []structedit.Edit
+	err      error
+}
+
+// replace records an edit which replaces the text prefix at the start of the
+// name of n (a symbol, keyword, or var quote) with text.
+func (r *renamer) replace(n parse.Node, name, text string) {
+	// The name ends the node, which may start with something else, such
+	// as the #' of a var quote.
+	start := parse.End(n, r.src) - len(name)
+	r.edits = append(r.edits, structedit.Edit{Start: start, End: start + len(r.old), Text: text})
+}
+
+func (r *renamer) walk(n parse.Node) {
+	switch n := n.(type) {
+	case *parse.SymbolNode:
+		if strings.HasPrefix(n.Val, r.old+"/") {
+			r.replace(n, n.Val, r.new)
+		}
+		return
+	case *parse.VarQuoteNode:
+		if strings.HasPrefix(n.Val, r.old+"/") {
+			r.replace(n, n.Val, r.new)
+		}
+		return
+	case *parse.KeywordNode:
+		if strings.HasPrefix(n.Val, ":"+r.old+"/") {
+			r.replace(n, n.Val[1:], r.new)
+		}
+		return
+	case *parse.NamespacedMapNode:
+		if n.Namespace == ":"+r.old {
+			start := n.Offset + len("#:")
+			r.edits = append(r.edits, structedit.Edit{Start: start, End: start + len(r.old), Text: r.new})
+		}
+	}
+	switch {
+	case goclj.FnFormSymbol(n, "ns"):
+		for _, clause := range n.Children() {
+			if goclj.FnFormKeyword(clause, ":require", ":require-macros", ":use") {
+				for _, spec := range clause.Children()[1:] {
+					r.libspec("", spec)
+				}
+			}
+		}
+	case goclj.FnFormSymbol(n, "require", "require-macros", "use"):
+		for _, spec := range n.Children()[1:] {
+			r.libspec("", spec)
+		}
+	case goclj.FnFormSymbol(n, nsFns...):
+		if arg := nextSemantic(n.Children()[1:]); arg != nil {
+			if sym, ok := unquote(arg).(*parse.SymbolNode); ok && sym.Val == r.old {
+				r.replace(sym, sym.Val, r.new)
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		r.walk(child)
+	}
+}
+
+// libspec renames the namespace in a libspec (or prefix list) of a require,
+// as goclj.Resolver reads them.
+func (r *renamer) libspec(prefix string, n parse.Node) {
+	var sym *parse.SymbolNode
+	switch n := unquote(n).(type) {
+	case *parse.SymbolNode:
+		sym = n
+	case *parse.VectorNode, *parse.ListNode:
+		nodes, _ := parse.SemanticChildren(n)
+		if len(nodes) == 0 {
+			return
+		}
+		lib, ok := nodes[0].(*parse.SymbolNode)
+		if !ok {
+			return
+		}
+		if len(nodes) > 1 && !goclj.Keyword(nodes[1]) {
+			// A prefix list: (app [util :as u] core)
+			for _, child := range nodes[1:] {
+				r.libspec(qualify(prefix, lib.Val), child)
+			}
+			return
+		}
+		sym = lib
+	default:
+		return
+	}
+	if qualify(prefix, sym.Val) != r.old {
+		return
+	}
+	if prefix == "" {
+		r.replace(sym, sym.Val, r.new)
+		return
+	}
+	if !strings.HasPrefix(r.new, prefix+".") {
+		if r.err == nil {
+			r.err = fmt.Errorf("%s: cannot rename %s within a prefix list for %s", &sym.Pos, r.old, prefix)
+		}
+		return
+	}
+	start := sym.Offset
+	r.edits = append(r.edits, structedit.Edit{Start: start, End: start + len(sym.Val), Text: r.new[len(prefix)+1:]})
+}
+
+func qualify(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// unquote returns the node quoted by n, if it is a quote, or n.
+func unquote(n parse.Node) parse.Node {
+	if q, ok := n.(*parse.QuoteNode); ok {
+		return q.Node
+	}
+	return n
+}
+
+// RenameLocal works out the edits which rename a local (bound by let, fn,
+// or another binding form of clojure.core) in t, which was parsed from src.
+// The local is the one bound by, or referred to by, the symbol at the byte
+// offset off. The binding and every reference to it are renamed to new,
+// while other locals and vars of either name are left alone: it is an error
+// if the new name would shadow a reference to something else, or be
+// shadowed where the local is referred to.
+//
+// A local bound by the :keys (or :strs or :syms) of a map destructuring
+// pattern is rebound explicitly, so that renaming a to c in {:keys [a b]}
+// gives {:keys [b] c :a}. Defaults given by :or are renamed along with their
+// locals.
+func RenameLocal(t *parse.Tree, src []byte, off int, new string) ([]structedit.Edit, error) {
+	if new == "" || new == "&" || strings.ContainsAny(new, "/:;'\"`~@^#\\()[]{}, \t\n") ||
+		(new[0] >= '0' && new[0] <= '9') {
+		return nil, fmt.Errorf("invalid local name %q", new)
+	}
+	bindings := localBindings(t)
+	var sym *parse.SymbolNode
+	for n := range bindings {
+		if s, ok := n.(*parse.SymbolNode); ok && s.Offset <= off && off <= s.Offset+len(s.Val) {
+			sym = s
+			break
+		}
+	}
+	if sym == nil {
+		return nil, fmt.Errorf("no symbol at offset %d", off)
+	}
+	binding := bindings[sym]
+	if binding == nil {
+		return nil, fmt.Errorf("%s: %s is not a local", &sym.Pos, sym.Val)
+	}
+	var refs []*parse.SymbolNode
+	for n, b := range bindings {
+		if s, ok := n.(*parse.SymbolNode); ok && b == binding && n != binding {
+			refs = append(refs, s)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Offset < refs[j].Offset })
+	path := pathTo(t.Roots, binding)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%s: cannot find the binding of %s", &sym.Pos, sym.Val)
+	}
+	var old string
+	switch b := binding.(type) {
+	case *parse.SymbolNode:
+		old = goclj.SymbolName(b.Val)
+	case *parse.KeywordNode:
+		old = goclj.SymbolName(strings.TrimLeft(b.Val, ":"))
+	}
+	if new == old {
+		return nil, nil
+	}
+	if n := captured(t, bindings, binding, refs, new); n != nil {
+		return nil, fmt.Errorf("%s: renaming %s to %s would change what %s refers to",
+			n.Position(), old, new, n.(*parse.SymbolNode).Val)
+	}
+
+	var edits []structedit.Edit
+	for _, ref := range refs {
+		edits = append(edits, structedit.Edit{Start: ref.Offset, End: ref.Offset + len(ref.Val), Text: new})
+	}
+	b := mapBinding(path, binding)
+	switch {
+	case b != nil && b.Keys != nil:
+		start, end := binding.Position().Offset, parse.End(binding, src)
+		for end < len(src) && isSpace(src[end]) {
+			end++
+		}
+		if end < len(src) && src[end] == ']' {
+			for start > 0 && isSpace(src[start-1]) {
+				start--
+			}
+		}
+		edits = append(edits, structedit.Edit{Start: start, End: end})
+		close := parse.End(b.Map, src) - 1
+		edits = append(edits, structedit.Edit{Start: close, End: close, Text: " " + new + " " + b.LookupKey()})
+	default:
+		sym := binding.(*parse.SymbolNode)
+		edits = append(edits, structedit.Edit{Start: sym.Offset, End: sym.Offset + len(sym.Val), Text: new})
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	return edits, nil
+}
+
+// localBindings maps each symbol and var quote in t to the node which binds
+// the local it binds or refers to, or to nil if it isn't a local.
+func localBindings(t *parse.Tree) map[parse.Node]parse.Node {
+	bindings := make(map[parse.Node]parse.Node)
+	walkAll(t.Roots, func(_ string, n, binding parse.Node) {
+		bindings[n] = binding
+	})
+	return bindings
+}
+
+// captured reports the first symbol of t (by position) whose binding would
+// change if the local bound by binding, and referred to by refs, were
+// renamed to new, or nil if none would.
+func captured(t *parse.Tree, bindings map[parse.Node]parse.Node, binding parse.Node, refs []*parse.SymbolNode, new string) parse.Node {
+	// Rename the nodes in place, find the bindings again, and put the
+	// names back.
+	var restore []func()
+	rename := func(val *string, s string) {
+		old := *val
+		*val = s
+		restore = append(restore, func() { *val = old })
+	}
+	switch b := binding.(type) {
+	case *parse.SymbolNode:
+		rename(&b.Val, new)
+	case *parse.KeywordNode:
+		rename(&b.Val, ":"+new)
+	}
+	for _, ref := range refs {
+		rename(&ref.Val, new)
+	}
+	after := localBindings(t)
+	for _, f := range restore {
+		f()
+	}
+	var first parse.Node
+	for n, b := range after {
+		if b != bindings[n] && (first == nil || n.Position().Offset < first.Position().Offset) {
+			first = n
+		}
+	}
+	return first
+}
+
+// pathTo returns the ancestors of target among roots, outermost first, or
+// nil if target isn't among them.
+func pathTo(roots []parse.Node, target parse.Node) []parse.Node {
+	for _, n := range roots {
+		if n == target {
+			return []parse.Node{}
+		}
+		if path := pathTo(n.Children(), target); path != nil {
+			return append([]parse.Node{n}, path...)
+		}
+	}
+	return nil
+}
+
+// mapBinding returns the description of the local bound by binding, given
+// the path to it, if it is bound by a map destructuring pattern.
+func mapBinding(path []parse.Node, binding parse.Node) *analysis.Binding {
+	for i := len(path) - 1; i >= 0 && i >= len(path)-2; i-- {
+		if _, ok := path[i].(*parse.MapNode); !ok {
+			continue
+		}
+		for _, b := range analysis.Destructure(path[i]) {
+			if b.Node == binding && b.Map != nil {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == ','
+}
@@ -0,0 +1 @@
+(ns hidden (:require [app.util :as u])) (u/twice 1)
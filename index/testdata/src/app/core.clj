@@ -0,0 +1,15 @@
+(ns app.core
+  (:require [app.util :as u :refer [helper]]
+            [clojure.string :as str]))
+
+(defn run
+  "Runs."
+  [x]
+  (let [helper (u/twice x)
+        {:keys [a] :or {a (u/twice 1)}} {}]
+    (helper (str/join [a]))))
+
+(defn main []
+  (run (helper 1))
+  (#'run 2)
+  (fn run [] (run)))
@@ -0,0 +1,12 @@
+(ns app.util)
+
+(declare twice)
+
+(defn helper [x] (twice x))
+
+(defn- twice [x] (* 2 x))
+
+(def ^:private secret 42)
+
+(defprotocol Shape
+  (area [s]))
@@ -0,0 +1,263 @@
+// Package diff produces the unified diffs of formatting changes shown by
+// cljfmt -d and in the details of lint diagnostics.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Context is the number of unchanged lines shown around each change in a
+// unified diff.
+const Context = 3
+
+// Unified returns a unified diff of the change from before to after, which
+// are the contents of the named file before and after formatting. It returns
+// "" if they are the same.
+func Unified(name string, before, after []byte) string {
+	a, b := splitLines(string(before)), splitLines(string(after))
+	ops := Lines(a, b)
+
+	// aLine[i] and bLine[i] are the numbers of lines of before and after
+	// preceding ops[i].
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.Kind != '+' {
+			aLine[i+1]++
+		}
+		if op.Kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk over the changes whose context would overlap
+		// or abut it.
+		end := i
+		for j := i + 1; j < len(ops); j++ {
+			if ops[j].Kind == ' ' {
+				continue
+			}
+			if j-end > 2*Context {
+				break
+			}
+			end = j
+		}
+		start := i - Context
+		if start < 0 {
+			start = 0
+		}
+		stop := end + Context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "diff -u %s.orig %s\n", name, name)
+			fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", name, name)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start]+1, aLine[stop]-aLine[start]),
+			hunkRange(bLine[start]+1, bLine[stop]-bLine[start]))
+		for _, op := range ops[start:stop] {
+			buf.WriteByte(op.Kind)
+			buf.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return buf.String()
+}
+
+// Hunk returns a unified diff hunk (without context lines) of the change
+// from the text before to the text after, which begin on the given line.
+func Hunk(before, after string, line int) string {
+	b := strings.SplitAfter(before, "\n")
+	a := strings.SplitAfter(after, "\n")
+	for len(b) > 0 && len(a) > 0 && b[0] == a[0] {
+		b, a = b[1:], a[1:]
+		line++
+	}
+	for len(b) > 0 && len(a) > 0 && b[len(b)-1] == a[len(a)-1] {
+		b, a = b[:len(b)-1], a[:len(a)-1]
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(line, len(b)), hunkRange(line, len(a)))
+	for _, l := range b {
+		buf.WriteString("-" + strings.TrimSuffix(l, "\n") + "\n")
+	}
+	for _, l := range a {
+		buf.WriteString("+" + strings.TrimSuffix(l, "\n") + "\n")
+	}
+	return buf.String()
+}
+
+// hunkRange formats the range of n lines starting at line as in a unified
+// diff hunk header.
+func hunkRange(line, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, n)
+}
+
+// splitLines splits s into lines, each with its trailing newline (if any).
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// An Op is a line of a diff: kept (' '), deleted ('-'), or inserted ('+').
+type Op struct {
+	Kind byte
+	Line string
+}
+
+// Lines returns a shortest edit script turning a into b. It uses the
+// linear-space variant of Myers' algorithm, which finds the middle snake of
+// an edit script and recurses on either side of it, so that its memory use
+// is proportional to len(a)+len(b) rather than to their product.
+func Lines(a, b []string) []Op {
+	d := &differ{a: a, b: b}
+	d.diff(0, len(a), 0, len(b))
+	// Put the deletions of each run of changes before its insertions, as
+	// diff tools do.
+	ops := d.ops
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == ' ' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].Kind != ' ' {
+			j++
+		}
+		sort.SliceStable(ops[i:j], func(p, q int) bool {
+			return ops[i+p].Kind == '-' && ops[i+q].Kind == '+'
+		})
+		i = j
+	}
+	return ops
+}
+
+type differ struct {
+	a, b []string
+	ops  []Op
+}
+
+// diff appends the edit script turning a[x0:x1] into b[y0:y1] to d.ops.
+func (d *differ) diff(x0, x1, y0, y1 int) {
+	for x0 < x1 && y0 < y1 && d.a[x0] == d.b[y0] {
+		d.ops = append(d.ops, Op{' ', d.a[x0]})
+		x0++
+		y0++
+	}
+	suffix := 0
+	for x0 < x1-suffix && y0 < y1-suffix && d.a[x1-suffix-1] == d.b[y1-suffix-1] {
+		suffix++
+	}
+	x1 -= suffix
+	y1 -= suffix
+
+	switch {
+	case x0 == x1:
+		for _, line := range d.b[y0:y1] {
+			d.ops = append(d.ops, Op{'+', line})
+		}
+	case y0 == y1:
+		for _, line := range d.a[x0:x1] {
+			d.ops = append(d.ops, Op{'-', line})
+		}
+	default:
+		// Both sides are nonempty and differ at each end, so the edit
+		// script has at least two edits, and those on either side of the
+		// middle snake are each shorter than it.
+		sx, sy, ex, ey := d.middleSnake(x0, x1, y0, y1)
+		d.diff(x0, sx, y0, sy)
+		for _, line := range d.a[sx:ex] {
+			d.ops = append(d.ops, Op{' ', line})
+		}
+		d.diff(ex, x1, ey, y1)
+	}
+
+	for _, line := range d.a[x1 : x1+suffix] {
+		d.ops = append(d.ops, Op{' ', line})
+	}
+}
+
+// middleSnake finds the middle snake of a shortest edit script turning
+// a[x0:x1] into b[y0:y1]: the diagonal run of equal lines from (sx, sy) to
+// (ex, ey) at which a search forward from the start and a search backward
+// from the end meet.
+func (d *differ) middleSnake(x0, x1, y0, y1 int) (sx, sy, ex, ey int) {
+	n, m := x1-x0, y1-y0
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n+m+1)/2 + 1
+	// vf[off+k] is the furthest x reached forward on diagonal k (x-y = k),
+	// and vb[off+k-delta] is the furthest x reached backward on it, with
+	// x and y relative to (x0, y0).
+	off := max + 1
+	vf := make([]int, 2*max+3)
+	vb := make([]int, 2*max+3)
+	vf[off+1] = 0
+	vb[off+1] = n + 1
+	for D := 0; D <= max; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1] // down: an insertion
+			} else {
+				x = vf[off+k-1] + 1 // right: a deletion
+			}
+			y := x - k
+			sx, sy = x, y
+			for x < n && y < m && d.a[x0+x] == d.b[y0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			// Diagonal k is k-delta in the backward search, which has
+			// reached diagonals -(D-1) to D-1.
+			if odd && k-delta >= -(D-1) && k-delta <= D-1 && x >= vb[off+k-delta] {
+				return x0 + sx, y0 + sy, x0 + x, y0 + y
+			}
+		}
+		for k := -D; k <= D; k += 2 {
+			// Diagonal k of the backward search is c = k+delta.
+			c := k + delta
+			var x int
+			if k == -D || (k != D && vb[off+k+1]-1 < vb[off+k-1]) {
+				x = vb[off+k+1] - 1 // left: a deletion
+			} else {
+				x = vb[off+k-1] // up: an insertion
+			}
+			y := x - c
+			ex, ey = x, y
+			for x > 0 && y > 0 && d.a[x0+x-1] == d.b[y0+y-1] {
+				x--
+				y--
+			}
+			vb[off+k] = x
+			if !odd && c >= -D && c <= D && x <= vf[off+c] {
+				return x0 + x, y0 + y, x0 + ex, y0 + ey
+			}
+		}
+	}
+	panic("diff: no middle snake")
+}
@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	before := "(ns a)\n\n(defn f\n[x]\n  x)\n\n(def a 1)\n(def b 2)\n(def c 3)\n(def d 4)\n(def e 5)\n(def g 6)\n(def h 7)\n(def i  8)"
+	after := "(ns a)\n\n(defn f\n  [x]\n  x)\n\n(def a 1)\n(def b 2)\n(def c 3)\n(def d 4)\n(def e 5)\n(def g 6)\n(def h 7)\n(def i 8)\n"
+	want := "diff -u a.clj.orig a.clj\n" +
+		"--- a.clj.orig\n" +
+		"+++ a.clj\n" +
+		"@@ -1,7 +1,7 @@\n" +
+		" (ns a)\n" +
+		" \n" +
+		" (defn f\n" +
+		"-[x]\n" +
+		"+  [x]\n" +
+		"   x)\n" +
+		" \n" +
+		" (def a 1)\n" +
+		"@@ -11,4 +11,4 @@\n" +
+		" (def e 5)\n" +
+		" (def g 6)\n" +
+		" (def h 7)\n" +
+		"-(def i  8)\n" +
+		"\\ No newline at end of file\n" +
+		"+(def i 8)\n"
+	if got := Unified("a.clj", []byte(before), []byte(after)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Unified("a.clj", []byte(after), []byte(after)); got != "" {
+		t.Errorf("got %q for identical inputs; want empty", got)
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		a := randomLines(rng, rng.Intn(14))
+		b := randomLines(rng, rng.Intn(14))
+		ops := Lines(a, b)
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range ops {
+			if op.Kind != '+' {
+				gotA = append(gotA, op.Line)
+			}
+			if op.Kind != '-' {
+				gotB = append(gotB, op.Line)
+			}
+			if op.Kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("Lines(%q, %q) = %v does not turn one into the other", a, b, ops)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("Lines(%q, %q) = %v has %d edits; want %d", a, b, ops, edits, want)
+		}
+	}
+}
+
+func randomLines(rng *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a'+rng.Intn(3))) + "\n"
+	}
+	return lines
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// TestLargeReindent checks that diffing a large file in which every form is
+// reindented takes memory in proportion to its size.
+func TestLargeReindent(t *testing.T) {
+	const forms = 5000
+	var before, after strings.Builder
+	for i := 0; i < forms; i++ {
+		fmt.Fprintf(&before, "(defn f%d\n[x]\n  (inc x))\n", i)
+		fmt.Fprintf(&after, "(defn f%d\n  [x]\n  (inc x))\n", i)
+	}
+	var start, end runtime.MemStats
+	runtime.ReadMemStats(&start)
+	d := Unified("big.clj", []byte(before.String()), []byte(after.String()))
+	runtime.ReadMemStats(&end)
+	if got := strings.Count(d, "\n-[x]\n"); got != forms {
+		t.Errorf("got %d deleted parameter lines; want %d", got, forms)
+	}
+	if got := strings.Count(d, "\n+  [x]\n"); got != forms {
+		t.Errorf("got %d inserted parameter lines; want %d", got, forms)
+	}
+	const limit = 64 << 20
+	if alloc := end.TotalAlloc - start.TotalAlloc; alloc > limit {
+		t.Errorf("diff allocated %d bytes; want at most %d", alloc, limit)
+	}
+}
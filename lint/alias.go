@@ -0,0 +1,248 @@
+package lint
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// Aliases counts the aliases given to each namespace by the ns forms of a
+// set of files (typically, a whole project).
+type Aliases struct {
+	counts map[string]map[string]int // namespace -> alias -> files
+}
+
+// NewAliases returns an empty Aliases.
+func NewAliases() *Aliases {
+	return &Aliases{counts: make(map[string]map[string]int)}
+}
+
+// Add counts the aliases of the ns form of t.
+func (a *Aliases) Add(t *parse.Tree) {
+	seen := make(map[[2]string]bool)
+	for _, spec := range aliasSpecs(t) {
+		k := [2]string{spec.ns, spec.alias.Val}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		m, ok := a.counts[spec.ns]
+		if !ok {
+			m = make(map[string]int)
+			a.counts[spec.ns] = m
+		}
+		m[spec.alias.Val]++
+	}
+}
+
+// An AliasCount is an alias and the number of files which use it.
+type AliasCount struct {
+	Alias string `json:"alias"`
+	Count int    `json:"count"`
+}
+
+// An AliasSummary lists the aliases of a namespace, most common first.
+type AliasSummary struct {
+	Namespace string       `json:"namespace"`
+	Aliases   []AliasCount `json:"aliases"`
+}
+
+// Summary returns the summary of the aliases of ns.
+func (a *Aliases) Summary(ns string) AliasSummary {
+	s := AliasSummary{Namespace: ns}
+	for alias, n := range a.counts[ns] {
+		s.Aliases = append(s.Aliases, AliasCount{alias, n})
+	}
+	sort.Slice(s.Aliases, func(i, j int) bool {
+		a0, a1 := s.Aliases[i], s.Aliases[j]
+		if a0.Count != a1.Count {
+			return a0.Count > a1.Count
+		}
+		return a0.Alias < a1.Alias
+	})
+	return s
+}
+
+// Dominant returns the most common alias of ns (ties are broken
+// alphabetically). It reports false if ns has no aliases.
+func (a *Aliases) Dominant(ns string) (string, bool) {
+	s := a.Summary(ns)
+	if len(s.Aliases) == 0 {
+		return "", false
+	}
+	return s.Aliases[0].Alias, true
+}
+
+// Inconsistent returns the summaries of the namespaces which are given more
+// than one alias, sorted by namespace.
+func (a *Aliases) Inconsistent() []AliasSummary {
+	var result []AliasSummary
+	for ns, m := range a.counts {
+		if len(m) > 1 {
+			result = append(result, a.Summary(ns))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Namespace < result[j].Namespace })
+	return result
+}
+
+// AliasRule returns a rule which reports each alias of a namespace which
+// differs from its most common alias in a (see Aliases.Dominant).
+func AliasRule(a *Aliases) *Rule {
+	return &Rule{
+		ID:  "inconsistent-alias",
+		Doc: "reports namespace aliases which differ from the usual alias",
+		Run: func(pass *Pass) {
+			for _, spec := range aliasSpecs(pass.Tree) {
+				dominant, ok := a.Dominant(spec.ns)
+				if !ok || dominant == spec.alias.Val {
+					continue
+				}
+				pass.Report(spec.alias, "%s is aliased as %s here but usually as %s",
+					spec.ns, spec.alias.Val, dominant)
+			}
+		},
+	}
+}
+
+// UnknownAliasRule returns a rule which reports qualified symbols and
+// auto-resolved keywords, such as str/join and ::str/key, whose qualifier is
+// neither an alias nor a namespace required by the file (in its ns form or
+// with top-level require calls). Namespaces which are available without
+// being required in the dialect d, such as clojure.string and, in babashka,
+// babashka.fs and the built-in aliases such as json and str, are not
+// reported, nor are Java classes such as Math or java.util.UUID.
+func UnknownAliasRule(d goclj.Dialect) *Rule {
+	return &Rule{
+		ID:  "unknown-alias",
+		Doc: "reports qualified names whose alias or namespace is not required",
+		Run: func(pass *Pass) {
+			known := func(q string) bool {
+				if q == "js" || q == "clojure.core" || unicode.IsUpper(rune(q[0])) {
+					return true
+				}
+				if i := strings.LastIndexByte(q, '.'); i >= 0 && unicode.IsUpper(rune(q[i+1])) {
+					return true // a class
+				}
+				if pass.Resolver.Resolve(q+"/x") != q+"/x" || pass.Resolver.Requires(q) || d.Builtin(q) {
+					return true
+				}
+				_, ok := goclj.BabashkaAliases[q]
+				return ok && d == goclj.DialectBabashka
+			}
+			var ns string
+			var find func(n parse.Node)
+			find = func(n parse.Node) {
+				var name string
+				switch n := n.(type) {
+				case *parse.SymbolNode:
+					name = n.Val
+				case *parse.VarQuoteNode:
+					name = n.Val
+				case *parse.KeywordNode:
+					if !strings.HasPrefix(n.Val, "::") {
+						return
+					}
+					name = n.Val[2:]
+				case *parse.QuoteNode:
+					return
+				default:
+					for _, child := range n.Children() {
+						find(child)
+					}
+					return
+				}
+				i := strings.IndexByte(name, '/')
+				if i <= 0 || i == len(name)-1 {
+					return
+				}
+				if q := name[:i]; q != ns && !known(q) {
+					pass.Report(n, "%s is not an alias or a required namespace", q)
+				}
+			}
+			for _, root := range pass.Tree.Roots {
+				if goclj.FnFormSymbol(root, "ns") {
+					if nodes, _ := parse.SemanticChildren(root); len(nodes) > 1 {
+						if sym, ok := nodes[1].(*parse.SymbolNode); ok && ns == "" {
+							ns = sym.Val
+						}
+					}
+					continue
+				}
+				find(root)
+			}
+		},
+	}
+}
+
+// An aliasSpec is a libspec with an alias, such as [clojure.string :as str].
+type aliasSpec struct {
+	ns    string
+	alias *parse.SymbolNode
+}
+
+// aliasSpecs returns the libspecs with aliases in the ns form of t.
+func aliasSpecs(t *parse.Tree) []aliasSpec {
+	var specs []aliasSpec
+	var add func(prefix string, n parse.Node)
+	add = func(prefix string, n parse.Node) {
+		if q, ok := n.(*parse.QuoteNode); ok {
+			n = q.Node
+		}
+		switch n.(type) {
+		case *parse.VectorNode, *parse.ListNode:
+		default:
+			return
+		}
+		it := analysis.Items(n.Children())
+		if len(it) == 0 {
+			return
+		}
+		sym, ok := it[0].Node.(*parse.SymbolNode)
+		if !ok {
+			return
+		}
+		name := sym.Val
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		// A prefix list, such as (clojure [string :as str]).
+		if len(it) > 1 {
+			switch it[1].Node.(type) {
+			case *parse.VectorNode, *parse.ListNode, *parse.SymbolNode:
+				for _, sub := range it[1:] {
+					add(name, sub.Node)
+				}
+				return
+			}
+		}
+		for j := 1; j+1 < len(it); j++ {
+			kw, ok := it[j].Node.(*parse.KeywordNode)
+			if !ok || (kw.Val != ":as" && kw.Val != ":as-alias") {
+				continue
+			}
+			if alias, ok := it[j+1].Node.(*parse.SymbolNode); ok {
+				specs = append(specs, aliasSpec{ns: name, alias: alias})
+			}
+		}
+	}
+	for _, root := range t.Roots {
+		if !goclj.FnFormSymbol(root, "ns") {
+			continue
+		}
+		for _, clause := range root.Children() {
+			if !goclj.FnFormKeyword(clause, ":require", ":require-macros", ":use") {
+				continue
+			}
+			for _, n := range clause.Children()[1:] {
+				add("", n)
+			}
+		}
+		break
+	}
+	return specs
+}
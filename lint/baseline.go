@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// A Baseline records the diagnostics in a body of code at some point (say,
+// when a rule is adopted) so that they can be ignored, and only new problems
+// reported.
+//
+// Diagnostics are matched by file, rule, and message, but not position, so
+// that a baseline isn't invalidated by edits elsewhere in a file. A file
+// with n diagnostics in the baseline may have up to n matching diagnostics
+// before any are reported.
+type Baseline struct {
+	Entries []BaselineEntry `json:"entries"`
+}
+
+// A BaselineEntry is a kind of diagnostic recorded in a Baseline.
+type BaselineEntry struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+type baselineKey struct {
+	file, rule, message string
+}
+
+func keyOf(d *Diagnostic) baselineKey {
+	return baselineKey{d.Pos.Name, d.Rule, d.Message}
+}
+
+// NewBaseline creates a Baseline which matches diags.
+func NewBaseline(diags []*Diagnostic) *Baseline {
+	counts := make(map[baselineKey]int)
+	for _, d := range diags {
+		counts[keyOf(d)]++
+	}
+	b := &Baseline{Entries: []BaselineEntry{}}
+	for k, n := range counts {
+		b.Entries = append(b.Entries, BaselineEntry{
+			File:    k.file,
+			Rule:    k.rule,
+			Message: k.message,
+			Count:   n,
+		})
+	}
+	sort.Slice(b.Entries, func(i, j int) bool {
+		e0, e1 := b.Entries[i], b.Entries[j]
+		if e0.File != e1.File {
+			return e0.File < e1.File
+		}
+		if e0.Rule != e1.Rule {
+			return e0.Rule < e1.Rule
+		}
+		return e0.Message < e1.Message
+	})
+	return b
+}
+
+// ReadBaseline reads a Baseline in the JSON format written by Write.
+func ReadBaseline(r io.Reader) (*Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Write writes b to w as JSON.
+func (b *Baseline) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// Filter returns the diagnostics among diags which are not in b.
+func (b *Baseline) Filter(diags []*Diagnostic) []*Diagnostic {
+	remaining := make(map[baselineKey]int)
+	for _, e := range b.Entries {
+		remaining[baselineKey{e.File, e.Rule, e.Message}] += e.Count
+	}
+	return filter(diags, func(d *Diagnostic) bool {
+		k := keyOf(d)
+		if remaining[k] > 0 {
+			remaining[k]--
+			return false
+		}
+		return true
+	})
+}
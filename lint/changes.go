@@ -0,0 +1,186 @@
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A LineRange is a range of lines, from Start to End inclusive.
+type LineRange struct {
+	Start, End int
+}
+
+// ParseDiff reads a unified diff (such as the output of git diff) and
+// returns the lines of the new version of each file which it changes, keyed
+// by the file's name in the diff (without git's "b/" prefix). Inserted lines
+// are changed, as is the line following each deletion, so that a form from
+// which lines were only removed still counts as changed. Deleted files are
+// omitted.
+func ParseDiff(r io.Reader) (map[string][]LineRange, error) {
+	changed := make(map[string]map[int]bool)
+	var (
+		file       string
+		line       int // the current line of the new version
+		oldN, newN int // the lines remaining in the current hunk
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if oldN > 0 || newN > 0 {
+			if text == "" {
+				text = " " // some tools strip the space of empty context lines
+			}
+			switch text[0] {
+			case ' ':
+				line++
+				oldN--
+				newN--
+			case '+':
+				if file != "" {
+					changed[file][line] = true
+				}
+				line++
+				newN--
+			case '-':
+				if file != "" {
+					changed[file][line] = true
+				}
+				oldN--
+			case '\\': // \ No newline at end of file
+			default:
+				return nil, fmt.Errorf("unexpected line in diff hunk: %q", text)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(text, "+++ ")
+			if i := strings.IndexByte(file, '\t'); i >= 0 {
+				file = file[:i] // a timestamp follows
+			}
+			if file == "/dev/null" {
+				file = ""
+				continue
+			}
+			file = strings.TrimPrefix(file, "b/")
+			if changed[file] == nil {
+				changed[file] = make(map[int]bool)
+			}
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			line, oldN, newN, err = parseHunkHeader(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	result := make(map[string][]LineRange)
+	for file, lines := range changed {
+		result[file] = lineRanges(lines)
+	}
+	return result, nil
+}
+
+// parseHunkHeader parses a hunk header such as "@@ -1,4 +1,5 @@", returning
+// the first line of the new version and the numbers of lines of the old and
+// new versions in the hunk.
+func parseHunkHeader(text string) (line, oldN, newN int, err error) {
+	fields := strings.Fields(text)
+	if len(fields) < 4 || fields[3] != "@@" ||
+		!strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", text)
+	}
+	_, oldN, err1 := parseHunkRange(fields[1][1:])
+	line, newN, err2 := parseHunkRange(fields[2][1:])
+	if err1 != nil || err2 != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", text)
+	}
+	if newN == 0 {
+		// The range of an empty hunk ends at the line before it.
+		line++
+	}
+	return line, oldN, newN, nil
+}
+
+// parseHunkRange parses the range "start,n" (or "start", for a single line)
+// of a hunk header.
+func parseHunkRange(s string) (start, n int, err error) {
+	n = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if n, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, n, err
+}
+
+// lineRanges returns the set of lines as a sorted list of ranges.
+func lineRanges(lines map[int]bool) []LineRange {
+	var sorted []int
+	for line := range lines {
+		sorted = append(sorted, line)
+	}
+	sort.Ints(sorted)
+	var ranges []LineRange
+	for _, line := range sorted {
+		if n := len(ranges); n > 0 && ranges[n-1].End == line-1 {
+			ranges[n-1].End = line
+			continue
+		}
+		ranges = append(ranges, LineRange{line, line})
+	}
+	return ranges
+}
+
+// ChangedForms returns the top-level forms (and comments) of t which span
+// any of the changed lines.
+func ChangedForms(t *parse.Tree, changed []LineRange) []parse.Node {
+	var result []parse.Node
+	for _, n := range forms(t.Roots) {
+		start, end := n.Position().Line, n.End().Line
+		if end < start {
+			end = start
+		}
+		for _, r := range changed {
+			if r.Start <= end && start <= r.End {
+				result = append(result, n)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// FilterChanged returns the diagnostics among diags, which were reported for
+// t, which are in the top-level forms of t that span any of the changed
+// lines (or are on a changed line outside of any form). Since t is the new
+// version of a file, the positions of the diagnostics are in the new
+// version, as are the lines of a diff read by ParseDiff.
+func FilterChanged(t *parse.Tree, diags []*Diagnostic, changed []LineRange) []*Diagnostic {
+	touched := ChangedForms(t, changed)
+	return filter(diags, func(d *Diagnostic) bool {
+		for _, n := range touched {
+			if n.Position().Offset <= d.Pos.Offset && d.Pos.Offset < n.End().Offset {
+				return true
+			}
+		}
+		for _, r := range changed {
+			if r.Start <= d.Pos.Line && d.Pos.Line <= r.End {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,191 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// FunctionLengthRule returns a rule which reports top-level function
+// definitions (defn, defn-, defmacro, and defmethod forms) that span more
+// than max lines. If max is not positive, the rule reports nothing.
+func FunctionLengthRule(max int) *Rule {
+	return &Rule{
+		ID:  "function-length",
+		Doc: "reports function definitions with too many lines",
+		Run: func(pass *Pass) {
+			if max <= 0 {
+				return
+			}
+			for _, fn := range functions(pass.Tree) {
+				start := fn.form.Position().Line
+				if n := lastLine(fn.form) - start + 1; n > max {
+					pass.ReportDetail(fn.form, fmt.Sprintf("%s is %d lines long\n", fn.name, n),
+						"%s is longer than %d lines", fn.name, max)
+				}
+			}
+		},
+	}
+}
+
+// NestingDepthRule returns a rule which reports top-level function
+// definitions that nest forms (lists and #() literals) more than max deep.
+// The depth of each form in the body of the function is 1. If max is not
+// positive, the rule reports nothing.
+func NestingDepthRule(max int) *Rule {
+	return &Rule{
+		ID:  "nesting-depth",
+		Doc: "reports function definitions with deeply nested forms",
+		Run: func(pass *Pass) {
+			if max <= 0 {
+				return
+			}
+			for _, fn := range functions(pass.Tree) {
+				if n := tooDeep(fn.body, 0, max); n != nil {
+					pass.Report(n, "%s nests forms more than %d deep", fn.name, max)
+				}
+			}
+		},
+	}
+}
+
+// ParamCountRule returns a rule which reports the arities of top-level
+// function definitions that take more than max parameters. A rest
+// parameter and a destructured parameter each count as one. If max is not
+// positive, the rule reports nothing.
+func ParamCountRule(max int) *Rule {
+	return &Rule{
+		ID:  "param-count",
+		Doc: "reports functions with too many parameters",
+		Run: func(pass *Pass) {
+			if max <= 0 {
+				return
+			}
+			for _, fn := range functions(pass.Tree) {
+				for _, params := range fn.params {
+					n := 0
+					for _, it := range analysis.Items(params.Children()) {
+						if !isSymbol(it.Node, "&") {
+							n++
+						}
+					}
+					if n > max {
+						pass.Report(params, "%s has %d parameters (more than %d)", fn.name, n, max)
+					}
+				}
+			}
+		},
+	}
+}
+
+// A function is a top-level function definition.
+type function struct {
+	name   string
+	form   parse.Node
+	params []parse.Node // the parameter vector of each arity
+	body   []parse.Node // the bodies of all the arities
+}
+
+// functions returns the top-level function definitions in t.
+func functions(t *parse.Tree) []function {
+	var fns []function
+	for _, root := range t.Roots {
+		var tail []parse.Node // the params and body, or the arities
+		fn := function{form: root}
+		switch {
+		case goclj.FnFormSymbol(root, "defn", "defn-", "defmacro"):
+			d, ok := goclj.ParseDefn(root)
+			if !ok {
+				continue
+			}
+			nodes := root.Children()
+			fn.name = nodes[d.Name].(*parse.SymbolNode).Val
+			start := d.Params
+			if start < 0 {
+				start = d.Arities[0]
+			}
+			tail = nodes[start:]
+		case goclj.FnFormSymbol(root, "defmethod"):
+			nodes := root.Children()
+			it := analysis.Items(nodes[1:])
+			if len(it) < 3 || !goclj.Symbol(it[0].Node) {
+				continue
+			}
+			fn.name = it[0].Node.(*parse.SymbolNode).Val + " " + minified(it[1].Node)
+			tail = nodes[indexOf(nodes, it[1].Node)+1:]
+		default:
+			continue
+		}
+		arities := [][]parse.Node{tail}
+		if it := analysis.Items(tail); len(it) > 0 && !goclj.Vector(it[0].Node) {
+			arities = nil
+			for _, it := range it {
+				if _, ok := it.Node.(*parse.ListNode); ok {
+					arities = append(arities, it.Node.Children())
+				}
+			}
+		}
+		for _, arity := range arities {
+			it := analysis.Items(arity)
+			if len(it) == 0 || !goclj.Vector(it[0].Node) {
+				continue
+			}
+			fn.params = append(fn.params, it[0].Node)
+			for _, body := range it[1:] {
+				fn.body = append(fn.body, body.Node)
+			}
+		}
+		fns = append(fns, fn)
+	}
+	return fns
+}
+
+// tooDeep returns the first form among nodes (and their descendants) whose
+// nesting depth exceeds max, or nil if there isn't one. The nodes are at
+// the given depth.
+func tooDeep(nodes []parse.Node, depth, max int) parse.Node {
+	for _, n := range nodes {
+		d := depth
+		switch n.(type) {
+		case *parse.ListNode, *parse.FnLiteralNode:
+			d++
+			if d > max {
+				return n
+			}
+		}
+		if found := tooDeep(n.Children(), d, max); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// lastLine returns the last line of the code of n, approximated as the last
+// line of its descendants (since the closing delimiter usually follows the
+// last of them).
+func lastLine(n parse.Node) int {
+	line := n.Position().Line
+	switch n := n.(type) {
+	case *parse.StringNode:
+		line += strings.Count(n.Val, "\n")
+	case *parse.RegexNode:
+		line += strings.Count(n.Val, "\n")
+	}
+	for _, child := range n.Children() {
+		if l := lastLine(child); l > line {
+			line = l
+		}
+	}
+	return line
+}
+
+// minified returns the text of n in its most compact form.
+func minified(n parse.Node) string {
+	var b strings.Builder
+	format.Minify(&b, &parse.Tree{Roots: []parse.Node{n}})
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// DeprecatedRule returns a rule which reports uses of deprecated vars and
+// requires of deprecated namespaces. The keys of deprecated are the
+// fully-qualified names of the vars (such as "old.core/f") and the names of
+// the namespaces; each value is a suggested replacement, or the empty string
+// if there isn't one. FindDeprecated finds the vars and namespaces marked
+// with :deprecated metadata.
+//
+// Symbols are resolved through the aliases and refers of the ns form, and
+// unqualified symbols also refer to the vars of the file's own namespace.
+func DeprecatedRule(deprecated map[string]string) *Rule {
+	return &Rule{
+		ID:  "deprecated",
+		Doc: "reports uses of deprecated vars and namespaces",
+		Run: func(pass *Pass) {
+			if len(deprecated) == 0 {
+				return
+			}
+			report := func(n parse.Node, name string) {
+				if repl := deprecated[name]; repl != "" {
+					pass.Report(n, "%s is deprecated; use %s instead", name, repl)
+				} else {
+					pass.Report(n, "%s is deprecated", name)
+				}
+			}
+			ns := nsName(pass.Tree)
+			for _, root := range pass.Tree.Roots {
+				if goclj.FnFormSymbol(root, "ns") {
+					for _, clause := range root.Children() {
+						if !goclj.FnFormKeyword(clause, ":require", ":require-macros", ":use") {
+							continue
+						}
+						analysis.WalkScopes(clause, nil, func(n parse.Node, _ *analysis.Scope) bool {
+							if sym, ok := n.(*parse.SymbolNode); ok {
+								if _, ok := deprecated[sym.Val]; ok && !strings.Contains(sym.Val, "/") {
+									report(sym, sym.Val)
+								}
+							}
+							return true
+						})
+					}
+					continue
+				}
+				var defined parse.Node // the name of a def form
+				if isDefForm(root) {
+					if it := analysis.Items(root.Children()[1:]); len(it) > 0 {
+						defined = it[0].Node
+					}
+				}
+				analysis.WalkScopes(root, nil, func(n parse.Node, s *analysis.Scope) bool {
+					sym, ok := n.(*parse.SymbolNode)
+					if !ok || n == defined {
+						return true
+					}
+					name := pass.Resolver.Resolve(sym.Val)
+					if !strings.Contains(name, "/") || name == "/" {
+						if s.Lookup(name) != nil || ns == "" {
+							return true
+						}
+						name = ns + "/" + name
+					}
+					if _, ok := deprecated[name]; ok {
+						report(sym, name)
+					}
+					return true
+				})
+			}
+		},
+	}
+}
+
+// FindDeprecated adds the vars and namespaces defined in t which are marked as
+// deprecated, as in
+//
+//	(defn ^{:deprecated "1.2" :superseded-by "g"} f ...)
+//	(defn f {:deprecated "1.2"} ...)
+//	(ns ^:deprecated old.core)
+//
+// to deprecated. The replacement for each is given by :superseded-by, if
+// present, and is qualified with the namespace of the definition if it is
+// unqualified.
+func FindDeprecated(t *parse.Tree, deprecated map[string]string) {
+	var ns string
+	for _, root := range t.Roots {
+		if !isDefForm(root) && !goclj.FnFormSymbol(root, "ns") {
+			continue
+		}
+		nodes := root.Children()[1:]
+		it := analysis.Items(nodes)
+		if len(it) == 0 {
+			continue
+		}
+		sym, ok := it[0].Node.(*parse.SymbolNode)
+		if !ok {
+			continue
+		}
+		var metas []parse.Node
+		for _, n := range nodes[:indexOf(nodes, sym)] {
+			if m, ok := n.(*parse.MetadataNode); ok {
+				metas = append(metas, m.Node)
+			}
+		}
+		// An attr-map, after the name (and docstring).
+		for _, next := range it[1:] {
+			if _, ok := next.Node.(*parse.StringNode); ok {
+				continue
+			}
+			if _, ok := next.Node.(*parse.MapNode); ok {
+				metas = append(metas, next.Node)
+			}
+			break
+		}
+		dep, repl := false, ""
+		for _, m := range metas {
+			d, r := deprecation(m)
+			dep = dep || d
+			if r != "" {
+				repl = r
+			}
+		}
+		name := sym.Val
+		if goclj.FnFormSymbol(root, "ns") {
+			ns = name
+			if dep {
+				deprecated[name] = repl
+			}
+			continue
+		}
+		if !dep {
+			continue
+		}
+		if ns != "" {
+			name = ns + "/" + name
+			if repl != "" && !strings.Contains(repl, "/") && !strings.Contains(repl, ".") {
+				repl = ns + "/" + repl
+			}
+		}
+		deprecated[name] = repl
+	}
+}
+
+// deprecation reports whether the metadata m (such as :deprecated or
+// {:deprecated "1.2"}) marks a deprecated var, and returns the replacement
+// given by :superseded-by, if any.
+func deprecation(m parse.Node) (deprecated bool, replacement string) {
+	switch m := m.(type) {
+	case *parse.KeywordNode:
+		return m.Val == ":deprecated", ""
+	case *parse.MapNode:
+		it := analysis.Items(m.Nodes)
+		for j := 0; j+1 < len(it); j += 2 {
+			kw, ok := it[j].Node.(*parse.KeywordNode)
+			if !ok {
+				continue
+			}
+			switch kw.Val {
+			case ":deprecated":
+				switch v := it[j+1].Node.(type) {
+				case *parse.BoolNode:
+					deprecated = v.Val
+				case *parse.NilNode:
+				default:
+					deprecated = true
+				}
+			case ":superseded-by":
+				switch v := it[j+1].Node.(type) {
+				case *parse.StringNode:
+					replacement = v.Val
+				case *parse.SymbolNode:
+					replacement = v.Val
+				case *parse.QuoteNode:
+					if sym, ok := v.Node.(*parse.SymbolNode); ok {
+						replacement = sym.Val
+					}
+				}
+			}
+		}
+	}
+	return deprecated, replacement
+}
+
+// isDefForm reports whether n is a def-like form such as (def ...),
+// (defn ...), or (defmacro ...).
+func isDefForm(n parse.Node) bool {
+	if !goclj.FnFormSymbol(n) {
+		return false
+	}
+	return strings.HasPrefix(goclj.SymbolName(n.Children()[0].(*parse.SymbolNode).Val), "def")
+}
@@ -0,0 +1,82 @@
+package lint
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// MisplacedDocstringRule returns a rule which reports strings which follow
+// the parameter vector of a function definition (defn, defn-, or defmacro)
+// and precede the rest of its body, as in
+//
+//	(defn f [x]
+//	  "Docs."
+//	  (g x))
+//
+// Such a string is not a docstring but an expression whose value is
+// discarded. If the definition has a single arity and no docstring, the
+// diagnostic can be fixed by moving the string after the name.
+func MisplacedDocstringRule() *Rule {
+	return &Rule{
+		ID:  "misplaced-docstring",
+		Doc: "reports docstrings after the parameter vector",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "defn", "defn-", "defmacro") {
+					return
+				}
+				d, ok := goclj.ParseDefn(n)
+				if !ok {
+					return
+				}
+				nodes := n.Children()
+				name := nodes[d.Name].(*parse.SymbolNode)
+				if d.Params >= 0 {
+					s := misplacedDocstring(nodes[d.Params+1:])
+					if s == nil {
+						return
+					}
+					var fix func()
+					i := indexOf(nodes, s)
+					followed := i+1 < len(nodes) && isComment(nodes[i+1])
+					if d.Docstring < 0 && !followed {
+						fix = func() {
+							parse.RemoveChild(n, s)
+							parse.InsertAfter(n, name, s)
+						}
+					}
+					pass.ReportFix(s, fix, "the string after the parameters of %s is not a docstring", name.Val)
+					return
+				}
+				for _, a := range d.Arities {
+					it := analysis.Items(nodes[a].Children())
+					if len(it) == 0 || !goclj.Vector(it[0].Node) {
+						continue
+					}
+					body := nodes[a].Children()[indexOf(nodes[a].Children(), it[0].Node)+1:]
+					if s := misplacedDocstring(body); s != nil {
+						pass.Report(s, "the string after the parameters of %s is not a docstring", name.Val)
+					}
+				}
+			})
+		},
+	}
+}
+
+// misplacedDocstring returns the first form of the body of a function if it
+// is a string followed by other forms, or nil otherwise. (A string which is
+// the entire body is the return value.)
+func misplacedDocstring(body []parse.Node) *parse.StringNode {
+	it := analysis.Items(body)
+	if len(it) < 2 {
+		return nil
+	}
+	s, _ := it[0].Node.(*parse.StringNode)
+	return s
+}
+
+func isComment(n parse.Node) bool {
+	_, ok := n.(*parse.CommentNode)
+	return ok
+}
@@ -0,0 +1,53 @@
+package lint
+
+import (
+	"fmt"
+
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// DuplicateKeyRule returns a rule which reports duplicate keys in map
+// literals and duplicate elements in set literals, which the Clojure reader
+// only rejects when the code is loaded. Keys are duplicates if they print
+// the same (ignoring whitespace and comments). Each diagnostic is at the
+// duplicate and its detail gives the position of the first occurrence.
+func DuplicateKeyRule() *Rule {
+	return &Rule{
+		ID:  "duplicate-key",
+		Doc: "reports duplicate keys in map and set literals",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				var keys []parse.Node
+				var what string
+				switch n := n.(type) {
+				case *parse.MapNode, *parse.NamespacedMapNode:
+					what = "key in map literal"
+					for j, it := range analysis.Items(n.Children()) {
+						if j%2 == 0 {
+							keys = append(keys, it.Node)
+						}
+					}
+				case *parse.SetNode:
+					what = "element in set literal"
+					for _, it := range analysis.Items(n.Nodes) {
+						keys = append(keys, it.Node)
+					}
+				default:
+					return
+				}
+				seen := make(map[string]parse.Node)
+				for _, k := range keys {
+					s := minified(k)
+					first, ok := seen[s]
+					if !ok {
+						seen[s] = k
+						continue
+					}
+					pass.ReportDetail(k, fmt.Sprintf("first at %s\n", first.Position()),
+						"duplicate %s: %s", what, s)
+				}
+			})
+		},
+	}
+}
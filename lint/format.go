@@ -0,0 +1,74 @@
+package lint
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/internal/diff"
+	"github.com/cespare/goclj/parse"
+)
+
+// FormatRule returns a rule, "format", which reports each top-level form
+// whose layout differs from the printer's (including the spacing after the
+// form). The Detail of each diagnostic is a unified diff hunk of the change.
+// The changes that transforms would make are left to the rules returned by
+// TransformRule.
+//
+// The rule compares the printed code with the source of the tree, so it
+// reports nothing for trees which weren't parsed by parse.Reader or
+// parse.File. The code is printed with a Printer created by newPrinter (or
+// format.NewPrinter, if newPrinter is nil), whose Transforms are overwritten.
+func FormatRule(newPrinter func(w io.Writer) *format.Printer) *Rule {
+	if newPrinter == nil {
+		newPrinter = format.NewPrinter
+	}
+	rule := &Rule{
+		ID:  "format",
+		Doc: "reports forms which are not formatted",
+	}
+	rule.Run = func(pass *Pass) {
+		src := pass.Tree.Source()
+		if src == nil {
+			return
+		}
+		none := make(map[format.Transform]bool)
+		for _, t := range format.AllTransforms() {
+			none[t] = false
+		}
+		var buf bytes.Buffer
+		printedPos := make(map[parse.Node]parse.Pos)
+		p := newPrinter(&buf)
+		p.Transforms = none
+		p.DataProfiles = nil
+		p.DataProfile = format.DataProfileNone
+		p.PrintedPositions = printedPos
+		if err := p.PrintTree(pass.Tree); err != nil {
+			return
+		}
+		printed := buf.Bytes()
+		if bytes.Equal(src, printed) {
+			return
+		}
+
+		roots := forms(pass.Tree.Roots)
+		srcPos := make(map[parse.Node]parse.Pos)
+		for _, n := range roots {
+			srcPos[n] = *n.Position()
+		}
+		srcSegs := segments(src, roots, srcPos)
+		printedSegs := segments(printed, roots, printedPos)
+		for i, n := range roots {
+			if srcSegs[i] == nil || printedSegs[i] == nil || bytes.Equal(srcSegs[i], printedSegs[i]) {
+				continue
+			}
+			line := 1
+			if i > 0 {
+				line = n.Position().Line
+			}
+			detail := diff.Hunk(string(srcSegs[i]), string(printedSegs[i]), line)
+			pass.ReportDetail(n, detail, "this form is not formatted")
+		}
+	}
+	return rule
+}
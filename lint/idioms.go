@@ -0,0 +1,191 @@
+package lint
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// These rules report code which has a simpler or more idiomatic equivalent,
+// or which is probably a mistake. Each is a separate rule so that teams can
+// choose which ones to follow.
+
+// NilEqualityRule returns a rule which reports comparisons with nil such as
+// (= x nil), which are better written (nil? x), and (not= x nil), which are
+// better written (some? x). The diagnostics can be fixed.
+func NilEqualityRule() *Rule {
+	return &Rule{
+		ID:  "nil-equality",
+		Doc: "reports (= x nil) and (not= x nil)",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "=", "not=") {
+					return
+				}
+				it := analysis.Items(n.Children())
+				if len(it) != 3 || !simple(n) {
+					return
+				}
+				var x parse.Node
+				switch {
+				case isNil(it[2].Node):
+					x = it[1].Node
+				case isNil(it[1].Node):
+					x = it[2].Node
+				default:
+					return
+				}
+				head := it[0].Node.(*parse.SymbolNode)
+				pred := "nil?"
+				if head.Val == "not=" {
+					pred = "some?"
+				}
+				pass.ReportFix(n, func() {
+					n.SetChildren([]parse.Node{&parse.SymbolNode{Pos: head.Pos, Val: pred}, x})
+				}, "use (%s x) rather than (%s x nil)", pred, head.Val)
+			})
+		},
+	}
+}
+
+// IfNotRule returns a rule which reports (if (not x) ...), which is better
+// written (if-not x ...) or, without an else branch, (when-not x ...). The
+// diagnostics can be fixed.
+func IfNotRule() *Rule {
+	return &Rule{
+		ID:  "if-not",
+		Doc: "reports (if (not x) ...)",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "if") {
+					return
+				}
+				it := analysis.Items(n.Children())
+				if len(it) != 3 && len(it) != 4 {
+					return
+				}
+				test := it[1].Node
+				if !goclj.FnFormSymbol(test, "not") || !simple(test) {
+					return
+				}
+				tit := analysis.Items(test.Children())
+				if len(tit) != 2 {
+					return
+				}
+				head := it[0].Node.(*parse.SymbolNode)
+				repl := "if-not"
+				if len(it) == 3 {
+					repl = "when-not"
+				}
+				pass.ReportFix(n, func() {
+					nodes := n.Children()
+					nodes[indexOf(nodes, head)] = &parse.SymbolNode{Pos: head.Pos, Val: repl}
+					nodes[indexOf(nodes, test)] = tit[1].Node
+				}, "use (%s x ...) rather than (if (not x) ...)", repl)
+			})
+		},
+	}
+}
+
+// SingleBranchIfRule returns a rule which reports if forms without an else
+// branch, which are better written with when. (Those whose test is a (not
+// ...) form are left to IfNotRule.) The diagnostics can be fixed.
+func SingleBranchIfRule() *Rule {
+	return &Rule{
+		ID:  "single-branch-if",
+		Doc: "reports if forms without an else branch",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "if") {
+					return
+				}
+				it := analysis.Items(n.Children())
+				if len(it) != 3 || goclj.FnFormSymbol(it[1].Node, "not") {
+					return
+				}
+				head := it[0].Node.(*parse.SymbolNode)
+				pass.ReportFix(n, func() {
+					nodes := n.Children()
+					nodes[indexOf(nodes, head)] = &parse.SymbolNode{Pos: head.Pos, Val: "when"}
+				}, "use when rather than if without an else branch")
+			})
+		},
+	}
+}
+
+// SeqTestRule returns a rule which reports tests of whether a collection is
+// non-empty which are probably mistaken or roundabout: (seq? x) as the test
+// of an if, when, or the like, which is true only if x is a seq (not if it
+// is non-empty), and (not (empty? x)), which is better written (seq x). The
+// diagnostics of the latter can be fixed.
+func SeqTestRule() *Rule {
+	return &Rule{
+		ID:  "seq-test",
+		Doc: "reports (when (seq? x) ...) and (not (empty? x))",
+		Run: func(pass *Pass) {
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "if", "if-not", "when", "when-not", "and", "or") {
+					return
+				}
+				for _, it := range analysis.Items(n.Children())[1:] {
+					if !goclj.FnFormSymbol(it.Node, "seq?") {
+						continue
+					}
+					pass.Report(it.Node, "(seq? x) is true only if x is a seq; to test whether x is non-empty, use (seq x)")
+					if !goclj.FnFormSymbol(n, "and", "or") {
+						break // only the test
+					}
+				}
+			})
+			walkForms(pass.Tree, func(n parse.Node) {
+				if !goclj.FnFormSymbol(n, "not") || !simple(n) {
+					return
+				}
+				it := analysis.Items(n.Children())
+				if len(it) != 2 || !goclj.FnFormSymbol(it[1].Node, "empty?") || !simple(it[1].Node) {
+					return
+				}
+				inner := analysis.Items(it[1].Node.Children())
+				if len(inner) != 2 {
+					return
+				}
+				head := it[0].Node.(*parse.SymbolNode)
+				pass.ReportFix(n, func() {
+					n.SetChildren([]parse.Node{&parse.SymbolNode{Pos: head.Pos, Val: "seq"}, inner[1].Node})
+				}, "use (seq x) rather than (not (empty? x))")
+			})
+		},
+	}
+}
+
+// walkForms calls fn for each node in t.
+func walkForms(t *parse.Tree, fn func(n parse.Node)) {
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		fn(n)
+		for _, child := range n.Children() {
+			walk(child)
+		}
+	}
+	for _, root := range t.Roots {
+		walk(root)
+	}
+}
+
+// simple reports whether the children of n are all forms, so that a fix can
+// rearrange them without worrying about comments and the like.
+func simple(n parse.Node) bool {
+	for _, child := range n.Children() {
+		switch child.(type) {
+		case *parse.CommentNode, *parse.NewlineNode, *parse.MetadataNode,
+			*parse.TagNode, *parse.ReaderDiscardNode:
+			return false
+		}
+	}
+	return true
+}
+
+func isNil(n parse.Node) bool {
+	_, ok := n.(*parse.NilNode)
+	return ok
+}
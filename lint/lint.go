@@ -0,0 +1,177 @@
+// Package lint checks Clojure code for problems.
+//
+// Each kind of problem is found by a Rule, which is identified by a stable ID
+// (such as "sort-import-require"). The ID appears in each Diagnostic and is
+// used to suppress diagnostics with comments such as
+//
+//	;; goclj:ignore sort-import-require
+//
+// and to grandfather in existing diagnostics with a Baseline.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Diagnostic is a problem found by a Rule.
+type Diagnostic struct {
+	Rule    string // the ID of the rule
+	Pos     parse.Pos
+	Message string
+	// Detail optionally elaborates on Message over several lines, such
+	// as with a diff of a suggested change.
+	Detail string
+	// Fix, if non-nil, modifies the tree to fix the problem. The fixes of
+	// the diagnostics reported by Lint for a tree may be applied together,
+	// in any order.
+	Fix func()
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", &d.Pos, d.Message, d.Rule)
+}
+
+// A Rule checks a file for one kind of problem.
+type Rule struct {
+	// ID identifies the rule in diagnostics, goclj:ignore comments,
+	// baselines, and configuration. It is a short lowercase name such as
+	// "sort-import-require" and must not change once released, as that
+	// would invalidate the suppressions and baselines which use it.
+	ID string
+	// Doc is a one-line description of what the rule reports.
+	Doc string
+	// Run checks pass.Tree, reporting problems with pass.Report. It must
+	// not modify the tree (but the fixes it reports may).
+	Run func(pass *Pass)
+}
+
+// A Pass holds the file being checked by a single rule.
+type Pass struct {
+	Rule *Rule
+	Tree *parse.Tree
+	// Resolver resolves symbols through the ns form of Tree.
+	Resolver *goclj.Resolver
+
+	diags []*Diagnostic
+}
+
+// Report records a problem at the position of n. The message should not
+// include positions (or other details which change as unrelated code is
+// edited) so that the diagnostic still matches a Baseline after such edits.
+func (p *Pass) Report(n parse.Node, format string, args ...interface{}) {
+	p.diags = append(p.diags, &Diagnostic{
+		Rule:    p.Rule.ID,
+		Pos:     *n.Position(),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ReportDetail is like Report, but it also sets the Detail of the diagnostic.
+func (p *Pass) ReportDetail(n parse.Node, detail, format string, args ...interface{}) {
+	p.Report(n, format, args...)
+	p.diags[len(p.diags)-1].Detail = detail
+}
+
+// ReportFix is like Report, but it also sets the Fix of the diagnostic.
+func (p *Pass) ReportFix(n parse.Node, fix func(), format string, args ...interface{}) {
+	p.Report(n, format, args...)
+	p.diags[len(p.diags)-1].Fix = fix
+}
+
+// Lint runs rules on t, which must have been parsed with
+// parse.IncludeNonSemantic, and returns the diagnostics they report in order
+// of position. Diagnostics suppressed by goclj:ignore comments are omitted.
+func Lint(t *parse.Tree, rules []*Rule) []*Diagnostic {
+	r := goclj.NewResolver(t)
+	var diags []*Diagnostic
+	for _, rule := range rules {
+		pass := &Pass{Rule: rule, Tree: t, Resolver: r}
+		rule.Run(pass)
+		diags = append(diags, pass.diags...)
+	}
+	ignored := ignoredRules(t)
+	diags = filter(diags, func(d *Diagnostic) bool {
+		ids, ok := ignored[d.Pos.Line]
+		if !ok {
+			return true
+		}
+		if len(ids) == 0 {
+			return false
+		}
+		for _, id := range ids {
+			if id == d.Rule {
+				return false
+			}
+		}
+		return true
+	})
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos.Offset < diags[j].Pos.Offset
+	})
+	return diags
+}
+
+func filter(diags []*Diagnostic, keep func(d *Diagnostic) bool) []*Diagnostic {
+	var result []*Diagnostic
+	for _, d := range diags {
+		if keep(d) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// ignoreMarker begins a comment which suppresses diagnostics on the
+// following line:
+//
+//	;; goclj:ignore rule-a rule-b
+//	(form ...)
+//
+// Without any rule IDs, every diagnostic on the line is suppressed.
+const ignoreMarker = "goclj:ignore"
+
+// ignoredRules returns the IDs of the rules suppressed on each line of t. An
+// empty list means that every rule is suppressed.
+func ignoredRules(t *parse.Tree) map[int][]string {
+	ignored := make(map[int][]string)
+	var find func(n parse.Node)
+	find = func(n parse.Node) {
+		if c, ok := n.(*parse.CommentNode); ok {
+			text := strings.TrimSpace(strings.TrimLeft(c.Text, ";"))
+			if text != ignoreMarker && !strings.HasPrefix(text, ignoreMarker+" ") {
+				return
+			}
+			line := c.Position().Line + 1
+			ids := strings.FieldsFunc(text[len(ignoreMarker):], func(r rune) bool {
+				return r == ' ' || r == '\t' || r == ','
+			})
+			if old, ok := ignored[line]; ok && (len(old) == 0 || len(ids) == 0) {
+				ignored[line] = nil
+				return
+			}
+			ignored[line] = append(ignored[line], ids...)
+			return
+		}
+		for _, child := range n.Children() {
+			find(child)
+		}
+	}
+	for _, root := range t.Roots {
+		find(root)
+	}
+	return ignored
+}
+
+func indexOf(nodes []parse.Node, n parse.Node) int {
+	for i, node := range nodes {
+		if node == n {
+			return i
+		}
+	}
+	return -1
+}
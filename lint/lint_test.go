@@ -0,0 +1,577 @@
+package lint
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+func parseString(t *testing.T, s string) *parse.Tree {
+	tree, err := parse.Reader(strings.NewReader(s), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func diagStrings(diags []*Diagnostic) []string {
+	var s []string
+	for _, d := range diags {
+		s = append(s, d.String())
+	}
+	return s
+}
+
+func checkDiags(t *testing.T, diags []*Diagnostic, want []string) {
+	t.Helper()
+	if got := diagStrings(diags); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// symbolRule reports every symbol named x.
+var symbolRule = &Rule{
+	ID:  "no-x",
+	Doc: "reports x",
+	Run: func(pass *Pass) {
+		var find func(n parse.Node)
+		find = func(n parse.Node) {
+			if sym, ok := n.(*parse.SymbolNode); ok && sym.Val == "x" {
+				pass.Report(n, "x is not allowed")
+			}
+			for _, child := range n.Children() {
+				find(child)
+			}
+		}
+		for _, root := range pass.Tree.Roots {
+			find(root)
+		}
+	},
+}
+
+func TestSuppression(t *testing.T) {
+	tree := parseString(t, `(def a x)
+;; goclj:ignore no-x
+(def b x)
+;; goclj:ignore other-rule
+(def c x)
+(def d ; goclj:ignore
+  x)
+;; goclj:ignore other-rule, no-x
+(def e x)
+`)
+	checkDiags(t, Lint(tree, []*Rule{symbolRule}), []string{
+		"temp:1:8: x is not allowed (no-x)",
+		"temp:5:8: x is not allowed (no-x)",
+	})
+}
+
+func TestBaseline(t *testing.T) {
+	tree := parseString(t, "(def a x)\n(def b x)\n")
+	b := NewBaseline(Lint(tree, []*Rule{symbolRule}))
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BaselineEntry{{File: "temp", Rule: "no-x", Message: "x is not allowed", Count: 2}}
+	if !reflect.DeepEqual(b.Entries, want) {
+		t.Fatalf("got baseline %+v; want %+v", b.Entries, want)
+	}
+
+	// The baseline still covers the old diagnostics after they move, but
+	// not a new one.
+	tree = parseString(t, "(def new x)\n\n(def a x)\n(def b x)\n")
+	checkDiags(t, b.Filter(Lint(tree, []*Rule{symbolRule})), []string{
+		"temp:4:8: x is not allowed (no-x)",
+	})
+}
+
+func TestTransformRule(t *testing.T) {
+	tree := parseString(t, `(ns foo
+  (:require [b] [a]))
+(defn f
+  [x] x)
+
+(defn g [x]
+  x)
+`)
+	var rules []*Rule
+	for _, tr := range format.AllTransforms() {
+		if format.DefaultTransforms[tr] {
+			rules = append(rules, TransformRule(tr, nil))
+		}
+	}
+	diags := Lint(tree, rules)
+	checkDiags(t, diags, []string{
+		"temp:1:1: requires and imports are not sorted (sort-import-require)",
+		"temp:1:1: the blank-lines-after-ns transform would change this form (blank-lines-after-ns)",
+		"temp:3:1: the fix-defn-arglist-newline transform would change this form (fix-defn-arglist-newline)",
+	})
+	for i, want := range []string{
+		"@@ -2 +2,2 @@\n-  (:require [b] [a]))\n+  (:require [a]\n+            [b]))\n",
+		"@@ -2,0 +3 @@\n+\n",
+		"@@ -3,2 +3,2 @@\n-(defn f\n-  [x] x)\n+(defn f [x]\n+  x)\n",
+	} {
+		if i < len(diags) && diags[i].Detail != want {
+			t.Errorf("diagnostic %d: got detail\n%s\nwant\n%s", i, diags[i].Detail, want)
+		}
+	}
+
+	// The tree is unchanged.
+	var buf bytes.Buffer
+	if err := format.Minify(&buf, tree); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "(ns foo(:require[b][a]))(defn f[x]x)(defn g[x]x)"; got != want {
+		t.Errorf("after linting, tree is %q; want %q", got, want)
+	}
+}
+
+func TestFormatRule(t *testing.T) {
+	tree := parseString(t, `(defn f [x]
+      x)
+
+(defn g [x]
+  x)
+(def   h 1)
+`)
+	diags := Lint(tree, []*Rule{FormatRule(nil)})
+	checkDiags(t, diags, []string{
+		"temp:1:1: this form is not formatted (format)",
+		"temp:6:1: this form is not formatted (format)",
+	})
+	for i, want := range []string{
+		"@@ -2 +2 @@\n-      x)\n+  x)\n",
+		"@@ -6 +6 @@\n-(def   h 1)\n+(def h 1)\n",
+	} {
+		if i < len(diags) && diags[i].Detail != want {
+			t.Errorf("diagnostic %d: got detail\n%s\nwant\n%s", i, diags[i].Detail, want)
+		}
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	const diff = `diff --git a/src/a.clj b/src/a.clj
+index 1111111..2222222 100644
+--- a/src/a.clj
++++ b/src/a.clj
+@@ -1,4 +1,5 @@
+ (ns a)
+-(def x 1)
++(def x 2)
++(def y 3)
+
+ (defn f [])
+@@ -20,3 +21,2 @@ (defn g
+ (defn g []
+-  1
+   2)
+diff --git a/old.clj b/old.clj
+deleted file mode 100644
+--- a/old.clj
++++ /dev/null
+@@ -1 +0,0 @@
+-(ns old)
+diff --git a/new.clj b/new.clj
+new file mode 100644
+--- /dev/null
++++ b/new.clj
+@@ -0,0 +1,2 @@
++(ns new)
++(def z 1)
+`
+	got, err := ParseDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]LineRange{
+		"src/a.clj": {{2, 3}, {22, 22}},
+		"new.clj":   {{1, 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if _, err := ParseDiff(strings.NewReader("+++ b/a.clj\n@@ -1 +x @@\n")); err == nil {
+		t.Error("got no error for malformed hunk header")
+	}
+}
+
+func TestFilterChanged(t *testing.T) {
+	tree := parseString(t, `(def a x)
+
+(defn f []
+  (let [y 1]
+    x))
+
+(def b x)
+`)
+	diags := Lint(tree, []*Rule{symbolRule})
+	checkDiags(t, FilterChanged(tree, diags, []LineRange{{4, 4}}), []string{
+		"temp:5:5: x is not allowed (no-x)",
+	})
+	checkDiags(t, FilterChanged(tree, diags, []LineRange{{1, 1}, {7, 7}}), []string{
+		"temp:1:8: x is not allowed (no-x)",
+		"temp:7:8: x is not allowed (no-x)",
+	})
+	checkDiags(t, FilterChanged(tree, diags, []LineRange{{2, 2}, {6, 6}}), nil)
+}
+
+func TestReflection(t *testing.T) {
+	tree := parseString(t, `(ns foo.hot)
+
+(defn f [s ^String t {:keys [a b]}]
+  (.length s)
+  (.length t)
+  (. a toString)
+  (.. b (substring 1) length)
+  (.length ^String s)
+  (.length (identity s))
+  (let [sb (StringBuilder.)
+        u "x"
+        v (get-thing)
+        s "shadowed"]
+    (.append sb (.trim u))
+    (.-field v)
+    (.length s))
+  (fn [x] (.foo x))
+  (reify Runnable
+    (run [this] (.foo this)))
+  (try nil (catch Exception e (.getMessage e))))
+
+(defn g
+  ([x] (.bar x))
+  ([x y] (doseq [z x] (.baz z))))
+`)
+	checkDiags(t, Lint(tree, []*Rule{ReflectionRule(nil)}), nil)
+	checkDiags(t, Lint(tree, []*Rule{ReflectionRule([]string{"foo.*"})}), []string{
+		"temp:4:3: call to .length on s cannot be resolved without a type hint (reflection)",
+		"temp:6:3: call to .toString on a cannot be resolved without a type hint (reflection)",
+		"temp:7:3: call to .substring on b cannot be resolved without a type hint (reflection)",
+		"temp:15:5: call to .-field on v cannot be resolved without a type hint (reflection)",
+		"temp:17:11: call to .foo on x cannot be resolved without a type hint (reflection)",
+		"temp:23:8: call to .bar on x cannot be resolved without a type hint (reflection)",
+		"temp:24:23: call to .baz on z cannot be resolved without a type hint (reflection)",
+	})
+
+	tree = parseString(t, "(ns foo)\n(set! *warn-on-reflection* true)\n(defn f [s] (.length s))\n")
+	checkDiags(t, Lint(tree, []*Rule{ReflectionRule(nil)}), []string{
+		"temp:3:13: call to .length on s cannot be resolved without a type hint (reflection)",
+	})
+}
+
+func TestDeprecated(t *testing.T) {
+	lib := parseString(t, `(ns ^:deprecated old.util)
+
+(ns lib.core)
+
+(defn ^{:deprecated "1.2" :superseded-by "g"} f [x] x)
+
+(defn g "Docs." {:deprecated "1.3"} [x] x)
+
+(defn h [x] x)
+`)
+	deprecated := map[string]string{"other.ns/q": "other.ns/r"}
+	FindDeprecated(lib, deprecated)
+	want := map[string]string{
+		"other.ns/q": "other.ns/r",
+		"old.util":   "",
+		"lib.core/f": "lib.core/g",
+		"lib.core/g": "",
+	}
+	if !reflect.DeepEqual(deprecated, want) {
+		t.Fatalf("FindDeprecated: got %v; want %v", deprecated, want)
+	}
+
+	tree := parseString(t, `(ns app.core
+  (:require [lib.core :as lib :refer [g]]
+            [old.util :as u]
+            [other.ns :as o]))
+
+(defn run [f]
+  (lib/f 1)
+  (g 2)
+  (lib/h 3)
+  (o/q 4)
+  (f 5))
+`)
+	checkDiags(t, Lint(tree, []*Rule{DeprecatedRule(deprecated)}), []string{
+		"temp:3:14: old.util is deprecated (deprecated)",
+		"temp:7:4: lib.core/f is deprecated; use lib.core/g instead (deprecated)",
+		"temp:8:4: lib.core/g is deprecated (deprecated)",
+		"temp:10:4: other.ns/q is deprecated; use other.ns/r instead (deprecated)",
+	})
+}
+
+func TestAliases(t *testing.T) {
+	files := []string{
+		"(ns a (:require [clojure.string :as str] [clojure.set :as set]))",
+		"(ns b (:require [clojure.string :as str] [clojure.set :as s]))",
+		"(ns c (:require (clojure [string :as string] [set :as set])))",
+	}
+	aliases := NewAliases()
+	var trees []*parse.Tree
+	for _, f := range files {
+		tree := parseString(t, f)
+		aliases.Add(tree)
+		trees = append(trees, tree)
+	}
+	want := []AliasSummary{
+		{"clojure.set", []AliasCount{{"set", 2}, {"s", 1}}},
+		{"clojure.string", []AliasCount{{"str", 2}, {"string", 1}}},
+	}
+	if got := aliases.Inconsistent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inconsistent: got %+v; want %+v", got, want)
+	}
+	var diags []*Diagnostic
+	for _, tree := range trees {
+		diags = append(diags, Lint(tree, []*Rule{AliasRule(aliases)})...)
+	}
+	checkDiags(t, diags, []string{
+		"temp:1:59: clojure.set is aliased as s here but usually as set (inconsistent-alias)",
+		"temp:1:38: clojure.string is aliased as string here but usually as str (inconsistent-alias)",
+	})
+}
+
+func TestComplexity(t *testing.T) {
+	tree := parseString(t, `(ns foo)
+
+(defn small [a b] (+ a b))
+
+(defn big
+  "Docs."
+  [a b c d & more]
+  (let [x (if a
+            (when b (inc (f #(g %))))
+            "line 1
+line 2")]
+    x))
+
+(defmethod m :k
+  ([a] a)
+  ([a b c d e] (list a b c d e)))
+`)
+	rules := []*Rule{FunctionLengthRule(6), NestingDepthRule(4), ParamCountRule(4)}
+	diags := Lint(tree, rules)
+	checkDiags(t, diags, []string{
+		"temp:5:1: big is longer than 6 lines (function-length)",
+		"temp:7:3: big has 5 parameters (more than 4) (param-count)",
+		"temp:9:26: big nests forms more than 4 deep (nesting-depth)",
+		"temp:16:4: m :k has 5 parameters (more than 4) (param-count)",
+	})
+	if len(diags) > 0 && diags[0].Detail != "big is 8 lines long\n" {
+		t.Errorf("got detail %q", diags[0].Detail)
+	}
+	checkDiags(t, Lint(tree, []*Rule{FunctionLengthRule(0), NestingDepthRule(0), ParamCountRule(0)}), nil)
+}
+
+func TestIdioms(t *testing.T) {
+	const src = `(defn f [x y]
+  (when (= x nil) (g))
+  (when (not= nil y) (g))
+  (if (not x)
+    (g)
+    (h))
+  (if (not x) (g))
+  (if x (g))
+  (if x (g) (h))
+  (when (seq? x) (g))
+  (and (seq? x) (seq? y))
+  (if (not (empty? x)) (g) (h)))
+`
+	tree := parseString(t, src)
+	rules := []*Rule{NilEqualityRule(), IfNotRule(), SingleBranchIfRule(), SeqTestRule()}
+	diags := Lint(tree, rules)
+	checkDiags(t, diags, []string{
+		"temp:2:9: use (nil? x) rather than (= x nil) (nil-equality)",
+		"temp:3:9: use (some? x) rather than (not= x nil) (nil-equality)",
+		"temp:4:3: use (if-not x ...) rather than (if (not x) ...) (if-not)",
+		"temp:7:3: use (when-not x ...) rather than (if (not x) ...) (if-not)",
+		"temp:8:3: use when rather than if without an else branch (single-branch-if)",
+		"temp:10:9: (seq? x) is true only if x is a seq; to test whether x is non-empty, use (seq x) (seq-test)",
+		"temp:11:8: (seq? x) is true only if x is a seq; to test whether x is non-empty, use (seq x) (seq-test)",
+		"temp:11:17: (seq? x) is true only if x is a seq; to test whether x is non-empty, use (seq x) (seq-test)",
+		"temp:12:3: use (if-not x ...) rather than (if (not x) ...) (if-not)",
+		"temp:12:7: use (seq x) rather than (not (empty? x)) (seq-test)",
+	})
+
+	for _, d := range diags {
+		if d.Fix != nil {
+			d.Fix()
+		}
+	}
+	var buf bytes.Buffer
+	p := format.NewPrinter(&buf)
+	p.Transforms = map[format.Transform]bool{}
+	if err := p.PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	const want = `(defn f [x y]
+  (when (nil? x) (g))
+  (when (some? y) (g))
+  (if-not x
+    (g)
+    (h))
+  (when-not x (g))
+  (when x (g))
+  (if x (g) (h))
+  (when (seq? x) (g))
+  (and (seq? x) (seq? y))
+  (if-not (empty? x) (g) (h)))
+`
+	if got := buf.String(); got != want {
+		t.Errorf("after fixes, got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	tree := parseString(t, `(def m {:a 1
+        :b {:c 1 :c 2}
+        :a 3})
+(def s #{1 (f  x) 2 (f x) #_1 1})
+(def ok {1 1 2 1} #{[1] (1)})
+(def n #:a{:b 1 :b 2})
+`)
+	diags := Lint(tree, []*Rule{DuplicateKeyRule()})
+	checkDiags(t, diags, []string{
+		"temp:2:18: duplicate key in map literal: :c (duplicate-key)",
+		"temp:3:9: duplicate key in map literal: :a (duplicate-key)",
+		"temp:4:21: duplicate element in set literal: (f x) (duplicate-key)",
+		"temp:4:31: duplicate element in set literal: 1 (duplicate-key)",
+		"temp:6:17: duplicate key in map literal: :b (duplicate-key)",
+	})
+	if len(diags) > 1 && diags[1].Detail != "first at temp:1:9\n" {
+		t.Errorf("got detail %q", diags[1].Detail)
+	}
+}
+
+func TestMisplacedDocstring(t *testing.T) {
+	tree := parseString(t, `(defn f [x] "Docs." x)
+
+(defn g
+  [x]
+  "Docs."
+  (h x))
+
+(defn- k [x]
+  "Docs."
+  (h x))
+
+(defmacro m
+  ([x] "Docs." x)
+  ([x y] "Not a mistake."))
+
+(defn ok [x] "Returned.")
+
+(defn ok2 "Docs." [x] "Also returned." x)
+`)
+	diags := Lint(tree, []*Rule{MisplacedDocstringRule()})
+	checkDiags(t, diags, []string{
+		"temp:1:13: the string after the parameters of f is not a docstring (misplaced-docstring)",
+		"temp:5:3: the string after the parameters of g is not a docstring (misplaced-docstring)",
+		"temp:9:3: the string after the parameters of k is not a docstring (misplaced-docstring)",
+		"temp:13:8: the string after the parameters of m is not a docstring (misplaced-docstring)",
+		"temp:18:23: the string after the parameters of ok2 is not a docstring (misplaced-docstring)",
+	})
+	for _, d := range diags {
+		if d.Fix != nil {
+			d.Fix()
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.NewPrinter(&buf).PrintTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	const want = `(defn f "Docs." [x] x)
+
+(defn g
+  "Docs."
+  [x]
+  (h x))
+
+(defn- k
+  "Docs."
+  [x]
+  (h x))
+
+(defmacro m
+  ([x] "Docs." x)
+  ([x y] "Not a mistake."))
+
+(defn ok [x] "Returned.")
+
+(defn ok2 "Docs." [x] "Also returned." x)
+`
+	if got := buf.String(); got != want {
+		t.Errorf("after fixes, got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnusedPrivate(t *testing.T) {
+	tree := parseString(t, `(ns foo.core)
+
+(defn- unused [n] (when (pos? n) (unused (dec n))))
+
+(defn- helper [x] x)
+
+(def ^:private table {})
+
+(def ^{:private true} shadowed 1)
+
+(def ^{:private false} public 1)
+
+(defn- qualified [] 1)
+
+(defn- quoted [] 1)
+
+(defn f [shadowed]
+  (helper shadowed)
+  (foo.core/qualified)
+  (#'quoted))
+`)
+	checkDiags(t, Lint(tree, []*Rule{UnusedPrivateRule()}), []string{
+		"temp:3:8: private var unused is never used (unused-private)",
+		"temp:7:16: private var table is never used (unused-private)",
+		"temp:9:23: private var shadowed is never used (unused-private)",
+	})
+}
+
+func TestUnknownAlias(t *testing.T) {
+	const src = `(ns foo.core
+  (:require [clojure.set :as set]
+            [foo.util]))
+
+(defn f [x]
+  (set/union (str/split x #",") (fs/list-dir "."))
+  (foo.util/g ::set/k ::json/k :other/k 'quoted/sym)
+  (foo.core/f (Math/abs 1) (java.util.UUID/randomUUID) clojure.core//)
+  (clojure.string/join (babashka.fs/cwd)))
+`
+	tree := parseString(t, src)
+	checkDiags(t, Lint(tree, []*Rule{UnknownAliasRule(goclj.DialectClojure)}), []string{
+		"temp:6:15: str is not an alias or a required namespace (unknown-alias)",
+		"temp:6:34: fs is not an alias or a required namespace (unknown-alias)",
+		"temp:7:23: json is not an alias or a required namespace (unknown-alias)",
+		"temp:9:25: babashka.fs is not an alias or a required namespace (unknown-alias)",
+	})
+
+	// Babashka scripts may use the built-in aliases and namespaces, and
+	// top-level require calls instead of an ns form.
+	tree = parseString(t, `#!/usr/bin/env bb
+(require '[clojure.set :as set])
+
+(set/union (str/split "a,b" #",") (json/parse-string "[]") (babashka.fs/cwd) (csk/->kebab-case "a"))
+`)
+	checkDiags(t, Lint(tree, []*Rule{UnknownAliasRule(goclj.DialectBabashka)}), []string{
+		"temp:4:79: csk is not an alias or a required namespace (unknown-alias)",
+	})
+}
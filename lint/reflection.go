@@ -0,0 +1,127 @@
+package lint
+
+import (
+	"path"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// ReflectionRule returns a rule which reports Java interop calls that
+// probably need reflection, approximating *warn-on-reflection* without
+// compiling the code. A call such as (.length s) or (. s length) is reported
+// if s is a local which is neither type-hinted nor bound to an expression
+// of a known type (such as a constructor call or a string literal). Calls
+// on other expressions are not reported, since their types can't be
+// determined from the code alone.
+//
+// The rule checks the namespaces which set *warn-on-reflection* to true and
+// those whose names match one of the given patterns (which use the syntax of
+// path.Match, so "myapp.hot.*" matches all the namespaces under myapp.hot).
+func ReflectionRule(namespaces []string) *Rule {
+	return &Rule{
+		ID:  "reflection",
+		Doc: "reports Java interop calls on locals without type hints",
+		Run: func(pass *Pass) {
+			if !checkReflection(pass.Tree, namespaces) {
+				return
+			}
+			for _, root := range pass.Tree.Roots {
+				analysis.WalkScopes(root, nil, func(n parse.Node, s *analysis.Scope) bool {
+					method, target, ok := interopCall(n)
+					if !ok || target.Hinted {
+						return true
+					}
+					if sym, ok := target.Node.(*parse.SymbolNode); ok {
+						if l := s.Lookup(sym.Val); l != nil && !l.Typed {
+							pass.Report(n, "call to %s on %s cannot be resolved without a type hint", method, sym.Val)
+						}
+					}
+					return true
+				})
+			}
+		},
+	}
+}
+
+// checkReflection reports whether the reflection rule applies to t.
+func checkReflection(t *parse.Tree, namespaces []string) bool {
+	if name := nsName(t); name != "" {
+		for _, pattern := range namespaces {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	for _, root := range t.Roots {
+		if !goclj.FnFormSymbol(root, "set!") {
+			continue
+		}
+		it := analysis.Items(root.Children()[1:])
+		if len(it) == 2 && isSymbol(it[0].Node, "*warn-on-reflection*") && isTrue(it[1].Node) {
+			return true
+		}
+	}
+	return false
+}
+
+// interopCall returns the method name and target of an instance method call
+// or field access such as (.method target args*), (. target method args*),
+// (. target (method args*)), or (.. target method ...).
+func interopCall(n parse.Node) (method string, target analysis.Item, ok bool) {
+	if !goclj.FnFormSymbol(n) {
+		return "", analysis.Item{}, false
+	}
+	it := analysis.Items(n.Children())
+	head := it[0].Node.(*parse.SymbolNode).Val
+	switch {
+	case head == "." || head == "..":
+		if len(it) < 3 {
+			return "", analysis.Item{}, false
+		}
+		m := it[2].Node
+		if goclj.FnFormSymbol(m) {
+			m = m.Children()[0]
+		}
+		sym, ok := m.(*parse.SymbolNode)
+		if !ok {
+			return "", analysis.Item{}, false
+		}
+		return "." + sym.Val, it[1], true
+	case strings.HasPrefix(head, ".") && len(head) > 1 && !strings.HasPrefix(head, ".."):
+		if len(it) < 2 {
+			return "", analysis.Item{}, false
+		}
+		return head, it[1], true
+	}
+	return "", analysis.Item{}, false
+}
+
+// nsName returns the name of the namespace declared by the first ns form in
+// t, or the empty string if there isn't one.
+func nsName(t *parse.Tree) string {
+	for _, root := range t.Roots {
+		if !goclj.FnFormSymbol(root, "ns") {
+			continue
+		}
+		if it := analysis.Items(root.Children()[1:]); len(it) > 0 {
+			if sym, ok := it[0].Node.(*parse.SymbolNode); ok {
+				return sym.Val
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func isSymbol(n parse.Node, name string) bool {
+	sym, ok := n.(*parse.SymbolNode)
+	return ok && sym.Val == name
+}
+
+func isTrue(n parse.Node) bool {
+	b, ok := n.(*parse.BoolNode)
+	return ok && b.Val
+}
@@ -0,0 +1,153 @@
+package lint
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/internal/diff"
+	"github.com/cespare/goclj/parse"
+)
+
+// TransformRule returns a rule which reports each top-level form that the
+// transform t would change (including the spacing after the form). The
+// rule's ID is the name of the transform, such as "sort-import-require". The
+// Detail of each diagnostic is a unified diff hunk of the change.
+//
+// The rule for format.TransformSortImportRequire checks the ordering of the
+// :require and :import clauses of ns forms without modifying the code, as a
+// check-only alternative to the transform.
+//
+// The code is printed with Printers created by newPrinter (or
+// format.NewPrinter, if newPrinter is nil), so that transforms which depend
+// on configuration such as Printer.SortCollation see the same configuration
+// as when formatting. The Printers' Transforms are overwritten.
+func TransformRule(t format.Transform, newPrinter func(w io.Writer) *format.Printer) *Rule {
+	if newPrinter == nil {
+		newPrinter = format.NewPrinter
+	}
+	rule := &Rule{
+		ID:  t.String(),
+		Doc: "reports forms that the " + t.String() + " transform would change",
+	}
+	rule.Run = func(pass *Pass) {
+		none := make(map[format.Transform]bool)
+		only := make(map[format.Transform]bool)
+		for _, t1 := range format.AllTransforms() {
+			none[t1] = false
+			only[t1] = t1 == t
+		}
+
+		// The transforms modify the tree, so work on a copy, which is
+		// made by printing the tree without any transforms and parsing
+		// the result. (This keeps the same top-level forms on the same
+		// lines.) Data profiles would modify the tree too, so they're
+		// left out.
+		var buf bytes.Buffer
+		p := newPrinter(&buf)
+		p.Transforms = none
+		p.DataProfiles = nil
+		p.DataProfile = format.DataProfileNone
+		if err := p.PrintTree(pass.Tree); err != nil {
+			return
+		}
+		before := append([]byte(nil), buf.Bytes()...)
+		tree, err := parse.Reader(bytes.NewReader(before), "", parse.IncludeNonSemantic)
+		if err != nil {
+			return
+		}
+		roots := forms(tree.Roots)
+		orig := forms(pass.Tree.Roots)
+		if len(roots) != len(orig) {
+			return
+		}
+		beforePos := make(map[parse.Node]parse.Pos)
+		buf.Reset()
+		p = newPrinter(&buf)
+		p.Transforms = none
+		p.PrintedPositions = beforePos
+		if err := p.PrintTree(tree); err != nil {
+			return
+		}
+		before = append(before[:0], buf.Bytes()...)
+
+		afterPos := make(map[parse.Node]parse.Pos)
+		buf.Reset()
+		p = newPrinter(&buf)
+		p.Transforms = only
+		p.PrintedPositions = afterPos
+		if err := p.PrintTree(tree); err != nil {
+			return
+		}
+		after := buf.Bytes()
+		if bytes.Equal(before, after) {
+			return
+		}
+
+		beforeSegs := segments(before, roots, beforePos)
+		afterSegs := segments(after, roots, afterPos)
+		for i, n := range orig {
+			if beforeSegs[i] == nil || afterSegs[i] == nil || bytes.Equal(beforeSegs[i], afterSegs[i]) {
+				continue
+			}
+			line := 1
+			if i > 0 {
+				line = beforePos[roots[i]].Line
+			}
+			detail := diff.Hunk(string(beforeSegs[i]), string(afterSegs[i]), line)
+			if msg, ok := transformMessages[t]; ok {
+				pass.ReportDetail(n, detail, "%s", msg)
+			} else {
+				pass.ReportDetail(n, detail, "the %s transform would change this form", t)
+			}
+		}
+	}
+	return rule
+}
+
+// transformMessages are the messages of the transform rules which have
+// something more specific to say than the default.
+var transformMessages = map[format.Transform]string{
+	format.TransformSortImportRequire: "requires and imports are not sorted",
+}
+
+// forms returns the top-level forms and comments among roots.
+func forms(roots []parse.Node) []parse.Node {
+	var result []parse.Node
+	for _, n := range roots {
+		if !goclj.Newline(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// segments splits the printed text b into the text of each of roots
+// (including the whitespace following it), given the printed position of
+// each. The first segment also includes any text before the first root. A
+// segment is nil if its root wasn't printed.
+func segments(b []byte, roots []parse.Node, pos map[parse.Node]parse.Pos) [][]byte {
+	segs := make([][]byte, len(roots))
+	for i, n := range roots {
+		start, ok := pos[n]
+		if !ok {
+			continue
+		}
+		if i == 0 {
+			start.Offset = 0
+		}
+		end := len(b)
+		for _, next := range roots[i+1:] {
+			if p, ok := pos[next]; ok {
+				end = p.Offset
+				break
+			}
+		}
+		if start.Offset > end {
+			continue
+		}
+		segs[i] = b[start.Offset:end]
+	}
+	return segs
+}
@@ -0,0 +1,123 @@
+package lint
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/analysis"
+	"github.com/cespare/goclj/parse"
+)
+
+// UnusedPrivateRule returns a rule which reports private vars (those defined
+// with defn- or marked ^:private) which are not used in their file outside
+// their own definitions. Since a private var can only be used by its own
+// namespace (barring tricks such as #'other.ns/f), these are usually dead
+// code.
+func UnusedPrivateRule() *Rule {
+	return &Rule{
+		ID:  "unused-private",
+		Doc: "reports private vars which are never used",
+		Run: func(pass *Pass) {
+			ns := nsName(pass.Tree)
+			private := make(map[string]*parse.SymbolNode) // name -> definition
+			var names []string
+			for _, root := range pass.Tree.Roots {
+				if sym := privateDef(root); sym != nil {
+					if _, ok := private[sym.Val]; !ok {
+						names = append(names, sym.Val)
+					}
+					private[sym.Val] = sym
+				}
+			}
+			if len(private) == 0 {
+				return
+			}
+			used := make(map[string]bool)
+			for _, root := range pass.Tree.Roots {
+				if goclj.FnFormSymbol(root, "ns") {
+					continue
+				}
+				var self string // the var defined by root
+				if sym := privateDef(root); sym != nil {
+					self = sym.Val
+				}
+				analysis.WalkScopes(root, nil, func(n parse.Node, s *analysis.Scope) bool {
+					var name string
+					switch n := n.(type) {
+					case *parse.SymbolNode:
+						if s.Binds(n) {
+							return true
+						}
+						name = n.Val
+					case *parse.VarQuoteNode:
+						name = n.Val
+					default:
+						return true
+					}
+					name = pass.Resolver.Resolve(name)
+					if i := strings.Index(name, "/"); i > 0 && i < len(name)-1 {
+						if name[:i] != ns {
+							return true
+						}
+						name = name[i+1:]
+					} else if s.Lookup(name) != nil {
+						return true
+					}
+					if name != self {
+						used[name] = true
+					}
+					return true
+				})
+			}
+			for _, name := range names {
+				if !used[name] {
+					pass.Report(private[name], "private var %s is never used", name)
+				}
+			}
+		},
+	}
+}
+
+// privateDef returns the name of the var defined by n if n is a def-like
+// form (def, defn, defmacro, and the like) which defines a private var.
+func privateDef(n parse.Node) *parse.SymbolNode {
+	if !goclj.FnFormSymbol(n, "def", "defn", "defn-", "defmacro", "defmulti", "defonce") {
+		return nil
+	}
+	nodes := n.Children()[1:]
+	it := analysis.Items(nodes)
+	if len(it) == 0 {
+		return nil
+	}
+	sym, ok := it[0].Node.(*parse.SymbolNode)
+	if !ok {
+		return nil
+	}
+	if goclj.FnFormSymbol(n, "defn-") {
+		return sym
+	}
+	for _, m := range nodes[:indexOf(nodes, sym)] {
+		if m, ok := m.(*parse.MetadataNode); ok && private(m.Node) {
+			return sym
+		}
+	}
+	return nil
+}
+
+// private reports whether the metadata m (such as :private or
+// {:private true}) marks a private var.
+func private(m parse.Node) bool {
+	switch m := m.(type) {
+	case *parse.KeywordNode:
+		return m.Val == ":private"
+	case *parse.MapNode:
+		it := analysis.Items(m.Nodes)
+		for j := 0; j+1 < len(it); j += 2 {
+			if kw, ok := it[j].Node.(*parse.KeywordNode); ok && kw.Val == ":private" {
+				b, ok := it[j+1].Node.(*parse.BoolNode)
+				return ok && b.Val
+			}
+		}
+	}
+	return false
+}
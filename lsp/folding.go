@@ -0,0 +1,32 @@
+package lsp
+
+import (
+	"encoding/json"
+
+	"github.com/cespare/goclj/analysis"
+)
+
+// foldingRange returns the ranges of a document which may be folded (see
+// analysis.FoldingRanges).
+func (s *Server) foldingRange(params json.RawMessage) (interface{}, error) {
+	var p foldingRangeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.parsedDocument(uriToPath(p.TextDocument.URI))
+	if d == nil {
+		return nil, nil
+	}
+	ranges := []FoldingRange{}
+	for _, r := range analysis.FoldingRanges(d.tree, []byte(d.text)) {
+		fr := FoldingRange{StartLine: r.StartLine - 1, EndLine: r.EndLine - 1}
+		switch r.Kind {
+		case analysis.FoldComment:
+			fr.Kind = "comment"
+		case analysis.FoldImports:
+			fr.Kind = "imports"
+		}
+		ranges = append(ranges, fr)
+	}
+	return ranges, nil
+}
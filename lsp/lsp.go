@@ -0,0 +1,451 @@
+// Package lsp implements a Language Server Protocol server which provides
+// static navigation of Clojure projects (such as go-to-definition) without
+// a running REPL. It is backed by an index.Index of the project, which is
+// updated as the editor changes files.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cespare/goclj/index"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Server is a language server. It serves one client, over the streams
+// given to Serve.
+type Server struct {
+	// Log, if non-nil, receives messages about problems which aren't
+	// reported to the client, such as files which can't be parsed.
+	Log *log.Logger
+	// Cache, if non-nil, caches the index of the client's root directory,
+	// so that the files which haven't changed since the last time the
+	// server indexed them are loaded rather than parsed.
+	Cache *index.Cache
+
+	ix   *index.Index
+	docs map[string]*document // the open documents, by path
+}
+
+// New returns a Server with an empty index. The index is loaded from the
+// client's root directory when the client initializes the server.
+func New() *Server {
+	return &Server{
+		ix:   index.New(),
+		docs: make(map[string]*document),
+	}
+}
+
+// A handler handles the params of a request (or notification) and returns
+// the result.
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":              (*Server).initialize,
+	"initialized":             nop,
+	"shutdown":                nop,
+	"textDocument/didOpen":    (*Server).didOpen,
+	"textDocument/didChange":  (*Server).didChange,
+	"textDocument/didSave":    nop,
+	"textDocument/didClose":   (*Server).didClose,
+	"textDocument/definition": (*Server).definition,
+	"textDocument/references": (*Server).references,
+
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"workspace/symbol":            (*Server).workspaceSymbol,
+
+	"textDocument/semanticTokens/full": (*Server).semanticTokens,
+	"textDocument/foldingRange":        (*Server).foldingRange,
+}
+
+func nop(*Server, json.RawMessage) (interface{}, error) { return nil, nil }
+
+// Serve reads requests from r and writes responses to w until the client
+// sends the exit notification or r reaches EOF.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			resp := &response{Error: &responseError{codeParseError, err.Error()}}
+			if err := writeMessage(w, resp); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			if rerr != nil {
+				s.logf("%s: %s", req.Method, rerr.Message)
+			}
+			continue
+		}
+		if err := writeMessage(w, &response{ID: req.ID, Result: result, Error: rerr}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (result interface{}, rerr *responseError) {
+	h, ok := handlers[req.Method]
+	if !ok {
+		if req.ID == nil || strings.HasPrefix(req.Method, "$/") {
+			return nil, nil // notifications may be ignored
+		}
+		return nil, &responseError{codeMethodNotFound, "method not supported: " + req.Method}
+	}
+	result, err := h(s, req.Params)
+	if err != nil {
+		code := codeInternalError
+		if _, ok := err.(paramsError); ok {
+			code = codeInvalidParams
+		}
+		return nil, &responseError{code, err.Error()}
+	}
+	return result, nil
+}
+
+type paramsError struct{ error }
+
+// decode decodes params into v.
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return paramsError{err}
+	}
+	return nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	}
+}
+
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func writeMessage(w io.Writer, resp *response) error {
+	resp.JSONRPC = "2.0"
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	root := p.RootPath
+	if p.RootURI != "" {
+		root = uriToPath(p.RootURI)
+	}
+	if root != "" {
+		var ix *index.Index
+		var err error
+		if s.Cache != nil {
+			ix, err = index.LoadCached(s.Cache, root)
+		} else {
+			ix, err = index.Load(root)
+		}
+		if err != nil {
+			s.logf("error loading index: %s", err)
+		}
+		if ix != nil {
+			s.ix = ix
+		}
+	}
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":   1, // full
+			"definitionProvider": true,
+			"referencesProvider": true,
+
+			"documentSymbolProvider":  true,
+			"workspaceSymbolProvider": true,
+			"semanticTokensProvider": map[string]interface{}{
+				"legend": map[string]interface{}{
+					"tokenTypes":     semanticTokenTypes,
+					"tokenModifiers": []string{},
+				},
+				"full": true,
+			},
+			"foldingRangeProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "goclj"},
+	}, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	s.update(uriToPath(p.TextDocument.URI), p.TextDocument.Text)
+	return nil, nil
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if n := len(p.ContentChanges); n > 0 {
+		// The server asks for full syncs, so the last change has the
+		// whole text.
+		s.update(uriToPath(p.TextDocument.URI), p.ContentChanges[n-1].Text)
+	}
+	return nil, nil
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	path := uriToPath(p.TextDocument.URI)
+	delete(s.docs, path)
+	// Go back to the file on disk (if the change wasn't saved).
+	if err := s.ix.AddFile(path); err != nil {
+		s.ix.Remove(path)
+	}
+	return nil, nil
+}
+
+// update records the text of the open document at path and reindexes it. If
+// the text can't be parsed, the previous version stays in the index.
+func (s *Server) update(path, text string) {
+	d := newDocument(text)
+	s.docs[path] = d
+	t, err := parse.Reader(strings.NewReader(text), path, parse.IncludeNonSemantic)
+	if err != nil {
+		s.logf("%s", err)
+		return
+	}
+	d.tree = t
+	s.ix.Add(path, t)
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	ns, name, ok := s.symbolAt(p.TextDocument.URI, p.Position)
+	if !ok {
+		return nil, nil
+	}
+	v := s.ix.DefinitionOf(ns, name)
+	if v == nil {
+		return nil, nil
+	}
+	loc, ok := s.location(v.Pos, len(v.Name))
+	if !ok {
+		return nil, nil
+	}
+	return []Location{loc}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p referenceParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	ns, name, ok := s.symbolAt(p.TextDocument.URI, p.Position)
+	if !ok {
+		return nil, nil
+	}
+	locs := []Location{}
+	if p.Context.IncludeDeclaration {
+		if v := s.ix.DefinitionOf(ns, name); v != nil {
+			if loc, ok := s.location(v.Pos, len(v.Name)); ok {
+				locs = append(locs, loc)
+			}
+		}
+	}
+	for _, r := range s.ix.ReferencesTo(ns, name) {
+		if loc, ok := s.location(r.Pos, len(r.Text)); ok {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+// symbolAt returns the var named by the symbol (or definition) at pos in
+// the document at uri.
+func (s *Server) symbolAt(uri string, pos Position) (ns, name string, ok bool) {
+	path := uriToPath(uri)
+	f := s.ix.File(path)
+	d := s.document(path)
+	if f == nil || d == nil {
+		return "", "", false
+	}
+	off := d.offset(pos)
+	for _, v := range f.Vars {
+		if v.Pos.Offset <= off && off <= v.Pos.Offset+len(v.Name) {
+			return v.Namespace, v.Name, true
+		}
+	}
+	for _, r := range f.Refs {
+		if r.Pos.Offset <= off && off <= r.Pos.Offset+len(r.Text) {
+			return r.Namespace, r.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// location returns the location of the n bytes at pos.
+func (s *Server) location(pos parse.Pos, n int) (Location, bool) {
+	d := s.document(pos.Name)
+	if d == nil {
+		return Location{}, false
+	}
+	return d.location(pos, n), true
+}
+
+// document returns the open document at path or, if it isn't open, the
+// file on disk, or nil if it can't be read.
+func (s *Server) document(path string) *document {
+	if d, ok := s.docs[path]; ok {
+		return d
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		s.logf("%s", err)
+		return nil
+	}
+	return newDocument(string(b))
+}
+
+// parsedDocument is like document, but it also parses the document if
+// necessary. It returns nil if the document can't be parsed.
+func (s *Server) parsedDocument(path string) *document {
+	d := s.document(path)
+	if d == nil || d.tree != nil {
+		return d
+	}
+	t, err := parse.Reader(strings.NewReader(d.text), path, parse.IncludeNonSemantic)
+	if err != nil {
+		s.logf("%s", err)
+		return nil
+	}
+	d.tree = t
+	return d
+}
+
+// A document is the text of a file.
+type document struct {
+	text  string
+	lines []int // the offset of the start of each line
+	tree  *parse.Tree
+}
+
+func newDocument(text string) *document {
+	d := &document{text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	return d
+}
+
+// location returns the location in d of the n bytes at pos.
+func (d *document) location(pos parse.Pos, n int) Location {
+	return Location{URI: pathToURI(pos.Name), Range: d.rangeOf(pos.Offset, pos.Offset+n)}
+}
+
+// rangeOf returns the range of the bytes [start, end) of d.
+func (d *document) rangeOf(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// offset converts pos to a byte offset in d.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	off := d.lines[pos.Line]
+	for units := 0; units < pos.Character && off < len(d.text) && d.text[off] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[off:])
+		off += size
+		units += utf16Len(r)
+	}
+	return off
+}
+
+// position converts a byte offset in d to a Position.
+func (d *document) position(off int) Position {
+	if off > len(d.text) {
+		off = len(d.text)
+	}
+	line := 0
+	for line+1 < len(d.lines) && d.lines[line+1] <= off {
+		line++
+	}
+	units := 0
+	for _, r := range d.text[d.lines[line]:off] {
+		units += utf16Len(r)
+	}
+	return Position{Line: line, Character: units}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -0,0 +1,329 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A session is a list of messages from a client.
+type session struct {
+	buf bytes.Buffer
+	id  int
+}
+
+func (c *session) request(method string, params interface{}) int {
+	c.id++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	return c.id
+}
+
+func (c *session) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *session) send(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&c.buf, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+// run serves the session and returns the responses by ID.
+func (c *session) run(t *testing.T) map[int]json.RawMessage {
+	t.Helper()
+	var out bytes.Buffer
+	if err := New().Serve(&c.buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[int]json.RawMessage)
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var resp struct {
+			ID     int
+			Result json.RawMessage
+			Error  *responseError
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != nil {
+			responses[resp.ID] = json.RawMessage(fmt.Sprintf(`{"error":%d}`, resp.Error.Code))
+			continue
+		}
+		responses[resp.ID] = resp.Result
+	}
+	return responses
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "goclj-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func docPos(uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{line, char},
+	}
+}
+
+func locations(t *testing.T, result json.RawMessage, dir string) []string {
+	t.Helper()
+	var locs []Location
+	if err := json.Unmarshal(result, &locs); err != nil {
+		t.Fatalf("bad locations %s: %s", result, err)
+	}
+	var s []string
+	for _, l := range locs {
+		rel, err := filepath.Rel(dir, uriToPath(l.URI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = append(s, fmt.Sprintf("%s:%d:%d-%d:%d", rel,
+			l.Range.Start.Line, l.Range.Start.Character, l.Range.End.Line, l.Range.End.Character))
+	}
+	return s
+}
+
+func TestNavigation(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app/util.clj": "(ns app.util)\n\n(defn twice [x] (* 2 x))\n",
+		"src/app/core.clj": "(ns app.core\n  (:require [app.util :as u]))\n\n(defn f [] (u/twice 1))\n",
+	})
+	defer os.RemoveAll(dir)
+	core := pathToURI(filepath.Join(dir, "src/app/core.clj"))
+
+	var c session
+	c.request("initialize", map[string]string{"rootUri": pathToURI(dir)})
+	c.notify("initialized", struct{}{})
+	// The open document differs from the file on disk; the "é" is two
+	// bytes but one UTF-16 code unit.
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]string{
+			"uri":  core,
+			"text": "(ns app.core\n  (:require [app.util :as u]))\n\n(defn f [] \"é\" (u/twice 1)\n  (u/twice 2))\n",
+		},
+	})
+	def := c.request("textDocument/definition", docPos(core, 3, 19))
+	defOfDef := c.request("textDocument/definition", docPos(pathToURI(filepath.Join(dir, "src/app/util.clj")), 2, 7))
+	none := c.request("textDocument/definition", docPos(core, 3, 1))
+	refs := c.request("textDocument/references", map[string]interface{}{
+		"textDocument": map[string]string{"uri": core},
+		"position":     Position{4, 4},
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+	unknown := c.request("textDocument/unknown", struct{}{})
+	shutdown := c.request("shutdown", nil)
+	c.notify("exit", nil)
+	c.request("initialize", struct{}{}) // after exit
+
+	resp := c.run(t)
+	if got, want := locations(t, resp[def], dir), []string{"src/app/util.clj:2:6-2:11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("definition: got %q; want %q", got, want)
+	}
+	if got, want := locations(t, resp[defOfDef], dir), []string{"src/app/util.clj:2:6-2:11"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("definition of definition: got %q; want %q", got, want)
+	}
+	if got := string(resp[none]); got != "null" {
+		t.Errorf("definition of nothing: got %s", got)
+	}
+	wantRefs := []string{
+		"src/app/util.clj:2:6-2:11",
+		"src/app/core.clj:3:16-3:23",
+		"src/app/core.clj:4:3-4:10",
+	}
+	if got := locations(t, resp[refs], dir); !reflect.DeepEqual(got, wantRefs) {
+		t.Errorf("references: got %q; want %q", got, wantRefs)
+	}
+	if got := string(resp[unknown]); got != `{"error":-32601}` {
+		t.Errorf("unknown method: got %s", got)
+	}
+	if got, ok := resp[shutdown]; !ok || string(got) != "null" {
+		t.Errorf("shutdown: got %s", got)
+	}
+	if len(resp) != 7 {
+		t.Errorf("got %d responses; want 7", len(resp))
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app/shapes.clj": `(ns app.shapes)
+
+(defprotocol Shape
+  (area [s])
+  (perimeter [s]))
+
+(defrecord Square [side])
+
+(def ^:private unit 1)
+
+(deftest area-test
+  (is true))
+`,
+		"src/app/util.clj": "(ns app.util)\n\n(defn parse-area [s] s)\n",
+	})
+	defer os.RemoveAll(dir)
+	shapes := pathToURI(filepath.Join(dir, "src/app/shapes.clj"))
+
+	var c session
+	c.request("initialize", map[string]string{"rootUri": pathToURI(dir)})
+	outline := c.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]string{"uri": shapes},
+	})
+	search := c.request("workspace/symbol", map[string]string{"query": "area"})
+	qualified := c.request("workspace/symbol", map[string]string{"query": "util/pa"})
+	resp := c.run(t)
+
+	var symbols []DocumentSymbol
+	if err := json.Unmarshal(resp[outline], &symbols); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var list func(prefix string, symbols []DocumentSymbol)
+	list = func(prefix string, symbols []DocumentSymbol) {
+		for _, s := range symbols {
+			got = append(got, fmt.Sprintf("%s%s %d %d:%d-%d:%d %d:%d", prefix, s.Name, s.Kind,
+				s.Range.Start.Line, s.Range.Start.Character, s.Range.End.Line, s.Range.End.Character,
+				s.SelectionRange.Start.Line, s.SelectionRange.Start.Character))
+			list(prefix+"  ", s.Children)
+		}
+	}
+	list("", symbols)
+	want := []string{
+		"app.shapes 3 0:0-0:15 0:4",
+		"Shape 11 2:0-4:18 2:13",
+		"  area 6 3:2-3:12 3:3",
+		"  perimeter 6 4:2-4:17 4:3",
+		"Square 23 6:0-6:25 6:11",
+		"unit 13 8:0-8:22 8:15",
+		"area-test 12 10:0-11:12 10:9",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("documentSymbol: got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, tt := range []struct {
+		id   int
+		want []string
+	}{
+		{search, []string{"area app.shapes 6", "area-test app.shapes 12", "parse-area app.util 12"}},
+		{qualified, []string{"parse-area app.util 12"}},
+	} {
+		var infos []SymbolInformation
+		if err := json.Unmarshal(resp[tt.id], &infos); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, info := range infos {
+			got = append(got, fmt.Sprintf("%s %s %d", info.Name, info.ContainerName, info.Kind))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("workspace/symbol: got %q; want %q", got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	for _, tt := range []struct {
+		query, name string
+		score       int
+		ok          bool
+	}{
+		{"foo", "foo", 0, true},
+		{"Foo", "foo-bar", 1, true},
+		{"bar", "foo-bar", 2, true},
+		{"fb", "foo-bar", 6, true},
+		{"fbz", "foo-bar", 0, false},
+	} {
+		score, ok := matchScore(tt.query, tt.name)
+		if score != tt.score || ok != tt.ok {
+			t.Errorf("matchScore(%q, %q): got %d, %t; want %d, %t", tt.query, tt.name, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app/core.clj": "(ns app.core\n  (:require [clojure.string :as str]))\n\n(defn f [x]\n  (str/join \"é\" x :k))\n",
+	})
+	defer os.RemoveAll(dir)
+	core := pathToURI(filepath.Join(dir, "src/app/core.clj"))
+
+	var c session
+	c.request("initialize", map[string]string{"rootUri": pathToURI(dir)})
+	id := c.request("textDocument/semanticTokens/full", map[string]interface{}{
+		"textDocument": map[string]string{"uri": core},
+	})
+	resp := c.run(t)
+	var result struct{ Data []int }
+	if err := json.Unmarshal(resp[id], &result); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{
+		0, 1, 2, 1, 0, // ns
+		0, 3, 8, 0, 0, // app.core
+		1, 3, 8, 3, 0, // :require
+		0, 10, 14, 0, 0, // clojure.string
+		0, 15, 3, 3, 0, // :as
+		0, 4, 3, 0, 0, // str
+		2, 1, 4, 1, 0, // defn
+		0, 8, 1, 4, 0, // x
+		1, 3, 3, 0, 0, // str
+		0, 4, 4, 2, 0, // join
+		0, 9, 1, 4, 0, // x
+		0, 2, 2, 3, 0, // :k
+	}
+	if !reflect.DeepEqual(result.Data, want) {
+		t.Errorf("got %v; want %v", result.Data, want)
+	}
+}
+
+func TestFoldingRange(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/app/core.clj": "(ns app.core\n  (:require [clojure.string :as str]))\n\n;; a\n;; b\n(defn f [x]\n  (let [y x]\n    y))\n",
+	})
+	defer os.RemoveAll(dir)
+	core := pathToURI(filepath.Join(dir, "src/app/core.clj"))
+
+	var c session
+	c.request("initialize", map[string]string{"rootUri": pathToURI(dir)})
+	id := c.request("textDocument/foldingRange", map[string]interface{}{
+		"textDocument": map[string]string{"uri": core},
+	})
+	resp := c.run(t)
+	var got []FoldingRange
+	if err := json.Unmarshal(resp[id], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []FoldingRange{{0, 1, "imports"}, {3, 4, "comment"}, {5, 7, ""}, {6, 7, ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/index"
+	"github.com/cespare/goclj/parse"
+)
+
+// maxWorkspaceSymbols limits the results of a workspace/symbol request.
+const maxWorkspaceSymbols = 100
+
+// symbolKind returns the SymbolKind of a var defined by the given form.
+func symbolKind(defForm string) int {
+	switch defForm {
+	case "defn", "defn-", "defmacro", "defmulti", "deftest":
+		return symbolFunction
+	case "defprotocol", "definterface":
+		return symbolInterface
+	case "defrecord":
+		return symbolStruct
+	case "deftype":
+		return symbolClass
+	}
+	return symbolVariable
+}
+
+// documentSymbol returns an outline of the top-level forms of a file which
+// define vars (and its ns form). The methods of a protocol are children of
+// the protocol.
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p documentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	path := uriToPath(p.TextDocument.URI)
+	f := s.ix.File(path)
+	d := s.parsedDocument(path)
+	if f == nil || d == nil {
+		return nil, nil
+	}
+	src := []byte(d.text)
+	vars := f.Vars
+	symbols := []DocumentSymbol{}
+	for _, root := range d.tree.Roots {
+		start, end := root.Position().Offset, parse.End(root, src)
+		if goclj.FnFormSymbol(root, "ns") {
+			for _, n := range root.Children()[1:] {
+				if sym, ok := n.(*parse.SymbolNode); ok {
+					symbols = append(symbols, DocumentSymbol{
+						Name:           sym.Val,
+						Kind:           symbolNamespace,
+						Range:          d.rangeOf(start, end),
+						SelectionRange: d.rangeOf(sym.Offset, sym.Offset+len(sym.Val)),
+					})
+					break
+				}
+			}
+			continue
+		}
+		for len(vars) > 0 && vars[0].Pos.Offset < start {
+			vars = vars[1:]
+		}
+		var defined []*index.Var
+		for len(vars) > 0 && vars[0].Pos.Offset < end {
+			defined, vars = append(defined, vars[0]), vars[1:]
+		}
+		if len(defined) == 0 {
+			continue
+		}
+		v := defined[0] // then the methods of a protocol
+		sym := DocumentSymbol{
+			Name:           v.Name,
+			Detail:         v.Kind,
+			Kind:           symbolKind(v.Kind),
+			Range:          d.rangeOf(start, end),
+			SelectionRange: d.rangeOf(v.Pos.Offset, v.Pos.Offset+len(v.Name)),
+		}
+		for _, m := range defined[1:] {
+			selection := d.rangeOf(m.Pos.Offset, m.Pos.Offset+len(m.Name))
+			child := DocumentSymbol{
+				Name:           m.Name,
+				Kind:           symbolMethod,
+				Range:          selection,
+				SelectionRange: selection,
+			}
+			// The range is that of the method's signature.
+			for _, n := range root.Children() {
+				if n.Position().Offset <= m.Pos.Offset && m.Pos.Offset < parse.End(n, src) {
+					child.Range = d.rangeOf(n.Position().Offset, parse.End(n, src))
+					break
+				}
+			}
+			sym.Children = append(sym.Children, child)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, nil
+}
+
+// workspaceSymbol returns the vars in the index which match the query, best
+// matches first (see matchScore).
+func (s *Server) workspaceSymbol(params json.RawMessage) (interface{}, error) {
+	var p workspaceSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	type match struct {
+		v     *index.Var
+		score int
+	}
+	var matches []match
+	for _, v := range s.ix.Vars() {
+		name := v.Name
+		if strings.Contains(p.Query, "/") {
+			name = v.Namespace + "/" + v.Name
+		}
+		if score, ok := matchScore(p.Query, name); ok {
+			matches = append(matches, match{v, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		m0, m1 := matches[i], matches[j]
+		if m0.score != m1.score {
+			return m0.score < m1.score
+		}
+		return m0.v.Name < m1.v.Name
+	})
+	if len(matches) > maxWorkspaceSymbols {
+		matches = matches[:maxWorkspaceSymbols]
+	}
+	docs := make(map[string]*document)
+	result := []SymbolInformation{}
+	for _, m := range matches {
+		d, ok := docs[m.v.Pos.Name]
+		if !ok {
+			d = s.document(m.v.Pos.Name)
+			docs[m.v.Pos.Name] = d
+		}
+		if d == nil {
+			continue
+		}
+		kind := symbolKind(m.v.Kind)
+		if m.v.Protocol != "" {
+			kind = symbolMethod
+		}
+		result = append(result, SymbolInformation{
+			Name:          m.v.Name,
+			Kind:          kind,
+			Location:      d.location(m.v.Pos, len(m.v.Name)),
+			ContainerName: m.v.Namespace,
+		})
+	}
+	return result, nil
+}
+
+// matchScore reports whether name matches the query: whether the characters
+// of the query appear in name in order, ignoring case. Lower scores are
+// better matches: an exact match is best, followed by a prefix, a substring,
+// and then other matches (with the fewest gaps first).
+func matchScore(query, name string) (int, bool) {
+	q, n := strings.ToLower(query), strings.ToLower(name)
+	switch {
+	case q == n:
+		return 0, true
+	case strings.HasPrefix(n, q):
+		return 1, true
+	case strings.Contains(n, q):
+		return 2, true
+	}
+	gaps := 0
+	qr := []rune(q)
+	i := 0
+	for _, r := range n {
+		if i == len(qr) {
+			break
+		}
+		if r == qr[i] {
+			i++
+		} else if i > 0 {
+			gaps++
+		}
+	}
+	if i < len(qr) {
+		return 0, false
+	}
+	return 3 + gaps, true
+}
@@ -0,0 +1,44 @@
+package lsp
+
+import (
+	"encoding/json"
+
+	"github.com/cespare/goclj/highlight"
+)
+
+// semanticTokenTypes is the legend of the semantic tokens: the LSP names of
+// the highlight.TokenTypes, in order.
+var semanticTokenTypes = []string{
+	highlight.TokenNamespace: "namespace",
+	highlight.TokenMacro:     "macro",
+	highlight.TokenFunction:  "function",
+	highlight.TokenKeyword:   "keyword",
+	highlight.TokenLocal:     "variable",
+}
+
+// semanticTokens classifies the symbols and keywords of a document (see
+// highlight.SemanticTokens). Each token is encoded as five integers: its
+// line and start character (relative to the previous token), its length,
+// its type, and its modifiers (which are unused).
+func (s *Server) semanticTokens(params json.RawMessage) (interface{}, error) {
+	var p semanticTokensParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.parsedDocument(uriToPath(p.TextDocument.URI))
+	if d == nil {
+		return nil, nil
+	}
+	data := []int{}
+	var prev Position
+	for _, tok := range highlight.SemanticTokens(d.tree) {
+		start, end := d.position(tok.Start), d.position(tok.End)
+		line, char := start.Line-prev.Line, start.Character
+		if line == 0 {
+			char -= prev.Character
+		}
+		data = append(data, line, char, end.Character-start.Character, int(tok.Type), 0)
+		prev = start
+	}
+	return map[string]interface{}{"data": data}, nil
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// Namespace holds the metrics for a single file.
+type Namespace struct {
+	Name      string      `json:"name"` // empty if there is no ns form
+	File      string      `json:"file"`
+	Lines     int         `json:"lines"`
+	Forms     int         `json:"forms"`
+	MaxDepth  int         `json:"maxDepth"`
+	Functions []*Function `json:"functions"`
+}
+
+// Function holds the metrics for a single function (or macro or method)
+// definition.
+type Function struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"` // the defining form; e.g., "defn"
+	Line int    `json:"line"`
+	// Lines is the number of source lines spanned by the definition.
+	Lines int `json:"lines"`
+	// Forms is the number of forms (including the defn form itself and
+	// all nested forms, but excluding comments) in the definition.
+	Forms int `json:"forms"`
+	// MaxDepth is the maximum nesting depth of collections in the
+	// function, counting the outer defn as depth 1.
+	MaxDepth int `json:"maxDepth"`
+	// Arities is the number of arities of the function and Params is the
+	// largest number of parameters taken by any of them. A variadic
+	// parameter (& rest) counts as one parameter.
+	Arities int `json:"arities"`
+	Params  int `json:"params"`
+	// Complexity is a cyclomatic complexity estimate: one plus the number
+	// of branch points (if, when, and, or, cond clauses, and the like).
+	Complexity int `json:"complexity"`
+}
+
+var functionForms = []string{"defn", "defn-", "defmacro", "defmethod"}
+
+// Compute computes the metrics for t. The tree should have been parsed with
+// parse.IncludeNonSemantic so that lines can be counted.
+func Compute(t *parse.Tree) *Namespace {
+	ns := &Namespace{}
+	for _, root := range t.Roots {
+		if goclj.Newline(root) || goclj.Comment(root) {
+			continue
+		}
+		if ns.File == "" {
+			ns.File = root.Position().Name
+		}
+		if goclj.FnFormSymbol(root, "ns") && ns.Name == "" {
+			if nodes, _ := parse.SemanticChildren(root); len(nodes) > 1 {
+				if sym, ok := nodes[1].(*parse.SymbolNode); ok {
+					ns.Name = sym.Val
+				}
+			}
+		}
+		if last := root.Position().Line + Lines(root) - 1; last > ns.Lines {
+			ns.Lines = last
+		}
+		ns.Forms += countForms(root)
+		if d := depth(root); d > ns.MaxDepth {
+			ns.MaxDepth = d
+		}
+		if goclj.FnFormSymbol(root, functionForms...) {
+			if fn := computeFunction(root); fn != nil {
+				ns.Functions = append(ns.Functions, fn)
+			}
+		}
+	}
+	return ns
+}
+
+func computeFunction(form parse.Node) *Function {
+	nodes, _ := parse.SemanticChildren(form)
+	fn := &Function{
+		Kind:       nodes[0].(*parse.SymbolNode).Val,
+		Line:       form.Position().Line,
+		Lines:      Lines(form),
+		Forms:      countForms(form),
+		MaxDepth:   depth(form),
+		Complexity: 1 + branches(form),
+	}
+	nodes = nodes[1:]
+	for len(nodes) > 0 {
+		if _, ok := nodes[0].(*parse.MetadataNode); !ok {
+			break
+		}
+		nodes = nodes[1:]
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	sym, ok := nodes[0].(*parse.SymbolNode)
+	if !ok {
+		return nil
+	}
+	fn.Name = sym.Val
+	nodes = nodes[1:]
+	if fn.Kind == "defmethod" {
+		// Skip the dispatch value, which may itself be a vector.
+		if len(nodes) == 0 {
+			return fn
+		}
+		nodes = nodes[1:]
+	}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *parse.VectorNode:
+			fn.addArity(n)
+			return fn
+		case *parse.ListNode:
+			if body, _ := parse.SemanticChildren(n); len(body) > 0 {
+				if v, ok := body[0].(*parse.VectorNode); ok {
+					fn.addArity(v)
+				}
+			}
+		}
+	}
+	return fn
+}
+
+func (fn *Function) addArity(params *parse.VectorNode) {
+	fn.Arities++
+	n := 0
+	nodes, _ := parse.SemanticChildren(params)
+	for _, p := range nodes {
+		if sym, ok := p.(*parse.SymbolNode); ok && sym.Val == "&" {
+			continue
+		}
+		if _, ok := p.(*parse.MetadataNode); ok {
+			continue // type hint
+		}
+		n++
+	}
+	if n > fn.Params {
+		fn.Params = n
+	}
+}
+
+// Lines returns the number of source lines spanned by n.
+func Lines(n parse.Node) int {
+	lines := 1
+	var count func(n parse.Node)
+	count = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.NewlineNode:
+			lines++
+		case *parse.StringNode:
+			lines += strings.Count(n.Val, "\n")
+		case *parse.RegexNode:
+			lines += strings.Count(n.Val, "\n")
+		}
+		for _, child := range n.Children() {
+			count(child)
+		}
+	}
+	count(n)
+	return lines
+}
+
+func countForms(n parse.Node) int {
+	if goclj.Newline(n) || goclj.Comment(n) {
+		return 0
+	}
+	count := 1
+	for _, child := range n.Children() {
+		count += countForms(child)
+	}
+	return count
+}
+
+func depth(n parse.Node) int {
+	max := 0
+	for _, child := range n.Children() {
+		if d := depth(child); d > max {
+			max = d
+		}
+	}
+	switch n.(type) {
+	case *parse.ListNode, *parse.VectorNode, *parse.MapNode, *parse.SetNode, *parse.FnLiteralNode,
+		*parse.NamespacedMapNode:
+		return max + 1
+	}
+	return max
+}
+
+// branchForms maps forms to the number of leading arguments to skip before
+// counting clauses. A value of -1 means the form is a single branch point.
+var branchForms = map[string]int{
+	"if":        -1,
+	"if-not":    -1,
+	"if-let":    -1,
+	"if-some":   -1,
+	"when":      -1,
+	"when-not":  -1,
+	"when-let":  -1,
+	"when-some": -1,
+	"while":     -1,
+	"and":       0,
+	"or":        0,
+	"cond":      0,
+	"cond->":    1,
+	"cond->>":   1,
+	"case":      1,
+	"condp":     2,
+}
+
+func branches(n parse.Node) int {
+	count := 0
+	if goclj.FnFormSymbol(n) {
+		args, _ := parse.SemanticChildren(n)
+		name := args[0].(*parse.SymbolNode).Val
+		args = args[1:]
+		if skip, ok := branchForms[name]; ok {
+			switch {
+			case skip < 0:
+				count++
+			case name == "and" || name == "or":
+				if len(args) > 1 {
+					count += len(args) - 1
+				}
+			case len(args) > skip:
+				count += (len(args) - skip) / 2
+			}
+		}
+	}
+	for _, child := range n.Children() {
+		count += branches(child)
+	}
+	return count
+}
+
+// WriteJSON writes namespaces to w as a JSON array.
+func WriteJSON(w io.Writer, namespaces []*Namespace) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(namespaces)
+}
+
+// WriteCSV writes the per-function metrics of namespaces to w as CSV, with a
+// header row.
+func WriteCSV(w io.Writer, namespaces []*Namespace) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"file", "namespace", "name", "kind", "line",
+		"lines", "forms", "max_depth", "arities", "params", "complexity",
+	})
+	for _, ns := range namespaces {
+		for _, fn := range ns.Functions {
+			cw.Write([]string{
+				ns.File,
+				ns.Name,
+				fn.Name,
+				fn.Kind,
+				strconv.Itoa(fn.Line),
+				strconv.Itoa(fn.Lines),
+				strconv.Itoa(fn.Forms),
+				strconv.Itoa(fn.MaxDepth),
+				strconv.Itoa(fn.Arities),
+				strconv.Itoa(fn.Params),
+				strconv.Itoa(fn.Complexity),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+const testSource = `(ns foo.bar)
+
+(defn f
+  "Doc
+  string."
+  [a b & more]
+  ;; comment
+  (if (and a b)
+    (cond
+      (> a 1) :big
+      (> a 0) :small
+      :else :neg)
+    (map inc more)))
+
+(defn- ^String g
+  ([] (g 1))
+  ([x] (str x)))
+`
+
+func TestCompute(t *testing.T) {
+	tree, err := parse.Reader(strings.NewReader(testSource), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := Compute(tree)
+	if ns.Name != "foo.bar" || ns.File != "temp" || ns.Lines != 17 {
+		t.Errorf("got ns name=%q file=%q lines=%d; want foo.bar, temp, 17",
+			ns.Name, ns.File, ns.Lines)
+	}
+	want := []*Function{
+		{
+			Name:       "f",
+			Kind:       "defn",
+			Line:       3,
+			Lines:      11,
+			Forms:      33,
+			MaxDepth:   4,
+			Arities:    1,
+			Params:     3,
+			Complexity: 6,
+		},
+		{
+			Name:       "g",
+			Kind:       "defn-",
+			Line:       15,
+			Lines:      3,
+			Forms:      16,
+			MaxDepth:   3,
+			Arities:    2,
+			Params:     1,
+			Complexity: 1,
+		},
+	}
+	if !reflect.DeepEqual(ns.Functions, want) {
+		for _, fn := range ns.Functions {
+			t.Logf("got %+v", fn)
+		}
+		t.Error("wrong function metrics")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []*Namespace{ns}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 3 {
+		t.Errorf("got %d CSV lines; want 3", got)
+	}
+}
+
+func TestComputeDefmethod(t *testing.T) {
+	const src = `(defmethod f [:a :b] [x] (inc x))`
+	tree, err := parse.Reader(strings.NewReader(src), "temp", parse.IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := Compute(tree)
+	if len(ns.Functions) != 1 {
+		t.Fatalf("got %d functions; want 1", len(ns.Functions))
+	}
+	fn := ns.Functions[0]
+	if fn.Name != "f" || fn.Kind != "defmethod" || fn.Arities != 1 || fn.Params != 1 {
+		t.Errorf("got name=%q kind=%q arities=%d params=%d; want f, defmethod, 1, 1",
+			fn.Name, fn.Kind, fn.Arities, fn.Params)
+	}
+}
@@ -0,0 +1,200 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The functions below construct nodes (without positions) for building a
+// Tree programmatically, say, to generate Clojure code. The Tree can be
+// printed with format.Printer, which indents the code and puts it in the
+// usual layout; only the line breaks within forms (given by Newline nodes)
+// are up to the caller.
+
+// NewTree returns a tree of the given top-level forms, laid out the way
+// top-level forms usually are: with a blank line between forms and a newline
+// at the end. A comment is followed by a single newline, so that it stays
+// with the form it describes, and tags and metadata stay on the line of the
+// form they apply to.
+func NewTree(forms ...Node) *Tree {
+	var roots []Node
+	for i, n := range forms {
+		roots = append(roots, n)
+		switch n.(type) {
+		case *TagNode, *MetadataNode:
+			continue
+		case *CommentNode:
+			roots = append(roots, &NewlineNode{})
+			continue
+		}
+		roots = append(roots, &NewlineNode{})
+		if i < len(forms)-1 {
+			roots = append(roots, &NewlineNode{})
+		}
+	}
+	return &Tree{Roots: roots}
+}
+
+// Symbol returns a symbol, such as foo or clojure.string/join.
+func Symbol(name string) *SymbolNode { return &SymbolNode{Val: name} }
+
+// Keyword returns a keyword with the given name, which does not include the
+// leading colon: Keyword("foo/bar") is :foo/bar. Keyword(":x") is the
+// auto-resolved keyword ::x.
+func Keyword(name string) *KeywordNode { return &KeywordNode{Val: ":" + name} }
+
+// String returns a string literal whose value is s, escaping it as needed.
+func String(s string) *StringNode {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return &StringNode{Val: b.String()}
+}
+
+// Unescape returns the value of a string literal whose text between the
+// quotes is raw (the Val of a StringNode), interpreting its escape
+// sequences; it is the inverse of String.
+func Unescape(raw string) (string, error) {
+	if !strings.Contains(raw, `\`) {
+		return raw, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(raw) {
+			return "", fmt.Errorf("bad escape at end of string %q", raw)
+		}
+		switch raw[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case '"', '\\':
+			b.WriteByte(raw[i])
+		case 'u':
+			if i+5 > len(raw) {
+				return "", fmt.Errorf("bad unicode escape in string %q", raw)
+			}
+			n, err := strconv.ParseUint(raw[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("bad unicode escape in string %q", raw)
+			}
+			b.WriteRune(rune(n))
+			i += 4
+		default:
+			// Octal escapes: \0 through \377.
+			j := i
+			for j < len(raw) && j < i+3 && raw[j] >= '0' && raw[j] <= '7' {
+				j++
+			}
+			if j == i {
+				return "", fmt.Errorf("unsupported escape \\%c in string %q", raw[i], raw)
+			}
+			n, err := strconv.ParseUint(raw[i:j], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("bad octal escape in string %q", raw)
+			}
+			b.WriteRune(rune(n))
+			i = j - 1
+		}
+	}
+	return b.String(), nil
+}
+
+var charNames = map[rune]string{
+	'\n': "newline",
+	' ':  "space",
+	'\t': "tab",
+	'\f': "formfeed",
+	'\b': "backspace",
+	'\r': "return",
+}
+
+// Char returns a character literal for r, such as \a, \newline, or \u0000.
+func Char(r rune) *CharacterNode {
+	text := `\` + string(r)
+	if name, ok := charNames[r]; ok {
+		text = `\` + name
+	} else if r < 0x20 || r == 0x7f {
+		text = fmt.Sprintf(`\u%04x`, r)
+	}
+	return &CharacterNode{Val: r, Text: text}
+}
+
+// Int returns a number literal for n.
+func Int(n int64) *NumberNode { return &NumberNode{Val: strconv.FormatInt(n, 10)} }
+
+// Number returns a number literal written as text, such as 1.5, 22/7, or
+// 0xff.
+func Number(text string) *NumberNode { return &NumberNode{Val: text} }
+
+// Bool returns true or false.
+func Bool(b bool) *BoolNode { return &BoolNode{Val: b} }
+
+// Nil returns nil.
+func Nil() *NilNode { return &NilNode{} }
+
+// List returns a list of nodes, such as a function call.
+func List(nodes ...Node) *ListNode { return &ListNode{Nodes: nodes} }
+
+// Vector returns a vector of nodes.
+func Vector(nodes ...Node) *VectorNode { return &VectorNode{Nodes: nodes} }
+
+// Map returns a map of nodes, which alternate between keys and values.
+func Map(nodes ...Node) *MapNode { return &MapNode{Nodes: nodes} }
+
+// Set returns a set of nodes.
+func Set(nodes ...Node) *SetNode { return &SetNode{Nodes: nodes} }
+
+// Quote returns n quoted, as in 'n.
+func Quote(n Node) *QuoteNode { return &QuoteNode{Node: n} }
+
+// Meta returns metadata, as in ^:private or ^String, which applies to the
+// node that follows it.
+func Meta(n Node) *MetadataNode { return &MetadataNode{Node: n} }
+
+// Tag returns a reader tag, such as #inst, which applies to the node that
+// follows it. The name does not include the #.
+func Tag(name string) *TagNode { return &TagNode{Val: name} }
+
+// Comment returns a comment. The text includes the semicolons, as in
+// Comment(";; TODO: handle errors").
+func Comment(text string) *CommentNode { return &CommentNode{Text: text} }
+
+// Newline returns a line break, to put in the nodes of a form (or between
+// top-level forms).
+func Newline() *NewlineNode { return &NewlineNode{} }
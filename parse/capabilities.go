@@ -0,0 +1,42 @@
+package parse
+
+// FeaturesVersion is the version of the layout of Features. Fields may be
+// added to Features without changing it; it changes only if the meaning of
+// an existing field does.
+const FeaturesVersion = 1
+
+// Features describes what this version of the package supports, for
+// clients (such as editor plugins, which may be used with several versions
+// of goclj) which need to know whether a feature is available. Its fields
+// have JSON names so that it can be passed on as it is.
+type Features struct {
+	// Version is FeaturesVersion.
+	Version int `json:"version"`
+	// Kinds are the names of the Kinds of nodes the parser creates (see
+	// Kind.String), in order.
+	Kinds []string `json:"kinds"`
+	// Options are the names of the supported ParseOpts.
+	Options []string `json:"options"`
+}
+
+// parseOptNames are the names of the ParseOpts, as listed by Capabilities.
+var parseOptNames = []struct {
+	opt  ParseOpts
+	name string
+}{
+	{IncludeNonSemantic, "include-non-semantic"},
+	{ReplaceInvalidUTF8, "replace-invalid-utf8"},
+	{Recover, "recover"},
+}
+
+// Capabilities returns the Features of the package.
+func Capabilities() *Features {
+	f := &Features{Version: FeaturesVersion}
+	for _, k := range Kinds() {
+		f.Kinds = append(f.Kinds, k.Name)
+	}
+	for _, o := range parseOptNames {
+		f.Options = append(f.Options, o.name)
+	}
+	return f
+}
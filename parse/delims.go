@@ -0,0 +1,281 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A DelimError is returned by Reader and File when parsing fails because the
+// delimiters of the input are unbalanced: a closing delimiter is missing or
+// there is an extra one.
+type DelimError struct {
+	Err error // the parse error
+	// Fix is the most likely repair of the delimiters, or nil if none
+	// was found.
+	Fix *DelimFix
+}
+
+func (e *DelimError) Error() string { return e.Err.Error() }
+
+// A DelimFix is a repair of unbalanced delimiters: removing the delimiter
+// Remove at Pos, inserting the delimiter Insert at Pos, or both (replacing
+// one delimiter with another).
+type DelimFix struct {
+	Pos    Pos
+	Remove string
+	Insert string
+}
+
+func (f *DelimFix) String() string {
+	pos := fmt.Sprintf("%d:%d", f.Pos.Line, f.Pos.Col)
+	switch {
+	case f.Remove == "":
+		return fmt.Sprintf("insert %s at %s", f.Insert, pos)
+	case f.Insert == "":
+		return fmt.Sprintf("remove %s at %s", f.Remove, pos)
+	}
+	return fmt.Sprintf("replace %s with %s at %s", f.Remove, f.Insert, pos)
+}
+
+// Apply returns the result of applying f to src, the source in which the
+// problem was found.
+func (f *DelimFix) Apply(src []byte) []byte {
+	off := f.Pos.Offset
+	b := make([]byte, 0, len(src)+len(f.Insert))
+	b = append(b, src[:off]...)
+	b = append(b, f.Insert...)
+	return append(b, src[off+len(f.Remove):]...)
+}
+
+// FixDelims finds the most likely repair of the delimiters of src, or returns
+// nil if they are balanced (or src can't be scanned). The name is used for
+// the position of the fix.
+//
+// Like parinfer, it uses indentation to judge where forms were meant to end:
+// a missing closing delimiter most likely belongs at the end of the line
+// before the first line which is indented no further than the delimiter's
+// opening. Of the fixes considered, FixDelims picks the one that leaves the
+// fewest unbalanced delimiters; only if there's a tie does indentation decide.
+func FixDelims(src []byte, name string) *DelimFix {
+	code := codeTokens(src, name)
+	var delims []delim
+	for _, tok := range code {
+		if isOpen(tok.typ) || isClose(tok.typ) {
+			delims = append(delims, delim{tok.pos, tok.val})
+		}
+	}
+	var (
+		fixes []*DelimFix
+		stack []int // indexes into code
+		// The first closing delimiter which doesn't match.
+		bad      = -1
+		badStack []int
+	)
+	const maxIndentFixes = 100
+	for i, tok := range code {
+		if i > 0 && !isClose(tok.typ) && len(stack) > 0 && len(fixes) < maxIndentFixes {
+			top := code[stack[len(stack)-1]]
+			if startsLine(code, i) && tok.pos.Col <= top.pos.Col {
+				fixes = append(fixes, &DelimFix{Pos: tokenEnd(code[i-1]), Insert: closer(top.val)})
+			}
+		}
+		switch {
+		case isOpen(tok.typ):
+			stack = append(stack, i)
+		case isClose(tok.typ):
+			if len(stack) > 0 && code[stack[len(stack)-1]].val == opener(tok.val) {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			if bad < 0 {
+				bad = i
+				badStack = append([]int(nil), stack...)
+			}
+			// Recover as the scoring does.
+			for j := len(stack) - 1; j >= 0; j-- {
+				if code[stack[j]].val == opener(tok.val) {
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+	}
+	if bad >= 0 {
+		c := code[bad]
+		fixes = append(fixes, removals(code, bad)...)
+		if len(badStack) > 0 {
+			top := code[badStack[len(badStack)-1]]
+			fixes = append(fixes,
+				&DelimFix{Pos: c.pos, Remove: c.val, Insert: closer(top.val)},
+				&DelimFix{Pos: c.pos, Insert: closer(top.val)})
+		}
+		fixes = append(fixes, &DelimFix{Pos: c.pos, Remove: c.val})
+	} else if len(stack) > 0 {
+		top := code[stack[len(stack)-1]]
+		fixes = append(fixes, &DelimFix{Pos: tokenEnd(code[len(code)-1]), Insert: closer(top.val)})
+	} else {
+		return nil
+	}
+	var best *DelimFix
+	bestScore := unbalanced(delims, nil)
+	for _, fix := range fixes {
+		if score := unbalanced(delims, fix); score < bestScore {
+			best, bestScore = fix, score
+		}
+	}
+	return best
+}
+
+// removals returns fixes for the extra closing delimiter code[bad], at the
+// top level, which remove an earlier closing delimiter instead: one which
+// closed a form that the indentation of the following lines shows to
+// continue.
+func removals(code []token, bad int) []*DelimFix {
+	var fixes []*DelimFix
+	// Find the opening delimiter of each closing one.
+	var stack []int
+	opened := make(map[int]int)
+	for i := 0; i < bad; i++ {
+		switch {
+		case isOpen(code[i].typ):
+			stack = append(stack, i)
+		case isClose(code[i].typ) && len(stack) > 0:
+			opened[i] = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return nil
+	}
+	for i := bad - 1; i >= 0 && len(fixes) < 10; i-- {
+		if !isClose(code[i].typ) {
+			continue
+		}
+		for j := i + 1; j <= bad; j++ {
+			if startsLine(code, j) {
+				if !isClose(code[j].typ) && code[j].pos.Col > code[opened[i]].pos.Col {
+					fixes = append(fixes, &DelimFix{Pos: code[i].pos, Remove: code[i].val})
+				}
+				break
+			}
+		}
+	}
+	return fixes
+}
+
+// A delim is a delimiter in the source.
+type delim struct {
+	pos Pos
+	val string
+}
+
+// unbalanced returns the number of unbalanced delimiters among delims after
+// applying fix (which may be nil). A closing delimiter which doesn't match
+// the innermost open form closes the nearest enclosing form which it does
+// match, if any, leaving the forms inside it unclosed.
+func unbalanced(delims []delim, fix *DelimFix) int {
+	n := 0
+	var stack []string
+	visit := func(val string) {
+		if c := closer(val); c != "" {
+			stack = append(stack, val)
+			return
+		}
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j] == opener(val) {
+				n += len(stack) - 1 - j
+				stack = stack[:j]
+				return
+			}
+		}
+		n++
+	}
+	fixed := fix == nil
+	for _, d := range delims {
+		if !fixed && d.pos.Offset >= fix.Pos.Offset {
+			fixed = true
+			if fix.Insert != "" {
+				visit(fix.Insert)
+			}
+			if fix.Remove != "" && d.pos.Offset == fix.Pos.Offset {
+				continue
+			}
+		}
+		visit(d.val)
+	}
+	if !fixed && fix.Insert != "" {
+		visit(fix.Insert)
+	}
+	return n + len(stack)
+}
+
+// codeTokens returns the tokens of src apart from comments and newlines. If
+// src can't be scanned, it returns the tokens before the problem.
+func codeTokens(src []byte, name string) []token {
+	l := lex(name, bufio.NewReader(bytes.NewReader(src)))
+	var toks []token
+	for {
+		tok := l.nextToken()
+		switch tok.typ {
+		case tokEOF, tokError:
+			return toks
+		case tokComment, tokNewline:
+			continue
+		}
+		toks = append(toks, tok)
+	}
+}
+
+// startsLine reports whether code[i] is the first token on its line.
+func startsLine(code []token, i int) bool {
+	return i == 0 || tokenEnd(code[i-1]).Line < code[i].pos.Line
+}
+
+// tokenEnd returns the position just past tok.
+func tokenEnd(tok token) Pos {
+	pos := tok.pos
+	pos.Offset += len(tok.val)
+	if i := strings.LastIndexByte(tok.val, '\n'); i >= 0 {
+		pos.Line += strings.Count(tok.val, "\n")
+		pos.Col = len(tok.val) - i
+	} else {
+		pos.Col += len(tok.val)
+	}
+	return pos
+}
+
+func isOpen(typ tokType) bool {
+	return typ == tokLeftParen || typ == tokLeftBracket || typ == tokLeftBrace
+}
+
+func isClose(typ tokType) bool {
+	return typ == tokRightParen || typ == tokRightBracket || typ == tokRightBrace
+}
+
+// closer returns the closing delimiter of an opening one, or "" if open
+// isn't an opening delimiter.
+func closer(open string) string {
+	switch open {
+	case "(":
+		return ")"
+	case "[":
+		return "]"
+	case "{":
+		return "}"
+	}
+	return ""
+}
+
+func opener(close string) string {
+	switch close {
+	case ")":
+		return "("
+	case "]":
+		return "["
+	case "}":
+		return "{"
+	}
+	return ""
+}
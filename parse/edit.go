@@ -0,0 +1,114 @@
+package parse
+
+// These functions edit the children of a node while keeping its layout
+// intact: a node inserted into a form which spans multiple lines goes on its
+// own line, nodes are never placed after a comment on the same line, and
+// removing a node removes the line break that separated it from its
+// neighbors. (The printer takes care of indentation.)
+
+// InsertAfter inserts n into the children of parent, after anchor. It reports
+// whether anchor is a child of parent.
+func InsertAfter(parent, anchor, n Node) bool {
+	nodes := parent.Children()
+	i := indexOf(nodes, anchor)
+	if i < 0 {
+		return false
+	}
+	i++
+	// Keep a comment beside anchor with anchor.
+	if i < len(nodes) && isComment(nodes[i]) {
+		i++
+	}
+	ins := []Node{n}
+	if isComment(nodes[i-1]) || isMultiline(nodes) {
+		ins = []Node{&NewlineNode{}, n}
+		if i < len(nodes) && !isNewline(nodes[i]) {
+			ins = append(ins, &NewlineNode{})
+		}
+	}
+	parent.SetChildren(insertNodes(nodes, i, ins...))
+	return true
+}
+
+// InsertBefore inserts n into the children of parent, before anchor and any
+// comments on the lines directly above it. It reports whether anchor is a
+// child of parent.
+func InsertBefore(parent, anchor, n Node) bool {
+	nodes := parent.Children()
+	i := indexOf(nodes, anchor)
+	if i < 0 {
+		return false
+	}
+	ins := []Node{n}
+	if isMultiline(nodes) {
+		for i >= 2 && isNewline(nodes[i-1]) && isComment(nodes[i-2]) &&
+			(i == 2 || isNewline(nodes[i-3])) {
+			i -= 2
+		}
+		ins = []Node{n, &NewlineNode{}}
+		if i > 0 && !isNewline(nodes[i-1]) {
+			ins = append([]Node{&NewlineNode{}}, ins...)
+		}
+	}
+	parent.SetChildren(insertNodes(nodes, i, ins...))
+	return true
+}
+
+// RemoveChild removes child from the children of parent, along with a comment
+// beside it and the line break which separated it from its neighbors. It
+// reports whether child was found.
+func RemoveChild(parent, child Node) bool {
+	nodes := parent.Children()
+	i := indexOf(nodes, child)
+	if i < 0 {
+		return false
+	}
+	j := i + 1
+	if j < len(nodes) && isComment(nodes[j]) {
+		j++
+	}
+	switch {
+	// A comment must stay at the end of its line.
+	case i > 0 && isNewline(nodes[i-1]) && (i == 1 || !isComment(nodes[i-2])):
+		i--
+	case j < len(nodes) && isNewline(nodes[j]):
+		j++
+	}
+	parent.SetChildren(append(nodes[:i:i], nodes[j:]...))
+	return true
+}
+
+func indexOf(nodes []Node, n Node) int {
+	for i, node := range nodes {
+		if node == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func insertNodes(nodes []Node, i int, ins ...Node) []Node {
+	result := make([]Node, 0, len(nodes)+len(ins))
+	result = append(result, nodes[:i]...)
+	result = append(result, ins...)
+	return append(result, nodes[i:]...)
+}
+
+func isMultiline(nodes []Node) bool {
+	for _, n := range nodes {
+		if isNewline(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNewline(n Node) bool {
+	_, ok := n.(*NewlineNode)
+	return ok
+}
+
+func isComment(n Node) bool {
+	_, ok := n.(*CommentNode)
+	return ok
+}
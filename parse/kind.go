@@ -0,0 +1,189 @@
+package parse
+
+import "fmt"
+
+// A Kind identifies the type of a Node. Kinds and their names are stable, so
+// they may be used by generic tools (serializers, highlighters, queries) in
+// place of type switches over the node types.
+type Kind int
+
+const (
+	KindInvalid Kind = iota // not a node created by this package
+
+	KindBool
+	KindCharacter
+	KindComment
+	KindDeref
+	KindFnLiteral
+	KindKeyword
+	KindList
+	KindMap
+	KindMetadata
+	KindNewline
+	KindNil
+	KindNumber
+	KindQuote
+	KindReaderDiscard
+	KindReaderEval
+	KindRegex
+	KindSet
+	KindString
+	KindSymbol
+	KindSyntaxQuote
+	KindTag
+	KindUnquote
+	KindUnquoteSplice
+	KindVarQuote
+	KindVector
+	KindError
+	KindNamespacedMap
+)
+
+// A Category is a set of tags which classify Kinds.
+type Category uint
+
+const (
+	// CategoryCollection is for nodes holding a sequence of forms:
+	// lists, vectors, maps, sets, and fn literals.
+	CategoryCollection Category = 1 << iota
+	// CategoryLiteral is for self-evaluating atoms, such as numbers,
+	// strings, keywords, and nil.
+	CategoryLiteral
+	// CategoryReaderMacro is for nodes written with a reader macro
+	// character, such as 'x, @x, ^x, and #(...).
+	CategoryReaderMacro
+	// CategoryNonSemantic is for nodes which don't affect the meaning
+	// of the code: comments and newlines.
+	CategoryNonSemantic
+)
+
+// A KindInfo describes a Kind.
+type KindInfo struct {
+	Kind       Kind
+	Name       string
+	Categories Category
+}
+
+var kinds = []KindInfo{
+	{KindInvalid, "invalid", 0},
+	{KindBool, "bool", CategoryLiteral},
+	{KindCharacter, "character", CategoryLiteral},
+	{KindComment, "comment", CategoryNonSemantic},
+	{KindDeref, "deref", CategoryReaderMacro},
+	{KindFnLiteral, "fn-literal", CategoryCollection | CategoryReaderMacro},
+	{KindKeyword, "keyword", CategoryLiteral},
+	{KindList, "list", CategoryCollection},
+	{KindMap, "map", CategoryCollection},
+	{KindMetadata, "metadata", CategoryReaderMacro},
+	{KindNewline, "newline", CategoryNonSemantic},
+	{KindNil, "nil", CategoryLiteral},
+	{KindNumber, "number", CategoryLiteral},
+	{KindQuote, "quote", CategoryReaderMacro},
+	{KindReaderDiscard, "reader-discard", CategoryReaderMacro},
+	{KindReaderEval, "reader-eval", CategoryReaderMacro},
+	{KindRegex, "regex", CategoryLiteral | CategoryReaderMacro},
+	{KindSet, "set", CategoryCollection | CategoryReaderMacro},
+	{KindString, "string", CategoryLiteral},
+	{KindSymbol, "symbol", 0},
+	{KindSyntaxQuote, "syntax-quote", CategoryReaderMacro},
+	{KindTag, "tag", CategoryReaderMacro},
+	{KindUnquote, "unquote", CategoryReaderMacro},
+	{KindUnquoteSplice, "unquote-splice", CategoryReaderMacro},
+	{KindVarQuote, "var-quote", CategoryReaderMacro},
+	{KindVector, "vector", CategoryCollection},
+	{KindError, "error", 0},
+	{KindNamespacedMap, "namespaced-map", CategoryCollection | CategoryReaderMacro},
+}
+
+// Kinds returns descriptions of every Kind of node (not including
+// KindInvalid), in order.
+func Kinds() []KindInfo {
+	return append([]KindInfo(nil), kinds[1:]...)
+}
+
+// KindOf returns the Kind of n.
+func KindOf(n Node) Kind {
+	switch n.(type) {
+	case *BoolNode:
+		return KindBool
+	case *CharacterNode:
+		return KindCharacter
+	case *CommentNode:
+		return KindComment
+	case *DerefNode:
+		return KindDeref
+	case *FnLiteralNode:
+		return KindFnLiteral
+	case *KeywordNode:
+		return KindKeyword
+	case *ListNode:
+		return KindList
+	case *MapNode:
+		return KindMap
+	case *MetadataNode:
+		return KindMetadata
+	case *NewlineNode:
+		return KindNewline
+	case *NilNode:
+		return KindNil
+	case *NumberNode:
+		return KindNumber
+	case *QuoteNode:
+		return KindQuote
+	case *ReaderDiscardNode:
+		return KindReaderDiscard
+	case *ReaderEvalNode:
+		return KindReaderEval
+	case *RegexNode:
+		return KindRegex
+	case *SetNode:
+		return KindSet
+	case *StringNode:
+		return KindString
+	case *SymbolNode:
+		return KindSymbol
+	case *SyntaxQuoteNode:
+		return KindSyntaxQuote
+	case *TagNode:
+		return KindTag
+	case *UnquoteNode:
+		return KindUnquote
+	case *UnquoteSpliceNode:
+		return KindUnquoteSplice
+	case *VarQuoteNode:
+		return KindVarQuote
+	case *VectorNode:
+		return KindVector
+	case *ErrorNode:
+		return KindError
+	case *NamespacedMapNode:
+		return KindNamespacedMap
+	}
+	return KindInvalid
+}
+
+// ParseKind returns the Kind with the given name.
+func ParseKind(name string) (Kind, error) {
+	for _, info := range kinds[1:] {
+		if info.Name == name {
+			return info.Kind, nil
+		}
+	}
+	return KindInvalid, fmt.Errorf("unknown node kind %q", name)
+}
+
+func (k Kind) info() KindInfo {
+	if k < 0 || int(k) >= len(kinds) {
+		return kinds[KindInvalid]
+	}
+	return kinds[k]
+}
+
+// String returns the name of k, such as "list" or "syntax-quote".
+func (k Kind) String() string { return k.info().Name }
+
+// Categories returns the categories that k belongs to.
+func (k Kind) Categories() Category { return k.info().Categories }
+
+// Is reports whether k belongs to any of the categories in c.
+func (k Kind) Is(c Category) bool { return k.info().Categories&c != 0 }
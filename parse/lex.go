@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Pos is a position in source text.
@@ -15,6 +16,7 @@ type Pos struct {
 	Col    int
 }
 
+// Copy returns a pointer to a copy of p.
 func (p *Pos) Copy() *Pos {
 	var p2 Pos
 	p2 = *p
@@ -32,7 +34,7 @@ func (p *Pos) FormatError(tag string, msg string) error {
 // A token is a single lexeme produced by the scanner.
 type token struct {
 	typ tokType
-	pos *Pos
+	pos Pos
 	val string
 }
 
@@ -40,9 +42,25 @@ func (t token) AsError() error {
 	if t.typ != tokError {
 		panic("AsError called on non-error token")
 	}
+	if t.val == invalidUTF8 {
+		return &EncodingError{Pos: t.pos}
+	}
 	return t.pos.FormatError("lex", t.val)
 }
 
+// invalidUTF8 is the text of the error token for invalid UTF-8.
+const invalidUTF8 = "invalid UTF-8 encoding"
+
+// An EncodingError is returned when the input is not valid UTF-8 (unless it
+// is parsed with ReplaceInvalidUTF8).
+type EncodingError struct {
+	Pos Pos // the position of the first invalid byte
+}
+
+func (e *EncodingError) Error() string {
+	return e.Pos.FormatError("lex", invalidUTF8).Error()
+}
+
 type tokType int
 
 const (
@@ -115,31 +133,41 @@ func (t token) String() string {
 		tokDispatch,
 		tokString,
 		tokSymbol:
-		return fmt.Sprintf("<%s@%s>(%q)", t.typ, t.pos, t.val)
+		return fmt.Sprintf("<%s@%s>(%q)", t.typ, &t.pos, t.val)
 	}
-	return fmt.Sprintf("<%s@%s>", t.typ, t.pos)
+	return fmt.Sprintf("<%s@%s>", t.typ, &t.pos)
 }
 
 // lexer holds the state of the scanner. A single rune of backup is supported.
+//
+// Positions are values rather than pointers so that scanning a rune or
+// emitting a token doesn't allocate.
+//
+// The lexer runs in the parser's goroutine: nextToken runs the state
+// functions until they have emitted a token.
 type lexer struct {
 	name    string // the name of the input source
 	input   *bufio.Reader
-	pos     *Pos // the current position in the input
-	start   *Pos // the start position of the token being scanned
-	lastPos *Pos // the position before the most recent next() call
-	tokens  chan token
-	val     []rune // the literal contents of the token
+	pos     Pos  // the current position in the input
+	start   Pos  // the start position of the token being scanned
+	lastPos Pos  // the position before the most recent next() call
+	canBack bool // whether lastPos is valid
+	state   stateFn
+	tokens  []token // emitted tokens not yet returned by nextToken
+	val     []rune  // the literal contents of the token
+	// replaceInvalid makes the lexer read invalid UTF-8 as U+FFFD
+	// rather than stopping with an error.
+	replaceInvalid bool
 }
 
 func lex(name string, input *bufio.Reader) *lexer {
 	l := &lexer{
-		name:   name,
-		input:  input,
-		pos:    &Pos{Name: name, Line: 1, Col: 1},
-		start:  &Pos{Name: name, Line: 1, Col: 1},
-		tokens: make(chan token),
+		name:  name,
+		input: input,
+		pos:   Pos{Name: name, Line: 1, Col: 1},
+		start: Pos{Name: name, Line: 1, Col: 1},
+		state: lexOuter,
 	}
-	go l.run()
 	return l
 }
 
@@ -147,6 +175,11 @@ type inputReadErr struct {
 	err error
 }
 
+// invalidUTF8Err is raised by next when it reads invalid UTF-8 at pos.
+type invalidUTF8Err struct {
+	pos Pos
+}
+
 func (l *lexer) next() (r rune, eof bool) {
 	r, w, err := l.input.ReadRune()
 	if err != nil {
@@ -155,7 +188,11 @@ func (l *lexer) next() (r rune, eof bool) {
 		}
 		panic(inputReadErr{err})
 	}
-	l.lastPos = l.pos.Copy()
+	if r == utf8.RuneError && w == 1 && !l.replaceInvalid {
+		panic(invalidUTF8Err{l.pos})
+	}
+	l.lastPos = l.pos
+	l.canBack = true
 	l.pos.Offset += w
 	l.pos.Col += w
 	if r == '\n' {
@@ -167,7 +204,7 @@ func (l *lexer) next() (r rune, eof bool) {
 }
 
 func (l *lexer) back() {
-	if l.lastPos == nil {
+	if !l.canBack {
 		panic("back() call not preceded by a next()")
 	}
 	if err := l.input.UnreadRune(); err != nil {
@@ -175,7 +212,7 @@ func (l *lexer) back() {
 	}
 	l.pos = l.lastPos
 	l.val = l.val[:len(l.val)-1]
-	l.lastPos = nil
+	l.canBack = false
 }
 
 // scanWhile scans while f(current rune) is true.
@@ -212,30 +249,42 @@ func (l *lexer) scanUntil(set string) {
 }
 
 func (l *lexer) emit(typ tokType) {
-	l.tokens <- token{typ, l.start, string(l.val)}
+	l.tokens = append(l.tokens, token{typ, l.start, string(l.val)})
 	l.skip()
 }
 
 func (l *lexer) skip() {
-	l.start = l.pos.Copy()
+	l.start = l.pos
 	l.val = l.val[:0]
 }
 
-func (l *lexer) synth(typ tokType, val string) {
-	l.tokens <- token{typ, l.start, val}
+// synth emits a token of the given type and value which starts at pos.
+func (l *lexer) synth(typ tokType, pos Pos, val string) {
+	l.tokens = append(l.tokens, token{typ, pos, val})
 }
 
+// nextToken returns the next token, scanning more of the input as needed.
+// Once the input is exhausted, it returns EOF tokens.
 func (l *lexer) nextToken() token {
-	return <-l.tokens
+	for len(l.tokens) == 0 {
+		if l.state == nil {
+			return token{typ: tokEOF, pos: l.start}
+		}
+		l.step()
+	}
+	tok := l.tokens[0]
+	n := copy(l.tokens, l.tokens[1:])
+	l.tokens = l.tokens[:n]
+	return tok
 }
 
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.tokens <- token{tokError, l.start, fmt.Sprintf(format, args...)}
+	l.tokens = append(l.tokens, token{tokError, l.start, fmt.Sprintf(format, args...)})
 	return nil
 }
 
 func (l *lexer) scanError(err error) stateFn {
-	l.tokens <- token{tokError, l.start, fmt.Sprintf("error while scanning: %s", err)}
+	l.tokens = append(l.tokens, token{tokError, l.start, fmt.Sprintf("error while scanning: %s", err)})
 	return nil
 }
 
@@ -247,20 +296,23 @@ func (l *lexer) eof() stateFn {
 // stateFn represents a single state in the scanner.
 type stateFn func(*lexer) stateFn
 
-func (l *lexer) run() {
+// step runs the current state function.
+func (l *lexer) step() {
 	defer func() {
 		if e := recover(); e != nil {
-			if e2, ok := e.(inputReadErr); ok {
-				l.scanError(e2.err)
+			switch e := e.(type) {
+			case inputReadErr:
+				l.state = l.scanError(e.err)
+				return
+			case invalidUTF8Err:
+				l.tokens = append(l.tokens, token{tokError, e.pos, invalidUTF8})
+				l.state = nil
 				return
 			}
 			panic(e)
 		}
 	}()
-
-	for state := lexOuter; state != nil; state = state(l) {
-	}
-	close(l.tokens)
+	l.state = l.state(l)
 }
 
 func lexOuter(l *lexer) stateFn {
@@ -412,15 +464,16 @@ func lexDispatch(l *lexer) stateFn {
 		return nil
 	}
 	val := string(l.val)
+	start := l.start
 	switch r {
 	case '{', '(', '"':
 		l.back()
 		l.skip()
-		l.synth(tokDispatch, val)
+		l.synth(tokDispatch, start, val)
 		return lexOuter
 	case '\'', '_', '^', '=':
 		l.skip()
-		l.synth(tokDispatch, val)
+		l.synth(tokDispatch, start, val)
 		return lexOuter
 	case '!':
 		// #! is a reader dispatch macro for comments.
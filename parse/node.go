@@ -1,9 +1,13 @@
 package parse
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 type Node interface {
 	Position() *Pos
+	End() *Pos
 	String() string // A non-recursive string representation
 	Children() []Node
 	SetChildren([]Node)
@@ -11,8 +15,20 @@ type Node interface {
 
 func (p *Pos) Position() *Pos { return p }
 
+// nodeEnd is embedded in each type of Node to record where it ends.
+type nodeEnd struct {
+	end Pos
+}
+
+// End returns the position just past the end of the node, as recorded by
+// the parser (so the node's text spans from its Position to its End). It
+// is the zero Pos for nodes which weren't parsed, such as those created by
+// the transforms of the format package.
+func (e *nodeEnd) End() *Pos { return &e.end }
+
 type BoolNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val bool
 }
 
@@ -27,7 +43,8 @@ func (n *BoolNode) Children() []Node   { return nil }
 func (n *BoolNode) SetChildren([]Node) { panic("SetChildren called on BoolNode") }
 
 type CharacterNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val  rune
 	Text string
 }
@@ -37,7 +54,8 @@ func (n *CharacterNode) Children() []Node   { return nil }
 func (n *CharacterNode) SetChildren([]Node) { panic("SetChildren called on CharacterNode") }
 
 type CommentNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Text string
 }
 
@@ -46,7 +64,8 @@ func (n *CommentNode) Children() []Node   { return nil }
 func (n *CommentNode) SetChildren([]Node) { panic("SetChildren called on CommentNode") }
 
 type DerefNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -60,7 +79,8 @@ func (n *DerefNode) SetChildren(nodes []Node) {
 }
 
 type KeywordNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -69,7 +89,8 @@ func (n *KeywordNode) Children() []Node   { return nil }
 func (n *KeywordNode) SetChildren([]Node) { panic("SetChildren called on KeywordNode") }
 
 type ListNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Nodes []Node
 }
 
@@ -80,7 +101,8 @@ func (n *ListNode) Children() []Node         { return n.Nodes }
 func (n *ListNode) SetChildren(nodes []Node) { n.Nodes = nodes }
 
 type MapNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Nodes []Node
 }
 
@@ -91,8 +113,28 @@ func (n *MapNode) String() string {
 func (n *MapNode) Children() []Node         { return n.Nodes }
 func (n *MapNode) SetChildren(nodes []Node) { n.Nodes = nodes }
 
+// A NamespacedMapNode is a map whose keywords and symbols without a
+// namespace are given one by default, as in #:user{:id 1} or #::{:id 1}.
+type NamespacedMapNode struct {
+	Pos
+	nodeEnd
+	// Namespace is the keyword after the #, as written: ":user" for
+	// #:user{...}, "::" for the current namespace, or "::s" for the
+	// namespace aliased as s.
+	Namespace string
+	Nodes     []Node
+}
+
+func (n *NamespacedMapNode) String() string {
+	semanticNodes := countSemantic(n.Nodes)
+	return fmt.Sprintf("nsmap(%s, length=%d)", n.Namespace, semanticNodes/2)
+}
+func (n *NamespacedMapNode) Children() []Node         { return n.Nodes }
+func (n *NamespacedMapNode) SetChildren(nodes []Node) { n.Nodes = nodes }
+
 type MetadataNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -106,7 +148,8 @@ func (n *MetadataNode) SetChildren(nodes []Node) {
 }
 
 type NewlineNode struct {
-	*Pos
+	Pos
+	nodeEnd
 }
 
 func (n *NewlineNode) String() string     { return "newline" }
@@ -114,7 +157,8 @@ func (n *NewlineNode) Children() []Node   { return nil }
 func (n *NewlineNode) SetChildren([]Node) { panic("SetChildren called on NewlineNode") }
 
 type NilNode struct {
-	*Pos
+	Pos
+	nodeEnd
 }
 
 func (n *NilNode) String() string     { return "nil" }
@@ -122,7 +166,8 @@ func (n *NilNode) Children() []Node   { return nil }
 func (n *NilNode) SetChildren([]Node) { panic("SetChildren called on NilNode") }
 
 type NumberNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -131,7 +176,8 @@ func (n *NumberNode) Children() []Node   { return nil }
 func (n *NumberNode) SetChildren([]Node) { panic("SetChildren called on NumberNode") }
 
 type SymbolNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -140,7 +186,8 @@ func (n *SymbolNode) Children() []Node   { return nil }
 func (n *SymbolNode) SetChildren([]Node) { panic("SetChildren called on SymbolNode") }
 
 type QuoteNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -154,7 +201,8 @@ func (n *QuoteNode) SetChildren(nodes []Node) {
 }
 
 type StringNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -163,7 +211,8 @@ func (n *StringNode) Children() []Node   { return nil }
 func (n *StringNode) SetChildren([]Node) { panic("SetChildren called on StringNode") }
 
 type SyntaxQuoteNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -177,7 +226,8 @@ func (n *SyntaxQuoteNode) SetChildren(nodes []Node) {
 }
 
 type UnquoteNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -191,7 +241,8 @@ func (n *UnquoteNode) SetChildren(nodes []Node) {
 }
 
 type UnquoteSpliceNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -205,7 +256,8 @@ func (n *UnquoteSpliceNode) SetChildren(nodes []Node) {
 }
 
 type VectorNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Nodes []Node
 }
 
@@ -216,7 +268,8 @@ func (n *VectorNode) Children() []Node         { return n.Nodes }
 func (n *VectorNode) SetChildren(nodes []Node) { n.Nodes = nodes }
 
 type FnLiteralNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Nodes []Node
 }
 
@@ -227,7 +280,8 @@ func (n *FnLiteralNode) Children() []Node         { return n.Nodes }
 func (n *FnLiteralNode) SetChildren(nodes []Node) { n.Nodes = nodes }
 
 type ReaderDiscardNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -241,7 +295,8 @@ func (n *ReaderDiscardNode) SetChildren(nodes []Node) {
 }
 
 type ReaderEvalNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Node Node
 }
 
@@ -255,7 +310,8 @@ func (n *ReaderEvalNode) SetChildren(nodes []Node) {
 }
 
 type RegexNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -264,7 +320,8 @@ func (n *RegexNode) Children() []Node   { return nil }
 func (n *RegexNode) SetChildren([]Node) { panic("SetChildren called on RegexNode") }
 
 type SetNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Nodes []Node
 }
 
@@ -275,7 +332,8 @@ func (n *SetNode) Children() []Node         { return n.Nodes }
 func (n *SetNode) SetChildren(nodes []Node) { n.Nodes = nodes }
 
 type VarQuoteNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -284,7 +342,8 @@ func (n *VarQuoteNode) Children() []Node   { return nil }
 func (n *VarQuoteNode) SetChildren([]Node) { panic("SetChildren called on VarQuoteNode") }
 
 type TagNode struct {
-	*Pos
+	Pos
+	nodeEnd
 	Val string
 }
 
@@ -292,12 +351,304 @@ func (n *TagNode) String() string     { return fmt.Sprintf("tag(%s)", n.Val) }
 func (n *TagNode) Children() []Node   { return nil }
 func (n *TagNode) SetChildren([]Node) { panic("SetChildren called on TagNode") }
 
-func isSemantic(n Node) bool {
-	switch n.(type) {
-	case *CommentNode, *NewlineNode:
-		return false
+// An ErrorNode stands in for text with a syntax error in a tree parsed with
+// Recover.
+type ErrorNode struct {
+	Pos
+	nodeEnd
+	Text string // the source text, exactly as written
+	Err  error  // the syntax error
+}
+
+func (n *ErrorNode) String() string     { return fmt.Sprintf("error(%q)", n.Text) }
+func (n *ErrorNode) Children() []Node   { return nil }
+func (n *ErrorNode) SetChildren([]Node) { panic("SetChildren called on ErrorNode") }
+
+// ClearPositions sets the positions (and ends) of n and all of its
+// descendants to the zero Pos. This is useful after a tree has been rearranged, when the
+// positions no longer correspond to the input.
+func ClearPositions(n Node) {
+	*n.Position() = Pos{}
+	*n.End() = Pos{}
+	for _, child := range n.Children() {
+		ClearPositions(child)
+	}
+}
+
+// End returns the offset just past the end of n in src, the source from
+// which it was parsed. Rather than relying on the end recorded by the parser
+// (see Node.End), it works from the start of n, its last descendant, and
+// src, finding the closing delimiter of a collection by scanning src.
+func End(n Node, src []byte) int {
+	off := n.Position().Offset
+	switch n := n.(type) {
+	case *BoolNode:
+		return off + len(n.String())
+	case *CharacterNode:
+		return off + len(n.Text)
+	case *CommentNode:
+		return off + len(n.Text)
+	case *KeywordNode:
+		return off + len(n.Val)
+	case *NewlineNode:
+		return off + 1
+	case *NilNode:
+		return off + len("nil")
+	case *NumberNode:
+		return off + len(n.Val)
+	case *RegexNode:
+		return off + len(n.Val) + len(`#""`)
+	case *StringNode:
+		return off + len(n.Val) + len(`""`)
+	case *SymbolNode:
+		return off + len(n.Val)
+	case *ErrorNode:
+		return off + len(n.Text)
+	case *TagNode:
+		return endOfName(off, n.Val, src)
+	case *VarQuoteNode:
+		return endOfName(off, n.Val, src)
+	case *ListNode, *VectorNode, *MapNode, *SetNode, *FnLiteralNode, *NamespacedMapNode:
+		i := off + 1
+		switch n := n.(type) {
+		case *SetNode, *FnLiteralNode:
+			i++
+		case *NamespacedMapNode:
+			// There may be whitespace before the brace.
+			i += len(n.Namespace)
+			if j := bytes.IndexByte(src[i:], '{'); j >= 0 {
+				i += j + 1
+			}
+		}
+		if nodes := n.Children(); len(nodes) > 0 {
+			i = End(nodes[len(nodes)-1], src)
+		}
+		// Skip whitespace and comments (which aren't nodes if the tree
+		// was parsed without IncludeNonSemantic) to the delimiter.
+		for i < len(src) {
+			switch c := src[i]; {
+			case c == ';':
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			case isWhitespace(rune(c)):
+				i++
+			default:
+				return i + 1
+			}
+		}
+		return i
+	}
+	// Quotes, metadata, and other reader macros wrapping a single node.
+	if nodes := n.Children(); len(nodes) > 0 {
+		return End(nodes[len(nodes)-1], src)
+	}
+	return off
+}
+
+// Copy returns a deep copy of n. The copy may be changed (for instance, by
+// the transforms of the format package) without affecting n.
+func Copy(n Node) Node {
+	var cp Node
+	switch n := n.(type) {
+	case *BoolNode:
+		c := *n
+		cp = &c
+	case *CharacterNode:
+		c := *n
+		cp = &c
+	case *CommentNode:
+		c := *n
+		cp = &c
+	case *DerefNode:
+		c := *n
+		cp = &c
+	case *KeywordNode:
+		c := *n
+		cp = &c
+	case *ListNode:
+		c := *n
+		cp = &c
+	case *MapNode:
+		c := *n
+		cp = &c
+	case *NamespacedMapNode:
+		c := *n
+		cp = &c
+	case *MetadataNode:
+		c := *n
+		cp = &c
+	case *NewlineNode:
+		c := *n
+		cp = &c
+	case *NilNode:
+		c := *n
+		cp = &c
+	case *NumberNode:
+		c := *n
+		cp = &c
+	case *SymbolNode:
+		c := *n
+		cp = &c
+	case *QuoteNode:
+		c := *n
+		cp = &c
+	case *StringNode:
+		c := *n
+		cp = &c
+	case *SyntaxQuoteNode:
+		c := *n
+		cp = &c
+	case *UnquoteNode:
+		c := *n
+		cp = &c
+	case *UnquoteSpliceNode:
+		c := *n
+		cp = &c
+	case *VectorNode:
+		c := *n
+		cp = &c
+	case *FnLiteralNode:
+		c := *n
+		cp = &c
+	case *ReaderDiscardNode:
+		c := *n
+		cp = &c
+	case *ReaderEvalNode:
+		c := *n
+		cp = &c
+	case *RegexNode:
+		c := *n
+		cp = &c
+	case *SetNode:
+		c := *n
+		cp = &c
+	case *VarQuoteNode:
+		c := *n
+		cp = &c
+	case *TagNode:
+		c := *n
+		cp = &c
+	case *ErrorNode:
+		c := *n
+		cp = &c
+	default:
+		panicf("Copy called on unknown node type %T", n)
+	}
+	if nodes := n.Children(); len(nodes) > 0 || KindOf(n).Is(CategoryCollection) {
+		children := make([]Node, len(nodes))
+		for i, child := range nodes {
+			children[i] = Copy(child)
+		}
+		cp.SetChildren(children)
+	}
+	return cp
+}
+
+// Copy returns a deep copy of t (see Copy).
+func (t *Tree) Copy() *Tree {
+	t2 := &Tree{
+		Roots:              make([]Node, len(t.Roots)),
+		src:                t.src,
+		includeNonSemantic: t.includeNonSemantic,
+	}
+	for i, n := range t.Roots {
+		t2.Roots[i] = Copy(n)
+	}
+	return t2
+}
+
+// Source returns the source from which t was parsed, or nil if it wasn't
+// parsed by Reader or File.
+func (t *Tree) Source() []byte { return t.src }
+
+// NodeAt returns the innermost node of t at the given line and column, or
+// nil if there is none. Lines and columns are 1-based, and columns count
+// bytes, as in Pos. Finding the node requires the source of t, so t must have
+// been parsed by Reader or File (and not rearranged since).
+func (t *Tree) NodeAt(line, col int) Node {
+	if nodes := t.EnclosingForms(line, col); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// EnclosingForms returns the nodes of t which contain the given line and
+// column, innermost first: the node returned by NodeAt, then its parent, and
+// so on up to a top-level node. See NodeAt for the requirements of t.
+func (t *Tree) EnclosingForms(line, col int) []Node {
+	off, ok := t.offset(line, col)
+	if !ok {
+		return nil
+	}
+	var path []Node
+	nodes := t.Roots
+outer:
+	for {
+		for _, n := range nodes {
+			if n.Position().Offset <= off && off < End(n, t.src) {
+				path = append(path, n)
+				nodes = n.Children()
+				continue outer
+			}
+		}
+		break
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// offset converts a line and column to an offset in t.src. It reports
+// whether the position is in t.src.
+func (t *Tree) offset(line, col int) (int, bool) {
+	if line < 1 || col < 1 {
+		return 0, false
 	}
-	return true
+	off := 0
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(t.src[off:], '\n')
+		if i < 0 {
+			return 0, false
+		}
+		off += i + 1
+	}
+	end := len(t.src)
+	if i := bytes.IndexByte(t.src[off:], '\n'); i >= 0 {
+		end = off + i + 1 // including the newline
+	}
+	if off+col-1 >= end {
+		return 0, false
+	}
+	return off + col - 1, true
+}
+
+// endOfName returns the end of a tag or var quote at off with the given
+// name. There may be whitespace between the # or #' and the name.
+func endOfName(off int, name string, src []byte) int {
+	if i := bytes.Index(src[off:], []byte(name)); i >= 0 {
+		return off + i + len(name)
+	}
+	return off
+}
+
+// SemanticChildren returns the children of n which affect the meaning of
+// the code; that is, n.Children() without any comments or newlines. The
+// returned indexes give the position of each of those nodes in n.Children(),
+// so that callers can modify the raw children.
+func SemanticChildren(n Node) (nodes []Node, indexes []int) {
+	for i, child := range n.Children() {
+		if isSemantic(child) {
+			nodes = append(nodes, child)
+			indexes = append(indexes, i)
+		}
+	}
+	return nodes, indexes
+}
+
+func isSemantic(n Node) bool {
+	return !KindOf(n).Is(CategoryNonSemantic)
 }
 
 func countSemantic(nodes []Node) int {
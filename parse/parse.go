@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -13,14 +14,33 @@ import (
 type Tree struct {
 	Roots []Node
 
+	// src is the source from which the tree was parsed, if it was
+	// parsed by Reader or File.
+	src []byte
+
 	// Config
 	includeNonSemantic bool
 
+	// When recovering from errors (see Recover), read holds the input
+	// read so far and errs the syntax errors found; atEOF records
+	// whether an error has been found at the end of the input.
+	read  *bytes.Buffer
+	errs  ErrorList
+	atEOF bool
+
 	// Parser state
 	tok       token // single-item lookahead
 	peekCount int
 	lex       *lexer
 	inLambda  bool
+
+	// budget, if positive, limits used, the estimated memory used by
+	// the nodes parsed so far and, if keepSrc is set, by the source they
+	// were parsed from.
+	budget  int64
+	used    int64
+	keepSrc bool
+	srcUsed int64
 }
 
 // String pretty-prints the tree recursively using each Node's String().
@@ -40,7 +60,7 @@ func nodesToString(nodes []Node, depth int) string {
 func (t *Tree) parse() (err error) {
 	defer t.recover(&err)
 	for {
-		node := t.parseNext()
+		node := t.parseElem()
 		if node == nil {
 			break
 		}
@@ -61,6 +81,8 @@ func (t *Tree) recover(err *error) {
 			*err = e.err
 		case parseError:
 			*err = e.err
+		case *BudgetError:
+			*err = e
 		default:
 			panic(e)
 		}
@@ -69,9 +91,21 @@ func (t *Tree) recover(err *error) {
 
 func (t *Tree) nextToken() token {
 	tok := t.lex.nextToken()
-	if tok.typ == tokError {
+	if tok.typ == tokError && t.read == nil {
+		// When recovering from errors, the parser meets the error token
+		// as an unexpected token (see parseElem).
 		panic(lexError{tok.AsError()})
 	}
+	if t.budget > 0 {
+		t.used += tokenCost + int64(len(tok.val))
+		if end := int64(tok.pos.Offset + len(tok.val)); t.keepSrc && end > t.srcUsed {
+			t.used += end - t.srcUsed
+			t.srcUsed = end
+		}
+		if t.used > t.budget {
+			panic(&BudgetError{Name: tok.pos.Name, Budget: t.budget})
+		}
+	}
 	return tok
 }
 
@@ -99,7 +133,7 @@ func (t *Tree) peek() token {
 	return t.tok
 }
 
-func (t *Tree) errorf(pos *Pos, format string, args ...interface{}) {
+func (t *Tree) errorf(pos Pos, format string, args ...interface{}) {
 	panic(parseError{pos.FormatError("parse", fmt.Sprintf(format, args...))})
 }
 
@@ -107,6 +141,75 @@ func (t *Tree) unexpected(tok token) { t.errorf(tok.pos, "unexpected token %q",
 
 func (t *Tree) unexpectedEOF(tok token) { t.errorf(tok.pos, "unexpected EOF") }
 
+// unclosed reports the end of the input within a sequence. When recovering
+// from errors, the error is recorded (unless one has been already for the
+// end of the input), and the sequence is closed.
+func (t *Tree) unclosed(tok token) {
+	if t.read == nil {
+		t.unexpectedEOF(tok)
+	}
+	if !t.atEOF {
+		t.errs = append(t.errs, tok.pos.FormatError("parse", "unexpected EOF"))
+		t.atEOF = true
+	}
+}
+
+// parseElem parses the next item of a sequence, or of the top level. When
+// recovering from errors, a syntax error is recorded and the text of the
+// item becomes an ErrorNode: its tokens up to and including the one where
+// the error was found (unless that closes a sequence, in which case it is
+// left to close the enclosing one), or, for an error from the lexer such as
+// an unterminated string, the rest of the input.
+func (t *Tree) parseElem() (n Node) {
+	if t.read == nil {
+		return t.parseNext()
+	}
+	var start Pos
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+		pe, ok := e.(parseError)
+		if !ok {
+			panic(e)
+		}
+		err := pe.err
+		end := t.tok.pos.Offset + len(t.tok.val)
+		switch t.tok.typ {
+		case tokRightParen, tokRightBracket, tokRightBrace:
+			if t.tok.pos.Offset > start.Offset {
+				t.backup()
+				end = t.tok.pos.Offset
+			}
+		case tokEOF:
+			t.atEOF = true
+		case tokError:
+			err = t.tok.AsError()
+			if _, ok := err.(*EncodingError); ok {
+				panic(lexError{err})
+			}
+			// The lexer stops at an error, so the rest of the
+			// input is read into t.read for the ErrorNode.
+			if _, err := io.Copy(ioutil.Discard, t.lex.input); err != nil {
+				panic(lexError{err})
+			}
+			end = t.read.Len()
+			t.atEOF = true
+		}
+		t.errs = append(t.errs, err)
+		text := string(t.read.Bytes()[start.Offset:end])
+		n = &ErrorNode{Pos: start, Text: text, Err: err}
+		*n.End() = advance(start, text)
+	}()
+	tok := t.peek()
+	if tok.typ == tokEOF {
+		return nil
+	}
+	start = tok.pos
+	return t.parseNext()
+}
+
 // ParseOpts is a bitset of parsing options for Reader and File.
 type ParseOpts uint
 
@@ -114,16 +217,95 @@ const (
 	// IncludeNonSemantic makes the parser include non-semantic nodes:
 	// CommentNodes and NewlineNodes.
 	IncludeNonSemantic ParseOpts = 1 << iota
+	// ReplaceInvalidUTF8 makes the parser read each byte of the input
+	// which isn't part of valid UTF-8 as U+FFFD (the replacement
+	// character), as Go's string conversions do. Otherwise, parsing
+	// stops at the first such byte with an *EncodingError. Positions
+	// still count the bytes of the input, so they may not match the
+	// lengths of the replaced text.
+	ReplaceInvalidUTF8
+	// Recover makes Reader and File parse input with syntax errors, as
+	// code being edited often has: rather than stopping at the first
+	// error, the parser puts an ErrorNode in the tree in place of the text
+	// where it was found and carries on. The sequences left open at the
+	// end of the input are closed. Along with the tree, Reader and File
+	// return an ErrorList of the errors found, if there are any. (Errors
+	// which aren't syntax errors, such as an *EncodingError, stop
+	// parsing as usual.) Recover has no effect on a Stream.
+	Recover
 )
 
+// An ErrorList is the error returned, along with the tree, by Reader and
+// File for input with syntax errors parsed with Recover. The errors are in
+// the order they were found.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
 func Reader(r io.Reader, filename string, opts ParseOpts) (*Tree, error) {
+	return ReaderBudget(r, filename, opts, 0)
+}
+
+// tokenCost is a rough estimate of the memory used by the node(s) built from
+// a single token, apart from the token's text.
+const tokenCost = 96
+
+// A BudgetError is returned when parsing would use more memory than its
+// budget allows.
+type BudgetError struct {
+	Name   string // the name of the input
+	Budget int64
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s: parsing needs more than the memory budget of %d bytes", e.Name, e.Budget)
+}
+
+// ReaderBudget is like Reader, but it returns a *BudgetError if the parsed
+// tree would use more than approximately budget bytes of memory, counting the
+// copy of the source which the tree keeps (see Tree.Source). A budget of zero
+// or less means there is no limit.
+func ReaderBudget(r io.Reader, filename string, opts ParseOpts, budget int64) (*Tree, error) {
+	// Keep the source in case the delimiters are unbalanced, for
+	// FixDelims.
+	var src bytes.Buffer
+	br := bufio.NewReader(io.TeeReader(r, &src))
 	t := &Tree{
 		includeNonSemantic: opts&IncludeNonSemantic != 0,
-		lex:                lex(filename, bufio.NewReader(r)),
+		lex:                lex(filename, br),
+		budget:             budget,
+		keepSrc:            true,
+	}
+	t.lex.replaceInvalid = opts&ReplaceInvalidUTF8 != 0
+	if opts&Recover != 0 {
+		t.read = &src
 	}
 	if err := t.parse(); err != nil {
+		switch err.(type) {
+		case *BudgetError, *EncodingError:
+			return nil, err
+		}
+		if _, err := io.Copy(ioutil.Discard, br); err != nil {
+			return nil, err
+		}
+		if fix := FixDelims(src.Bytes(), filename); fix != nil {
+			return nil, &DelimError{Err: err, Fix: fix}
+		}
 		return nil, err
 	}
+	t.src = src.Bytes()
+	t.read = nil
+	if len(t.errs) > 0 {
+		return t, t.errs
+	}
 	return t, nil
 }
 
@@ -136,28 +318,50 @@ func File(filename string, opts ParseOpts) (*Tree, error) {
 	return Reader(f, filename, opts)
 }
 
-// parseNext parses the next top-level item from the token stream.
-// It returns nil if there are no non-EOF tokens left in the stream.
+// parseNext parses the next top-level item from the token stream, recording
+// its end. It returns nil if there are no non-EOF tokens left in the stream.
 func (t *Tree) parseNext() Node {
+	n := t.parseNode()
+	if n != nil {
+		// Every node ends with the last token it consumed.
+		*n.End() = advance(t.tok.pos, t.tok.val)
+	}
+	return n
+}
+
+// advance returns the position just past text, which starts at pos.
+func advance(pos Pos, text string) Pos {
+	for i := 0; i < len(text); i++ {
+		pos.Offset++
+		pos.Col++
+		if text[i] == '\n' {
+			pos.Line++
+			pos.Col = 1
+		}
+	}
+	return pos
+}
+
+func (t *Tree) parseNode() Node {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokSymbol:
 			switch val := tok.val; val {
 			case "nil":
-				return &NilNode{tok.pos}
+				return &NilNode{Pos: tok.pos}
 			case "true", "false":
-				return &BoolNode{tok.pos, val == "true"}
+				return &BoolNode{Pos: tok.pos, Val: val == "true"}
 			default:
-				return &SymbolNode{tok.pos, tok.val}
+				return &SymbolNode{Pos: tok.pos, Val: tok.val}
 			}
 		case tokCharLiteral:
 			return t.parseCharLiteral(tok)
 		case tokComment:
-			return &CommentNode{tok.pos, tok.val}
+			return &CommentNode{Pos: tok.pos, Text: tok.val}
 		case tokAtSign:
-			return &DerefNode{tok.pos, t.parseNextSemantic()}
+			return &DerefNode{Pos: tok.pos, Node: t.parseNextSemantic()}
 		case tokKeyword:
-			return &KeywordNode{tok.pos, tok.val}
+			return &KeywordNode{Pos: tok.pos, Val: tok.val}
 		case tokLeftParen:
 			return t.parseList(tok)
 		case tokLeftBrace:
@@ -165,26 +369,28 @@ func (t *Tree) parseNext() Node {
 		case tokCircumflex:
 			return t.parseMetadata(tok)
 		case tokNewline:
-			return &NewlineNode{tok.pos}
+			return &NewlineNode{Pos: tok.pos}
 		case tokNumber:
 			// TODO: need to parse the number here; a number token may not be valid.
-			return &NumberNode{tok.pos, tok.val}
+			return &NumberNode{Pos: tok.pos, Val: tok.val}
 		case tokApostrophe:
-			return &QuoteNode{tok.pos, t.parseNextSemantic()}
+			return &QuoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
 		case tokString:
-			return &StringNode{tok.pos, tok.val[1 : len(tok.val)-1]}
+			return &StringNode{Pos: tok.pos, Val: tok.val[1 : len(tok.val)-1]}
 		case tokBacktick:
-			return &SyntaxQuoteNode{tok.pos, t.parseNextSemantic()}
+			return &SyntaxQuoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
 		case tokTilde:
 			next := t.next()
-			switch next.typ {
-			case tokAtSign:
-				return &UnquoteSpliceNode{tok.pos, t.parseNextSemantic()}
-			case tokEOF:
+			switch {
+			case next.typ == tokAtSign && next.pos.Offset == tok.pos.Offset+1:
+				// With whitespace between them, as in ~ @x, the
+				// @ is a deref rather than part of a ~@.
+				return &UnquoteSpliceNode{Pos: tok.pos, Node: t.parseNextSemantic()}
+			case next.typ == tokEOF:
 				t.unexpectedEOF(next)
 			}
 			t.backup()
-			return &UnquoteNode{tok.pos, t.parseNextSemantic()}
+			return &UnquoteNode{Pos: tok.pos, Node: t.parseNextSemantic()}
 		case tokLeftBracket:
 			return t.parseVector(tok)
 		case tokDispatch:
@@ -258,7 +464,7 @@ func (t *Tree) parseCharLiteral(tok token) Node {
 			}
 		}
 	}
-	return &CharacterNode{tok.pos, r, tok.val}
+	return &CharacterNode{Pos: tok.pos, Val: r, Text: tok.val}
 }
 
 func (t *Tree) parseList(start token) Node {
@@ -266,12 +472,13 @@ func (t *Tree) parseList(start token) Node {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokRightParen:
-			return &ListNode{start.pos, nodes}
+			return &ListNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
-			t.unexpectedEOF(tok)
+			t.unclosed(tok)
+			return &ListNode{Pos: start.pos, Nodes: nodes}
 		}
 		t.backup()
-		node := t.parseNext()
+		node := t.parseElem()
 		if t.includeNonSemantic || isSemantic(node) {
 			nodes = append(nodes, node)
 		}
@@ -283,12 +490,13 @@ func (t *Tree) parseMap(start token) Node {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokRightBrace:
-			return &MapNode{start.pos, nodes}
+			return &MapNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
-			t.unexpectedEOF(tok)
+			t.unclosed(tok)
+			return &MapNode{Pos: start.pos, Nodes: nodes}
 		}
 		t.backup()
-		node := t.parseNext()
+		node := t.parseElem()
 		if t.includeNonSemantic || isSemantic(node) {
 			nodes = append(nodes, node)
 		}
@@ -300,12 +508,13 @@ func (t *Tree) parseVector(start token) Node {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokRightBracket:
-			return &VectorNode{start.pos, nodes}
+			return &VectorNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
-			t.unexpectedEOF(tok)
+			t.unclosed(tok)
+			return &VectorNode{Pos: start.pos, Nodes: nodes}
 		}
 		t.backup()
-		node := t.parseNext()
+		node := t.parseElem()
 		if t.includeNonSemantic || isSemantic(node) {
 			nodes = append(nodes, node)
 		}
@@ -340,7 +549,9 @@ func (t *Tree) parseTag(start token) Node {
 	tok := t.next()
 	switch tok.typ {
 	case tokSymbol:
-		return &TagNode{start.pos, tok.val}
+		return &TagNode{Pos: start.pos, Val: tok.val}
+	case tokKeyword:
+		return t.parseNamespacedMap(start, tok)
 	case tokEOF:
 		t.unexpectedEOF(tok)
 	default:
@@ -349,26 +560,71 @@ func (t *Tree) parseTag(start token) Node {
 	panic("not reached")
 }
 
+// parseNamespacedMap parses a map with a namespace, such as #:user{:id 1},
+// after the keyword giving the namespace.
+func (t *Tree) parseNamespacedMap(start, ns token) Node {
+	if ns.pos.Offset != start.pos.Offset {
+		t.unexpected(ns)
+	}
+	if strings.Contains(ns.val, "/") || ns.val != "::" && strings.HasSuffix(ns.val, ":") {
+		t.errorf(ns.pos, "invalid namespaced map prefix %q", ns.val)
+	}
+	tok := t.next()
+	switch tok.typ {
+	case tokLeftBrace:
+	case tokEOF:
+		t.unexpectedEOF(tok)
+	default:
+		t.unexpected(tok)
+	}
+	// The lexer places the octothorpe after the #.
+	pos := start.pos
+	pos.Offset--
+	pos.Col--
+	var nodes []Node
+	for {
+		switch tok := t.next(); tok.typ {
+		case tokRightBrace:
+			return &NamespacedMapNode{Pos: pos, Namespace: ns.val, Nodes: nodes}
+		case tokEOF:
+			t.unclosed(tok)
+			return &NamespacedMapNode{Pos: pos, Namespace: ns.val, Nodes: nodes}
+		}
+		t.backup()
+		node := t.parseElem()
+		if t.includeNonSemantic || isSemantic(node) {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
 func (t *Tree) parseFnLiteral(start token) Node {
 	if t.inLambda {
-		t.errorf(start.pos, "cannot nest fn literals")
+		err := start.pos.FormatError("parse", "cannot nest fn literals")
+		if t.read == nil {
+			panic(parseError{err})
+		}
+		// Parse the inner fn literal anyway, as it is more likely to
+		// be a mistake than the start of some other form.
+		t.errs = append(t.errs, err)
 	}
 	tok := t.next()
 	if tok.typ != tokLeftParen {
 		panic("should not happen")
 	}
+	defer func(inLambda bool) { t.inLambda = inLambda }(t.inLambda)
 	t.inLambda = true
 	var nodes []Node
 	for {
 		switch tok = t.next(); tok.typ {
 		case tokRightParen:
-			t.inLambda = false
-			return &FnLiteralNode{start.pos, nodes}
+			return &FnLiteralNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
-			t.unexpectedEOF(tok)
+			t.unclosed(tok)
+			return &FnLiteralNode{Pos: start.pos, Nodes: nodes}
 		}
 		t.backup()
-		node := t.parseNext()
+		node := t.parseElem()
 		if t.includeNonSemantic || isSemantic(node) {
 			nodes = append(nodes, node)
 		}
@@ -381,7 +637,7 @@ func (t *Tree) parseMetadata(start token) Node {
 		t.unexpectedEOF(tok)
 	}
 	t.backup()
-	return &MetadataNode{start.pos, t.parseNext()}
+	return &MetadataNode{Pos: start.pos, Node: t.parseNext()}
 }
 
 func (t *Tree) parseReaderDiscard(start token) Node {
@@ -390,7 +646,7 @@ func (t *Tree) parseReaderDiscard(start token) Node {
 		t.unexpectedEOF(tok)
 	}
 	t.backup()
-	return &ReaderDiscardNode{start.pos, t.parseNext()}
+	return &ReaderDiscardNode{Pos: start.pos, Node: t.parseNext()}
 }
 
 func (t *Tree) parseReaderEval(start token) Node {
@@ -399,7 +655,7 @@ func (t *Tree) parseReaderEval(start token) Node {
 		t.unexpectedEOF(tok)
 	}
 	t.backup()
-	return &ReaderEvalNode{start.pos, t.parseNext()}
+	return &ReaderEvalNode{Pos: start.pos, Node: t.parseNext()}
 }
 
 func (t *Tree) parseRegex(start token) Node {
@@ -407,7 +663,7 @@ func (t *Tree) parseRegex(start token) Node {
 	if tok.typ != tokString {
 		panic("should not happen")
 	}
-	return &RegexNode{start.pos, tok.val[1 : len(tok.val)-1]}
+	return &RegexNode{Pos: start.pos, Val: tok.val[1 : len(tok.val)-1]}
 }
 
 func (t *Tree) parseSet(start token) Node {
@@ -419,12 +675,13 @@ func (t *Tree) parseSet(start token) Node {
 	for {
 		switch tok := t.next(); tok.typ {
 		case tokRightBrace:
-			return &SetNode{start.pos, nodes}
+			return &SetNode{Pos: start.pos, Nodes: nodes}
 		case tokEOF:
-			t.unexpectedEOF(tok)
+			t.unclosed(tok)
+			return &SetNode{Pos: start.pos, Nodes: nodes}
 		}
 		t.backup()
-		node := t.parseNext()
+		node := t.parseElem()
 		if t.includeNonSemantic || isSemantic(node) {
 			nodes = append(nodes, node)
 		}
@@ -434,7 +691,7 @@ func (t *Tree) parseSet(start token) Node {
 func (t *Tree) parseVarQuote(start token) Node {
 	switch tok := t.next(); tok.typ {
 	case tokSymbol:
-		return &VarQuoteNode{start.pos, tok.val}
+		return &VarQuoteNode{Pos: start.pos, Val: tok.val}
 	case tokEOF:
 		t.unexpectedEOF(tok)
 	default:
@@ -1,6 +1,10 @@
 package parse
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
@@ -32,7 +36,9 @@ var testCases = []struct {
 	{"#foo", "tag(foo)"},
 	{"~foo", "unquote"},
 	{"~@foo", "unquote splice"},
+	{"~ @foo", "unquote"},
 	{"#'asdf", "varquote(asdf)"},
+	{"#:foo{:a b :c d}", "nsmap(:foo, length=2)"},
 	{"[a b c]", "vector(length=3)"},
 
 	// issue 13
@@ -43,6 +49,11 @@ var testCases = []struct {
 	{"#^foo", "metadata"},
 	{"#! hello!", `comment("#! hello!")`},
 
+	// namespaced maps
+	{"#::{:a b}", "nsmap(::, length=1)"},
+	{"#::s{}", "nsmap(::s, length=0)"},
+	{"#:foo {:a b}", "nsmap(:foo, length=1)"},
+
 	// issue 35
 	{"a%b%", "sym(a%b%)"},
 	{":100%>50%", "keyword(:100%>50%)"},
@@ -64,6 +75,14 @@ func TestAll(t *testing.T) {
 	}
 }
 
+func TestInvalidNamespacedMaps(t *testing.T) {
+	for _, s := range []string{"#:a/b{}", "# :a{}", "#:a[]", "#:a"} {
+		if _, err := Reader(strings.NewReader(s), "temp", IncludeNonSemantic); err == nil {
+			t.Errorf("got nil error parsing %q", s)
+		}
+	}
+}
+
 // Issue 32.
 func TestUnreadable(t *testing.T) {
 	_, err := Reader(strings.NewReader("#<X Y Z>"), "temp", IncludeNonSemantic)
@@ -75,6 +94,134 @@ func TestUnreadable(t *testing.T) {
 	}
 }
 
+func TestInvalidUTF8(t *testing.T) {
+	const input = "(a \"b\")\n(c \xffd \"\xe2\x82\")"
+	_, err := Reader(strings.NewReader(input), "temp", IncludeNonSemantic)
+	encErr, ok := err.(*EncodingError)
+	if !ok {
+		t.Fatalf("got error %v; want *EncodingError", err)
+	}
+	if want := (Pos{Name: "temp", Offset: 11, Line: 2, Col: 4}); encErr.Pos != want {
+		t.Errorf("got error at %s; want %s", &encErr.Pos, &want)
+	}
+
+	tree, err := Reader(strings.NewReader(input), "temp", ReplaceInvalidUTF8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := tree.flatStrings()
+	want := []string{"list(length=2)", "sym(a)", `string("b")`, "list(length=3)", "sym(c)", "sym(\ufffdd)", "string(\"\ufffd\ufffd\")"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with ReplaceInvalidUTF8, got %q; want %q", got, want)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  []string
+		errs  []string
+	}{
+		{
+			"(a ]) (b)",
+			[]string{"list(length=2)", "sym(a)", `error("]")`, "list(length=1)", "sym(b)"},
+			[]string{"temp:1:4: unexpected token"},
+		},
+		{
+			"(f ') x)",
+			[]string{"list(length=2)", "sym(f)", `error("'")`, "sym(x)", `error(")")`},
+			[]string{"temp:1:5: unexpected token", "temp:1:8: unexpected token"},
+		},
+		{
+			"(a [b\n",
+			[]string{"list(length=2)", "sym(a)", "vector(length=1)", "sym(b)"},
+			[]string{"temp:2:1: unexpected EOF"},
+		},
+		{
+			"(a \"b) c",
+			[]string{"list(length=2)", "sym(a)", `error("\"b) c")`},
+			[]string{"temp:1:4: reached EOF"},
+		},
+		{
+			"#(a #(b %)) \\bad",
+			[]string{"lambda(length=2)", "sym(a)", "lambda(length=2)", "sym(b)", "sym(%)", `error("\\bad")`},
+			[]string{"temp:1:5: cannot nest", "temp:1:13: invalid character literal"},
+		},
+		{
+			"(a 'b)",
+			[]string{"list(length=2)", "sym(a)", "quote", "sym(b)"},
+			nil,
+		},
+	} {
+		tree, err := Reader(strings.NewReader(tc.input), "temp", Recover)
+		if tree == nil {
+			t.Fatalf("%q: got nil tree and error %v", tc.input, err)
+		}
+		if got := tree.flatStrings(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got nodes %q; want %q", tc.input, got, tc.want)
+		}
+		if tc.errs == nil {
+			if err != nil {
+				t.Errorf("%q: got error %v", tc.input, err)
+			}
+			continue
+		}
+		errs, ok := err.(ErrorList)
+		if !ok || len(errs) != len(tc.errs) {
+			t.Errorf("%q: got error %v; want %d errors", tc.input, err, len(tc.errs))
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), tc.errs[i]) {
+				t.Errorf("%q: got error %q; want it to contain %q", tc.input, err, tc.errs[i])
+			}
+		}
+	}
+	if _, err := Reader(strings.NewReader("(a \xff)"), "temp", Recover); err == nil {
+		t.Error("got no error for invalid UTF-8")
+	} else if _, ok := err.(*EncodingError); !ok {
+		t.Errorf("got error %v for invalid UTF-8; want *EncodingError", err)
+	}
+}
+
+func TestScanner(t *testing.T) {
+	const input = "(f #{:a} #\"x+\")\n#inst \"2020\" #'v ; c"
+	s := NewScanner(strings.NewReader(input), "temp", 0)
+	var got []string
+	for {
+		tok, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if input[tok.Pos.Offset:tok.Pos.Offset+len(tok.Val)] != tok.Val {
+			t.Errorf("token %s %q at offset %d doesn't match the input", tok.Type, tok.Val, tok.Pos.Offset)
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%d(%s)", tok.Type, tok.Pos.Line, tok.Pos.Col, tok.Val))
+	}
+	want := []string{
+		"left-paren:1:1(()", "symbol:1:2(f)", "dispatch:1:4(#)", "left-brace:1:5({)",
+		"keyword:1:6(:a)", "right-brace:1:8(})", "dispatch:1:10(#)", `string:1:11("x+")`,
+		"right-paren:1:15())", "newline:1:16(\n)", "octothorpe:2:1(#)", "symbol:2:2(inst)",
+		`string:2:7("2020")`, "dispatch:2:14(#')", "symbol:2:16(v)", "comment:2:18(; c)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got tokens\n%q\nwant\n%q", got, want)
+	}
+
+	s = NewScanner(strings.NewReader("(a \"b"), "temp", 0)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Next(); err == nil || err == io.EOF {
+		t.Fatalf("got error %v for unterminated string", err)
+	}
+}
+
 // Issue 33.
 func TestCommentCarriageReturn(t *testing.T) {
 	const input = "3;a\r4"
@@ -140,3 +287,486 @@ func (t *Tree) flatStrings() []string {
 	}
 	return nodes
 }
+
+func TestDispatchPositions(t *testing.T) {
+	const input = "#{1} #(+ %) #_x #'y #\"re\""
+	tree, err := Reader(strings.NewReader(input), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, root := range tree.Roots {
+		got = append(got, root.Position().Offset)
+	}
+	want := []int{0, 5, 12, 16, 20}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got offsets %v; want %v", got, want)
+	}
+}
+
+func TestStream(t *testing.T) {
+	const input = "(a b)\n; c\n[d] e"
+	for _, opts := range []ParseOpts{0, IncludeNonSemantic} {
+		tree, err := Reader(strings.NewReader(input), "temp", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, n := range tree.Roots {
+			want = append(want, n.String())
+		}
+		s := NewStream(strings.NewReader(input), "temp", opts)
+		var got []string
+		for {
+			n, err := s.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, n.String())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("with opts %d: got %q; want %q", opts, got, want)
+		}
+	}
+
+	s := NewStream(strings.NewReader("(a) (b"), "temp", 0)
+	if _, err := s.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Next()
+	if err == nil || err == io.EOF || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Fatalf("got error %v; want unexpected EOF", err)
+	}
+	if _, err2 := s.Next(); err2 != err {
+		t.Errorf("after error, got %v; want %v", err2, err)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	const input = "(a b c)\n(d e f)\n"
+	if _, err := ReaderBudget(strings.NewReader(input), "temp", 0, 10000); err != nil {
+		t.Fatalf("with large budget: %s", err)
+	}
+	_, err := ReaderBudget(strings.NewReader(input), "temp", 0, 1000)
+	if _, ok := err.(*BudgetError); !ok {
+		t.Fatalf("with small budget: got error %v; want *BudgetError", err)
+	}
+	// The source kept by the tree counts too.
+	padded := "(a" + strings.Repeat(" ", 2000) + "b)\n"
+	_, err = ReaderBudget(strings.NewReader(padded), "temp", 0, 1000)
+	if _, ok := err.(*BudgetError); !ok {
+		t.Fatalf("with small budget for the source: got error %v; want *BudgetError", err)
+	}
+
+	// The budget of a Stream applies to each form.
+	s := NewStream(strings.NewReader(input), "temp", 0)
+	s.SetBudget(1000)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s = NewStream(strings.NewReader(input), "temp", 0)
+	s.SetBudget(100)
+	if _, err := s.Next(); err == nil {
+		t.Fatal("got nil error with small stream budget")
+	}
+}
+
+func TestKinds(t *testing.T) {
+	for _, tc := range testCases {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := tree.Roots[0]
+		k := KindOf(n)
+		if k == KindInvalid {
+			t.Errorf("%q: got KindInvalid", tc.s)
+			continue
+		}
+		k2, err := ParseKind(k.String())
+		if err != nil || k2 != k {
+			t.Errorf("%q: ParseKind(%q) = %v, %v", tc.s, k, k2, err)
+		}
+		if got, want := k.Is(CategoryNonSemantic), !isSemantic(n); got != want {
+			t.Errorf("%q: got non-semantic %t; want %t", tc.s, got, want)
+		}
+	}
+	infos := Kinds()
+	for i, info := range infos {
+		if info.Kind != Kind(i+1) {
+			t.Errorf("Kinds()[%d] is %v", i, info.Kind)
+		}
+	}
+	if infos[len(infos)-1].Kind != KindNamespacedMap {
+		t.Errorf("last kind is %v; want namespaced-map", infos[len(infos)-1].Kind)
+	}
+	if !KindSet.Is(CategoryCollection) || KindSymbol.Is(CategoryLiteral) {
+		t.Error("wrong categories")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	f := Capabilities()
+	if f.Version != FeaturesVersion {
+		t.Errorf("got version %d", f.Version)
+	}
+	if len(f.Kinds) != len(Kinds()) {
+		t.Fatalf("got %d kinds; want %d", len(f.Kinds), len(Kinds()))
+	}
+	for i, name := range f.Kinds {
+		if k, err := ParseKind(name); err != nil || k != Kind(i+1) {
+			t.Errorf("kind %d: ParseKind(%q) = %v, %v", i, name, k, err)
+		}
+	}
+	if want := []string{"include-non-semantic", "replace-invalid-utf8", "recover"}; !reflect.DeepEqual(f.Options, want) {
+		t.Errorf("got options %q; want %q", f.Options, want)
+	}
+}
+
+func TestSemanticChildren(t *testing.T) {
+	const input = "(a ; b\n c\n\n d)"
+	tree, err := Reader(strings.NewReader(input), "temp", IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := tree.Roots[0]
+	nodes, indexes := SemanticChildren(list)
+	var got []string
+	for i, n := range nodes {
+		if list.Children()[indexes[i]] != n {
+			t.Errorf("index %d of node %s is wrong", indexes[i], n)
+		}
+		got = append(got, n.String())
+	}
+	want := []string{"sym(a)", "sym(c)", "sym(d)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if want := []int{0, 3, 6}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("got indexes %v; want %v", indexes, want)
+	}
+}
+
+func TestClearPositions(t *testing.T) {
+	tree, err := Reader(strings.NewReader("(a [b ^c d])"), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ClearPositions(tree.Roots[0])
+	var visit func(n Node)
+	visit = func(n Node) {
+		if *n.Position() != (Pos{}) {
+			t.Errorf("%s has position %s", n, n.Position())
+		}
+		for _, child := range n.Children() {
+			visit(child)
+		}
+	}
+	visit(tree.Roots[0])
+}
+
+func TestEdit(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		op   string
+		i    int    // semantic index of the anchor
+		want string // children, with newlines as "/"
+	}{
+		{"[a b]", "after", 0, "a x b"},
+		{"[a\nb]", "after", 0, "a / x / b"},
+		{"[a ; c\nb]", "after", 0, "a ; c / x / b"},
+		{"[a b\nc]", "after", 0, "a / x / b / c"},
+		{"[a\nb]", "after", 1, "a / b / x"},
+		{"[a b]", "before", 1, "a x b"},
+		{"[a\nb]", "before", 1, "a / x / b"},
+		{"[a\n; c\nb]", "before", 1, "a / x / ; c / b"},
+		{"[a b\nc]", "before", 1, "a / x / b / c"},
+		{"[a b c]", "remove", 1, "a c"},
+		{"[a\nb\nc]", "remove", 1, "a / c"},
+		{"[a\nb ; c\nd]", "remove", 1, "a / d"},
+		{"[a ; c\nb]", "remove", 1, "a ; c /"},
+		{"[a\nb]", "remove", 0, "b"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.s), "temp", IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := tree.Roots[0]
+		sem, _ := SemanticChildren(v)
+		x := &SymbolNode{Val: "x"}
+		var ok bool
+		switch tc.op {
+		case "after":
+			ok = InsertAfter(v, sem[tc.i], x)
+		case "before":
+			ok = InsertBefore(v, sem[tc.i], x)
+		case "remove":
+			ok = RemoveChild(v, sem[tc.i])
+		}
+		if !ok {
+			t.Errorf("%s %q: anchor not found", tc.op, tc.s)
+			continue
+		}
+		var got []string
+		for _, n := range v.Children() {
+			switch n := n.(type) {
+			case *SymbolNode:
+				got = append(got, n.Val)
+			case *NewlineNode:
+				got = append(got, "/")
+			case *CommentNode:
+				got = append(got, n.Text)
+			}
+		}
+		if s := strings.Join(got, " "); s != tc.want {
+			t.Errorf("%s %q: got %q; want %q", tc.op, tc.s, s, tc.want)
+		}
+	}
+	if InsertAfter(&VectorNode{}, &SymbolNode{}, &SymbolNode{}) {
+		t.Error("InsertAfter with a missing anchor reported success")
+	}
+}
+
+// BenchmarkLex measures the lexer alone; the bench package has the
+// benchmarks for parsing and printing.
+func BenchmarkLex(b *testing.B) {
+	const form = `
+(defn f
+  "Docstring." ; comment
+  [{:keys [a b] :as m} & args]
+  (let [x #{:a 'b \c 1.5}]
+    (-> m (assoc :a @x) (update :b #(+ % 1)))))
+`
+	input := strings.Repeat(form, 1000)
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := lex("bench", bufio.NewReader(strings.NewReader(input)))
+		for {
+			tok := l.nextToken()
+			if tok.typ == tokError {
+				b.Fatal(tok.AsError())
+			}
+			if tok.typ == tokEOF {
+				break
+			}
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	const input = `(a "b\"" [c ; d
+  ]  #{} #(e %) ^:f g 'h @i #_j #"k" \l #m n #'o {:p 1 ,} #::q {} true nil)`
+	for _, opts := range []ParseOpts{0, IncludeNonSemantic} {
+		tree, err := Reader(strings.NewReader(input), "temp", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range tree.Roots[0].Children() {
+			if _, ok := n.(*NewlineNode); ok {
+				continue
+			}
+			got = append(got, input[n.Position().Offset:End(n, []byte(input))])
+		}
+		// (A tag's position is that of its name.)
+		want := []string{
+			"a", `"b\""`, "[c ; d\n  ]", "#{}", "#(e %)", "^:f", "g", "'h", "@i", "#_j",
+			`#"k"`, `\l`, "m", "n", "#'o", "{:p 1 ,}", "#::q {}", "true",
+			"nil",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("with opts %d: got %q; want %q", opts, got, want)
+		}
+		if end := End(tree.Roots[0], []byte(input)); end != len(input) {
+			t.Errorf("with opts %d: got end %d for the list; want %d", opts, end, len(input))
+		}
+		// The ends recorded by the parser agree.
+		var check func(n Node)
+		check = func(n Node) {
+			off := End(n, []byte(input))
+			want := Pos{Name: "temp", Offset: off, Line: 1 + strings.Count(input[:off], "\n")}
+			want.Col = off - strings.LastIndex(input[:off], "\n")
+			if got := *n.End(); got != want {
+				t.Errorf("with opts %d: got end %s (offset %d) for %s; want %s (offset %d)",
+					opts, &got, got.Offset, n, &want, want.Offset)
+			}
+			for _, child := range n.Children() {
+				check(child)
+			}
+		}
+		check(tree.Roots[0])
+	}
+}
+
+func TestFixDelims(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string // the fix, or empty if there is none
+	}{
+		{"(defn f [x]\n  (inc x))\n", ""},
+		{"(defn f [x]\n  (inc x)\n", "insert ) at 2:10"},
+		{"(defn f [x]\n  (let [y x]\n    (inc y)\n  y)\n\n(defn g [])\n", "insert ) at 3:12"},
+		{"(defn f [x]\n  (inc x)))\n", "remove ) at 2:11"},
+		{"(defn f [x]\n  (inc x))\n  (dec x))\n", "remove ) at 2:10"},
+		{"(let [x 1)\n  x)\n", "replace ) with ] at 1:10"},
+		{"(f \"(\" [a b)\n", "insert ] at 1:12"},
+		{"(f ; )\n  {:a 1\n   :b 2)\n", "insert } at 3:8"},
+	} {
+		_, err := Reader(strings.NewReader(tt.in), "temp", IncludeNonSemantic)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("for %q, got error: %s", tt.in, err)
+			}
+			continue
+		}
+		de, ok := err.(*DelimError)
+		if !ok {
+			t.Errorf("for %q, got err=%v; want a *DelimError", tt.in, err)
+			continue
+		}
+		if de.Fix == nil {
+			t.Errorf("for %q, got no fix; want %s", tt.in, tt.want)
+			continue
+		}
+		if got := de.Fix.String(); got != tt.want {
+			t.Errorf("for %q, got fix %q; want %q", tt.in, got, tt.want)
+			continue
+		}
+		if _, err := Reader(bytes.NewReader(de.Fix.Apply([]byte(tt.in))), "temp", 0); err != nil {
+			t.Errorf("for %q, the fix doesn't parse: %s", tt.in, err)
+		}
+	}
+}
+
+func TestNodeAt(t *testing.T) {
+	src := "(ns foo)\n\n(defn f [x] ; doc\n  (inc 'x))\n"
+	tree, err := Reader(strings.NewReader(src), "temp", IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		line, col int
+		want      []string
+	}{
+		{1, 1, []string{"list(length=2)"}},
+		{1, 6, []string{"sym(foo)", "list(length=2)"}},
+		{2, 1, []string{"newline"}},
+		{3, 10, []string{"sym(x)", "vector(length=1)", "list(length=4)"}},
+		{3, 12, []string{"list(length=4)"}},
+		{3, 15, []string{"comment(\"; doc\")", "list(length=4)"}},
+		{4, 9, []string{"sym(x)", "quote", "list(length=2)", "list(length=4)"}},
+		{4, 11, []string{"list(length=4)"}},
+		{4, 12, []string{"newline"}},
+		{4, 13, nil},
+		{5, 1, nil},
+		{0, 1, nil},
+	} {
+		var got []string
+		for _, n := range tree.EnclosingForms(tt.line, tt.col) {
+			got = append(got, n.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EnclosingForms(%d, %d): got %q; want %q", tt.line, tt.col, got, tt.want)
+		}
+		n := tree.NodeAt(tt.line, tt.col)
+		if (n == nil) != (len(tt.want) == 0) || n != nil && n.String() != tt.want[0] {
+			t.Errorf("NodeAt(%d, %d): got %v; want %q", tt.line, tt.col, n, tt.want)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	const input = "(ns foo) ; x\n(defn ^:private f [x] #{'a @b} #(inc %) #\"re\" #inst \"2020\")\n[]"
+	tree, err := Reader(strings.NewReader(input), "temp", IncludeNonSemantic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := tree.String()
+	cp := tree.Copy()
+	if got := cp.String(); got != want {
+		t.Fatalf("copy differs: got\n%s\nwant\n%s", got, want)
+	}
+	var modify func(nodes []Node)
+	modify = func(nodes []Node) {
+		for _, n := range nodes {
+			n.Position().Line = 0
+			switch n := n.(type) {
+			case *SymbolNode:
+				n.Val = "changed"
+			case *VectorNode:
+				n.Nodes = append(n.Nodes, &NilNode{})
+			}
+			modify(n.Children())
+		}
+	}
+	modify(cp.Roots)
+	cp.Roots = cp.Roots[:1]
+	if got := tree.String(); got != want {
+		t.Errorf("changing the copy changed the tree: got\n%s\nwant\n%s", got, want)
+	}
+	if pos := tree.Roots[0].Position(); pos.Line != 1 {
+		t.Errorf("changing the copy changed a position: got %s", pos)
+	}
+}
+
+func TestRootHelpers(t *testing.T) {
+	show := func(tree *Tree) string {
+		var parts []string
+		for i, n := range tree.Roots {
+			switch n := n.(type) {
+			case *NewlineNode:
+				parts = append(parts, "\n")
+				continue
+			case *SymbolNode:
+				if i > 0 && !isNewline(tree.Roots[i-1]) {
+					parts = append(parts, " ")
+				}
+				parts = append(parts, n.Val)
+			case *CommentNode:
+				if i > 0 && !isNewline(tree.Roots[i-1]) {
+					parts = append(parts, " ")
+				}
+				parts = append(parts, n.Text)
+			}
+		}
+		return strings.Join(parts, "")
+	}
+	x := &SymbolNode{Val: "x"}
+	for _, tc := range []struct {
+		src  string
+		edit func(t *Tree)
+		want string
+	}{
+		{"", func(t *Tree) { t.InsertRoot(0, x) }, "x\n"},
+		{"a\n", func(t *Tree) { t.InsertRoot(1, x) }, "a\n\nx\n"},
+		{"a", func(t *Tree) { t.InsertRoot(1, x) }, "a\n\nx"},
+		{"a\n\n\n", func(t *Tree) { t.InsertRoot(1, x) }, "a\n\n\nx\n"},
+		{"a\n;; b\n;; c\nb\n", func(t *Tree) { t.InsertRoot(1, x) }, "a\n\nx\n\n;; b\n;; c\nb\n"},
+		{"a\nb ; c\n", func(t *Tree) { t.InsertRoot(0, x) }, "x\n\na\nb ; c\n"},
+		{"a\nb ; c\n", func(t *Tree) { t.RemoveRoot(1) }, "a\n"},
+		{"a\n\nb\n", func(t *Tree) { t.RemoveRoot(0) }, "b\n"},
+		{"a\nb\n\n\nc", func(t *Tree) { t.RemoveRoot(1) }, "a\n\n\nc"},
+		{"a\n\nb", func(t *Tree) { t.RemoveRoot(1) }, "a"},
+		{";; a\na\n", func(t *Tree) { t.RemoveRoot(0) }, ";; a\n"},
+		{"a ; c\nb\n", func(t *Tree) { t.ReplaceRoot(0, x) }, "x ; c\nb\n"},
+		{"a\nb\nc\n", func(t *Tree) {
+			a := t.RemoveRoot(0)
+			t.InsertRoot(t.NumRoots(), a)
+		}, "b\nc\n\na\n"},
+	} {
+		tree, err := Reader(strings.NewReader(tc.src), "temp", IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.edit(tree)
+		if got := show(tree); got != tc.want {
+			t.Errorf("for %q: got %q; want %q", tc.src, got, tc.want)
+		}
+	}
+}
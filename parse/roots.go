@@ -0,0 +1,124 @@
+package parse
+
+// The helpers below edit the top level of a tree for programs, such as code
+// generators, which add forms to existing files. They count only the
+// semantic roots of the tree (see SemanticChildren), so that the comments
+// and newlines between forms don't affect the indexes, and they keep those
+// newlines tidy: each inserted form is on lines of its own, with a blank
+// line between it and its neighbors.
+
+// NumRoots returns the number of semantic roots of t: the forms which
+// InsertRoot, RemoveRoot, and ReplaceRoot index.
+func (t *Tree) NumRoots() int { return countSemantic(t.Roots) }
+
+// rootIndex returns the index in t.Roots of the ith semantic root. It panics
+// if there is no such root.
+func (t *Tree) rootIndex(i int) int {
+	for j, n := range t.Roots {
+		if isSemantic(n) {
+			if i == 0 {
+				return j
+			}
+			i--
+		}
+	}
+	panicf("root index out of range")
+	return 0
+}
+
+// InsertRoot inserts node as the ith form of t, where i may be from 0 to
+// t.NumRoots(). The form goes before the ith form and the comments on the
+// lines directly above it (which are taken to belong to that form), or, if
+// i is t.NumRoots(), at the end of t. Newlines are added as needed to leave
+// a blank line on either side of it, and if t is empty or ends with a
+// newline, node is followed by one.
+func (t *Tree) InsertRoot(i int, node Node) {
+	var p int // where node goes in t.Roots
+	if i == t.NumRoots() {
+		p = len(t.Roots)
+	} else {
+		p = t.rootIndex(i)
+		for p >= 2 && isNewline(t.Roots[p-1]) && isComment(t.Roots[p-2]) &&
+			(p == 2 || isNewline(t.Roots[p-3])) {
+			p -= 2
+		}
+	}
+	var before []Node
+	if p > 0 {
+		for n := newlinesBefore(t.Roots, p); n < 2; n++ {
+			before = append(before, &NewlineNode{})
+		}
+	}
+	var after []Node
+	if p < len(t.Roots) {
+		after = []Node{&NewlineNode{}, &NewlineNode{}}
+	} else if p == 0 || isNewline(t.Roots[p-1]) {
+		after = []Node{&NewlineNode{}}
+	}
+	nodes := make([]Node, 0, len(t.Roots)+len(before)+1+len(after))
+	nodes = append(nodes, t.Roots[:p]...)
+	nodes = append(nodes, before...)
+	nodes = append(nodes, node)
+	nodes = append(nodes, after...)
+	t.Roots = append(nodes, t.Roots[p:]...)
+}
+
+// RemoveRoot removes the ith form of t, along with a comment beside it on
+// the same line, and returns the form. The newlines on either side of it
+// are merged, so the blank lines between the forms which were its
+// neighbors are the more of those on either side (at the start of t, none,
+// and at the end, just a final newline if there was one). Comments on the
+// lines above the form are kept.
+func (t *Tree) RemoveRoot(i int) Node {
+	j := t.rootIndex(i)
+	node := t.Roots[j]
+	end := j + 1
+	if end < len(t.Roots) && isComment(t.Roots[end]) {
+		end++
+	}
+	before := newlinesBefore(t.Roots, j)
+	after := 0
+	for end+after < len(t.Roots) && isNewline(t.Roots[end+after]) {
+		after++
+	}
+	start, stop := j-before, end+after
+	keep := before
+	if after > keep {
+		keep = after
+	}
+	switch {
+	case start == 0:
+		keep = 0
+	case stop == len(t.Roots):
+		// Keep a final newline, if there was one.
+		keep = after
+		if keep > 1 {
+			keep = 1
+		}
+	}
+	nodes := make([]Node, 0, len(t.Roots)-(stop-start)+keep)
+	nodes = append(nodes, t.Roots[:start]...)
+	for n := 0; n < keep; n++ {
+		nodes = append(nodes, &NewlineNode{})
+	}
+	t.Roots = append(nodes, t.Roots[stop:]...)
+	return node
+}
+
+// ReplaceRoot replaces the ith form of t with node, leaving the comments and
+// newlines around it as they are, and returns the form it replaced.
+func (t *Tree) ReplaceRoot(i int, node Node) Node {
+	j := t.rootIndex(i)
+	old := t.Roots[j]
+	t.Roots[j] = node
+	return old
+}
+
+// newlinesBefore returns the number of newlines directly before nodes[i].
+func newlinesBefore(nodes []Node, i int) int {
+	n := 0
+	for i-n > 0 && isNewline(nodes[i-n-1]) {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package parse
+
+import (
+	"bufio"
+	"io"
+)
+
+// A TokenType identifies the type of a Token. Like Kinds, token types and
+// their names are stable.
+type TokenType int
+
+const (
+	TokenInvalid TokenType = iota // not a token produced by a Scanner
+
+	TokenApostrophe   // '
+	TokenAtSign       // @
+	TokenBacktick     // `
+	TokenCharLiteral  // \c, \newline, etc
+	TokenCircumflex   // ^
+	TokenComment      // ; foobar (also #! foobar)
+	TokenDispatch     // #' #_ #^ #=, and the # of #{ #( #"
+	TokenKeyword      // :foo
+	TokenLeftBrace    // {
+	TokenLeftBracket  // [
+	TokenLeftParen    // (
+	TokenNewline      // \n
+	TokenNumber       // any numeric literal; may be invalid
+	TokenOctothorpe   // # (the start of a tag)
+	TokenRightBrace   // }
+	TokenRightBracket // ]
+	TokenRightParen   // )
+	TokenString       // "foo"
+	TokenSymbol       // foo, also lambda args (%, %N)
+	TokenTilde        // ~
+)
+
+var tokenTypes = map[tokType]TokenType{
+	tokApostrophe:   TokenApostrophe,
+	tokAtSign:       TokenAtSign,
+	tokBacktick:     TokenBacktick,
+	tokCharLiteral:  TokenCharLiteral,
+	tokCircumflex:   TokenCircumflex,
+	tokComment:      TokenComment,
+	tokDispatch:     TokenDispatch,
+	tokKeyword:      TokenKeyword,
+	tokLeftBrace:    TokenLeftBrace,
+	tokLeftBracket:  TokenLeftBracket,
+	tokLeftParen:    TokenLeftParen,
+	tokNewline:      TokenNewline,
+	tokNumber:       TokenNumber,
+	tokOctothorpe:   TokenOctothorpe,
+	tokRightBrace:   TokenRightBrace,
+	tokRightBracket: TokenRightBracket,
+	tokRightParen:   TokenRightParen,
+	tokString:       TokenString,
+	tokSymbol:       TokenSymbol,
+	tokTilde:        TokenTilde,
+}
+
+// String returns the name of t, such as "left-paren" or "keyword".
+func (t TokenType) String() string {
+	for tt, typ := range tokenTypes {
+		if typ == t {
+			return tt.String()
+		}
+	}
+	return "invalid"
+}
+
+// A Token is a single lexeme of Clojure source, as returned by a Scanner.
+type Token struct {
+	Type TokenType
+	Pos  Pos
+	Val  string // the text of the token, exactly as written
+}
+
+// A Scanner splits its input into tokens without parsing it, for tools such
+// as syntax highlighters which need the lexical structure of code that may
+// be incomplete.
+//
+// Whitespace and commas are skipped, except for newlines, which are
+// returned as TokenNewline tokens; the text between tokens may be recovered
+// from their offsets. Tokens never overlap: the dispatch token of #{, #(,
+// or #" is just the #, and is followed by the token for the delimiter or
+// string.
+type Scanner struct {
+	l   *lexer
+	err error
+}
+
+// NewScanner returns a Scanner which reads tokens from r. The filename is
+// used for the positions of the tokens. Of opts, only ReplaceInvalidUTF8
+// applies.
+func NewScanner(r io.Reader, filename string, opts ParseOpts) *Scanner {
+	l := lex(filename, bufio.NewReader(r))
+	l.replaceInvalid = opts&ReplaceInvalidUTF8 != 0
+	return &Scanner{l: l}
+}
+
+// Next returns the next token. At the end of the input, it returns io.EOF.
+// After Next returns an error, it returns the same error on every
+// subsequent call.
+func (s *Scanner) Next() (Token, error) {
+	if s.err != nil {
+		return Token{}, s.err
+	}
+	tok := s.l.nextToken()
+	switch tok.typ {
+	case tokEOF:
+		s.err = io.EOF
+		return Token{}, s.err
+	case tokError:
+		s.err = tok.AsError()
+		return Token{}, s.err
+	case tokDispatch:
+		// The lexer includes the delimiter of a paired dispatch form
+		// in the dispatch token as well as in the token which follows.
+		switch tok.val {
+		case "#{", "#(", `#"`:
+			tok.val = "#"
+		}
+	case tokOctothorpe:
+		// The lexer places the octothorpe of a tag after the #.
+		if tok.val == "" {
+			tok.pos.Offset--
+			tok.pos.Col--
+			tok.val = "#"
+		}
+	}
+	return Token{Type: tokenTypes[tok.typ], Pos: tok.pos, Val: tok.val}, nil
+}
@@ -0,0 +1,59 @@
+package parse
+
+import (
+	"bufio"
+	"io"
+)
+
+// A Stream parses the top-level forms of its input one at a time. Unlike
+// Reader, it does not keep the forms it has returned, so inputs much larger
+// than memory may be processed.
+type Stream struct {
+	t   *Tree
+	err error
+}
+
+// NewStream returns a Stream which parses r. The filename is used for the
+// positions of the nodes.
+func NewStream(r io.Reader, filename string, opts ParseOpts) *Stream {
+	s := &Stream{
+		t: &Tree{
+			includeNonSemantic: opts&IncludeNonSemantic != 0,
+			lex:                lex(filename, bufio.NewReader(r)),
+		},
+	}
+	s.t.lex.replaceInvalid = opts&ReplaceInvalidUTF8 != 0
+	return s
+}
+
+// SetBudget limits the memory used by each top-level node returned by Next to
+// approximately budget bytes. Next returns a *BudgetError for a node which
+// needs more.
+func (s *Stream) SetBudget(budget int64) {
+	s.t.budget = budget
+}
+
+// Next returns the next top-level node. At the end of the input, it returns
+// io.EOF. After Next returns an error, it returns the same error on every
+// subsequent call.
+func (s *Stream) Next() (Node, error) {
+	for s.err == nil {
+		s.t.used = 0
+		n := s.next()
+		if n == nil {
+			if s.err == nil {
+				s.err = io.EOF
+			}
+			break
+		}
+		if s.t.includeNonSemantic || isSemantic(n) {
+			return n, nil
+		}
+	}
+	return nil, s.err
+}
+
+func (s *Stream) next() Node {
+	defer s.t.recover(&s.err)
+	return s.t.parseNext()
+}
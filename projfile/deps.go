@@ -0,0 +1,167 @@
+package projfile
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A DepsFile is a parsed deps.edn file. Edits made through its methods are
+// applied to the underlying parse tree, so comments and layout are kept when
+// the file is written back out with Print.
+type DepsFile struct {
+	file
+	root *parse.MapNode
+}
+
+// ParseDeps parses a deps.edn file.
+func ParseDeps(r io.Reader, name string) (*DepsFile, error) {
+	f, err := parseFile(r, name)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootMap(f.tree, name)
+	if err != nil {
+		return nil, err
+	}
+	return &DepsFile{file: f, root: root}, nil
+}
+
+func rootMap(t *parse.Tree, name string) (*parse.MapNode, error) {
+	for _, n := range t.Roots {
+		if !goclj.Semantic(n) {
+			continue
+		}
+		m, ok := n.(*parse.MapNode)
+		if !ok {
+			return nil, unexpected(n, "a map")
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%s: no top-level map", name)
+}
+
+// Paths returns the :paths of d.
+func (d *DepsFile) Paths() []string {
+	return stringElems(mapGet(d.root, ":paths"))
+}
+
+// Aliases returns the names of the aliases (such as ":test") defined in d,
+// in the order in which they appear.
+func (d *DepsFile) Aliases() []string {
+	m, ok := mapGet(d.root, ":aliases").(*parse.MapNode)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, p := range pairs(m.Nodes) {
+		if k, ok := m.Nodes[p.k].(*parse.KeywordNode); ok {
+			names = append(names, k.Val)
+		}
+	}
+	return names
+}
+
+// Deps returns the dependencies of d. If alias is empty, these are the
+// top-level :deps; otherwise they are the :extra-deps (or :replace-deps or
+// :deps) of the named alias.
+func (d *DepsFile) Deps(alias string) []Dep {
+	m := d.depsMap(alias, false)
+	if m == nil {
+		return nil
+	}
+	var deps []Dep
+	for _, p := range pairs(m.Nodes) {
+		lib, ok := m.Nodes[p.k].(*parse.SymbolNode)
+		if !ok {
+			continue
+		}
+		dep := Dep{Lib: lib.Val, Pos: *lib.Position()}
+		if coord, ok := m.Nodes[p.v].(*parse.MapNode); ok {
+			dep.Coord = stringValues(coord)
+			dep.Version = dep.Coord[":mvn/version"]
+			delete(dep.Coord, ":mvn/version")
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// SetDep adds dep to the dependencies selected by alias (as with Deps) or,
+// if a dependency on dep.Lib already exists, updates its coordinate: a
+// non-empty Version replaces :mvn/version, and each entry of Coord replaces
+// the corresponding attribute. Other attributes are left alone.
+func (d *DepsFile) SetDep(alias string, dep Dep) error {
+	m := d.depsMap(alias, true)
+	if m == nil {
+		return fmt.Errorf("%s: alias %s is not a map", d.root.Position(), alias)
+	}
+	attrs := make(map[string]string)
+	for k, v := range dep.Coord {
+		attrs[k] = v
+	}
+	if dep.Version != "" {
+		attrs[":mvn/version"] = dep.Version
+	}
+	coord, ok := mapGet(m, dep.Lib).(*parse.MapNode)
+	if !ok {
+		coord = &parse.MapNode{}
+		d.mapSet(m, &parse.SymbolNode{Val: dep.Lib}, coord)
+	}
+	for _, k := range sortedKeys(attrs) {
+		d.mapSet(coord, &parse.KeywordNode{Val: k}, parse.String(attrs[k]))
+	}
+	d.fit()
+	return nil
+}
+
+// RemoveDep removes the dependency on lib from the dependencies selected by
+// alias. It reports whether the dependency was present.
+func (d *DepsFile) RemoveDep(alias, lib string) bool {
+	m := d.depsMap(alias, false)
+	if m == nil {
+		return false
+	}
+	return mapDelete(m, lib)
+}
+
+// depsMap finds the dependency map for alias. If create is set, missing
+// :deps, :aliases, alias, and :extra-deps maps are added.
+func (d *DepsFile) depsMap(alias string, create bool) *parse.MapNode {
+	if alias == "" {
+		return d.getMap(d.root, ":deps", create)
+	}
+	aliases := d.getMap(d.root, ":aliases", create)
+	if aliases == nil {
+		return nil
+	}
+	a := d.getMap(aliases, alias, create)
+	if a == nil {
+		return nil
+	}
+	for _, key := range []string{":extra-deps", ":replace-deps", ":deps"} {
+		if m, ok := mapGet(a, key).(*parse.MapNode); ok {
+			return m
+		}
+	}
+	return d.getMap(a, ":extra-deps", create)
+}
+
+// getMap returns the map-valued entry for key in m. If the entry doesn't exist
+// and create is set, an empty map is added.
+func (f *file) getMap(m *parse.MapNode, key string, create bool) *parse.MapNode {
+	switch v := mapGet(m, key).(type) {
+	case *parse.MapNode:
+		return v
+	case nil:
+		if !create {
+			return nil
+		}
+		created := &parse.MapNode{}
+		f.mapSet(m, &parse.KeywordNode{Val: key}, created)
+		return created
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package projfile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+// A Dep is a single dependency.
+type Dep struct {
+	Lib string
+	// Version is the Maven version (:mvn/version in deps.edn) or the
+	// version string of a Leiningen-style [lib "version"] vector. It is
+	// empty for dependencies that don't have one, such as git deps.
+	Version string
+	// Coord holds the other string-valued coordinate attributes, keyed by
+	// keyword (for example, ":git/sha" or ":classifier").
+	Coord map[string]string
+	Pos   parse.Pos
+}
+
+// file is a parsed project file which is edited in place and re-emitted
+// using format.Printer.
+type file struct {
+	tree *parse.Tree
+	// snap records the tree as parsed, so that Print can tell which forms
+	// were edited.
+	snap *format.Snapshot
+	// grown holds the single-line maps to which mapSet has added entries,
+	// which fit breaks onto multiple lines if they have become too wide.
+	grown []*parse.MapNode
+}
+
+func parseFile(r io.Reader, name string) (file, error) {
+	t, err := parse.Reader(r, name, parse.IncludeNonSemantic)
+	if err != nil {
+		return file{}, err
+	}
+	return file{tree: t, snap: format.NewSnapshot(t)}, nil
+}
+
+// Print writes the (possibly modified) file to w. The forms which were not
+// edited are written exactly as they were parsed; only the edited forms are
+// laid out again (as cljfmt would, but without its transforms), so an
+// unedited file is written back byte for byte.
+func (f file) Print(w io.Writer) error {
+	p := newPrinter(w)
+	p.Verbatim = true
+	p.Snapshot = f.snap
+	return p.PrintTree(f.tree)
+}
+
+// newPrinter returns a Printer which lays out forms without transforming
+// them.
+func newPrinter(w io.Writer) *format.Printer {
+	p := format.NewPrinter(w)
+	p.Transforms = make(map[format.Transform]bool)
+	for _, t := range format.AllTransforms() {
+		p.Transforms[t] = false
+	}
+	return p
+}
+
+// maxLineWidth is the width past which fit breaks a map onto multiple lines.
+const maxLineWidth = 80
+
+// fit breaks each map which mapSet has grown past maxLineWidth onto
+// multiple lines, with one entry per line. It is called once an edit is
+// complete, since the values added to a map may be filled in afterward.
+func (f *file) fit() {
+	for _, m := range f.grown {
+		col := m.Position().Col
+		if col < 1 || multiline(m) || col-1+printedWidth(m) <= maxLineWidth {
+			// A map added by the edit has no position; it is laid
+			// out along with the map containing it.
+			continue
+		}
+		ps := pairs(m.Nodes)
+		for i := len(ps) - 1; i > 0; i-- {
+			m.Nodes = insert(m.Nodes, ps[i].k, &parse.NewlineNode{})
+		}
+	}
+	f.grown = nil
+}
+
+// printedWidth returns the width of the longest line of n as laid out at
+// the start of a line.
+func printedWidth(n parse.Node) int {
+	var buf strings.Builder
+	if err := newPrinter(&buf).PrintTree(&parse.Tree{Roots: []parse.Node{n}}); err != nil {
+		return 0
+	}
+	width := 0
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if w := utf8.RuneCountInString(line); w > width {
+			width = w
+		}
+	}
+	return width
+}
+
+// multiline reports whether the entries of m span multiple lines.
+func multiline(m *parse.MapNode) bool {
+	for _, n := range m.Nodes {
+		if goclj.Newline(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// pair gives the indexes of a key and its value in a map's raw child list.
+type pair struct {
+	k, v int
+}
+
+// pairs finds the key/value pairs among nodes, skipping comments and newlines.
+func pairs(nodes []parse.Node) []pair {
+	var result []pair
+	key := -1
+	for i, n := range nodes {
+		if !goclj.Semantic(n) {
+			continue
+		}
+		if key < 0 {
+			key = i
+			continue
+		}
+		result = append(result, pair{key, i})
+		key = -1
+	}
+	return result
+}
+
+// keyString gives a string for comparing map keys: the value of a keyword,
+// symbol, or string.
+func keyString(n parse.Node) string {
+	switch n := n.(type) {
+	case *parse.KeywordNode:
+		return n.Val
+	case *parse.SymbolNode:
+		return n.Val
+	case *parse.StringNode:
+		return stringValue(n)
+	}
+	return ""
+}
+
+// stringValue returns the value of the string literal s (or its text, if
+// it has a malformed escape sequence).
+func stringValue(s *parse.StringNode) string {
+	if v, err := parse.Unescape(s.Val); err == nil {
+		return v
+	}
+	return s.Val
+}
+
+// mapGet returns the value for key in m, or nil.
+func mapGet(m *parse.MapNode, key string) parse.Node {
+	for _, p := range pairs(m.Nodes) {
+		if keyString(m.Nodes[p.k]) == key {
+			return m.Nodes[p.v]
+		}
+	}
+	return nil
+}
+
+// mapSet sets key to val in m. If the key isn't present, the new entry is
+// placed in sorted position, assuming the existing keys are sorted, and on
+// its own line if the map spans multiple lines. A single-line map is left for
+// fit to break if it becomes too wide.
+func (f *file) mapSet(m *parse.MapNode, key, val parse.Node) {
+	ks := keyString(key)
+	ps := pairs(m.Nodes)
+	for _, p := range ps {
+		if keyString(m.Nodes[p.k]) == ks {
+			m.Nodes[p.v] = val
+			return
+		}
+	}
+	sep := parse.Node(nil)
+	if multiline(m) {
+		sep = &parse.NewlineNode{}
+	} else {
+		f.grown = append(f.grown, m)
+	}
+	for _, p := range ps {
+		if ks < keyString(m.Nodes[p.k]) {
+			ins := []parse.Node{key, val}
+			if sep != nil {
+				ins = append(ins, sep)
+			}
+			m.Nodes = insert(m.Nodes, p.k, ins...)
+			return
+		}
+	}
+	ins := []parse.Node{key, val}
+	if len(ps) > 0 && sep != nil {
+		ins = append([]parse.Node{sep}, ins...)
+	}
+	end := len(m.Nodes)
+	if len(ps) > 0 {
+		end = ps[len(ps)-1].v + 1
+		// Keep a comment beside the last entry with that entry.
+		if end < len(m.Nodes) && goclj.Comment(m.Nodes[end]) {
+			end++
+		}
+	}
+	m.Nodes = insert(m.Nodes, end, ins...)
+}
+
+// mapDelete removes key from m, along with the line break before it.
+// It reports whether the key was found.
+func mapDelete(m *parse.MapNode, key string) bool {
+	for _, p := range pairs(m.Nodes) {
+		if keyString(m.Nodes[p.k]) != key {
+			continue
+		}
+		m.Nodes = removeRange(m.Nodes, p.k, p.v+1)
+		return true
+	}
+	return false
+}
+
+// removeRange removes nodes[i:j] along with the comments on the lines
+// above it and beside it and the newline that separates that range from the
+// previous (or, if it is first, the next) element.
+func removeRange(nodes []parse.Node, i, j int) []parse.Node {
+	if j < len(nodes) && goclj.Comment(nodes[j]) {
+		j++ // comment beside the removed element
+	}
+	for i >= 2 && goclj.Newline(nodes[i-1]) && goclj.Comment(nodes[i-2]) &&
+		(i == 2 || goclj.Newline(nodes[i-3])) {
+		i -= 2 // comment on its own line above the removed element
+	}
+	switch {
+	case i > 0 && goclj.Newline(nodes[i-1]):
+		i--
+	case j < len(nodes) && goclj.Newline(nodes[j]):
+		j++
+	}
+	return append(nodes[:i:i], nodes[j:]...)
+}
+
+func insert(nodes []parse.Node, i int, ins ...parse.Node) []parse.Node {
+	result := make([]parse.Node, 0, len(nodes)+len(ins))
+	result = append(result, nodes[:i]...)
+	result = append(result, ins...)
+	return append(result, nodes[i:]...)
+}
+
+// stringValues returns the string-valued entries of a coordinate map.
+func stringValues(m *parse.MapNode) map[string]string {
+	vals := make(map[string]string)
+	for _, p := range pairs(m.Nodes) {
+		k, ok := m.Nodes[p.k].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		if s, ok := m.Nodes[p.v].(*parse.StringNode); ok {
+			vals[k.Val] = stringValue(s)
+		}
+	}
+	return vals
+}
+
+// stringElems returns the string elements of a vector.
+func stringElems(n parse.Node) []string {
+	v, ok := n.(*parse.VectorNode)
+	if !ok {
+		return nil
+	}
+	var ss []string
+	for _, elem := range v.Nodes {
+		if s, ok := elem.(*parse.StringNode); ok {
+			ss = append(ss, stringValue(s))
+		}
+	}
+	return ss
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func unexpected(n parse.Node, what string) error {
+	return fmt.Errorf("%s: expected %s", n.Position(), what)
+}
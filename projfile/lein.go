@@ -0,0 +1,214 @@
+package projfile
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// A LeinFile is a parsed Leiningen project.clj file.
+type LeinFile struct {
+	file
+	// form is the defproject form:
+	// (defproject name "version" :key val ...)
+	form *parse.ListNode
+}
+
+// ParseLein parses a project.clj file. The file must contain a defproject
+// form.
+func ParseLein(r io.Reader, name string) (*LeinFile, error) {
+	f, err := parseFile(r, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range f.tree.Roots {
+		if goclj.FnFormSymbol(n, "defproject") {
+			return &LeinFile{file: f, form: n.(*parse.ListNode)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no defproject form", name)
+}
+
+// Name returns the project name, such as "com.example/foo".
+func (l *LeinFile) Name() string {
+	_, idx := parse.SemanticChildren(l.form)
+	if len(idx) < 2 {
+		return ""
+	}
+	return keyString(l.form.Nodes[idx[1]])
+}
+
+// Version returns the project version.
+func (l *LeinFile) Version() string {
+	if s := l.versionNode(); s != nil {
+		return stringValue(s)
+	}
+	return ""
+}
+
+// SetVersion replaces the project version.
+func (l *LeinFile) SetVersion(version string) error {
+	_, idx := parse.SemanticChildren(l.form)
+	if len(idx) < 3 {
+		return unexpected(l.form, "a project name and version")
+	}
+	if l.versionNode() == nil {
+		return unexpected(l.form.Nodes[idx[2]], "a version string")
+	}
+	l.form.Nodes[idx[2]] = parse.String(version)
+	return nil
+}
+
+func (l *LeinFile) versionNode() *parse.StringNode {
+	_, idx := parse.SemanticChildren(l.form)
+	if len(idx) < 3 {
+		return nil
+	}
+	s, _ := l.form.Nodes[idx[2]].(*parse.StringNode)
+	return s
+}
+
+// Profiles returns the names of the profiles (such as ":dev") defined in l.
+func (l *LeinFile) Profiles() []string {
+	m, ok := l.option(":profiles").(*parse.MapNode)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, p := range pairs(m.Nodes) {
+		if k, ok := m.Nodes[p.k].(*parse.KeywordNode); ok {
+			names = append(names, k.Val)
+		}
+	}
+	return names
+}
+
+// Deps returns the :dependencies of the project, if profile is empty, or of
+// the named profile.
+func (l *LeinFile) Deps(profile string) []Dep {
+	v := l.vector(profile, ":dependencies", false)
+	if v == nil {
+		return nil
+	}
+	return vectorDeps(v)
+}
+
+// Plugins returns the :plugins of the project, if profile is empty, or of the
+// named profile.
+func (l *LeinFile) Plugins(profile string) []Dep {
+	v := l.vector(profile, ":plugins", false)
+	if v == nil {
+		return nil
+	}
+	return vectorDeps(v)
+}
+
+// SetDep adds dep to the :dependencies selected by profile (as with Deps) or
+// updates the existing entry for dep.Lib, in the same manner as
+// ShadowFile.SetDep.
+func (l *LeinFile) SetDep(profile string, dep Dep) error {
+	return l.set(profile, ":dependencies", dep)
+}
+
+// SetPlugin is like SetDep, but for :plugins.
+func (l *LeinFile) SetPlugin(profile string, dep Dep) error {
+	return l.set(profile, ":plugins", dep)
+}
+
+// RemoveDep removes the dependency on lib from the :dependencies selected by
+// profile. It reports whether the dependency was present.
+func (l *LeinFile) RemoveDep(profile, lib string) bool {
+	v := l.vector(profile, ":dependencies", false)
+	return v != nil && removeVectorDep(v, lib)
+}
+
+// RemovePlugin is like RemoveDep, but for :plugins.
+func (l *LeinFile) RemovePlugin(profile, lib string) bool {
+	v := l.vector(profile, ":plugins", false)
+	return v != nil && removeVectorDep(v, lib)
+}
+
+func (l *LeinFile) set(profile, key string, dep Dep) error {
+	v := l.vector(profile, key, true)
+	if v == nil {
+		return fmt.Errorf("%s: cannot find or create %s for profile %q", l.form.Position(), key, profile)
+	}
+	setVectorDep(v, dep)
+	l.fit()
+	return nil
+}
+
+// vector finds the vector for key, either at the top level of the project
+// (if profile is empty) or in the given profile. If create is set, missing
+// entries are added.
+func (l *LeinFile) vector(profile, key string, create bool) *parse.VectorNode {
+	if profile == "" {
+		switch v := l.option(key).(type) {
+		case *parse.VectorNode:
+			return v
+		case nil:
+			if !create {
+				return nil
+			}
+			created := &parse.VectorNode{}
+			l.setOption(key, created)
+			return created
+		}
+		return nil
+	}
+	profiles, ok := l.option(":profiles").(*parse.MapNode)
+	if !ok {
+		if l.option(":profiles") != nil || !create {
+			return nil
+		}
+		profiles = &parse.MapNode{}
+		l.setOption(":profiles", profiles)
+	}
+	m := l.getMap(profiles, profile, create)
+	if m == nil {
+		return nil
+	}
+	switch v := mapGet(m, key).(type) {
+	case *parse.VectorNode:
+		return v
+	case nil:
+		if !create {
+			return nil
+		}
+		created := &parse.VectorNode{}
+		l.mapSet(m, &parse.KeywordNode{Val: key}, created)
+		return created
+	}
+	return nil
+}
+
+// option returns the value of the defproject option key, or nil.
+func (l *LeinFile) option(key string) parse.Node {
+	_, idx := parse.SemanticChildren(l.form)
+	for i := 3; i+1 < len(idx); i += 2 {
+		if keyString(l.form.Nodes[idx[i]]) == key {
+			return l.form.Nodes[idx[i+1]]
+		}
+	}
+	return nil
+}
+
+// setOption sets the defproject option key to val, adding it on a new line at
+// the end of the form if it isn't already present.
+func (l *LeinFile) setOption(key string, val parse.Node) {
+	_, idx := parse.SemanticChildren(l.form)
+	for i := 3; i+1 < len(idx); i += 2 {
+		if keyString(l.form.Nodes[idx[i]]) == key {
+			l.form.Nodes[idx[i+1]] = val
+			return
+		}
+	}
+	end := idx[len(idx)-1] + 1
+	if end < len(l.form.Nodes) && goclj.Comment(l.form.Nodes[end]) {
+		end++
+	}
+	l.form.Nodes = insert(l.form.Nodes, end,
+		&parse.NewlineNode{}, &parse.KeywordNode{Val: key}, val)
+}
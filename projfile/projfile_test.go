@@ -0,0 +1,291 @@
+package projfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const depsEDN = `{:paths ["src" "resources"]
+ :deps {org.clojure/clojure {:mvn/version "1.10.1"}
+        ;; Logging
+        org.slf4j/slf4j-api {:mvn/version "1.7.30"} ; pinned
+        zprint/zprint {:mvn/version "0.5.3"}}
+ :aliases {:test {:extra-paths ["test"]
+                  :extra-deps {lambdaisland/kaocha {:mvn/version "0.0-590"}}}
+           :dev {}}}
+`
+
+func TestDepsAccessors(t *testing.T) {
+	d, err := ParseDeps(strings.NewReader(depsEDN), "deps.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Paths(), []string{"src", "resources"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths: got %q; want %q", got, want)
+	}
+	if got, want := d.Aliases(), []string{":test", ":dev"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Aliases: got %q; want %q", got, want)
+	}
+	var libs []string
+	for _, dep := range d.Deps("") {
+		libs = append(libs, dep.Lib+" "+dep.Version)
+	}
+	want := []string{
+		"org.clojure/clojure 1.10.1",
+		"org.slf4j/slf4j-api 1.7.30",
+		"zprint/zprint 0.5.3",
+	}
+	if !reflect.DeepEqual(libs, want) {
+		t.Errorf("Deps: got %q; want %q", libs, want)
+	}
+	test := d.Deps(":test")
+	if len(test) != 1 || test[0].Lib != "lambdaisland/kaocha" || test[0].Pos.Line != 7 {
+		t.Errorf("Deps(:test): got %+v", test)
+	}
+	if deps := d.Deps(":dev"); deps != nil {
+		t.Errorf("Deps(:dev): got %+v; want none", deps)
+	}
+}
+
+func TestDepsEdit(t *testing.T) {
+	d, err := ParseDeps(strings.NewReader(depsEDN), "deps.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDep("", Dep{Lib: "org.clojure/clojure", Version: "1.10.3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDep("", Dep{Lib: "cheshire/cheshire", Version: "5.10.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if !d.RemoveDep("", "org.slf4j/slf4j-api") {
+		t.Error("RemoveDep: dependency not found")
+	}
+	if d.RemoveDep("", "org.slf4j/slf4j-api") {
+		t.Error("RemoveDep: removed dependency twice")
+	}
+	dep := Dep{Lib: "io.github.foo/bar", Coord: map[string]string{":git/sha": "abc123"}}
+	if err := d.SetDep(":dev", dep); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := d.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{:paths ["src" "resources"]
+ :deps {cheshire/cheshire {:mvn/version "5.10.0"}
+        org.clojure/clojure {:mvn/version "1.10.3"}
+        zprint/zprint {:mvn/version "0.5.3"}}
+ :aliases {:test {:extra-paths ["test"]
+                  :extra-deps {lambdaisland/kaocha {:mvn/version "0.0-590"}}}
+           :dev {:extra-deps {io.github.foo/bar {:git/sha "abc123"}}}}}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// messyDepsEDN is valid but not laid out the way cljfmt would lay it out.
+const messyDepsEDN = `{:paths ["src"   "resources"],
+
+
+ :deps {org.clojure/clojure {:mvn/version "1.10.1"}
+        c/d    {:mvn/version "2.0"}   ; aligned
+        ef/gh  {:mvn/version "3.0"}}
+ :aliases {:test
+             {:extra-deps {lambdaisland/kaocha {:mvn/version "0.0-590"}}}}}
+`
+
+func TestDepsRoundTrip(t *testing.T) {
+	print := func(d *DepsFile) string {
+		var buf bytes.Buffer
+		if err := d.Print(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	d, err := ParseDeps(strings.NewReader(messyDepsEDN), "deps.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := print(d); got != messyDepsEDN {
+		t.Errorf("unedited: got:\n%s\nwant:\n%s", got, messyDepsEDN)
+	}
+	if err := d.SetDep("", Dep{Lib: "c/d", Version: "2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(messyDepsEDN, `"2.0"`, `"2.1"`, 1)
+	if got := print(d); got != want {
+		t.Errorf("after SetDep: got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+const shadowEDN = `{:source-paths ["src/main"]
+ :dependencies [[reagent "0.10.0"]
+                [cljs-ajax "0.8.0" :exclusions [org.clojure/clojure]]]
+ :builds {:app {:target :browser}}}
+`
+
+func TestShadow(t *testing.T) {
+	s, err := ParseShadow(strings.NewReader(shadowEDN), "shadow-cljs.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.SourcePaths(), []string{"src/main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SourcePaths: got %q; want %q", got, want)
+	}
+	if got, want := s.Builds(), []string{":app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Builds: got %q; want %q", got, want)
+	}
+	deps := s.Deps()
+	if len(deps) != 2 || deps[1].Lib != "cljs-ajax" || deps[1].Version != "0.8.0" {
+		t.Errorf("Deps: got %+v", deps)
+	}
+	if err := s.SetDep(Dep{Lib: "reagent", Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	dep := Dep{Lib: "re-frame", Version: "1.1.2", Coord: map[string]string{":classifier": "aot"}}
+	if err := s.SetDep(dep); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{:source-paths ["src/main"]
+ :dependencies [[reagent "1.0.0"]
+                [cljs-ajax "0.8.0" :exclusions [org.clojure/clojure]]
+                [re-frame "1.1.2" :classifier "aot"]]
+ :builds {:app {:target :browser}}}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if !s.RemoveDep("cljs-ajax") || s.RemoveDep("cljs-ajax") {
+		t.Error("RemoveDep: wrong result")
+	}
+}
+
+const projectCLJ = `;; The web app.
+(defproject com.example/web "0.1.0-SNAPSHOT"
+  :description "An example"
+  :dependencies [[org.clojure/clojure "1.10.1"]
+                 [ring "1.8.0"]] ; HTTP
+  :plugins [[lein-cljfmt "0.6.7"]]
+  :profiles {:dev {:dependencies [[ring/ring-mock "0.4.0"]]}})
+`
+
+const messyProjectCLJ = `(defproject com.example/web "1.0"
+  :description   "An example"
+
+
+  :dependencies [[org.clojure/clojure "1.10.1"]
+                 [ring  "1.8.0"]])
+`
+
+func TestLeinRoundTrip(t *testing.T) {
+	l, err := ParseLein(strings.NewReader(messyProjectCLJ), "project.clj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := l.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != messyProjectCLJ {
+		t.Errorf("unedited: got:\n%s\nwant:\n%s", got, messyProjectCLJ)
+	}
+	if err := l.SetVersion("1.1"); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := l.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(messyProjectCLJ, `"1.0"`, `"1.1"`, 1)
+	if got := buf.String(); got != want {
+		t.Errorf("after SetVersion: got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLein(t *testing.T) {
+	l, err := ParseLein(strings.NewReader(projectCLJ), "project.clj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name() != "com.example/web" || l.Version() != "0.1.0-SNAPSHOT" {
+		t.Errorf("got name %q, version %q", l.Name(), l.Version())
+	}
+	if got, want := l.Profiles(), []string{":dev"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Profiles: got %q; want %q", got, want)
+	}
+	if deps := l.Deps(":dev"); len(deps) != 1 || deps[0].Lib != "ring/ring-mock" {
+		t.Errorf("Deps(:dev): got %+v", deps)
+	}
+	if plugins := l.Plugins(""); len(plugins) != 1 || plugins[0].Version != "0.6.7" {
+		t.Errorf("Plugins: got %+v", plugins)
+	}
+
+	if err := l.SetVersion("0.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetDep("", Dep{Lib: "ring", Version: "1.8.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetDep("", Dep{Lib: "cheshire", Version: "5.10.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetDep(":test", Dep{Lib: "eftest", Version: "0.5.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if !l.RemovePlugin("", "lein-cljfmt") {
+		t.Error("RemovePlugin: plugin not found")
+	}
+	var buf bytes.Buffer
+	if err := l.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `;; The web app.
+(defproject com.example/web "0.1.0"
+  :description "An example"
+  :dependencies [[org.clojure/clojure "1.10.1"]
+                 [ring "1.8.2"]
+                 [cheshire "5.10.0"]] ; HTTP
+  :plugins []
+  :profiles {:dev {:dependencies [[ring/ring-mock "0.4.0"]]}
+             :test {:dependencies [[eftest "0.5.9"]]}})
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLeinEscapes(t *testing.T) {
+	l, err := ParseLein(strings.NewReader(`(defproject a "1.0-\"rc\"1"
+  :dependencies [[b "2.0\t3"]])
+`), "project.clj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Version(), `1.0-"rc"1`; got != want {
+		t.Errorf("Version: got %q; want %q", got, want)
+	}
+	if deps := l.Deps(""); len(deps) != 1 || deps[0].Version != "2.0\t3" {
+		t.Errorf("Deps: got %+v", deps)
+	}
+	if err := l.SetVersion("2.0\n\"final\""); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := l.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `(defproject a "2.0\n\"final\""
+  :dependencies [[b "2.0\t3"]])
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package projfile
+
+import (
+	"io"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A ShadowFile is a parsed shadow-cljs.edn file.
+type ShadowFile struct {
+	file
+	root *parse.MapNode
+}
+
+// ParseShadow parses a shadow-cljs.edn file.
+func ParseShadow(r io.Reader, name string) (*ShadowFile, error) {
+	f, err := parseFile(r, name)
+	if err != nil {
+		return nil, err
+	}
+	root, err := rootMap(f.tree, name)
+	if err != nil {
+		return nil, err
+	}
+	return &ShadowFile{file: f, root: root}, nil
+}
+
+// SourcePaths returns the :source-paths of s.
+func (s *ShadowFile) SourcePaths() []string {
+	return stringElems(mapGet(s.root, ":source-paths"))
+}
+
+// Builds returns the build IDs (such as ":app") defined in s.
+func (s *ShadowFile) Builds() []string {
+	m, ok := mapGet(s.root, ":builds").(*parse.MapNode)
+	if !ok {
+		return nil
+	}
+	var ids []string
+	for _, p := range pairs(m.Nodes) {
+		if k, ok := m.Nodes[p.k].(*parse.KeywordNode); ok {
+			ids = append(ids, k.Val)
+		}
+	}
+	return ids
+}
+
+// Deps returns the :dependencies of s.
+func (s *ShadowFile) Deps() []Dep {
+	v, ok := mapGet(s.root, ":dependencies").(*parse.VectorNode)
+	if !ok {
+		return nil
+	}
+	return vectorDeps(v)
+}
+
+// SetDep adds dep to the :dependencies of s or updates the existing entry for
+// dep.Lib. A non-empty Version replaces the version string, and each entry of
+// Coord sets the corresponding keyword option.
+func (s *ShadowFile) SetDep(dep Dep) error {
+	v, ok := mapGet(s.root, ":dependencies").(*parse.VectorNode)
+	switch {
+	case ok:
+	case mapGet(s.root, ":dependencies") == nil:
+		v = &parse.VectorNode{}
+		s.mapSet(s.root, &parse.KeywordNode{Val: ":dependencies"}, v)
+	default:
+		return unexpected(mapGet(s.root, ":dependencies"), "a vector of dependencies")
+	}
+	setVectorDep(v, dep)
+	s.fit()
+	return nil
+}
+
+// RemoveDep removes the dependency on lib from s. It reports whether the
+// dependency was present.
+func (s *ShadowFile) RemoveDep(lib string) bool {
+	v, ok := mapGet(s.root, ":dependencies").(*parse.VectorNode)
+	if !ok {
+		return false
+	}
+	return removeVectorDep(v, lib)
+}
@@ -0,0 +1,157 @@
+package projfile
+
+import (
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/parse"
+)
+
+// This file handles Leiningen-style dependency vectors, which are used by
+// both project.clj and shadow-cljs.edn:
+//
+//   [[org.clojure/clojure "1.10.1"]
+//    [foo "1.0.0" :exclusions [bar]]]
+
+// vectorDeps returns the dependencies listed in v.
+func vectorDeps(v *parse.VectorNode) []Dep {
+	var deps []Dep
+	for _, n := range v.Nodes {
+		if dep, ok := vectorDep(n); ok {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
+func vectorDep(n parse.Node) (Dep, bool) {
+	v, ok := n.(*parse.VectorNode)
+	if !ok {
+		return Dep{}, false
+	}
+	elems, _ := parse.SemanticChildren(v)
+	if len(elems) == 0 {
+		return Dep{}, false
+	}
+	lib, ok := elems[0].(*parse.SymbolNode)
+	if !ok {
+		return Dep{}, false
+	}
+	dep := Dep{Lib: lib.Val, Pos: *v.Position(), Coord: make(map[string]string)}
+	if len(elems) > 1 {
+		if s, ok := elems[1].(*parse.StringNode); ok {
+			dep.Version = stringValue(s)
+		}
+	}
+	for i := 2; i+1 < len(elems); i += 2 {
+		k, ok := elems[i].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		if s, ok := elems[i+1].(*parse.StringNode); ok {
+			dep.Coord[k.Val] = stringValue(s)
+		}
+	}
+	return dep, true
+}
+
+// findVectorDep returns the dependency vector for lib in v, or nil.
+func findVectorDep(v *parse.VectorNode, lib string) *parse.VectorNode {
+	for _, n := range v.Nodes {
+		if dep, ok := vectorDep(n); ok && dep.Lib == lib {
+			return n.(*parse.VectorNode)
+		}
+	}
+	return nil
+}
+
+// setVectorDep adds dep to the end of v or updates the existing entry for
+// dep.Lib, as described for DepsFile.SetDep.
+func setVectorDep(v *parse.VectorNode, dep Dep) {
+	dv := findVectorDep(v, dep.Lib)
+	if dv == nil {
+		dv = &parse.VectorNode{Nodes: []parse.Node{&parse.SymbolNode{Val: dep.Lib}}}
+		if dep.Version != "" {
+			dv.Nodes = append(dv.Nodes, parse.String(dep.Version))
+		}
+		appendElem(v, dv)
+	} else if dep.Version != "" {
+		setVersion(dv, dep.Version)
+	}
+	for _, k := range sortedKeys(dep.Coord) {
+		setOption(dv, k, parse.String(dep.Coord[k]))
+	}
+}
+
+func setVersion(dv *parse.VectorNode, version string) {
+	for i, n := range dv.Nodes {
+		if !goclj.Semantic(n) {
+			continue
+		}
+		if _, ok := n.(*parse.SymbolNode); !ok {
+			continue
+		}
+		// The version follows the lib name.
+		for j := i + 1; j < len(dv.Nodes); j++ {
+			if !goclj.Semantic(dv.Nodes[j]) {
+				continue
+			}
+			if _, ok := dv.Nodes[j].(*parse.StringNode); ok {
+				dv.Nodes[j] = parse.String(version)
+				return
+			}
+			break
+		}
+		dv.Nodes = insert(dv.Nodes, i+1, parse.String(version))
+		return
+	}
+}
+
+// setOption sets the value of a keyword option such as :classifier in the
+// dependency vector dv.
+func setOption(dv *parse.VectorNode, key string, val parse.Node) {
+	_, idx := parse.SemanticChildren(dv)
+	for i := 2; i+1 < len(idx); i += 2 {
+		if keyString(dv.Nodes[idx[i]]) == key {
+			dv.Nodes[idx[i+1]] = val
+			return
+		}
+	}
+	dv.Nodes = append(dv.Nodes, &parse.KeywordNode{Val: key}, val)
+}
+
+// removeVectorDep removes the entry for lib from v. It reports whether the
+// entry was present.
+func removeVectorDep(v *parse.VectorNode, lib string) bool {
+	dv := findVectorDep(v, lib)
+	if dv == nil {
+		return false
+	}
+	for i, n := range v.Nodes {
+		if n == parse.Node(dv) {
+			v.Nodes = removeRange(v.Nodes, i, i+1)
+			break
+		}
+	}
+	return true
+}
+
+// appendElem adds n to the end of v, on its own line if v already spans
+// multiple lines.
+func appendElem(v *parse.VectorNode, n parse.Node) {
+	_, idx := parse.SemanticChildren(v)
+	if len(idx) == 0 {
+		v.Nodes = append(v.Nodes, n)
+		return
+	}
+	end := idx[len(idx)-1] + 1
+	if end < len(v.Nodes) && goclj.Comment(v.Nodes[end]) {
+		end++
+	}
+	ins := []parse.Node{n}
+	for _, child := range v.Nodes {
+		if goclj.Newline(child) {
+			ins = []parse.Node{&parse.NewlineNode{}, n}
+			break
+		}
+	}
+	v.Nodes = insert(v.Nodes, end, ins...)
+}
@@ -0,0 +1,235 @@
+package goclj
+
+import (
+	"strings"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// A Resolver resolves the symbols of a file through the aliases and referred
+// vars declared by the file's ns form (and by any top-level require calls).
+type Resolver struct {
+	required map[string]bool
+	aliases  map[string]string // alias -> namespace
+	refers   map[string]string // local name -> namespace/name
+	// like maps the names of macros to the forms they behave like (see
+	// TreatAs).
+	like map[string]string
+}
+
+// NewResolver creates a Resolver from the first ns form in t and the
+// top-level require calls, such as (require '[clojure.string :as str]),
+// which scripts use instead. If there are neither, the Resolver resolves
+// every symbol to itself.
+func NewResolver(t *parse.Tree) *Resolver {
+	r := &Resolver{
+		required: make(map[string]bool),
+		aliases:  make(map[string]string),
+		refers:   make(map[string]string),
+	}
+	seenNS := false
+	for _, root := range t.Roots {
+		switch {
+		case FnFormSymbol(root, "ns") && !seenNS:
+			seenNS = true
+			for _, clause := range root.Children() {
+				if FnFormKeyword(clause, ":require", ":require-macros", ":use") {
+					for _, n := range clause.Children()[1:] {
+						r.addLibspec("", n)
+					}
+				}
+			}
+		case FnFormSymbol(root, "require"):
+			for _, n := range root.Children()[1:] {
+				if q, ok := n.(*parse.QuoteNode); ok {
+					r.addLibspec("", q.Node)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// addLibspec records the aliases and refers of a single libspec (or prefix
+// list) of a :require or :use clause.
+func (r *Resolver) addLibspec(prefix string, n parse.Node) {
+	qualify := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	switch n := n.(type) {
+	case *parse.VectorNode, *parse.ListNode:
+	case *parse.SymbolNode:
+		r.required[qualify(n.Val)] = true
+		return
+	default:
+		return
+	}
+	nodes, _ := parse.SemanticChildren(n)
+	if len(nodes) == 0 {
+		return
+	}
+	var ns string
+	switch lib := nodes[0].(type) {
+	case *parse.SymbolNode:
+		ns = qualify(lib.Val)
+	case *parse.StringNode:
+		ns = lib.Val
+	default:
+		return
+	}
+	if len(nodes) > 1 && !Keyword(nodes[1]) {
+		// A prefix list: (clojure [string :as str] set)
+		for _, child := range nodes[1:] {
+			r.addLibspec(ns, child)
+		}
+		return
+	}
+	r.required[ns] = true
+	renames := make(map[string]string)
+	var refers []string
+	for i := 1; i+1 < len(nodes); i += 2 {
+		k, ok := nodes[i].(*parse.KeywordNode)
+		if !ok {
+			continue
+		}
+		switch k.Val {
+		case ":as", ":as-alias":
+			if alias, ok := nodes[i+1].(*parse.SymbolNode); ok {
+				r.aliases[alias.Val] = ns
+			}
+		case ":refer", ":only":
+			refers = append(refers, symbolVals(nodes[i+1])...)
+		case ":rename":
+			m, ok := nodes[i+1].(*parse.MapNode)
+			if !ok {
+				continue
+			}
+			names := symbolVals(m)
+			for j := 0; j+1 < len(names); j += 2 {
+				renames[names[j]] = names[j+1]
+			}
+		}
+	}
+	for _, name := range refers {
+		local := name
+		if renamed, ok := renames[name]; ok {
+			local = renamed
+		}
+		r.refers[local] = ns + "/" + name
+	}
+}
+
+// Requires reports whether the ns form requires the namespace ns. A nil
+// Resolver requires nothing.
+func (r *Resolver) Requires(ns string) bool {
+	return r != nil && r.required[ns]
+}
+
+// Resolve returns the fully-qualified name of sym if it is qualified by a
+// known alias or was referred by the ns form. Otherwise (or if r is nil) it
+// returns sym unchanged.
+func (r *Resolver) Resolve(sym string) string {
+	if r == nil {
+		return sym
+	}
+	if i := strings.Index(sym, "/"); i > 0 && i < len(sym)-1 {
+		if ns, ok := r.aliases[sym[:i]]; ok {
+			return ns + sym[i:]
+		}
+		return sym
+	}
+	if qualified, ok := r.refers[sym]; ok {
+		return qualified
+	}
+	return sym
+}
+
+// SymbolName returns the name of the symbol sym without its namespace, if
+// any: "join" for clojure.string/join and "/" for clojure.core//.
+func SymbolName(sym string) string {
+	if i := strings.Index(sym, "/"); i > 0 && i < len(sym)-1 {
+		return sym[i+1:]
+	}
+	return sym
+}
+
+// TreatAs makes FnFormSymbol match forms whose head symbol is name as if
+// their head symbol were form. This lets code which handles a built-in form
+// handle user macros which behave like it; for instance,
+// TreatAs("defhandler", "defn") for a defhandler macro which defines a
+// function. The name is matched like the names given to FnFormSymbol: if it
+// is qualified, it only matches a head symbol which resolves to it.
+//
+// Unlike the other methods, TreatAs panics if r is nil, since a nil
+// Resolver has nowhere to record name. A Resolver which knows no
+// namespaces can be made with NewResolver(&parse.Tree{}).
+func (r *Resolver) TreatAs(name, form string) {
+	if r.like == nil {
+		r.like = make(map[string]string)
+	}
+	r.like[name] = form
+}
+
+// FnFormSymbol is like the FnFormSymbol function, but it also recognizes
+// forms whose head symbol is aliased or referred, or which was given to
+// TreatAs. An unqualified name in sym matches a head symbol with that name
+// in any namespace the file knows of, so "defn" matches both (defn ...) and
+// (m/defn ...) if m is an alias declared by the ns form, but not
+// (x/defn ...) if x is unknown. A qualified name matches only a head symbol
+// that resolves to it; "schema.core/defn" matches (s/defn ...) if s is an
+// alias for schema.core, or (defn ...) if defn was referred from
+// schema.core. A nil Resolver matches head symbols literally.
+func (r *Resolver) FnFormSymbol(node parse.Node, sym ...string) bool {
+	if r == nil || len(sym) == 0 {
+		return FnFormSymbol(node, sym...)
+	}
+	if !FnFormSymbol(node) {
+		return false
+	}
+	head := node.(*parse.ListNode).Nodes[0].(*parse.SymbolNode).Val
+	resolved := r.Resolve(head)
+	// The head's name is only trusted if its namespace is known: it was
+	// resolved through an alias or a refer, or it is qualified by a
+	// required namespace or clojure.core.
+	name := ""
+	if resolved != head {
+		name = SymbolName(resolved)
+	} else if i := strings.Index(head, "/"); i > 0 && i < len(head)-1 {
+		if ns := head[:i]; ns == "clojure.core" || r.Requires(ns) {
+			name = head[i+1:]
+		}
+	}
+	match := func(s string) bool {
+		return s == head || s == resolved || (!strings.Contains(s, "/") && s == name)
+	}
+	for _, s := range sym {
+		if match(s) {
+			return true
+		}
+	}
+	for macro, form := range r.like {
+		if !match(macro) {
+			continue
+		}
+		for _, s := range sym {
+			if s == form {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// symbolVals returns the values of the symbols among the children of n.
+func symbolVals(n parse.Node) []string {
+	var vals []string
+	for _, child := range n.Children() {
+		if s, ok := child.(*parse.SymbolNode); ok {
+			vals = append(vals, s.Val)
+		}
+	}
+	return vals
+}
@@ -0,0 +1,80 @@
+package goclj
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+func TestResolverFnFormSymbol(t *testing.T) {
+	tree, err := parse.Reader(strings.NewReader(`(ns a
+  (:require [schema.core :as s]
+            [clojure.string]
+            [methodical.core :refer [defmethod] :rename {defmethod mdefmethod}]))
+`), "temp", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(tree)
+	for _, tt := range []struct {
+		form string
+		sym  string
+		want bool
+	}{
+		{"(defn f [])", "defn", true},
+		{"(s/defn f [])", "defn", true},
+		{"(s/defn f [])", "schema.core/defn", true},
+		{"(schema.core/defn f [])", "defn", true},
+		{"(clojure.core/defn f [])", "defn", true},
+		{"(clojure.string/join xs)", "join", true},
+		{"(mdefmethod f :x [])", "methodical.core/defmethod", true},
+		{"(mdefmethod f :x [])", "defmethod", true},
+
+		// The namespace of the head must be known.
+		{"(other/defn f [])", "defn", false},
+		{"(other.ns/defn f [])", "defn", false},
+		{"(other/defn f [])", "other/defn", true},
+		{"(defn f [])", "schema.core/defn", false},
+	} {
+		form, err := parse.Reader(strings.NewReader(tt.form), "temp", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.FnFormSymbol(form.Roots[0], tt.sym); got != tt.want {
+			t.Errorf("FnFormSymbol(%s, %q) = %t; want %t", tt.form, tt.sym, got, tt.want)
+		}
+	}
+}
+
+func TestResolverTreatAs(t *testing.T) {
+	r := NewResolver(&parse.Tree{})
+	r.TreatAs("defhandler", "defn")
+	r.TreatAs("my.macros/deftest*", "deftest")
+	for _, tt := range []struct {
+		form string
+		sym  string
+		want bool
+	}{
+		{"(defhandler f [])", "defn", true},
+		{"(defhandler f [])", "defmacro", false},
+		{"(defn f [])", "defn", true},
+		{"(deftest* t)", "deftest", false},
+	} {
+		form, err := parse.Reader(strings.NewReader(tt.form), "temp", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.FnFormSymbol(form.Roots[0], tt.sym); got != tt.want {
+			t.Errorf("FnFormSymbol(%s, %q) = %t; want %t", tt.form, tt.sym, got, tt.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("TreatAs on a nil Resolver did not panic")
+		}
+	}()
+	var nilResolver *Resolver
+	nilResolver.TreatAs("defhandler", "defn")
+}
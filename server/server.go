@@ -0,0 +1,329 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cespare/goclj"
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/lint"
+	"github.com/cespare/goclj/parse"
+)
+
+// Defaults for the limits of a Server.
+const (
+	DefaultMaxRequestBytes = 4 << 20
+	DefaultMaxConcurrent   = 16
+	DefaultMemoryBudget    = 256 << 20
+)
+
+// A Server is an http.Handler which formats Clojure code. It serves these
+// endpoints:
+//
+//	POST /v1/format  format the source; the response has the output
+//	POST /v1/check   report whether the source is already formatted
+//	POST /v1/lint    lint the source; the response has the diagnostics
+//	GET  /v1/capabilities  list the endpoints, node kinds, transforms,
+//	                 and other options (see Capabilities)
+//	GET  /healthz    report that the server is up
+//
+// The POST endpoints take a JSON Request and return a JSON Response.
+type Server struct {
+	// MaxRequestBytes limits the size of request bodies.
+	MaxRequestBytes int64
+	// MaxConcurrent limits the number of requests processed at once;
+	// requests beyond that are rejected with 503 Service Unavailable.
+	MaxConcurrent int
+	// MemoryBudget limits the memory used to parse each request (see
+	// parse.ReaderBudget); requests which need more are rejected with
+	// 413 Request Entity Too Large.
+	MemoryBudget int64
+	// Configure, if non-nil, is called to configure the Printer for
+	// each request (before the request's own transforms are applied).
+	Configure func(p *format.Printer, filename string)
+	// LintRules are the rules run for lint requests, in addition to
+	// the "format" rule (lint.FormatRule), which uses the Printer of a
+	// format request.
+	LintRules []*lint.Rule
+
+	semOnce sync.Once
+	sem     chan struct{}
+	mux     *http.ServeMux
+}
+
+// New returns a Server with the default limits.
+func New() *Server {
+	s := &Server{
+		MaxRequestBytes: DefaultMaxRequestBytes,
+		MaxConcurrent:   DefaultMaxConcurrent,
+		MemoryBudget:    DefaultMemoryBudget,
+		LintRules: []*lint.Rule{
+			lint.NilEqualityRule(),
+			lint.IfNotRule(),
+			lint.SingleBranchIfRule(),
+			lint.SeqTestRule(),
+			lint.DuplicateKeyRule(),
+			lint.MisplacedDocstringRule(),
+			lint.UnusedPrivateRule(),
+		},
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/v1/format", s.post(s.format))
+	s.mux.HandleFunc("/v1/check", s.post(s.check))
+	s.mux.HandleFunc("/v1/lint", s.post(s.lint))
+	s.mux.HandleFunc("/v1/capabilities", s.capabilities)
+	s.mux.HandleFunc("/healthz", s.health)
+	return s
+}
+
+// A Request is the body of a format, check, or lint request.
+type Request struct {
+	Source string `json:"source"`
+	// Filename is used in error messages and to choose file-specific
+	// formatting, such as the dialect. It defaults to "input.clj".
+	Filename string `json:"filename,omitempty"`
+	// Transforms turns transforms, named as by format.Transform.String,
+	// on or off for format and check requests. Lint requests check the
+	// names but otherwise ignore them, since the format rule checks only
+	// the layout of the source, with every transform turned off.
+	Transforms map[string]bool `json:"transforms,omitempty"`
+}
+
+// A Response is the body of the response to a format, check, or lint
+// request.
+type Response struct {
+	// Output is the formatted source (for format requests).
+	Output string `json:"output,omitempty"`
+	// Formatted reports whether the source was already formatted (for
+	// format and check requests).
+	Formatted bool `json:"formatted"`
+	// Diagnostics are the problems found (for lint requests).
+	Diagnostics []*Diagnostic `json:"diagnostics,omitempty"`
+	// Error describes why the request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// A Diagnostic is a lint.Diagnostic in a lint response.
+type Diagnostic struct {
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Capabilities is the body of the response to a capabilities request. It
+// lets clients check which options the server supports rather than
+// depending on its version.
+type Capabilities struct {
+	// Endpoints lists the POST endpoints, such as "/v1/lint".
+	Endpoints []string `json:"endpoints"`
+	// LintRules lists the IDs of the rules run for lint requests.
+	LintRules []string         `json:"lint_rules"`
+	Parse     *parse.Features  `json:"parse"`
+	Format    *format.Features `json:"format"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) capabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		reply(w, &Response{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+	caps := &Capabilities{
+		Endpoints: []string{"/v1/format", "/v1/check", "/v1/lint"},
+		LintRules: []string{"format"},
+		Parse:     parse.Capabilities(),
+		Format:    format.Capabilities(),
+	}
+	for _, rule := range s.LintRules {
+		caps.LintRules = append(caps.LintRules, rule.ID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(caps)
+}
+
+// post wraps a handler of POSTed Requests with the request limits.
+func (s *Server) post(handle func(req *Request) (*Response, int)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			reply(w, &Response{Error: "method not allowed"}, http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.acquire() {
+			reply(w, &Response{Error: "too many concurrent requests"}, http.StatusServiceUnavailable)
+			return
+		}
+		defer s.release()
+		var req Request
+		body := http.MaxBytesReader(w, r.Body, s.MaxRequestBytes)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			if _, ok := err.(*http.MaxBytesError); ok {
+				reply(w, &Response{Error: "request too large"}, http.StatusRequestEntityTooLarge)
+				return
+			}
+			reply(w, &Response{Error: "bad request: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		resp, code := handle(&req)
+		reply(w, resp, code)
+	}
+}
+
+func (s *Server) acquire() bool {
+	if s.MaxConcurrent <= 0 {
+		return true
+	}
+	s.semOnce.Do(func() { s.sem = make(chan struct{}, s.MaxConcurrent) })
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) release() {
+	if s.MaxConcurrent > 0 {
+		<-s.sem
+	}
+}
+
+func reply(w http.ResponseWriter, resp *Response, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) format(req *Request) (*Response, int) {
+	out, err := s.formatSource(req)
+	if err != nil {
+		return &Response{Error: err.Error()}, errorCode(err)
+	}
+	return &Response{Output: out, Formatted: out == req.Source}, http.StatusOK
+}
+
+func (s *Server) check(req *Request) (*Response, int) {
+	out, err := s.formatSource(req)
+	if err != nil {
+		return &Response{Error: err.Error()}, errorCode(err)
+	}
+	return &Response{Formatted: out == req.Source}, http.StatusOK
+}
+
+type requestError struct{ error }
+
+func errorCode(err error) int {
+	switch err.(type) {
+	case requestError:
+		return http.StatusBadRequest
+	case *parse.BudgetError:
+		return http.StatusRequestEntityTooLarge
+	}
+	// Errors from parsing the source.
+	return http.StatusUnprocessableEntity
+}
+
+func (s *Server) lint(req *Request) (*Response, int) {
+	// The transforms are checked, but FormatRule turns them all off.
+	filename, _, err := parseRequest(req)
+	if err != nil {
+		return &Response{Error: err.Error()}, errorCode(err)
+	}
+	t, err := s.parse(req.Source, filename)
+	if err != nil {
+		return &Response{Error: err.Error()}, errorCode(err)
+	}
+	newPrinter := func(w io.Writer) *format.Printer {
+		return s.newPrinter(w, filename, t, nil)
+	}
+	rules := append([]*lint.Rule{lint.FormatRule(newPrinter)}, s.LintRules...)
+	resp := new(Response)
+	for _, d := range lint.Lint(t, rules) {
+		resp.Diagnostics = append(resp.Diagnostics, &Diagnostic{
+			Line:    d.Pos.Line,
+			Col:     d.Pos.Col,
+			Rule:    d.Rule,
+			Message: d.Message,
+			Detail:  d.Detail,
+		})
+	}
+	return resp, http.StatusOK
+}
+
+// parseRequest returns the filename of req (or the default) and the
+// transforms it turns on or off.
+func parseRequest(req *Request) (string, map[format.Transform]bool, error) {
+	filename := req.Filename
+	if filename == "" {
+		filename = "input.clj"
+	}
+	transforms := make(map[format.Transform]bool)
+	for name, on := range req.Transforms {
+		t, err := format.ParseTransform(name)
+		if err != nil {
+			return "", nil, requestError{err}
+		}
+		transforms[t] = on
+	}
+	return filename, transforms, nil
+}
+
+func (s *Server) parse(src, filename string) (*parse.Tree, error) {
+	return parse.ReaderBudget(strings.NewReader(src), filename, parse.IncludeNonSemantic, s.MemoryBudget)
+}
+
+// newPrinter returns a Printer to w for t, configured for the file and with
+// the transforms of a request.
+func (s *Server) newPrinter(w io.Writer, filename string, t *parse.Tree, transforms map[format.Transform]bool) *format.Printer {
+	p := format.NewPrinter(w)
+	p.Dialect = goclj.DetectDialect(filename, t)
+	if s.Configure != nil {
+		s.Configure(p, filename)
+	}
+	if p.Transforms == nil {
+		p.Transforms = make(map[format.Transform]bool)
+	} else {
+		// Don't modify the caller's map.
+		m := make(map[format.Transform]bool)
+		for t, on := range p.Transforms {
+			m[t] = on
+		}
+		p.Transforms = m
+	}
+	for t, on := range transforms {
+		p.Transforms[t] = on
+	}
+	return p
+}
+
+func (s *Server) formatSource(req *Request) (string, error) {
+	filename, transforms, err := parseRequest(req)
+	if err != nil {
+		return "", err
+	}
+	t, err := s.parse(req.Source, filename)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := s.newPrinter(&buf, filename, t, transforms).PrintTree(t); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
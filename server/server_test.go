@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/format"
+	"github.com/cespare/goclj/parse"
+)
+
+func do(t *testing.T, s *Server, path string, req interface{}) (*Response, int) {
+	t.Helper()
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", path, bytes.NewReader(b)))
+	var resp Response
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("%s: bad response body: %s", path, err)
+	}
+	return &resp, w.Code
+}
+
+func TestFormat(t *testing.T) {
+	s := New()
+	resp, code := do(t, s, "/v1/format", Request{
+		Source:     "(ns a (:use [b]))\n\n(defn f\n  [x]\n      x)\n",
+		Transforms: map[string]bool{"use-to-require": true},
+	})
+	want := "(ns a (:require [b :refer :all]))\n\n(defn f\n  [x]\n  x)\n"
+	if code != http.StatusOK || resp.Output != want || resp.Formatted {
+		t.Errorf("got %d %+v; want output %q", code, resp, want)
+	}
+
+	resp, code = do(t, s, "/v1/check", Request{Source: want})
+	if code != http.StatusOK || !resp.Formatted || resp.Output != "" {
+		t.Errorf("check: got %d %+v", code, resp)
+	}
+}
+
+func TestFormatDialect(t *testing.T) {
+	// The shebang makes this a babashka script, whose task :requires
+	// are sorted.
+	resp, code := do(t, New(), "/v1/format", Request{
+		Source:     "#!/usr/bin/env bb\n{:tasks {:requires ([b] [a])}}\n",
+		Filename:   "tasks.clj",
+		Transforms: map[string]bool{"sort-import-require": true},
+	})
+	want := "#!/usr/bin/env bb\n{:tasks {:requires ([a]\n                    [b])}}\n"
+	if code != http.StatusOK || resp.Output != want {
+		t.Errorf("got %d %+v; want output %q", code, resp, want)
+	}
+}
+
+func TestLint(t *testing.T) {
+	resp, code := do(t, New(), "/v1/lint", Request{
+		Source: "(ns a)\n\n(def m {:a 1 :a 2})\n\n(defn f [x]\n      (= nil x))\n",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("got %d %+v", code, resp)
+	}
+	var got []string
+	for _, d := range resp.Diagnostics {
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Line, d.Col, d.Rule))
+	}
+	want := []string{"3:14 duplicate-key", "5:1 format", "6:7 nil-equality"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	resp, code = do(t, New(), "/v1/lint", Request{Source: "(ns a)\n"})
+	if code != http.StatusOK || len(resp.Diagnostics) > 0 {
+		t.Errorf("clean source: got %d %+v", code, resp)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := New()
+	s.MaxRequestBytes = 100
+	for _, tt := range []struct {
+		req  interface{}
+		code int
+	}{
+		{Request{Source: "(foo"}, http.StatusUnprocessableEntity},
+		{Request{Source: "x", Transforms: map[string]bool{"bogus": true}}, http.StatusBadRequest},
+		{"not a request", http.StatusBadRequest},
+		{Request{Source: strings.Repeat("x ", 100)}, http.StatusRequestEntityTooLarge},
+	} {
+		resp, code := do(t, s, "/v1/format", tt.req)
+		if code != tt.code || resp.Error == "" {
+			t.Errorf("for %+v: got %d %+v; want code %d and an error", tt.req, code, resp, tt.code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/v1/format", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /v1/format: got %d", w.Code)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	w := httptest.NewRecorder()
+	New().ServeHTTP(w, httptest.NewRequest("GET", "/v1/capabilities", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	var caps Capabilities
+	if err := json.NewDecoder(w.Body).Decode(&caps); err != nil {
+		t.Fatal(err)
+	}
+	if caps.Parse == nil || caps.Format == nil {
+		t.Fatalf("got %+v", caps)
+	}
+	if want := []string{"/v1/format", "/v1/check", "/v1/lint"}; !reflect.DeepEqual(caps.Endpoints, want) {
+		t.Errorf("endpoints: got %q; want %q", caps.Endpoints, want)
+	}
+	if len(caps.LintRules) < 2 || caps.LintRules[0] != "format" || caps.LintRules[1] != "nil-equality" {
+		t.Errorf("lint rules: got %q", caps.LintRules)
+	}
+	if !reflect.DeepEqual(caps.Parse, parse.Capabilities()) {
+		t.Errorf("parse: got %+v; want %+v", caps.Parse, parse.Capabilities())
+	}
+	if !reflect.DeepEqual(caps.Format, format.Capabilities()) {
+		t.Errorf("format: got %+v; want %+v", caps.Format, format.Capabilities())
+	}
+
+	w = httptest.NewRecorder()
+	New().ServeHTTP(w, httptest.NewRequest("POST", "/v1/capabilities", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got %d", w.Code)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	w := httptest.NewRecorder()
+	New().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
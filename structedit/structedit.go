@@ -0,0 +1,322 @@
+// Package structedit implements paredit-style structural editing: operations
+// such as slurp and barf which move the delimiters of forms rather than
+// individual characters. Each operation takes a tree and the source it was
+// parsed from (with parse.IncludeNonSemantic) along with a cursor, given as a
+// byte offset in the source, and returns the text edits which carry it out.
+package structedit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/cespare/goclj/parse"
+)
+
+// An Edit replaces the bytes [Start, End) of the source with Text. The edits
+// returned by an operation are in order and don't overlap; their offsets all
+// refer to the source before any of them are applied.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Apply returns the result of applying edits to src.
+func Apply(src []byte, edits []Edit) []byte {
+	edits = append([]Edit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	var b []byte
+	off := 0
+	for _, e := range edits {
+		b = append(b, src[off:e.Start]...)
+		b = append(b, e.Text...)
+		off = e.End
+	}
+	return append(b, src[off:]...)
+}
+
+// SlurpForward moves the closing delimiter of the innermost form around the
+// cursor past the form which follows it: (a |b) c becomes (a |b c). If the
+// innermost form has nothing after it, the next enclosing form which does is
+// used instead.
+func SlurpForward(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	for i := len(c.colls) - 1; i >= 0; i-- {
+		elems, j := c.siblings(c.colls[i])
+		if j+1 == len(elems) {
+			continue
+		}
+		close := parse.End(c.path[c.colls[i]], src) - 1
+		end := elems[j+1].end
+		return []Edit{
+			{close, close + 1, ""},
+			{end, end, string(src[close])},
+		}, nil
+	}
+	return nil, fmt.Errorf("nothing to slurp")
+}
+
+// SlurpBackward moves the opening delimiter of the innermost form around the
+// cursor before the form which precedes it: a (b| c) becomes (a b| c). If the
+// innermost form has nothing before it, the next enclosing form which does is
+// used instead.
+func SlurpBackward(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	for i := len(c.colls) - 1; i >= 0; i-- {
+		elems, j := c.siblings(c.colls[i])
+		if j == 0 {
+			continue
+		}
+		// The opening delimiter is moved along with anything before it
+		// (such as the quote in '(b c)).
+		start := elems[j].start
+		open := c.openEnd(c.colls[i])
+		pos := elems[j-1].start
+		return []Edit{
+			{pos, pos, string(src[start:open])},
+			{start, open, ""},
+		}, nil
+	}
+	return nil, fmt.Errorf("nothing to slurp")
+}
+
+// BarfForward moves the closing delimiter of the innermost form around the
+// cursor before its last element: (a |b c) becomes (a |b) c.
+func BarfForward(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	if len(c.colls) == 0 {
+		return nil, fmt.Errorf("no enclosing form")
+	}
+	i := c.colls[len(c.colls)-1]
+	elems := elements(c.path[i].Children(), src)
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("nothing to barf")
+	}
+	close := parse.End(c.path[i], src) - 1
+	pos := c.openEnd(i)
+	if len(elems) > 1 {
+		pos = elems[len(elems)-2].end
+	}
+	return []Edit{
+		{pos, pos, string(src[close])},
+		{close, close + 1, ""},
+	}, nil
+}
+
+// BarfBackward moves the opening delimiter of the innermost form around the
+// cursor after its first element: (a b| c) becomes a (b| c).
+func BarfBackward(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	if len(c.colls) == 0 {
+		return nil, fmt.Errorf("no enclosing form")
+	}
+	i := c.colls[len(c.colls)-1]
+	elems := elements(c.path[i].Children(), src)
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("nothing to barf")
+	}
+	siblings, j := c.siblings(i)
+	start := siblings[j].start
+	open := c.openEnd(i)
+	pos := parse.End(c.path[i], src) - 1
+	if len(elems) > 1 {
+		pos = elems[1].start
+	}
+	return []Edit{
+		{start, open, ""},
+		{pos, pos, string(src[start:open])},
+	}, nil
+}
+
+// Splice removes the delimiters of the innermost form around the cursor,
+// leaving its elements in the enclosing form: (a (b| c) d) becomes
+// (a b| c d).
+func Splice(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	if len(c.colls) == 0 {
+		return nil, fmt.Errorf("no enclosing form")
+	}
+	i := c.colls[len(c.colls)-1]
+	start := c.path[i].Position().Offset
+	close := parse.End(c.path[i], src) - 1
+	return []Edit{
+		{start, c.openEnd(i), ""},
+		{close, close + 1, ""},
+	}, nil
+}
+
+// Raise replaces the innermost form around the cursor with the element at
+// the cursor: (a (b |c) d) becomes (a |c d).
+func Raise(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+	c := newCursor(t, src, off)
+	n := c.at()
+	if n < 0 {
+		return nil, fmt.Errorf("no form at cursor")
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no enclosing form")
+	}
+	parent := c.path[n-1]
+	start, end := c.path[n].Position().Offset, parse.End(c.path[n], src)
+	return []Edit{{
+		parent.Position().Offset,
+		parse.End(parent, src),
+		string(src[start:end]),
+	}}, nil
+}
+
+// closers are the closing delimiters of the opening delimiters.
+var closers = map[string]string{
+	"(":  ")",
+	"[":  "]",
+	"{":  "}",
+	"#{": "}",
+	"#(": ")",
+}
+
+// Wrap surrounds the element at the cursor with a new form which is opened
+// by open (one of ( [ { #{ #() and closed by the matching delimiter: a |b c
+// becomes a (|b) c.
+func Wrap(t *parse.Tree, src []byte, off int, open string) ([]Edit, error) {
+	close, ok := closers[open]
+	if !ok {
+		return nil, fmt.Errorf("unknown delimiter %q", open)
+	}
+	c := newCursor(t, src, off)
+	n := c.at()
+	if n < 0 {
+		return nil, fmt.Errorf("no form at cursor")
+	}
+	start, end := c.path[n].Position().Offset, parse.End(c.path[n], src)
+	return []Edit{
+		{start, start, open},
+		{end, end, close},
+	}, nil
+}
+
+// A cursor is a position in a tree.
+type cursor struct {
+	t   *parse.Tree
+	src []byte
+	// path holds the semantic nodes which contain the cursor, starting
+	// with a top-level form.
+	path []parse.Node
+	// colls holds the indexes in path of the collections (such as lists)
+	// whose delimiters are around the cursor.
+	colls []int
+}
+
+func newCursor(t *parse.Tree, src []byte, off int) *cursor {
+	c := &cursor{t: t, src: src}
+	nodes := t.Roots
+outer:
+	for {
+		for _, n := range nodes {
+			if parse.KindOf(n).Is(parse.CategoryNonSemantic) {
+				continue
+			}
+			if n.Position().Offset <= off && off < parse.End(n, src) {
+				c.path = append(c.path, n)
+				if isCollection(n) && off >= c.openEnd(len(c.path)-1) {
+					c.colls = append(c.colls, len(c.path)-1)
+				}
+				nodes = n.Children()
+				continue outer
+			}
+		}
+		return c
+	}
+}
+
+// openEnd returns the offset just past the opening delimiter of the
+// collection path[i].
+func (c *cursor) openEnd(i int) int {
+	off := c.path[i].Position().Offset
+	for off < len(c.src) && c.src[off] != '(' && c.src[off] != '[' && c.src[off] != '{' {
+		off++
+	}
+	return off + 1
+}
+
+// siblings returns the elements of the collection (or the top level) in
+// which path[i] appears, along with the index of the element containing
+// path[i]. That element may include reader macros wrapping path[i] (as in
+// '(a b) or @(f)) and metadata before it.
+func (c *cursor) siblings(i int) ([]element, int) {
+	for i > 0 && !isCollection(c.path[i-1]) {
+		i--
+	}
+	nodes := c.t.Roots
+	if i > 0 {
+		nodes = c.path[i-1].Children()
+	}
+	elems := elements(nodes, c.src)
+	for j, e := range elems {
+		if nodes[e.last] == c.path[i] {
+			return elems, j
+		}
+	}
+	panic("structedit: node not found among its parent's elements")
+}
+
+// at returns the index in path of the element (of a collection, or at the
+// top level) at the cursor, or -1 if the cursor isn't on one.
+func (c *cursor) at() int {
+	n := len(c.path) - 1
+	if len(c.colls) > 0 && c.colls[len(c.colls)-1] == n {
+		// The cursor is inside a collection, between its elements.
+		return -1
+	}
+	for n > 0 && !isCollection(c.path[n-1]) {
+		n--
+	}
+	switch c.path[n].(type) {
+	case *parse.MetadataNode, *parse.TagNode:
+		// These belong to the next element.
+		return -1
+	}
+	return n
+}
+
+func isCollection(n parse.Node) bool {
+	return parse.KindOf(n).Is(parse.CategoryCollection)
+}
+
+// An element is a form among the children of a collection, including the
+// metadata and tags (such as ^:private or #inst) before it.
+type element struct {
+	start, end int
+	last       int // the index of the form
+}
+
+// elements returns the elements of nodes, ignoring comments and discarded
+// forms.
+func elements(nodes []parse.Node, src []byte) []element {
+	var elems []element
+	start := -1
+	for i, n := range nodes {
+		switch n.(type) {
+		case *parse.CommentNode, *parse.NewlineNode, *parse.ReaderDiscardNode:
+			continue
+		case *parse.MetadataNode:
+			if start < 0 {
+				start = n.Position().Offset
+			}
+			continue
+		case *parse.TagNode:
+			if start < 0 {
+				// The position of a tag is that of its name,
+				// after the #.
+				start = bytes.LastIndexByte(src[:n.Position().Offset], '#')
+			}
+			continue
+		}
+		if start < 0 {
+			start = n.Position().Offset
+		}
+		elems = append(elems, element{start, parse.End(n, src), i})
+		start = -1
+	}
+	return elems
+}
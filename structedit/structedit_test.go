@@ -0,0 +1,72 @@
+package structedit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cespare/goclj/parse"
+)
+
+func TestOperations(t *testing.T) {
+	type op func(t *parse.Tree, src []byte, off int) ([]Edit, error)
+	wrap := func(open string) op {
+		return func(t *parse.Tree, src []byte, off int) ([]Edit, error) {
+			return Wrap(t, src, off, open)
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		op   op
+		// The cursor is at the |.
+		in   string
+		want string // empty for an error
+	}{
+		{"SlurpForward", SlurpForward, "(a |b) c", "(a b c)"},
+		{"SlurpForward", SlurpForward, "(f (a |b)) c", "(f (a b) c)"},
+		{"SlurpForward", SlurpForward, "(a |b) ^:m #{c} d", "(a b ^:m #{c}) d"},
+		{"SlurpForward", SlurpForward, "'(a |b) ; x\n  c", "'(a b ; x\n  c)"},
+		{"SlurpForward", SlurpForward, "(a |b)", ""},
+		{"SlurpBackward", SlurpBackward, "a (b| c)", "(a b c)"},
+		{"SlurpBackward", SlurpBackward, "a '#{b| c}", "'#{a b c}"},
+		{"SlurpBackward", SlurpBackward, "(f [|b]) ", "([f b]) "},
+		{"BarfForward", BarfForward, "(a |b c)", "(a b) c"},
+		{"BarfForward", BarfForward, "[a |#inst \"x\"]", "[a] #inst \"x\""},
+		{"BarfForward", BarfForward, "(|a)", "()a"},
+		{"BarfForward", BarfForward, "(|)", ""},
+		{"BarfForward", BarfForward, "a |b", ""},
+		{"BarfBackward", BarfBackward, "(a b| c)", "a (b c)"},
+		{"BarfBackward", BarfBackward, "#(a %| c)", "a #(% c)"},
+		{"Splice", Splice, "(a (b| c) d)", "(a b c d)"},
+		{"Splice", Splice, "(a #{b| c} d)", "(a b c d)"},
+		{"Raise", Raise, "(a (b |c) d)", "(a c d)"},
+		{"Raise", Raise, "(a (b |@c) d)", "(a @c d)"},
+		{"Raise", Raise, "(a (b |(c)) d)", "(a (c) d)"},
+		{"Raise", Raise, "(a (b| c) d)", ""},
+		{"Raise", Raise, "|a", ""},
+		{"Wrap(", wrap("("), "a |b c", "a (b) c"},
+		{"Wrap[", wrap("["), "(a |'b c)", "(a ['b] c)"},
+		{"Wrap#{", wrap("#{"), "(a |\"b\" c)", "(a #{\"b\"} c)"},
+		{"Wrap<", wrap("<"), "a |b c", ""},
+	} {
+		off := strings.Index(tt.in, "|")
+		src := []byte(tt.in[:off] + tt.in[off+1:])
+		tree, err := parse.Reader(strings.NewReader(string(src)), "temp", parse.IncludeNonSemantic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits, err := tt.op(tree, src, off)
+		if err != nil {
+			if tt.want != "" {
+				t.Errorf("%s(%q): %s", tt.name, tt.in, err)
+			}
+			continue
+		}
+		if tt.want == "" {
+			t.Errorf("%s(%q): got %q; want error", tt.name, tt.in, Apply(src, edits))
+			continue
+		}
+		if got := string(Apply(src, edits)); got != tt.want {
+			t.Errorf("%s(%q): got %q; want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}